@@ -10,6 +10,7 @@ require (
 	github.com/edwvee/exiffix v0.0.0-20240229113213-0dbb146775be
 	github.com/google/go-cmp v0.6.0
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.17.9
 	github.com/kovidgoyal/imaging v1.6.3
 	github.com/seancfoley/ipaddress-go v1.6.0
 	github.com/shirou/gopsutil/v3 v3.24.5
@@ -17,6 +18,7 @@ require (
 	golang.org/x/exp v0.0.0-20230801115018-d63ba01acd4b
 	golang.org/x/image v0.18.0
 	golang.org/x/sys v0.21.0
+	golang.org/x/text v0.16.0
 	howett.net/plist v1.0.1
 )
 
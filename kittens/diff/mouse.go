@@ -89,6 +89,9 @@ func (self *Handler) line_pos_from_pos(x int, pos ScrollPos) *line_pos {
 }
 
 func (self *Handler) start_mouse_selection(ev *loop.MouseEvent) {
+	if self.mouse_selection.IsActive() && !self.mouse_selection.IsActiveForPointer(ev.PointerID) {
+		return
+	}
 	available_cols := self.logical_lines.columns / 2
 	if ev.Cell.Y >= self.screen_size.num_lines || ev.Cell.X < self.logical_lines.margin_size || (ev.Cell.X >= available_cols && ev.Cell.X < available_cols+self.logical_lines.margin_size) {
 		return
@@ -116,7 +119,7 @@ var debugprintln = tty.DebugPrintln
 var _ = debugprintln
 
 func (self *Handler) update_mouse_selection(ev *loop.MouseEvent) {
-	if !self.mouse_selection.IsActive() {
+	if !self.mouse_selection.IsActiveForPointer(ev.PointerID) {
 		return
 	}
 	if self.mouse_selection.OutOfVerticalBounds(ev) {
@@ -193,7 +196,7 @@ func (self *Handler) text_for_current_mouse_selection() string {
 }
 
 func (self *Handler) finish_mouse_selection(ev *loop.MouseEvent) {
-	if !self.mouse_selection.IsActive() {
+	if !self.mouse_selection.IsActiveForPointer(ev.PointerID) {
 		return
 	}
 	self.update_mouse_selection(ev)
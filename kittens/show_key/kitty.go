@@ -69,6 +69,11 @@ func run_kitty_loop(_ *Options) (err error) {
 		lp.Printf("%s: %s\n\n", ctx.Green("Text"), text)
 		return nil
 	}
+	// text committed by an input method is delivered to OnText as typed text
+	lp.OnIMEEvent = func(ev loop.IMEEvent) error {
+		lp.Printf("%s: %s\n\n", ctx.Green("Text"), ev.Committed)
+		return nil
+	}
 
 	err = lp.Run()
 	if err != nil {
@@ -0,0 +1,78 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package markup
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"kitty/tools/tty"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+type MarkupKind int
+
+const (
+	HEADING MarkupKind = iota
+	CODE
+	ERROR
+	WARNING
+	LINK
+)
+
+func (self MarkupKind) String() string {
+	switch self {
+	case HEADING:
+		return "HEADING"
+	case CODE:
+		return "CODE"
+	case ERROR:
+		return "ERROR"
+	case WARNING:
+		return "WARNING"
+	case LINK:
+		return "LINK"
+	}
+	return fmt.Sprintf("MarkupKind(%d)", int(self))
+}
+
+var semantic_ctx = sync.OnceValue(func() *Context {
+	ans := New(true)
+	ans.Yellow = ans.fmt_ctx.SprintFunc("bold fg=bright-yellow")
+	return ans
+})
+
+// Wrap text in the escape codes used to indicate its meaning. There is no
+// terminal protocol for semantic annotations, so the meaning is conveyed with
+// the same formatting used for help output, with LINK text, which must be a
+// URL, turned into an OSC 8 hyperlink that terminals and screen readers can
+// recognize. Use StripMarkup() or SupportsMarkup() for output that is not a terminal.
+func Markup(kind MarkupKind, text string) string {
+	c := semantic_ctx()
+	switch kind {
+	case HEADING:
+		return c.Title(text)
+	case CODE:
+		return c.Code(text)
+	case ERROR:
+		return c.Err(text)
+	case WARNING:
+		return c.Yellow(text)
+	case LINK:
+		return c.Url(text, text)
+	}
+	return text
+}
+
+// Remove the escape codes added by Markup() leaving only the text
+func StripMarkup(text string) string {
+	return wcswidth.StripEscapeCodes(text)
+}
+
+// Return true if STDOUT is a terminal that can display the output of Markup()
+func SupportsMarkup() bool {
+	return tty.IsTerminal(os.Stdout.Fd()) && os.Getenv("TERM") != "dumb"
+}
@@ -0,0 +1,23 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package markup
+
+import (
+	"fmt"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestSemanticMarkup(t *testing.T) {
+	for _, kind := range []MarkupKind{HEADING, CODE, ERROR, WARNING, LINK} {
+		text := "https://example.com"
+		m := Markup(kind, text)
+		if m == text {
+			t.Fatalf("No markup added for %s", kind)
+		}
+		if s := StripMarkup(m); s != text {
+			t.Fatalf("Stripping markup for %s failed: %#v", kind, s)
+		}
+	}
+}
@@ -14,10 +14,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"io"
 	"slices"
 	"strconv"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/zeebo/xxh3"
 )
 
@@ -27,7 +29,8 @@ const DefaultBlockSize = 1024 * 6
 // Internal constant used in rolling checksum.
 const _M = 1 << 16
 
-// Operation Types.
+// Operation Types. OpCompressedData is the same as OpData except that the
+// data is zstd compressed, see WithLiteralCompression().
 type OpType byte // enum
 
 const (
@@ -35,6 +38,7 @@ const (
 	OpData
 	OpHash
 	OpBlockRange
+	OpCompressedData
 )
 
 type xxh3_128 struct {
@@ -83,7 +87,7 @@ func (self Operation) String() string {
 		ans += strconv.FormatUint(self.BlockIndex, 10)
 	case OpBlockRange:
 		ans += strconv.FormatUint(self.BlockIndex, 10) + " to " + strconv.FormatUint(self.BlockIndexEnd, 10)
-	case OpData:
+	case OpData, OpCompressedData:
 		ans += strconv.Itoa(len(self.Data))
 	case OpHash:
 		ans += hex.EncodeToString(self.Data)
@@ -101,7 +105,7 @@ func (self Operation) SerializeSize() int {
 		return 13
 	case OpHash:
 		return 3 + len(self.Data)
-	case OpData:
+	case OpData, OpCompressedData:
 		return 5 + len(self.Data)
 	}
 	return -1
@@ -117,7 +121,7 @@ func (self Operation) Serialize(ans []byte) {
 	case OpHash:
 		bin.PutUint16(ans[1:], uint16(len(self.Data)))
 		copy(ans[3:], self.Data)
-	case OpData:
+	case OpData, OpCompressedData:
 		bin.PutUint32(ans[1:], uint32(len(self.Data)))
 		copy(ans[5:], self.Data)
 	}
@@ -155,7 +159,7 @@ func (self *Operation) Unserialize(data []byte) (n int, err error) {
 			return -1, io.ErrShortBuffer
 		}
 		self.Data = data[3:n]
-	case OpData:
+	case OpData, OpCompressedData:
 		n = 5
 		if len(data) < n {
 			return -1, io.ErrShortBuffer
@@ -212,6 +216,45 @@ type rsync struct {
 	checksummer             hash.Hash
 	checksum_done           bool
 	buffer                  []byte
+	// append a CRC32 to every serialized operation
+	block_crc bool
+	stats     RsyncStats
+	// zstd compress literal data in deltas at the level, if enabled
+	compress_literals         bool
+	literal_compression_level int
+	literal_decoder           *zstd.Decoder
+	literal_buffer            []byte
+}
+
+// The maximum size of the data of a single OpData operation
+func (r *rsync) max_literal_size() int { return r.BlockSize * DataSizeMultiple }
+
+// The zstd window size for literal data, the smallest power of two zstd
+// allows that can hold max_literal_size()
+func (r *rsync) literal_window_size() int {
+	ans := zstd.MinWindowSize
+	for ans < r.max_literal_size() {
+		ans <<= 1
+	}
+	return ans
+}
+
+// Convert an OpCompressedData operation to OpData, the returned data is only
+// valid until the next call
+func (r *rsync) decompress_literal(op *Operation) (err error) {
+	if op.Type != OpCompressedData {
+		return nil
+	}
+	if r.literal_decoder == nil {
+		if r.literal_decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(r.literal_window_size()))); err != nil {
+			return err
+		}
+	}
+	if r.literal_buffer, err = r.literal_decoder.DecodeAll(op.Data, r.literal_buffer[:0]); err != nil {
+		return fmt.Errorf("Failed to decompress the data in the delta: %w", err)
+	}
+	op.Type, op.Data = OpData, r.literal_buffer
+	return nil
 }
 
 func (r *rsync) SetHasher(c func() hash.Hash64) {
@@ -241,6 +284,7 @@ type signature_iterator struct {
 	src    io.Reader
 	rc     rolling_checksum
 	index  uint64
+	stats  *RsyncStats
 }
 
 // ans is valid iff err == nil
@@ -259,6 +303,7 @@ func (self *signature_iterator) next() (ans BlockHash, err error) {
 	self.hasher.Reset()
 	self.hasher.Write(b)
 	ans = BlockHash{Index: self.index, WeakHash: self.rc.full(b), StrongHash: self.hasher.Sum64()}
+	self.stats.StrongHashComputations++
 	self.index++
 	return
 
@@ -267,7 +312,7 @@ func (self *signature_iterator) next() (ans BlockHash, err error) {
 // Calculate the signature of target.
 func (r *rsync) CreateSignatureIterator(target io.Reader) func() (BlockHash, error) {
 	return (&signature_iterator{
-		hasher: r.hasher_constructor(), buffer: make([]byte, r.BlockSize), src: target,
+		hasher: r.hasher_constructor(), buffer: make([]byte, r.BlockSize), src: target, stats: &r.stats,
 	}).next
 }
 
@@ -277,6 +322,9 @@ func (r *rsync) ApplyDelta(output io.Writer, target io.ReadSeeker, op Operation)
 	var n int
 	var block []byte
 
+	if err = r.decompress_literal(&op); err != nil {
+		return err
+	}
 	r.set_buffer_to_size(r.BlockSize)
 	buffer := r.buffer
 	if r.checksummer == nil {
@@ -373,15 +421,54 @@ type diff struct {
 	block_size        int
 	finished, written bool
 	rc                rolling_checksum
+	block_crc         bool
+	stats             *RsyncStats
+	// nil unless literal data is compressed
+	encoder         *zstd.Encoder
+	compressed_data []byte
+	// the offset in the source of the start of buffer
+	buffer_offset int64
+	// the number of bytes at the start of the source already covered by a
+	// previous delta, they are only checksummed
+	skip_source                               int64
+	checkpoint_interval, ops_since_checkpoint int
+	on_checkpoint                             func(source_offset int64) error
 
 	pending_op *Operation
 }
 
 func (self *diff) Next() (err error) {
-	return self.pump_till_op_written()
+	if self.skip_source > 0 {
+		n, err := io.CopyN(self.checksummer, self.source, self.skip_source)
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("The source is shorter than the checkpoint offset: %d < %d", n, self.skip_source)
+			}
+			return err
+		}
+		self.buffer_offset, self.skip_source = self.skip_source, 0
+	}
+	if err = self.pump_till_op_written(); err == nil && self.on_checkpoint != nil && self.ops_since_checkpoint >= self.checkpoint_interval {
+		err = self.checkpoint()
+	}
+	return
+}
+
+// Send all data before the current window so that the delta so far
+// reproduces the source up to the start of the window
+func (self *diff) checkpoint() (err error) {
+	if err = self.send_data(); err != nil {
+		return
+	}
+	if err = self.send_pending(); err != nil {
+		return
+	}
+	self.ops_since_checkpoint = 0
+	return self.on_checkpoint(self.buffer_offset + int64(self.window.pos))
 }
 
 func (self *diff) hash(b []byte) uint64 {
+	self.stats.StrongHashComputations++
 	self.hasher.Reset()
 	self.hasher.Write(b)
 	return self.hasher.Sum64()
@@ -437,7 +524,11 @@ func (self *diff) enqueue(op Operation) (err error) {
 func (self *diff) send_op(op *Operation) error {
 	b := self.op_write_buf[:op.SerializeSize()]
 	op.Serialize(b)
+	if self.block_crc {
+		b = bin.AppendUint32(b, crc32.ChecksumIEEE(b))
+	}
 	self.written = true
+	self.ops_since_checkpoint++
 	_, err := self.output.Write(b)
 	return err
 }
@@ -448,16 +539,30 @@ func (self *diff) send_data() error {
 			return err
 		}
 		self.written = true
+		self.ops_since_checkpoint++
 		data := self.buffer[self.data.pos : self.data.pos+self.data.sz]
 		var buf [5]byte
-		bin.PutUint32(buf[1:], uint32(len(data)))
 		buf[0] = byte(OpData)
+		if self.encoder != nil {
+			// only use the compressed data if it is smaller
+			if self.compressed_data = self.encoder.EncodeAll(data, self.compressed_data[:0]); len(self.compressed_data) < len(data) {
+				data = self.compressed_data
+				buf[0] = byte(OpCompressedData)
+			}
+		}
+		bin.PutUint32(buf[1:], uint32(len(data)))
 		if _, err := self.output.Write(buf[:]); err != nil {
 			return err
 		}
 		if _, err := self.output.Write(data); err != nil {
 			return err
 		}
+		if self.block_crc {
+			crc := crc32.Update(crc32.ChecksumIEEE(buf[:]), crc32.IEEETable, data)
+			if _, err := self.output.Write(bin.AppendUint32(buf[:0], crc)); err != nil {
+				return err
+			}
+		}
 		self.data.pos += self.data.sz
 		self.data.sz = 0
 	}
@@ -492,6 +597,7 @@ func (self *diff) ensure_idx_valid(idx int) (ok bool, err error) {
 		// copy the window and any data present after it to the start of the buffer
 		distance_from_window_pos := idx - self.window.pos
 		amt_to_copy := len(self.buffer) - self.window.pos
+		self.buffer_offset += int64(self.window.pos)
 		copy(self.buffer, self.buffer[self.window.pos:self.window.pos+amt_to_copy])
 		self.buffer = self.buffer[:amt_to_copy]
 		self.window.pos = 0
@@ -555,6 +661,10 @@ func (self *diff) read_next() (err error) {
 	var block_index uint64
 	if hh, ok := self.hash_lookup[self.rc.val]; ok {
 		block_index, found_hash = find_hash(hh, self.hash(self.buffer[self.window.pos:self.window.pos+self.window.sz]))
+		self.stats.WeakHashHits++
+		if !found_hash {
+			self.stats.WeakHashFalsePositives++
+		}
 	}
 	if found_hash {
 		if err = self.send_data(); err != nil {
@@ -571,16 +681,18 @@ func (self *diff) read_next() (err error) {
 type OperationWriter struct {
 	Operations     []Operation
 	expecting_data bool
+	data_type      OpType
 }
 
 func (self *OperationWriter) Write(p []byte) (n int, err error) {
 	if self.expecting_data {
 		self.expecting_data = false
-		self.Operations = append(self.Operations, Operation{Type: OpData, Data: slices.Clone(p)})
+		self.Operations = append(self.Operations, Operation{Type: self.data_type, Data: slices.Clone(p)})
 	} else {
 		switch OpType(p[0]) {
-		case OpData:
+		case OpData, OpCompressedData:
 			self.expecting_data = true
+			self.data_type = OpType(p[0])
 		case OpBlock, OpBlockRange, OpHash:
 			op := Operation{}
 			if n, err = op.Unserialize(p); err != nil {
@@ -598,7 +710,7 @@ func (self *OperationWriter) Write(p []byte) (n int, err error) {
 
 func (r *rsync) CreateDelta(source io.Reader, signature []BlockHash) ([]Operation, error) {
 	w := OperationWriter{}
-	it := r.CreateDiff(source, signature, &w)
+	it := r.create_diff(source, signature, &w, false)
 	for {
 		if err := it(); err != nil {
 			if err == io.EOF {
@@ -612,18 +724,53 @@ func (r *rsync) CreateDelta(source io.Reader, signature []BlockHash) ([]Operatio
 const DataSizeMultiple int = 8
 
 func (r *rsync) CreateDiff(source io.Reader, signature []BlockHash, output io.Writer) func() error {
+	return r.create_diff(source, signature, output, r.block_crc)
+}
+
+// Like CreateDiff() except that the first source_offset bytes of source are
+// assumed to be covered by a previous delta and every checkpoint_interval
+// operations on_checkpoint is called, see Differ.ResumeCreateDelta()
+func (r *rsync) CreateResumableDiff(source io.Reader, signature []BlockHash, output io.Writer, source_offset int64, checkpoint_interval int, on_checkpoint func(int64) error) func() error {
+	ans, err := r.new_diff(source, signature, output, r.block_crc)
+	if err != nil {
+		return func() error { return err }
+	}
+	ans.skip_source, ans.checkpoint_interval, ans.on_checkpoint = source_offset, checkpoint_interval, on_checkpoint
+	return ans.Next
+}
+
+func (r *rsync) create_diff(source io.Reader, signature []BlockHash, output io.Writer, block_crc bool) func() error {
+	ans, err := r.new_diff(source, signature, output, block_crc)
+	if err != nil {
+		return func() error { return err }
+	}
+	return ans.Next
+}
+
+func (r *rsync) new_diff(source io.Reader, signature []BlockHash, output io.Writer, block_crc bool) (*diff, error) {
 	ans := &diff{
 		block_size: r.BlockSize, buffer: make([]byte, 0, (r.BlockSize * DataSizeMultiple)),
 		hash_lookup: make(map[uint32][]BlockHash, len(signature)),
 		source:      source, hasher: r.hasher_constructor(),
-		checksummer: r.checksummer_constructor(), output: output,
+		checksummer: r.checksummer_constructor(), output: output, block_crc: block_crc,
+		stats: &r.stats,
+	}
+	if r.compress_literals {
+		var err error
+		level := zstd.SpeedDefault
+		if r.literal_compression_level != 0 {
+			level = zstd.EncoderLevelFromZstd(r.literal_compression_level)
+		}
+		if ans.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(r.literal_window_size())); err != nil {
+			return nil, err
+		}
 	}
 	for _, h := range signature {
 		key := h.WeakHash
 		ans.hash_lookup[key] = append(ans.hash_lookup[key], h)
 	}
 
-	return ans.Next
+	return ans, nil
 }
 
 // Use a more unique way to identify a set of bytes.
@@ -1,25 +1,20 @@
 // License: GPLv3 Copyright: 2023, Kovid Goyal, <kovid at kovidgoyal.net>
 
-// First create a patcher with:
-// p = NewPatcher()
-// Create a signature for the file you want to update using
-// p.CreateSignatureIterator(file_to_update)
-// Now create a Differ with the created signature
-// d = NewDiffer()
-// d.AddSignatureData(signature_data_from_previous_step)
-// Now create a delta based on the signature and the reference file
-// d.CreateDelta(reference_file)
-// Finally, apply this delta using the patcher to produce a file identical to reference_file
-// based ont he delta data and file_to_update
-// p.StartDelta(output_file, file_to_update)
-// p.UpdateDelta(...)
-// p.FinishDelta()
 package rsync
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"math"
+	"slices"
+	"unsafe"
 
 	"kitty/tools/utils"
 )
@@ -45,12 +40,155 @@ const (
 type GrowBufferFunction = func(slice []byte, sz int) []byte
 
 type Api struct {
-	rsync     rsync
-	signature []BlockHash
+	rsync                   rsync
+	signature               []BlockHash
+	signature_memory_budget int64
+	signature_checksummer   hash.Hash
+	signature_hmac_key      []byte
+	signature_hmac_nonce    []byte
+	signature_hmac          hash.Hash
 
 	Checksum_type    ChecksumType
 	Strong_hash_type StrongHashType
 	Weak_hash_type   WeakHashType
+
+	// The version of the signature format, version 1 adds flags and a
+	// section for extensions to the header
+	Signature_version    uint16
+	Signature_flags      uint32
+	Signature_extensions []byte
+}
+
+const MaxSignatureVersion = 1
+const MaxSignatureExtensionsSize = 64 * 1024
+
+var ErrUnsupportedSignatureVersion = errors.New("Unsupported rsync signature version")
+
+// Create signatures with the specified version of the signature format
+func WithSignatureVersion(version uint16) ApiOption {
+	return func(self *Api) { self.Signature_version = version }
+}
+
+// Set in Signature_flags when an XXH3-128 checksum of the serialized block
+// hashes follows the last block in the signature. The low bits of
+// Signature_flags are free for use by applications.
+const SignatureIntegrityFlag uint32 = 1 << 31
+
+var ErrSignatureCorrupted = errors.New("The checksum of the rsync signature does not match its contents")
+
+// Append a checksum of the block hashes to created signatures, which the
+// Differ verifies in FinishSignatureData(), failing with ErrSignatureCorrupted
+// on a mismatch. Requires version 1 of the signature format, which is used if
+// no version was specified. Adds 16 bytes to the signature.
+func WithSignatureIntegrity(enabled bool) ApiOption {
+	return func(self *Api) {
+		if enabled {
+			self.Signature_flags |= SignatureIntegrityFlag
+			self.Signature_version = max(1, self.Signature_version)
+		} else {
+			self.Signature_flags &^= SignatureIntegrityFlag
+		}
+	}
+}
+
+// Set in Signature_flags when the signature header ends with a random 16 byte
+// nonce and every block hash in the signature is followed by a truncated HMAC
+// of it, see WithSignatureHMAC()
+const SignatureHMACFlag uint32 = 1 << 30
+
+const signature_hmac_size = 16
+const signature_hmac_nonce_size = 16
+
+var ErrSignatureTampered = errors.New("The HMAC of a block in the rsync signature does not match, the signature has been tampered with")
+
+// Follow every block hash in created signatures with the first 16 bytes of
+// its HMAC-SHA256, computed over the serialized index, weak hash and strong
+// hash of the block with a key derived from key and the signature header. The
+// header of every signature ends with a random nonce, so that blocks cannot be
+// moved from one signature to another created with the same key. Adds 16
+// bytes to the header. The Differ must be created with the same key, it
+// verifies every block in AddSignatureData(), failing with
+// ErrSignatureTampered on a mismatch or if the signature has no HMACs. This
+// authenticates signatures passed through untrusted relays. Requires version
+// 1 of the signature format, which is used if no version was specified. An
+// empty key disables the HMACs.
+func WithSignatureHMAC(key []byte) ApiOption {
+	return func(self *Api) {
+		if len(key) > 0 {
+			self.signature_hmac_key = slices.Clone(key)
+			self.Signature_flags |= SignatureHMACFlag
+			self.Signature_version = max(1, self.Signature_version)
+		} else {
+			self.signature_hmac_key = nil
+			self.Signature_flags &^= SignatureHMACFlag
+		}
+	}
+}
+
+var ErrSignatureTooLarge = errors.New("The signature is too large for the memory budget")
+
+const block_hash_memory_size = int64(unsafe.Sizeof(BlockHash{}))
+
+type ApiOption func(*Api)
+
+// An operation in a delta whose CRC does not match its contents, see WithBlockCRC()
+type ErrCorruptOperation struct {
+	// The index of the operation in the delta
+	OpIndex int
+}
+
+func (self ErrCorruptOperation) Error() string {
+	return fmt.Sprintf("The CRC of operation %d in the delta does not match its contents", self.OpIndex)
+}
+
+// Append a CRC32 to every operation in a delta created by the Differ, which the
+// Patcher verifies, failing with ErrCorruptOperation on a mismatch. Adds four
+// bytes per operation. Must be used for both the Differ and the Patcher.
+func WithBlockCRC(enabled bool) ApiOption {
+	return func(self *Api) { self.rsync.block_crc = enabled }
+}
+
+// Compress the literal data in deltas created by the Differ with zstd at the
+// specified zstd compression level, zero meaning the default level. Data that
+// does not shrink is sent uncompressed. Compressed data is sent in
+// OpCompressedData operations, which the Patcher decompresses transparently,
+// so only the Differ needs this option.
+func WithLiteralCompression(enabled bool, level int) ApiOption {
+	return func(self *Api) {
+		self.rsync.compress_literals, self.rsync.literal_compression_level = enabled, level
+	}
+}
+
+// Limit the memory used by the signature loaded with
+// Differ.AddSignatureData() to max_bytes, zero or less means no limit
+func WithMemoryBudget(max_bytes int64) ApiOption {
+	return func(self *Api) { self.signature_memory_budget = max_bytes }
+}
+
+// The memory currently allocated for the signature, in bytes
+func (self *Api) SignatureMemoryUsage() int64 {
+	return int64(cap(self.signature)) * block_hash_memory_size
+}
+
+// Statistics about the hashing of blocks, accumulated over all signatures and
+// deltas created with an Api
+type RsyncStats struct {
+	// The number of times the weak hash of a window matched a signature block
+	WeakHashHits int64
+	// The number of weak hash hits for which the strong hash did not match
+	WeakHashFalsePositives int64
+	// The number of strong hashes computed, one for every block of a
+	// signature and one for every weak hash hit when creating a delta
+	StrongHashComputations int64
+}
+
+func (self RsyncStats) String() string {
+	return fmt.Sprintf("RsyncStats{WeakHashHits: %d, WeakHashFalsePositives: %d, StrongHashComputations: %d}", self.WeakHashHits, self.WeakHashFalsePositives, self.StrongHashComputations)
+}
+
+// Statistics about signatures and deltas created so far
+func (self *Api) Stats() RsyncStats {
+	return self.rsync.stats
 }
 
 type Differ struct {
@@ -65,15 +203,139 @@ type Patcher struct {
 	delta_output                                 io.Writer
 	delta_input                                  io.ReadSeeker
 	total_data_in_delta                          int
+	op_index                                     int
 }
 
 // internal implementation {{{
+// Serialize the signature header, nonce is the last field of the header of
+// signatures with HMACs and must be signature_hmac_nonce_size bytes for them
+func (self *Api) append_signature_header(b []byte, nonce []byte) []byte {
+	b = bin.AppendUint16(b, self.Signature_version)
+	b = bin.AppendUint16(b, uint16(self.Checksum_type))
+	b = bin.AppendUint16(b, uint16(self.Strong_hash_type))
+	b = bin.AppendUint16(b, uint16(self.Weak_hash_type))
+	b = bin.AppendUint32(b, uint32(self.rsync.BlockSize))
+	if self.Signature_version > 0 {
+		b = bin.AppendUint32(b, self.Signature_flags)
+		b = bin.AppendUint32(b, uint32(len(self.Signature_extensions)))
+		b = append(b, self.Signature_extensions...)
+	}
+	if self.has_signature_hmac() {
+		b = append(b, nonce...)
+	}
+	return b
+}
+
+// Serialize the header for a new signature, with a fresh nonce if the
+// signature has HMACs, returning the HMAC for its block hashes
+func (self *Api) append_new_signature_header(b []byte) ([]byte, hash.Hash, error) {
+	var nonce []byte
+	if self.has_signature_hmac() {
+		nonce = make([]byte, signature_hmac_nonce_size)
+		if _, err := rand.Read(nonce); err != nil {
+			return b, nil, err
+		}
+	}
+	start := len(b)
+	b = self.append_signature_header(b, nonce)
+	return b, self.new_signature_hmac(b[start:]), nil
+}
+
+func (self *Api) check_signature_version() error {
+	if self.Signature_version > MaxSignatureVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSignatureVersion, self.Signature_version)
+	}
+	return nil
+}
+
+func (self *Api) has_signature_integrity() bool {
+	return self.Signature_version > 0 && self.Signature_flags&SignatureIntegrityFlag != 0
+}
+
+// A checksummer for the serialized block hashes of a signature, nil if the
+// signature has no checksum
+func (self *Api) new_signature_checksummer() hash.Hash {
+	if self.has_signature_integrity() {
+		return new_xxh3_128()
+	}
+	return nil
+}
+
+func (self *Api) has_signature_hmac() bool {
+	return self.Signature_version > 0 && self.Signature_flags&SignatureHMACFlag != 0
+}
+
+// An HMAC for the block hashes of the signature with the serialized header,
+// nil if the signature has no HMACs. Its key is the HMAC of the header, so
+// every block is bound to the signature it is in.
+func (self *Api) new_signature_hmac(header []byte) hash.Hash {
+	if !self.has_signature_hmac() {
+		return nil
+	}
+	h := hmac.New(sha256.New, self.signature_hmac_key)
+	h.Write(header)
+	return hmac.New(sha256.New, h.Sum(nil))
+}
+
+// The size of a serialized block hash in the signature, including its HMAC
+func (self *Api) signature_record_size(mac hash.Hash) int {
+	if mac != nil {
+		return BlockHashSize + signature_hmac_size
+	}
+	return BlockHashSize
+}
+
+// Serialize bl into output, which must be signature_record_size() bytes,
+// followed by its HMAC if mac is not nil
+func serialize_signature_record(bl BlockHash, output []byte, mac hash.Hash) {
+	bl.Serialize(output)
+	if mac != nil {
+		var sum [sha256.Size]byte
+		mac.Reset()
+		mac.Write(output[:BlockHashSize])
+		copy(output[BlockHashSize:], mac.Sum(sum[:0])[:signature_hmac_size])
+	}
+}
+
 func (self *Api) read_signature_header(data []byte) (consumed int, err error) {
 	if len(data) < 12 {
 		return -1, io.ErrShortBuffer
 	}
-	if version := bin.Uint16(data); version != 0 {
-		return consumed, fmt.Errorf("Invalid version in signature header: %d", version)
+	version := bin.Uint16(data)
+	if version > MaxSignatureVersion {
+		return consumed, fmt.Errorf("%w: %d", ErrUnsupportedSignatureVersion, version)
+	}
+	header_size := 12
+	self.Signature_flags, self.Signature_extensions = 0, nil
+	if version > 0 {
+		if len(data) < 20 {
+			return -1, io.ErrShortBuffer
+		}
+		ext_size := int(bin.Uint32(data[16:]))
+		if ext_size > MaxSignatureExtensionsSize {
+			return consumed, fmt.Errorf("rsync signature header has too large extensions %d > %d", ext_size, MaxSignatureExtensionsSize)
+		}
+		header_size = 20 + ext_size
+		if len(data) < header_size {
+			return -1, io.ErrShortBuffer
+		}
+		self.Signature_flags = bin.Uint32(data[12:])
+		self.Signature_extensions = slices.Clone(data[20:header_size])
+	}
+	self.Signature_version = version
+	self.signature_hmac_nonce = nil
+	if self.has_signature_hmac() {
+		if self.signature_hmac_key == nil {
+			return consumed, fmt.Errorf("The rsync signature is authenticated with an HMAC but no key was provided")
+		}
+		if len(data) < header_size+signature_hmac_nonce_size {
+			return -1, io.ErrShortBuffer
+		}
+		self.signature_hmac_nonce = slices.Clone(data[header_size : header_size+signature_hmac_nonce_size])
+		header_size += signature_hmac_nonce_size
+	} else if self.signature_hmac_key != nil {
+		// an attacker could have stripped the HMACs
+		return consumed, ErrSignatureTampered
 	}
 	switch csum := ChecksumType(bin.Uint16(data[2:])); csum {
 	case XXH3128Sum:
@@ -96,7 +358,7 @@ func (self *Api) read_signature_header(data []byte) (consumed int, err error) {
 		return consumed, fmt.Errorf("Invalid weak_hash in signature header: %d", weak_hash)
 	}
 	block_size := int(bin.Uint32(data[8:]))
-	consumed = 12
+	consumed = header_size
 	if block_size == 0 {
 		return consumed, fmt.Errorf("rsync signature header has zero block size")
 	}
@@ -104,22 +366,66 @@ func (self *Api) read_signature_header(data []byte) (consumed int, err error) {
 		return consumed, fmt.Errorf("rsync signature header has too large block size %d > %d", block_size, MaxBlockSize)
 	}
 	self.rsync.BlockSize = block_size
-	self.signature = make([]BlockHash, 0, 1024)
+	self.signature = make([]BlockHash, 0, self.max_signature_capacity(1024))
+	self.signature_checksummer = self.new_signature_checksummer()
+	self.signature_hmac = self.new_signature_hmac(data[:header_size])
 	return
 }
 
-func (self *Api) read_signature_blocks(data []byte) (consumed int) {
+// The capacity for the signature, limited by the memory budget
+func (self *Api) max_signature_capacity(wanted int) int {
+	if self.signature_memory_budget > 0 {
+		if limit := self.signature_memory_budget / block_hash_memory_size; int64(wanted) > limit {
+			wanted = int(limit)
+		}
+	}
+	return wanted
+}
+
+func (self *Api) read_signature_blocks(data []byte) (consumed int, err error) {
 	block_hash_size := self.rsync.HashSize() + 12
-	for ; len(data) >= block_hash_size; data = data[block_hash_size:] {
+	record_size := block_hash_size
+	if self.signature_hmac != nil {
+		record_size += signature_hmac_size
+	}
+	var sum [sha256.Size]byte
+	for ; len(data) >= record_size; data = data[record_size:] {
+		if mac := self.signature_hmac; mac != nil {
+			mac.Reset()
+			mac.Write(data[:block_hash_size])
+			if !hmac.Equal(mac.Sum(sum[:0])[:signature_hmac_size], data[block_hash_size:record_size]) {
+				return consumed, ErrSignatureTampered
+			}
+		}
 		bl := BlockHash{}
 		bl.Unserialize(data[:block_hash_size])
+		bl.Index &^= UnchangedBlockFlag
+		if len(self.signature) == cap(self.signature) && self.signature_memory_budget > 0 {
+			// grow within the budget rather than letting append() overshoot it
+			c := self.max_signature_capacity(max(1024, 2*cap(self.signature)))
+			if c <= len(self.signature) {
+				return consumed, ErrSignatureTooLarge
+			}
+			self.signature = append(make([]BlockHash, 0, c), self.signature...)
+		}
 		self.signature = append(self.signature, bl)
-		consumed += block_hash_size
+		if self.signature_checksummer != nil {
+			self.signature_checksummer.Write(data[:record_size])
+		}
+		consumed += record_size
 	}
 	return
 }
 
 func (self *Differ) FinishSignatureData() (err error) {
+	if self.signature_checksummer != nil {
+		// the checksum is shorter than a block hash so it is never consumed
+		// as one
+		if !bytes.Equal(self.signature_checksummer.Sum(nil), self.unconsumed_signature_data) {
+			return ErrSignatureCorrupted
+		}
+		self.unconsumed_signature_data, self.signature_checksummer = nil, nil
+	}
 	if len(self.unconsumed_signature_data) > 0 {
 		return fmt.Errorf("There were %d leftover bytes in the signature data", len(self.unconsumed_signature_data))
 	}
@@ -130,13 +436,33 @@ func (self *Differ) FinishSignatureData() (err error) {
 	return
 }
 
+// Unserialize the operation at the start of data, verifying its CRC, if
+// any. Like Operation.Unserialize() returns n < 0 if data is incomplete.
+func (self *Api) unserialize_op(op *Operation, data []byte, op_index int) (n int, err error) {
+	n, err = op.Unserialize(data)
+	if err == nil && self.rsync.block_crc {
+		if len(data) < n+4 {
+			return -1, io.ErrShortBuffer
+		}
+		if crc32.ChecksumIEEE(data[:n]) != bin.Uint32(data[n:]) {
+			return 0, ErrCorruptOperation{op_index}
+		}
+		n += 4
+	}
+	return
+}
+
 func (self *Patcher) update_delta(data []byte) (consumed int, err error) {
 	op := Operation{}
 	for len(data) > 0 {
-		n, uerr := op.Unserialize(data)
+		n, uerr := self.unserialize_op(&op, data, self.op_index)
 		if uerr == nil {
+			self.op_index++
 			consumed += n
 			data = data[n:]
+			if err = self.rsync.decompress_literal(&op); err != nil {
+				return
+			}
 			if err = self.rsync.ApplyDelta(self.delta_output, self.delta_input, op); err != nil {
 				return
 			}
@@ -160,7 +486,11 @@ func (self *Patcher) StartDelta(delta_output io.Writer, delta_input io.ReadSeeke
 	self.delta_output = delta_output
 	self.delta_input = delta_input
 	self.total_data_in_delta = 0
+	self.op_index = 0
 	self.unconsumed_delta_data = nil
+	// allow the same Patcher to apply more than one delta
+	self.rsync.checksummer = nil
+	self.rsync.checksum_done = false
 }
 
 // Apply a chunk of delta data
@@ -191,23 +521,72 @@ func (self *Patcher) FinishDelta() (err error) {
 	return
 }
 
+// Apply a complete serialized delta to original, returning the result
+func (self *Patcher) ApplyDeltaToBytes(delta, original []byte) ([]byte, error) {
+	output := bytes.Buffer{}
+	output.Grow(len(original))
+	self.StartDelta(&output, bytes.NewReader(original))
+	if err := self.UpdateDelta(delta); err != nil {
+		return nil, err
+	}
+	if err := self.FinishDelta(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// Create the serialized delta that transforms original into current, using a
+// signature of original created by this Patcher, so that the delta can be
+// applied with ApplyDeltaToBytes()
+func (self *Patcher) CreateDeltaFromBytes(original, current []byte) ([]byte, error) {
+	sig := bytes.Buffer{}
+	it := self.CreateSignatureIterator(bytes.NewReader(original), &sig)
+	for {
+		if err := it(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	d := NewDiffer(WithBlockCRC(self.rsync.block_crc))
+	if err := d.AddSignatureData(sig.Bytes()); err != nil {
+		return nil, err
+	}
+	delta := bytes.Buffer{}
+	it = d.CreateDelta(bytes.NewReader(current), &delta)
+	for {
+		if err := it(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return delta.Bytes(), nil
+}
+
 // Create a signature for the data source in src.
 func (self *Patcher) CreateSignatureIterator(src io.Reader, output io.Writer) func() error {
 	var it func() (BlockHash, error)
 	finished := false
-	var b [BlockHashSize]byte
+	var b [BlockHashSize + signature_hmac_size]byte
+	var record []byte
+	var mac hash.Hash
+	checksummer := self.new_signature_checksummer()
 	return func() error {
 		if finished {
 			return io.EOF
 		}
 		if it == nil { // write signature header
+			if err := self.check_signature_version(); err != nil {
+				return err
+			}
+			header, m, err := self.append_new_signature_header(nil)
+			if err != nil {
+				return err
+			}
+			mac, record = m, b[:self.signature_record_size(m)]
 			it = self.rsync.CreateSignatureIterator(src)
-			bin.PutUint16(b[:], 0)
-			bin.PutUint16(b[2:], uint16(self.Checksum_type))
-			bin.PutUint16(b[4:], uint16(self.Strong_hash_type))
-			bin.PutUint16(b[6:], uint16(self.Weak_hash_type))
-			bin.PutUint32(b[8:], uint32(self.rsync.BlockSize))
-			if _, err := output.Write(b[:12]); err != nil {
+			if _, err := output.Write(header); err != nil {
 				return err
 			}
 		}
@@ -215,10 +594,18 @@ func (self *Patcher) CreateSignatureIterator(src io.Reader, output io.Writer) fu
 		switch err {
 		case io.EOF:
 			finished = true
+			if checksummer != nil {
+				if _, err = output.Write(checksummer.Sum(nil)); err != nil {
+					return err
+				}
+			}
 			return io.EOF
 		case nil:
-			bl.Serialize(b[:BlockHashSize])
-			_, err = output.Write(b[:BlockHashSize])
+			serialize_signature_record(bl, record, mac)
+			if checksummer != nil {
+				checksummer.Write(record)
+			}
+			_, err = output.Write(record)
 			return err
 		default:
 			return err
@@ -226,17 +613,150 @@ func (self *Patcher) CreateSignatureIterator(src io.Reader, output io.Writer) fu
 	}
 }
 
+// Set in the Index of the records in a signature created by
+// CreateSignatureLazy() for blocks that are identical to the corresponding
+// block in the previous signature. The rest of the record is the same as in
+// the previous signature.
+const UnchangedBlockFlag uint64 = 1 << 63
+
+// Create a signature for src, like CreateSignatureIterator(), calling cb with
+// the serialized signature. Blocks are compared with the blocks at the same
+// index in prev_sig by their strong hash, which is computed for every block
+// as it is needed for its record whether or not the weak hash matches, so
+// comparing weak hashes first would not save any hashing. The weak hash is
+// computed only for blocks whose strong hash differs, for identical blocks
+// it is the weak hash from prev_sig. Identical blocks are marked with UnchangedBlockFlag so that
+// the receiver can update a previous signature incrementally. The signature
+// can be loaded by a Differ as is. The data passed to cb is only valid until
+// it returns.
+func (self *Api) CreateSignatureLazy(src io.Reader, prev_sig []BlockHash, cb func([]byte) error) error {
+	if err := self.check_signature_version(); err != nil {
+		return err
+	}
+	const records_per_chunk = 1024
+	checksummer := self.new_signature_checksummer()
+	buf, mac, err := self.append_new_signature_header(make([]byte, 0, records_per_chunk*(BlockHashSize+signature_hmac_size)))
+	if err != nil {
+		return err
+	}
+	record_size := self.signature_record_size(mac)
+	block := make([]byte, self.rsync.BlockSize)
+	hasher := self.rsync.hasher_constructor()
+	var rc rolling_checksum
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(src, block)
+		switch err {
+		case io.ErrUnexpectedEOF, io.EOF, nil:
+		default:
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		b := block[:n]
+		hasher.Reset()
+		hasher.Write(b)
+		bl := BlockHash{Index: index, StrongHash: hasher.Sum64()}
+		self.rsync.stats.StrongHashComputations++
+		if index < uint64(len(prev_sig)) && prev_sig[index].StrongHash == bl.StrongHash {
+			bl.Index |= UnchangedBlockFlag
+			bl.WeakHash = prev_sig[index].WeakHash
+		} else {
+			bl.WeakHash = rc.full(b)
+		}
+		if cap(buf)-len(buf) < record_size {
+			if err = cb(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+		buf = buf[:len(buf)+record_size]
+		serialize_signature_record(bl, buf[len(buf)-record_size:], mac)
+		if checksummer != nil {
+			checksummer.Write(buf[len(buf)-record_size:])
+		}
+		if n < len(block) {
+			break
+		}
+	}
+	if checksummer != nil {
+		buf = checksummer.Sum(buf)
+	}
+	if len(buf) > 0 {
+		return cb(buf)
+	}
+	return nil
+}
+
+// The complete serialized signature, header and block hashes, of the
+// currently loaded signature, for example, to cache it
+func (self *Api) SerializedSignature() ([]byte, error) {
+	if !self.rsync.HasHasher() {
+		return nil, fmt.Errorf("Cannot serialize the signature before loading one")
+	}
+	if err := self.check_signature_version(); err != nil {
+		return nil, err
+	}
+	// use the nonce of the loaded signature so that it is reproduced exactly
+	ans := self.append_signature_header(make([]byte, 0, 40+len(self.Signature_extensions)+len(self.signature)*(BlockHashSize+signature_hmac_size)), self.signature_hmac_nonce)
+	checksummer, mac := self.new_signature_checksummer(), self.new_signature_hmac(ans)
+	record_size := self.signature_record_size(mac)
+	for _, bl := range self.signature {
+		ans = ans[:len(ans)+record_size]
+		serialize_signature_record(bl, ans[len(ans)-record_size:], mac)
+		if checksummer != nil {
+			checksummer.Write(ans[len(ans)-record_size:])
+		}
+	}
+	if checksummer != nil {
+		ans = checksummer.Sum(ans)
+	}
+	return ans, nil
+}
+
+func (self *Differ) check_signature_loaded() error {
+	if err := self.FinishSignatureData(); err != nil {
+		return err
+	}
+	if self.signature == nil {
+		return fmt.Errorf("Cannot call CreateDelta() before loading a signature")
+	}
+	return nil
+}
+
 // Create a serialized delta based on the previously loaded signature
 func (self *Differ) CreateDelta(src io.Reader, output io.Writer) func() error {
-	if err := self.FinishSignatureData(); err != nil {
+	if err := self.check_signature_loaded(); err != nil {
 		return func() error { return err }
 	}
-	if self.signature == nil {
+	return self.rsync.CreateDiff(src, self.signature, output)
+}
+
+// Create a serialized delta like CreateDelta(), additionally, every
+// checkpoint_interval operations, everything read from src is written to
+// output and on_checkpoint is called with the offset into src up to which the
+// delta is complete. If sending the delta fails, it can be continued from the
+// last checkpoint with ResumeCreateDelta() instead of being re-created.
+func (self *Differ) CreateDeltaWithCheckpoints(src io.Reader, output io.Writer, checkpoint_interval int, on_checkpoint func(source_offset int64) error) func() error {
+	return self.ResumeCreateDelta(src, 0, output, checkpoint_interval, on_checkpoint)
+}
+
+// Continue a delta created by CreateDeltaWithCheckpoints() from the checkpoint
+// at source_offset. src must be read from its start, as the data before the
+// checkpoint is needed for the checksum of the delta. The operations written
+// to output follow the operations written before the checkpoint, so the
+// receiver must have applied exactly those, the Patcher output at that point
+// is source_offset bytes long.
+func (self *Differ) ResumeCreateDelta(src io.Reader, source_offset int64, output io.Writer, checkpoint_interval int, on_checkpoint func(source_offset int64) error) func() error {
+	if err := self.check_signature_loaded(); err != nil {
+		return func() error { return err }
+	}
+	if on_checkpoint != nil && checkpoint_interval < 1 {
 		return func() error {
-			return fmt.Errorf("Cannot call CreateDelta() before loading a signature")
+			return fmt.Errorf("The checkpoint interval must be positive not: %d", checkpoint_interval)
 		}
 	}
-	return self.rsync.CreateDiff(src, self.signature, output)
+	return self.rsync.CreateResumableDiff(src, self.signature, output, source_offset, checkpoint_interval, on_checkpoint)
 }
 
 func (self *Differ) BlockSize() int {
@@ -256,18 +776,22 @@ func (self *Differ) AddSignatureData(data []byte) (err error) {
 		}
 		self.unconsumed_signature_data = utils.ShiftLeft(self.unconsumed_signature_data, consumed)
 	}
-	consumed := self.read_signature_blocks(self.unconsumed_signature_data)
+	consumed, err := self.read_signature_blocks(self.unconsumed_signature_data)
 	self.unconsumed_signature_data = utils.ShiftLeft(self.unconsumed_signature_data, consumed)
-	return nil
+	return err
 }
 
 // Use to calculate a delta based on a supplied signature, via AddSignatureData
-func NewDiffer() *Differ {
-	return &Differ{}
+func NewDiffer(opts ...ApiOption) *Differ {
+	ans := &Differ{}
+	for _, o := range opts {
+		o(&ans.Api)
+	}
+	return ans
 }
 
 // Use to create a signature and possibly apply a delta
-func NewPatcher(expected_input_size int64) (ans *Patcher) {
+func NewPatcher(expected_input_size int64, opts ...ApiOption) (ans *Patcher) {
 	bs := DefaultBlockSize
 	sz := max(0, expected_input_size)
 	if sz > 0 {
@@ -283,5 +807,8 @@ func NewPatcher(expected_input_size int64) (ans *Patcher) {
 	}
 
 	ans.expected_input_size_for_signature_generation = sz
+	for _, o := range opts {
+		o(&ans.Api)
+	}
 	return
 }
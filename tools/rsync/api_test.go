@@ -5,15 +5,22 @@ package rsync
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	"kitty/tools/rsync/testutil"
 	"kitty/tools/utils"
 )
 
@@ -170,6 +177,21 @@ func TestRsyncRoundtrip(t *testing.T) {
 	run_roundtrip_test(t, src_data, changed[:len(changed)-3], num_of_patches, total_patch_size)
 	run_roundtrip_test(t, src_data, append(changed[:37], changed[81:]...), num_of_patches, total_patch_size)
 
+	// random data with a known fraction of identical blocks, the block size
+	// being the one the Patcher uses for this size of input
+	r := rand.New(rand.NewSource(1))
+	for _, similarity := range []float64{1, 0.9, 0.5, 0.1} {
+		src_data, changed := testutil.GenerateSimilarFile(r, 256*256, 256, similarity)
+		num_of_patches, total_patch_size := 0, 0
+		for offset := 0; offset < len(src_data); offset += 256 {
+			if !bytes.Equal(src_data[offset:offset+256], changed[offset:offset+256]) {
+				num_of_patches++
+				total_patch_size += 256
+			}
+		}
+		run_roundtrip_test(t, src_data, changed, num_of_patches, total_patch_size)
+	}
+
 	block_size = 13
 	src_data = generate_data(block_size, 17, "trailer")
 	changed = slices.Clone(src_data)
@@ -194,3 +216,794 @@ func TestRsyncHashers(t *testing.T) {
 		t.Fatalf(diff)
 	}
 }
+
+func signature_blocks(t testing.TB, sig []byte) []BlockHash {
+	d := NewDiffer()
+	if err := d.AddSignatureData(sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.FinishSignatureData(); err != nil {
+		t.Fatal(err)
+	}
+	return d.signature
+}
+
+func full_signature(t testing.TB, p *Patcher, src io.Reader) []byte {
+	out := bytes.Buffer{}
+	it := p.CreateSignatureIterator(src, &out)
+	for {
+		if err := it(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestRsyncLazySignature(t *testing.T) {
+	block_size := 16
+	src_data := generate_data(block_size, 16, "trailer")
+	changed := slices.Clone(src_data)
+	patch_data(changed, "3:patch1", "130:ptch3")
+	p := NewPatcher(int64(len(src_data)))
+	p.rsync.BlockSize = block_size
+	prev := signature_blocks(t, full_signature(t, p, bytes.NewReader(src_data)))
+	test := func(data []byte, unchanged ...uint64) {
+		t.Helper()
+		sig := []byte{}
+		if err := p.CreateSignatureLazy(bytes.NewReader(data), prev, func(b []byte) error {
+			sig = append(sig, b...)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		actual_unchanged := []uint64{}
+		for b := sig[12:]; len(b) > 0; b = b[BlockHashSize:] {
+			bl := BlockHash{}
+			bl.Unserialize(b)
+			if bl.Index&UnchangedBlockFlag != 0 {
+				actual_unchanged = append(actual_unchanged, bl.Index&^UnchangedBlockFlag)
+			}
+		}
+		if diff := cmp.Diff(unchanged, actual_unchanged); diff != "" {
+			t.Fatalf("Incorrect unchanged blocks in lazy signature:\n%s", diff)
+		}
+		expected := signature_blocks(t, full_signature(t, p, bytes.NewReader(data)))
+		if diff := cmp.Diff(expected, signature_blocks(t, sig)); diff != "" {
+			t.Fatalf("Lazy signature differs from full signature:\n%s", diff)
+		}
+	}
+	all := make([]uint64, len(prev))
+	for i := range all {
+		all[i] = uint64(i)
+	}
+	test(src_data, all...)
+	test(changed, slices.Concat(all[1:8], all[9:])...)
+	test(changed[:40], 1)
+	test(append(slices.Clone(src_data), "more data"...), all[:len(all)-1]...)
+	test([]byte{}, []uint64{}...)
+}
+
+func TestRsyncLazySignatureLargeExtensions(t *testing.T) {
+	src_data := generate_data(16, 8)
+	p := NewPatcher(int64(len(src_data)), WithSignatureVersion(1))
+	p.rsync.BlockSize = 16
+	// headers of 20 bytes plus the extensions that leave less room than a
+	// record in the buffer of the first chunk of the signature
+	chunk_size := 1024 * (BlockHashSize + signature_hmac_size)
+	for n := chunk_size - 20 - BlockHashSize - 4; n < chunk_size-20+4; n++ {
+		p.Signature_extensions = make([]byte, n)
+		var lazy []byte
+		if err := p.CreateSignatureLazy(bytes.NewReader(src_data), nil, func(b []byte) error { lazy = append(lazy, b...); return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(full_signature(t, p, bytes.NewReader(src_data)), lazy); diff != "" {
+			t.Fatalf("Lazy signature with %d bytes of extensions differs:\n%s", n, diff)
+		}
+	}
+}
+
+// Generates num_of_blocks blocks of data with the blocks in modified changed
+type generated_blocks struct {
+	block              []byte
+	num_of_blocks, pos int
+	modified           map[int]bool
+}
+
+func (self *generated_blocks) Read(p []byte) (n int, err error) {
+	bs := len(self.block)
+	for len(p) > 0 && self.pos < self.num_of_blocks*bs {
+		idx, offset := self.pos/bs, self.pos%bs
+		c := copy(p, self.block[offset:])
+		if self.modified[idx] {
+			for i := range c {
+				p[i] ^= 0xff
+			}
+		}
+		bin.PutUint64(p[:min(c, 8)], uint64(idx)) // make every block unique
+		p, n, self.pos = p[c:], n+c, self.pos+c
+	}
+	if n == 0 {
+		err = io.EOF
+	}
+	return
+}
+
+func BenchmarkRsyncLazySignature(b *testing.B) {
+	const file_size = 1 << 30
+	p := NewPatcher(file_size)
+	bs := p.rsync.BlockSize
+	num_of_blocks := file_size / bs
+	source := func(modified ...int) io.Reader {
+		ans := &generated_blocks{block: make([]byte, bs), num_of_blocks: num_of_blocks, modified: make(map[int]bool)}
+		for i := range ans.block {
+			ans.block[i] = byte(i)
+		}
+		for _, m := range modified {
+			ans.modified[m] = true
+		}
+		return ans
+	}
+	prev := signature_blocks(b, full_signature(b, p, source()))
+	modified := make([]int, 10)
+	for i := range modified {
+		modified[i] = i * num_of_blocks / len(modified)
+	}
+	b.Run("full", func(b *testing.B) {
+		b.SetBytes(file_size)
+		for i := 0; i < b.N; i++ {
+			full_signature(b, p, source(modified...))
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		b.SetBytes(file_size)
+		for i := 0; i < b.N; i++ {
+			if err := p.CreateSignatureLazy(source(modified...), prev, func([]byte) error { return nil }); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRsyncMemoryBudget(t *testing.T) {
+	block_size := 16
+	src_data := generate_data(block_size, 4096)
+	p := NewPatcher(int64(len(src_data)))
+	p.rsync.BlockSize = block_size
+	sig := full_signature(t, p, bytes.NewReader(src_data))
+	if blocks := signature_blocks(t, sig); len(blocks) != 4096 {
+		t.Fatalf("Incorrect number of blocks in signature: %d", len(blocks))
+	}
+	budget := 2048 * block_hash_memory_size
+	d := NewDiffer(WithMemoryBudget(budget))
+	// the header and as many blocks as fit in the budget
+	if err := d.AddSignatureData(sig[:12+2048*BlockHashSize]); err != nil {
+		t.Fatal(err)
+	}
+	sig = sig[12+2048*BlockHashSize:]
+	if u := d.SignatureMemoryUsage(); u > budget || u < int64(len(d.signature))*block_hash_memory_size {
+		t.Fatalf("Incorrect signature memory usage: %d for budget: %d", u, budget)
+	}
+	if err := d.AddSignatureData(sig); err != ErrSignatureTooLarge {
+		t.Fatalf("Exceeding the memory budget did not fail, error: %v", err)
+	}
+	if u := d.SignatureMemoryUsage(); u > budget {
+		t.Fatalf("Signature memory usage: %d exceeds the budget: %d", u, budget)
+	}
+}
+
+func TestRsyncSerializedSignature(t *testing.T) {
+	block_size := 16
+	src_data := generate_data(block_size, 64)
+	for _, version := range []uint16{0, 1} {
+		p := NewPatcher(int64(len(src_data)), WithSignatureVersion(version))
+		p.rsync.BlockSize = block_size
+		p.Signature_flags, p.Signature_extensions = 3, []byte("ext")
+		sig := full_signature(t, p, bytes.NewReader(src_data))
+		d := NewDiffer()
+		if _, err := d.SerializedSignature(); err == nil {
+			t.Fatalf("Serializing a signature before loading one did not fail")
+		}
+		if err := d.AddSignatureData(sig); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := d.SerializedSignature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(sig, actual); diff != "" {
+			t.Fatalf("Serialized signature for version %d differs from the original:\n%s", version, diff)
+		}
+	}
+}
+
+func TestRsyncBlockCRC(t *testing.T) {
+	block_size := 16
+	src_data := generate_data(block_size, 16)
+	changed := slices.Clone(src_data)
+	patch_data(changed, "3:patch1", "130:ptch3")
+	p := NewPatcher(int64(len(changed)), WithBlockCRC(true))
+	p.rsync.BlockSize = block_size
+	d := NewDiffer(WithBlockCRC(true))
+	if err := d.AddSignatureData(full_signature(t, p, bytes.NewReader(changed))); err != nil {
+		t.Fatal(err)
+	}
+	db := bytes.Buffer{}
+	it := d.CreateDelta(bytes.NewReader(src_data), &db)
+	for {
+		if err := it(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	apply := func(delta []byte) ([]byte, error) {
+		output := bytes.Buffer{}
+		p.StartDelta(&output, bytes.NewReader(changed))
+		for len(delta) > 0 {
+			n := min(7, len(delta))
+			if err := p.UpdateDelta(delta[:n]); err != nil {
+				return nil, err
+			}
+			delta = delta[n:]
+		}
+		return output.Bytes(), p.FinishDelta()
+	}
+	output, err := apply(db.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src_data, output) {
+		t.Fatalf("Patching with block CRCs failed, output:\n%s", string(output))
+	}
+	// corrupt the data of the first operation, which is OpData for the first patch
+	corrupted := slices.Clone(db.Bytes())
+	if OpType(corrupted[0]) != OpData {
+		t.Fatalf("Unexpected first operation in delta: %d", corrupted[0])
+	}
+	corrupted[6] ^= 1
+	_, err = apply(corrupted)
+	if err != (ErrCorruptOperation{OpIndex: 0}) {
+		t.Fatalf("Corruption not detected, error: %v", err)
+	}
+	var ce ErrCorruptOperation
+	corrupted = slices.Clone(db.Bytes())
+	corrupted[len(corrupted)-1] ^= 1
+	if _, err = apply(corrupted); !errors.As(err, &ce) || ce.OpIndex == 0 {
+		t.Fatalf("Corruption of the CRC of the last operation not detected: %v", err)
+	}
+}
+
+func TestRsyncSignatureVersions(t *testing.T) {
+	src_data := generate_data(16, 8)
+	p := NewPatcher(int64(len(src_data)), WithSignatureVersion(1))
+	p.Signature_flags, p.Signature_extensions = 3, []byte("ext")
+	v1 := full_signature(t, p, bytes.NewReader(src_data))
+	p.Signature_version = 0
+	v0 := full_signature(t, p, bytes.NewReader(src_data))
+	if len(v1) != len(v0)+8+3 {
+		t.Fatalf("Incorrect size of version 1 signature: %d", len(v1))
+	}
+	// feed the signature byte by byte to check the handling of partial headers
+	d := NewDiffer()
+	for i := range v1 {
+		if err := d.AddSignatureData(v1[i : i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.FinishSignatureData(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{uint16(1), uint32(3), "ext"}, []any{d.Signature_version, d.Signature_flags, string(d.Signature_extensions)}); diff != "" {
+		t.Fatalf("Incorrect version 1 header fields:\n%s", diff)
+	}
+	if diff := cmp.Diff(signature_blocks(t, v0), d.signature); diff != "" {
+		t.Fatalf("Version 1 signature blocks differ from version 0:\n%s", diff)
+	}
+	v2 := slices.Clone(v0)
+	bin.PutUint16(v2, 2)
+	if err := NewDiffer().AddSignatureData(v2); !errors.Is(err, ErrUnsupportedSignatureVersion) {
+		t.Fatalf("Unsupported signature version not detected, error: %v", err)
+	}
+	p.Signature_version = 2
+	if err := p.CreateSignatureIterator(bytes.NewReader(src_data), io.Discard)(); !errors.Is(err, ErrUnsupportedSignatureVersion) {
+		t.Fatalf("Creating a signature with an unsupported version did not fail, error: %v", err)
+	}
+}
+
+func TestRsyncSignatureIntegrity(t *testing.T) {
+	src_data := generate_data(16, 8)
+	p := NewPatcher(int64(len(src_data)))
+	plain := full_signature(t, p, bytes.NewReader(src_data))
+	p = NewPatcher(int64(len(src_data)), WithSignatureIntegrity(true))
+	if p.Signature_version != 1 {
+		t.Fatalf("Signature integrity did not use version 1: %d", p.Signature_version)
+	}
+	sig := full_signature(t, p, bytes.NewReader(src_data))
+	if len(sig) != len(plain)+8+16 {
+		t.Fatalf("Incorrect size of signature with integrity: %d", len(sig))
+	}
+	if diff := cmp.Diff(signature_blocks(t, plain), signature_blocks(t, sig)); diff != "" {
+		t.Fatalf("Signature blocks with integrity differ:\n%s", diff)
+	}
+	var lazy []byte
+	if err := p.CreateSignatureLazy(bytes.NewReader(src_data), nil, func(b []byte) error { lazy = append(lazy, b...); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sig, lazy); diff != "" {
+		t.Fatalf("Lazy signature with integrity differs:\n%s", diff)
+	}
+	finish := func(sig []byte) error {
+		d := NewDiffer()
+		if err := d.AddSignatureData(sig); err != nil {
+			return err
+		}
+		return d.FinishSignatureData()
+	}
+	corrupted := slices.Clone(sig)
+	corrupted[len(corrupted)-20] ^= 1
+	if err := finish(corrupted); !errors.Is(err, ErrSignatureCorrupted) {
+		t.Fatalf("Corrupted signature not detected, error: %v", err)
+	}
+	if err := finish(sig[:len(sig)-1]); !errors.Is(err, ErrSignatureCorrupted) {
+		t.Fatalf("Truncated signature not detected, error: %v", err)
+	}
+	if err := finish(sig[:len(sig)-16]); !errors.Is(err, ErrSignatureCorrupted) {
+		t.Fatalf("Signature without checksum not detected, error: %v", err)
+	}
+}
+
+func TestRsyncSignatureHMAC(t *testing.T) {
+	src_data := generate_data(16, 8)
+	key := []byte("secret")
+	p := NewPatcher(int64(len(src_data)))
+	plain := full_signature(t, p, bytes.NewReader(src_data))
+	p = NewPatcher(int64(len(src_data)), WithSignatureHMAC(key), WithSignatureIntegrity(true))
+	sig := full_signature(t, p, bytes.NewReader(src_data))
+	num_blocks := (len(plain) - 12) / BlockHashSize
+	if len(sig) != len(plain)+8+16+16+num_blocks*16 {
+		t.Fatalf("Incorrect size of signature with HMACs: %d", len(sig))
+	}
+	var lazy []byte
+	if err := p.CreateSignatureLazy(bytes.NewReader(src_data), nil, func(b []byte) error { lazy = append(lazy, b...); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(lazy) != len(sig) || bytes.Equal(lazy[20:36], sig[20:36]) {
+		t.Fatalf("Lazy signature with HMACs does not have its own nonce")
+	}
+	load := func(sig []byte, key []byte) (*Differ, error) {
+		d := NewDiffer(WithSignatureHMAC(key))
+		if err := d.AddSignatureData(sig); err != nil {
+			return d, err
+		}
+		return d, d.FinishSignatureData()
+	}
+	d, err := load(sig, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ld, err := load(lazy, key); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff(d.signature, ld.signature); diff != "" {
+		t.Fatalf("Lazy signature blocks with HMACs differ:\n%s", diff)
+	}
+	if diff := cmp.Diff(signature_blocks(t, plain), d.signature); diff != "" {
+		t.Fatalf("Signature blocks with HMACs differ:\n%s", diff)
+	}
+	if serialized, err := d.SerializedSignature(); err != nil || !bytes.Equal(serialized, sig) {
+		t.Fatalf("Serialized signature with HMACs differs, error: %v", err)
+	}
+	fix_checksum := func(sig []byte) []byte {
+		c := new_xxh3_128()
+		c.Write(sig[36:])
+		return c.Sum(sig)
+	}
+	// change the strong hash of the second block and fix the checksum
+	tampered := slices.Clone(sig[:len(sig)-16])
+	tampered[36+BlockHashSize+16+12] ^= 1
+	if _, err := load(fix_checksum(tampered), key); !errors.Is(err, ErrSignatureTampered) {
+		t.Fatalf("Tampered signature not detected, error: %v", err)
+	}
+	// replace the second block with the one from another signature made
+	// with the same key
+	spliced := slices.Clone(sig[:len(sig)-16])
+	copy(spliced[36+BlockHashSize+16:36+2*(BlockHashSize+16)], lazy[36+BlockHashSize+16:])
+	if _, err := load(fix_checksum(spliced), key); !errors.Is(err, ErrSignatureTampered) {
+		t.Fatalf("Block from another signature not detected, error: %v", err)
+	}
+	if _, err := load(sig, []byte("wrong key")); !errors.Is(err, ErrSignatureTampered) {
+		t.Fatalf("Signature with the wrong key not detected, error: %v", err)
+	}
+	if _, err := load(plain, key); !errors.Is(err, ErrSignatureTampered) {
+		t.Fatalf("Signature without HMACs not detected, error: %v", err)
+	}
+	if _, err := load(sig, nil); err == nil {
+		t.Fatalf("Signature with HMACs loaded without a key")
+	}
+}
+
+func TestRsyncLiteralCompression(t *testing.T) {
+	changed := generate_data(64, 64)
+	src_data := slices.Concat(changed[:1000], bytes.Repeat([]byte("compressible "), 1000), changed[1000:])
+	p := NewPatcher(int64(len(changed)))
+	sig := full_signature(t, p, bytes.NewReader(changed))
+	delta := func(opts ...ApiOption) []byte {
+		d := NewDiffer(opts...)
+		if err := d.AddSignatureData(sig); err != nil {
+			t.Fatal(err)
+		}
+		db := bytes.Buffer{}
+		it := d.CreateDelta(bytes.NewReader(src_data), &db)
+		for {
+			if err := it(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return db.Bytes()
+	}
+	plain, compressed := delta(), delta(WithLiteralCompression(true, 0))
+	if len(compressed) >= len(plain) {
+		t.Fatalf("Compressed delta not smaller: %d >= %d", len(compressed), len(plain))
+	}
+	has_compressed_data := false
+	for b := compressed; len(b) > 0; {
+		var op Operation
+		n, err := op.Unserialize(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		has_compressed_data = has_compressed_data || op.Type == OpCompressedData
+		b = b[n:]
+	}
+	if !has_compressed_data {
+		t.Fatalf("Delta has no compressed data")
+	}
+	output := bytes.Buffer{}
+	p.StartDelta(&output, bytes.NewReader(changed))
+	if err := p.UpdateDelta(compressed); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.FinishDelta(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src_data, output.Bytes()) {
+		t.Fatalf("Patching with compressed literal data failed")
+	}
+}
+
+func TestRsyncDeltaCheckpoints(t *testing.T) {
+	block_size := 16
+	changed := generate_data(block_size, 64)
+	src_data := slices.Clone(changed)
+	patch_data(src_data, "3:patch1", "130:ptch3", "400:patch4", "700:patch5", "1000:patch6")
+	p := NewPatcher(int64(len(changed)))
+	p.rsync.BlockSize = block_size
+	d := NewDiffer()
+	if err := d.AddSignatureData(full_signature(t, p, bytes.NewReader(changed))); err != nil {
+		t.Fatal(err)
+	}
+	run := func(it func() error) {
+		for {
+			if err := it(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	apply := func(delta []byte) []byte {
+		output := bytes.Buffer{}
+		p.StartDelta(&output, bytes.NewReader(changed))
+		if err := p.UpdateDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.FinishDelta(); err != nil {
+			t.Fatal(err)
+		}
+		return output.Bytes()
+	}
+	type checkpoint struct {
+		source_offset int64
+		delta_size    int
+	}
+	var checkpoints []checkpoint
+	db := bytes.Buffer{}
+	run(d.CreateDeltaWithCheckpoints(bytes.NewReader(src_data), &db, 2, func(source_offset int64) error {
+		checkpoints = append(checkpoints, checkpoint{source_offset, db.Len()})
+		return nil
+	}))
+	if len(checkpoints) < 2 {
+		t.Fatalf("Too few checkpoints: %v", checkpoints)
+	}
+	if !bytes.Equal(src_data, apply(db.Bytes())) {
+		t.Fatalf("Patching with a checkpointed delta failed")
+	}
+	for _, c := range checkpoints {
+		// the delta till the checkpoint reproduces the source till the offset
+		output := bytes.Buffer{}
+		p.StartDelta(&output, bytes.NewReader(changed))
+		if err := p.UpdateDelta(db.Bytes()[:c.delta_size]); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(src_data[:c.source_offset], output.Bytes()); diff != "" {
+			t.Fatalf("Output at checkpoint %v differs:\n%s", c, diff)
+		}
+		resumed := bytes.NewBuffer(slices.Clone(db.Bytes()[:c.delta_size]))
+		run(d.ResumeCreateDelta(bytes.NewReader(src_data), c.source_offset, resumed, 2, func(int64) error { return nil }))
+		if !bytes.Equal(src_data, apply(resumed.Bytes())) {
+			t.Fatalf("Patching with a delta resumed at %v failed", c)
+		}
+	}
+	if err := d.ResumeCreateDelta(bytes.NewReader(src_data[:10]), 20, &db, 2, nil)(); err == nil {
+		t.Fatalf("Resuming past the end of the source did not fail")
+	}
+}
+
+func TestRsyncApplyDeltaFast(t *testing.T) {
+	block_size := 16
+	src_data := generate_data(block_size, 16, "trailer")
+	changed := slices.Clone(src_data)
+	patch_data(changed, "3:patch1", "130:ptch3")
+	changed = changed[:len(changed)-3]
+	p := NewPatcher(int64(len(changed)))
+	p.rsync.BlockSize = block_size
+	d := NewDiffer()
+	if err := d.AddSignatureData(full_signature(t, p, bytes.NewReader(changed))); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.FinishSignatureData(); err != nil {
+		t.Fatal(err)
+	}
+	delta_ops, err := d.rsync.CreateDelta(bytes.NewReader(src_data), d.signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdir := t.TempDir()
+	input, err := os.Create(filepath.Join(tdir, "input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	if _, err = input.Write(changed); err != nil {
+		t.Fatal(err)
+	}
+	test := func(ops []Operation) error {
+		output, err := os.Create(filepath.Join(tdir, "output"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer output.Close()
+		ch := make(chan Operation, len(ops))
+		for _, op := range ops {
+			ch <- op
+		}
+		close(ch)
+		if err = p.ApplyDeltaFast(output, input, ch); err != nil {
+			return err
+		}
+		actual, err := os.ReadFile(output.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(src_data, actual) {
+			t.Fatalf("Applying delta with ApplyDeltaFast() failed, output:\n%s", string(actual))
+		}
+		return nil
+	}
+	if err = test(delta_ops); err != nil {
+		t.Fatal(err)
+	}
+	if err = test(delta_ops[:len(delta_ops)-1]); err == nil {
+		t.Fatalf("Missing checksum not detected")
+	}
+}
+
+func TestBlockHashBinaryCompatibility(t *testing.T) {
+	// the on-wire format documented in doc.go, this must never change
+	golden, _ := hex.DecodeString("0807060504030201" + "44332211" + "1817161514131211")
+	expected := BlockHash{Index: 0x0102030405060708, WeakHash: 0x11223344, StrongHash: 0x1112131415161718}
+	bl := BlockHash{}
+	if err := bl.Unserialize(golden); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, bl); diff != "" {
+		t.Fatalf("Unserializing the golden BlockHash failed:\n%s", diff)
+	}
+	b := make([]byte, BlockHashSize)
+	expected.Serialize(b)
+	if diff := cmp.Diff(hex.EncodeToString(golden), hex.EncodeToString(b)); diff != "" {
+		t.Fatalf("Serialized BlockHash differs from golden bytes:\n%s", diff)
+	}
+	if len(golden) != BlockHashSize || new_xxh3_64().Size()+12 != BlockHashSize {
+		t.Fatalf("Incorrect BlockHash size: %d", BlockHashSize)
+	}
+	if err := bl.Unserialize(golden[:BlockHashSize-1]); err == nil {
+		t.Fatalf("Unserializing a truncated BlockHash did not fail")
+	}
+}
+
+func TestRsyncHashDiagnostics(t *testing.T) {
+	p := NewPatcher(0)
+	p.rsync.BlockSize = 4
+	d, err := p.DiagnoseHashing(strings.NewReader("abcdabcdab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// windows: abcd bcda cdab dabc abcd bcda cdab, four distinct contents of
+	// which bcda and dabc have the same weak hash
+	if d.Positions != 7 || d.WeakHashCollisions != 1 || d.BucketFillFactor != 3.0/7 {
+		t.Fatalf("Incorrect diagnostics for repetitive content: %s", d)
+	}
+	total := 0
+	for _, n := range d.WeakHashDistribution {
+		total += n
+	}
+	if total != d.Positions {
+		t.Fatalf("Incorrect weak hash distribution total: %d", total)
+	}
+	// aca and bab have the same byte sum and weighted byte sum, so the same
+	// weak hash
+	p.rsync.BlockSize = 3
+	var rc rolling_checksum
+	if rc.full([]byte("aca")) != rc.full([]byte("bab")) {
+		t.Fatalf("Expected weak hash collision not found")
+	}
+	if d, err = p.DiagnoseHashing(strings.NewReader("aca_bab")); err != nil {
+		t.Fatal(err)
+	}
+	if d.Positions != 5 || d.WeakHashCollisions != 1 || d.BucketFillFactor != 4.0/5 {
+		t.Fatalf("Incorrect diagnostics for colliding content: %s", d)
+	}
+	if d, err = p.DiagnoseHashing(strings.NewReader("")); err != nil || d.Positions != 0 {
+		t.Fatalf("Incorrect diagnostics for empty content: %v %v", d, err)
+	}
+}
+
+func TestRsyncStats(t *testing.T) {
+	p := NewPatcher(4)
+	p.rsync.BlockSize = 4
+	d := NewDiffer()
+	if err := d.AddSignatureData(full_signature(t, p, strings.NewReader("bcdaefgh"))); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(RsyncStats{StrongHashComputations: 2}, p.Stats()); diff != "" {
+		t.Fatalf("Incorrect stats for signature:\n%s", diff)
+	}
+	// dabc has the same weak hash as bcda but a different strong hash
+	it := d.CreateDelta(strings.NewReader("dabcbcda"), io.Discard)
+	for {
+		if err := it(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff(RsyncStats{WeakHashHits: 2, WeakHashFalsePositives: 1, StrongHashComputations: 2}, d.Stats()); diff != "" {
+		t.Fatalf("Incorrect stats:\n%s", diff)
+	}
+	if err := p.CreateSignatureLazy(strings.NewReader("bcdaefghi"), d.signature, func([]byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(RsyncStats{StrongHashComputations: 5}, p.Stats()); diff != "" {
+		t.Fatalf("Incorrect stats for lazy signature:\n%s", diff)
+	}
+}
+
+func TestRsyncBytes(t *testing.T) {
+	original := generate_data(16, 64)
+	current := slices.Clone(original)
+	patch_data(current, "3:patch1", "500:ptch2")
+	current = append(current, "extra"...)
+	for _, block_crc := range []bool{false, true} {
+		p := NewPatcher(int64(len(original)), WithBlockCRC(block_crc))
+		delta, err := p.CreateDeltaFromBytes(original, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(delta) >= len(current) {
+			t.Fatalf("Delta of size %d not smaller than the data of size %d", len(delta), len(current))
+		}
+		output, err := p.ApplyDeltaToBytes(delta, original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(current), string(output)); diff != "" {
+			t.Fatalf("Patched data differs (block_crc: %v):\n%s", block_crc, diff)
+		}
+		if _, err = p.ApplyDeltaToBytes(delta[:len(delta)-1], original); err == nil {
+			t.Fatalf("Applying a truncated delta did not fail")
+		}
+	}
+}
+
+// Run the full signature, delta and patch pipeline, reporting throughput in
+// terms of the size of the file being synced
+func benchmark_roundtrip(b *testing.B, size int64, similarity float64) {
+	p := NewPatcher(size)
+	original, current := testutil.GenerateSimilarFile(rand.New(rand.NewSource(1)), size, p.rsync.BlockSize, similarity)
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		delta, err := p.CreateDeltaFromBytes(original, current)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = p.ApplyDeltaToBytes(delta, original); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoundTrip_1KB(b *testing.B)   { benchmark_roundtrip(b, 1024, 0.9) }
+func BenchmarkRoundTrip_1MB(b *testing.B)   { benchmark_roundtrip(b, 1024*1024, 0.9) }
+func BenchmarkRoundTrip_10MB(b *testing.B)  { benchmark_roundtrip(b, 10*1024*1024, 0.9) }
+func BenchmarkRoundTrip_100MB(b *testing.B) { benchmark_roundtrip(b, 100*1024*1024, 0.9) }
+
+func BenchmarkRoundTrip_HighSimilarity(b *testing.B) { benchmark_roundtrip(b, 10*1024*1024, 0.9) }
+func BenchmarkRoundTrip_LowSimilarity(b *testing.B)  { benchmark_roundtrip(b, 10*1024*1024, 0.1) }
+
+func mutate_randomly(r *rand.Rand, data []byte, block_size int) []byte {
+	random_bytes := func(n int) []byte {
+		ans := make([]byte, n)
+		r.Read(ans)
+		return ans
+	}
+	for n := r.Intn(8); n > 0 && len(data) > 0; n-- {
+		pos := r.Intn(len(data))
+		switch r.Intn(4) {
+		case 0: // point mutation
+			data[pos] ^= byte(1 + r.Intn(255))
+		case 1: // insertion
+			data = slices.Insert(data, pos, random_bytes(1+r.Intn(2*block_size))...)
+		case 2: // deletion
+			data = slices.Delete(data, pos, min(len(data), pos+1+r.Intn(2*block_size)))
+		case 3: // block swap
+			if other := r.Intn(len(data)); len(data) >= 2*block_size {
+				a, b := min(pos, other), max(pos, other)
+				if a+block_size <= b && b+block_size <= len(data) {
+					tmp := slices.Clone(data[a : a+block_size])
+					copy(data[a:], data[b:b+block_size])
+					copy(data[b:], tmp)
+				}
+			}
+		}
+	}
+	return data
+}
+
+// Check that random data with random mutations always round trips. The seed of
+// a failing iteration can be used to reproduce it.
+func TestRsyncRoundTripProperty(t *testing.T) {
+	iterations := utils.IfElse(testing.Short(), 100, 1000)
+	base_seed := time.Now().UnixNano()
+	for i := 0; i < iterations; i++ {
+		seed := base_seed + int64(i)
+		r := rand.New(rand.NewSource(seed))
+		// log uniform so that small sizes are well represented
+		size := int(math.Pow(2, r.Float64()*20))
+		original := make([]byte, size)
+		r.Read(original)
+		if r.Intn(4) == 0 { // low entropy data to exercise weak hash collisions
+			for j := range original {
+				original[j] &= 3
+			}
+		}
+		p := NewPatcher(int64(size), WithBlockCRC(r.Intn(2) == 0))
+		p.rsync.BlockSize = max(1, size/4096) + r.Intn(min(size, 4096))
+		modified := mutate_randomly(r, slices.Clone(original), p.rsync.BlockSize)
+		delta, err := p.CreateDeltaFromBytes(original, modified)
+		if err != nil {
+			t.Fatalf("Creating delta failed with seed: %d: %s", seed, err)
+		}
+		output, err := p.ApplyDeltaToBytes(delta, original)
+		if err != nil {
+			t.Fatalf("Applying delta failed with seed: %d: %s", seed, err)
+		}
+		if !bytes.Equal(output, modified) {
+			t.Fatalf("Round trip failed with seed: %d, size: %d, block size: %d", seed, size, p.rsync.BlockSize)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package rsync
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+var _ = fmt.Print
+
+func copy_range_fallback(output, input *os.File, src_offset, dest_offset, length int64) (int64, error) {
+	return io.Copy(io.NewOffsetWriter(output, dest_offset), io.NewSectionReader(input, src_offset, length))
+}
+
+// Apply the operations in ops, as created by a Differ for the file this
+// Patcher created the signature for, writing the result to output at its
+// current position. Blocks are copied from input to output in the kernel,
+// without reading them into memory, where the platform supports it, falling
+// back to regular reads and writes otherwise. As a consequence, the overall
+// checksum is verified by reading back the output when the OpHash operation is
+// received.
+func (self *Patcher) ApplyDeltaFast(output, input *os.File, ops <-chan Operation) error {
+	start, err := output.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	bs := int64(self.rsync.BlockSize)
+	pos := start
+	self.rsync.checksum_done = false
+	for op := range ops {
+		if err = self.rsync.decompress_literal(&op); err != nil {
+			return err
+		}
+		switch op.Type {
+		case OpBlock, OpBlockRange:
+			end := op.BlockIndex
+			if op.Type == OpBlockRange {
+				end = op.BlockIndexEnd
+			}
+			n, err := copy_range(output, input, int64(op.BlockIndex)*bs, pos, int64(end-op.BlockIndex+1)*bs)
+			if err != nil {
+				return err
+			}
+			pos += n
+		case OpData:
+			n, err := output.WriteAt(op.Data, pos)
+			if err != nil {
+				return err
+			}
+			pos += int64(n)
+		case OpHash:
+			checksummer := self.rsync.checksummer_constructor()
+			if _, err = io.Copy(checksummer, io.NewSectionReader(output, start, pos-start)); err != nil {
+				return err
+			}
+			if actual := checksummer.Sum(nil); !bytes.Equal(actual, op.Data) {
+				return fmt.Errorf("Failed to verify overall file checksum actual: %s != expected: %s. This usually happens if some data was corrupted in transit or one of the involved files was altered while the transfer was in progress.", hex.EncodeToString(actual), hex.EncodeToString(op.Data))
+			}
+			self.rsync.checksum_done = true
+		}
+	}
+	if _, err = output.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	if !self.rsync.checksum_done {
+		return fmt.Errorf("The checksum was not received at the end of the delta data")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build linux
+
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package rsync
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+// Copy length bytes, or till the end of input, using copy_file_range(2)
+func copy_range(output, input *os.File, src_offset, dest_offset, length int64) (copied int64, err error) {
+	rfd, wfd := int(input.Fd()), int(output.Fd())
+	for copied < length {
+		n, err := unix.CopyFileRange(rfd, &src_offset, wfd, &dest_offset, int(length-copied), 0)
+		if err != nil {
+			// not supported for these files, for example across filesystems on older kernels
+			n, err := copy_range_fallback(output, input, src_offset, dest_offset, length-copied)
+			return copied + n, err
+		}
+		if n == 0 {
+			break
+		}
+		copied += int64(n)
+	}
+	return
+}
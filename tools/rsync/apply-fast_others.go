@@ -0,0 +1,16 @@
+//go:build !linux
+
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package rsync
+
+import (
+	"fmt"
+	"os"
+)
+
+var _ = fmt.Print
+
+func copy_range(output, input *os.File, src_offset, dest_offset, length int64) (int64, error) {
+	return copy_range_fallback(output, input, src_offset, dest_offset, length)
+}
@@ -0,0 +1,85 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package rsync
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+var _ = fmt.Print
+
+type HashDiagnostics struct {
+	// The number of block sized windows in the source, one per byte
+	Positions int
+	// The number of windows whose weak hash is the same as that of an
+	// earlier window with different contents. Each of these requires a
+	// strong hash computation when creating a delta, for nothing.
+	WeakHashCollisions int
+	// The number of windows per value of the low byte of the weak hash
+	WeakHashDistribution [256]int
+	// The number of distinct weak hashes divided by the number of windows,
+	// one when every window has a different weak hash. Low values with few
+	// collisions mean the content is repetitive, low values with many
+	// collisions mean the weak hash distributes poorly for this content and
+	// block size.
+	BucketFillFactor float64
+}
+
+func (self HashDiagnostics) String() string {
+	return fmt.Sprintf("HashDiagnostics{positions: %d collisions: %d fill factor: %.3f}", self.Positions, self.WeakHashCollisions, self.BucketFillFactor)
+}
+
+// Compute the weak hash of every block sized window of src, as is done when
+// creating a delta, to show how well the weak hash distributes for this
+// content and block size. src is read fully into memory, so use a
+// representative sample for large files.
+func (self *Api) DiagnoseHashing(src io.Reader) (*HashDiagnostics, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	ans := &HashDiagnostics{}
+	if len(data) == 0 {
+		return ans, nil
+	}
+	bs := max(1, min(self.rsync.BlockSize, len(data)))
+	hasher := self.rsync.hasher_constructor()
+	strong_hash := func(b []byte) uint64 {
+		hasher.Reset()
+		hasher.Write(b)
+		return hasher.Sum64()
+	}
+	type seen_hash struct {
+		first_pos int
+		// the strong hashes of the distinct contents with this weak hash, only
+		// computed once a second window with the weak hash is found
+		strong_hashes []uint64
+	}
+	seen := make(map[uint32]*seen_hash)
+	var rc rolling_checksum
+	for pos := 0; pos+bs <= len(data); pos++ {
+		if pos == 0 {
+			rc.full(data[:bs])
+		} else {
+			rc.add_one_byte(data[pos], data[pos+bs-1])
+		}
+		ans.Positions++
+		ans.WeakHashDistribution[rc.val&0xff]++
+		s := seen[rc.val]
+		if s == nil {
+			seen[rc.val] = &seen_hash{first_pos: pos}
+			continue
+		}
+		if s.strong_hashes == nil {
+			s.strong_hashes = []uint64{strong_hash(data[s.first_pos : s.first_pos+bs])}
+		}
+		if sh := strong_hash(data[pos : pos+bs]); !slices.Contains(s.strong_hashes, sh) {
+			ans.WeakHashCollisions++
+			s.strong_hashes = append(s.strong_hashes, sh)
+		}
+	}
+	ans.BucketFillFactor = float64(len(seen)) / float64(ans.Positions)
+	return ans, nil
+}
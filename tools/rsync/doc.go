@@ -0,0 +1,85 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+// First create a patcher with:
+// p = NewPatcher()
+// Create a signature for the file you want to update using
+// p.CreateSignatureIterator(file_to_update)
+// Now create a Differ with the created signature
+// d = NewDiffer()
+// d.AddSignatureData(signature_data_from_previous_step)
+// Now create a delta based on the signature and the reference file
+// d.CreateDelta(reference_file)
+// Finally, apply this delta using the patcher to produce a file identical to reference_file
+// based ont he delta data and file_to_update
+// p.StartDelta(output_file, file_to_update)
+// p.UpdateDelta(...)
+// p.FinishDelta()
+//
+// # Binary formats
+//
+// All integers are little endian.
+//
+// A signature is a header followed by one BlockHash record per block of the
+// file and, with SignatureIntegrityFlag, a checksum. The header is:
+//
+//	offset  size  field
+//	0       2     version, 0 or 1
+//	2       2     checksum type, 0 is XXH3128Sum
+//	4       2     strong hash type, 0 is XXH3
+//	6       2     weak hash type, 0 is Rsync
+//	8       4     block size in bytes
+//
+// Version 1 headers continue with:
+//
+//	12      4     flags
+//	16      4     size of the extensions section, N
+//	20      N     extensions
+//
+// With SignatureHMACFlag the header ends with a 16 byte random nonce, after
+// the extensions.
+//
+// A BlockHash record is 12 bytes plus the size of the strong hash, which is 8
+// bytes for XXH3, so 20 bytes in total (BlockHashSize):
+//
+//	offset  size  field
+//	0       8     index of the block in the file, the high bit is
+//	              UnchangedBlockFlag in signatures from CreateSignatureLazy()
+//	8       4     weak hash (rolling checksum) of the block
+//	12      8     strong hash of the block
+//
+// With SignatureHMACFlag every record is followed by the first 16 bytes of
+// the HMAC-SHA256 of its 20 bytes, keyed with the HMAC-SHA256 of the complete
+// serialized header, nonce included, keyed with the key passed to
+// WithSignatureHMAC().
+//
+// With SignatureIntegrityFlag the last record is followed by the 16 byte
+// XXH3-128 checksum of all the serialized records, their HMACs included.
+//
+// A delta is a sequence of operations, each starting with a byte for its
+// OpType:
+//
+//	OpBlock           1 + 8 bytes: index of the block
+//	OpBlockRange      1 + 8 + 4 bytes: index of the first block, number of
+//	                  blocks after the first
+//	OpHash            1 + 2 + N bytes: size of the checksum of the whole
+//	                  file, the checksum
+//	OpData            1 + 4 + N bytes: size of the data, the data
+//	OpCompressedData  1 + 4 + N bytes: size of the compressed data, the
+//	                  data as a zstd frame, see WithLiteralCompression()
+//
+// With WithBlockCRC() every operation is followed by the 4 byte CRC32 (IEEE)
+// of its serialized bytes, for OpCompressedData that is the compressed data.
+//
+// # Resuming deltas
+//
+// A delta created with Differ.CreateDeltaWithCheckpoints() has checkpoints
+// every checkpoint_interval operations, at which all data read from the source so far has
+// been written to the delta, so the operations up to a checkpoint reproduce
+// exactly the source up to the offset passed to the checkpoint callback. If
+// sending the delta fails, the sender calls Differ.ResumeCreateDelta() with
+// the offset of the last checkpoint the receiver applied all operations up to,
+// the receiver continues feeding the new operations to the same Patcher. The
+// data before the checkpoint is read from the source again, but only to
+// compute the OpHash checksum of the whole file, which therefore covers both
+// parts of the delta.
+package rsync
@@ -0,0 +1,37 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+// Helpers for testing and benchmarking the rsync algorithm
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+)
+
+var _ = fmt.Print
+
+// Generate size bytes of random data and a copy of it in which the fraction
+// 1 - similarityPct of the blocks of blockSize bytes, chosen at random, are
+// replaced by different random bytes. A final partial block counts as a
+// block. similarityPct is clamped to [0, 1].
+func GenerateSimilarFile(r *rand.Rand, size int64, blockSize int, similarityPct float64) (original, modified []byte) {
+	if blockSize < 1 {
+		panic(fmt.Sprintf("Invalid block size: %d", blockSize))
+	}
+	similarityPct = max(0, min(similarityPct, 1))
+	original = make([]byte, size)
+	r.Read(original)
+	modified = slices.Clone(original)
+	num_blocks := int((size + int64(blockSize) - 1) / int64(blockSize))
+	num_changed := int(float64(num_blocks)*(1-similarityPct) + 0.5)
+	for _, i := range r.Perm(num_blocks)[:num_changed] {
+		block := modified[i*blockSize : min(len(modified), (i+1)*blockSize)]
+		r.Read(block)
+		// make sure the block actually differs from the original
+		if orig := original[i*blockSize:]; block[0] == orig[0] {
+			block[0] ^= byte(1 + r.Intn(255))
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestGenerateSimilarFile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		size              int64
+		block_size        int
+		similarity        float64
+		identical, blocks int
+	}{
+		{1024, 16, 0.8, 51, 64},
+		{1000, 16, 0.5, 31, 63},
+		{1024, 16, 1, 64, 64},
+		{1024, 16, 0, 0, 64},
+		{1024, 16, 2, 64, 64},
+		{0, 16, 0.5, 0, 0},
+	} {
+		original, modified := GenerateSimilarFile(r, tc.size, tc.block_size, tc.similarity)
+		if int64(len(original)) != tc.size || len(modified) != len(original) {
+			t.Fatalf("Incorrect sizes: %d and %d for: %v", len(original), len(modified), tc)
+		}
+		identical, blocks := 0, 0
+		for offset := 0; offset < len(original); offset += tc.block_size {
+			end := min(len(original), offset+tc.block_size)
+			blocks++
+			if bytes.Equal(original[offset:end], modified[offset:end]) {
+				identical++
+			}
+		}
+		if identical != tc.identical || blocks != tc.blocks {
+			t.Fatalf("%d of %d blocks identical for: %v", identical, blocks, tc)
+		}
+	}
+}
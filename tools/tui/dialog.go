@@ -0,0 +1,230 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/utils/style"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const max_dialog_message_width = 60
+
+type ButtonID int
+
+type dialog_button struct {
+	id       ButtonID
+	label    string
+	key      loop.ParsedShortcut
+	callback func()
+	x, width int // position on screen, set when rendered
+}
+
+// A dialog box drawn centered over the rest of the UI. While mounted it
+// traps all input. The region of the dialog is the area it is centered in,
+// defaulting to the whole screen. When dismissed the area it occupied is
+// cleared and the loop re-renders so that the UI underneath can redraw itself.
+type ModalDialog struct {
+	loop.ComponentBase
+
+	title, message     string
+	buttons            []*dialog_button
+	focused            int
+	on_cancel          func()
+	lp                 *loop.Loop
+	box                loop.Rect
+	buttons_y          int
+	cursor_was_visible bool
+}
+
+func NewModalDialog() *ModalDialog { return &ModalDialog{} }
+
+func (self *ModalDialog) SetTitle(s string)   { self.title = s }
+func (self *ModalDialog) SetMessage(s string) { self.message = s }
+
+// Called when the dialog is dismissed by pressing Escape
+func (self *ModalDialog) OnCancel(f func()) { self.on_cancel = f }
+
+// Add a button that can be activated by clicking it, by focusing it and
+// pressing Enter or by pressing key, if key.Key is not empty. Activating the
+// button dismisses the dialog and then calls cb.
+func (self *ModalDialog) AddButton(label string, key loop.KeyEvent, cb func()) ButtonID {
+	b := &dialog_button{id: ButtonID(len(self.buttons)), label: label, callback: cb}
+	b.key = loop.ParsedShortcut{Mods: key.Mods.WithoutLocks(), KeyName: key.Key}
+	self.buttons = append(self.buttons, b)
+	return b.id
+}
+
+// The currently focused button
+func (self *ModalDialog) Focused() ButtonID { return ButtonID(self.focused) }
+
+func (self *ModalDialog) SetFocused(id ButtonID) {
+	if int(id) >= 0 && int(id) < len(self.buttons) {
+		self.focused = int(id)
+	}
+}
+
+func (self *ModalDialog) OnMount(lp *loop.Loop) {
+	self.lp = lp
+	if self.Region().IsEmpty() {
+		if sz, err := lp.ScreenSize(); err == nil {
+			self.SetRegion(loop.Rect{Width: int(sz.WidthCells), Height: int(sz.HeightCells)})
+		}
+	}
+	self.cursor_was_visible = lp.IsCursorVisible()
+	lp.SetCursorVisible(false)
+}
+
+func (self *ModalDialog) OnUnmount(lp *loop.Loop) {
+	if !self.box.IsEmpty() {
+		blank := strings.Repeat(" ", self.box.Width+1)
+		for y := self.box.Y; y <= self.box.Y+self.box.Height; y++ {
+			lp.MoveCursorTo(self.box.X+1, y+1)
+			lp.QueueWriteString(blank)
+		}
+		self.box = loop.Rect{}
+	}
+	lp.SetCursorVisible(self.cursor_was_visible)
+	self.lp = nil
+}
+
+// Remove the dialog from the screen
+func (self *ModalDialog) Dismiss() {
+	if self.lp != nil {
+		self.lp.UnmountComponent(self)
+	}
+}
+
+func (self *ModalDialog) activate(idx int) {
+	self.Dismiss()
+	if cb := self.buttons[idx].callback; cb != nil {
+		cb()
+	}
+}
+
+func (self *ModalDialog) cancel() {
+	self.Dismiss()
+	if self.on_cancel != nil {
+		self.on_cancel()
+	}
+}
+
+func (self *ModalDialog) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	ev.Handled = true
+	for i, b := range self.buttons {
+		if b.key.KeyName != "" && ev.MatchesParsedShortcut(&b.key, loop.PRESS|loop.REPEAT) {
+			self.activate(i)
+			return nil
+		}
+	}
+	switch {
+	case ev.MatchesPressOrRepeat("escape"):
+		self.cancel()
+	case ev.MatchesPressOrRepeat("enter"):
+		if len(self.buttons) > 0 {
+			self.activate(self.focused)
+		}
+	case ev.MatchesPressOrRepeat("tab"), ev.MatchesPressOrRepeat("right"):
+		if len(self.buttons) > 0 {
+			self.focused = (self.focused + 1) % len(self.buttons)
+		}
+	case ev.MatchesPressOrRepeat("shift+tab"), ev.MatchesPressOrRepeat("left"):
+		if len(self.buttons) > 0 {
+			self.focused = (self.focused - 1 + len(self.buttons)) % len(self.buttons)
+		}
+	}
+	return nil
+}
+
+func (self *ModalDialog) HandleText(lp *loop.Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	return true, nil
+}
+
+func (self *ModalDialog) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	if ev.Event_type == loop.MOUSE_CLICK && ev.Buttons&loop.LEFT_MOUSE_BUTTON != 0 && ev.Cell.Y == self.buttons_y {
+		for i, b := range self.buttons {
+			if ev.Cell.X >= b.x && ev.Cell.X < b.x+b.width {
+				self.activate(i)
+				break
+			}
+		}
+	}
+	return true, nil
+}
+
+func (self *ModalDialog) Render(lp *loop.Loop) error {
+	r := self.Region()
+	max_width := min(max_dialog_message_width, r.Width-5)
+	if max_width < 1 {
+		return nil
+	}
+	lines := style.WrapTextAsLines(self.message, max_width, style.WrapOptions{})
+	labels := make([]string, len(self.buttons))
+	buttons_width := 0
+	for i, b := range self.buttons {
+		labels[i] = "[ " + b.label + " ]"
+		buttons_width += wcswidth.Stringwidth(labels[i])
+	}
+	buttons_width += 2 * max(0, len(labels)-1)
+	width := min(max_width, max(wcswidth.Stringwidth(self.title)+2, buttons_width))
+	for _, line := range lines {
+		width = max(width, wcswidth.Stringwidth(line))
+	}
+	self.box = loop.Rect{Width: width + 4, Height: len(lines) + 4}
+	self.box.X = r.X + max(0, (r.Width-self.box.Width-1)/2)
+	self.box.Y = r.Y + max(0, (r.Height-self.box.Height-1)/2)
+	self.buttons_y = self.box.Y + self.box.Height - 2
+
+	draw := func(y int, text string) {
+		lp.MoveCursorTo(self.box.X+1, y+1)
+		lp.QueueWriteString(text)
+	}
+	pad := func(text string, width int) string {
+		text, w := wcswidth.TruncateToVisualLengthWithWidth(text, width)
+		return text + strings.Repeat(" ", width-w)
+	}
+	cs := lp.ColorScheme()
+	border := func(text string) string { return lp.SprintStyled("fg="+cs.Border.AsRGBSharp(), text) }
+	shadow := lp.SprintStyled("fg="+cs.Muted.AsRGBSharp()+" dim", "░")
+	title := ""
+	if self.title != "" {
+		title, _ = wcswidth.TruncateToVisualLengthWithWidth(" "+self.title+" ", width+2)
+	}
+	y := self.box.Y
+	draw(y, border("┌")+title+border(strings.Repeat("─", width+2-wcswidth.Stringwidth(title))+"┐"))
+	side := border("│")
+	for _, line := range lines {
+		y++
+		draw(y, side+" "+pad(line, width)+" "+side+shadow)
+	}
+	y++
+	draw(y, side+" "+strings.Repeat(" ", width)+" "+side+shadow)
+	y++
+	buf := strings.Builder{}
+	x := self.box.X + 2 + max(0, (width-buttons_width)/2)
+	buf.WriteString(strings.Repeat(" ", x-self.box.X-2))
+	for i, b := range self.buttons {
+		if i > 0 {
+			buf.WriteString("  ")
+			x += 2
+		}
+		b.x, b.width = x, wcswidth.Stringwidth(labels[i])
+		x += b.width
+		if i == self.focused {
+			buf.WriteString(lp.SprintStyled("reverse", labels[i]))
+		} else {
+			buf.WriteString(labels[i])
+		}
+	}
+	draw(y, side+" "+buf.String()+strings.Repeat(" ", max(0, width-(x-self.box.X-2)))+" "+side+shadow)
+	y++
+	draw(y, border("└"+strings.Repeat("─", width+2)+"┘")+shadow)
+	lp.MoveCursorTo(self.box.X+2, y+2)
+	lp.QueueWriteString(strings.Repeat(shadow, self.box.Width))
+	return nil
+}
@@ -0,0 +1,47 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestModalDialog(t *testing.T) {
+	lp, _ := loop.New()
+	d := NewModalDialog()
+	d.SetRegion(loop.Rect{Width: 80, Height: 24})
+	activated := ""
+	d.AddButton("Yes", loop.KeyEvent{Key: "y"}, func() { activated = "yes" })
+	d.AddButton("No", loop.KeyEvent{Key: "n"}, func() { activated = "no" })
+	d.OnCancel(func() { activated = "cancel" })
+	press := func(key string) *loop.KeyEvent {
+		ev := &loop.KeyEvent{Type: loop.PRESS, Key: key}
+		lp.MountComponent(d)
+		if err := lp.Components()[0].HandleKeyEvent(lp, ev); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	for key, expected := range map[string]string{"y": "yes", "n": "no", "ESCAPE": "cancel", "ENTER": "yes"} {
+		activated = ""
+		if ev := press(key); !ev.Handled {
+			t.Fatalf("Key event not trapped by dialog: %s", key)
+		}
+		if activated != expected || len(lp.Components()) != 0 {
+			t.Fatalf("Unexpected result for %s: %#v mounted: %d", key, activated, len(lp.Components()))
+		}
+	}
+	activated = ""
+	if ev := press("x"); !ev.Handled || activated != "" || len(lp.Components()) != 1 {
+		t.Fatalf("Unbound key not trapped by dialog")
+	}
+	press("TAB")
+	if d.Focused() != 1 {
+		t.Fatalf("Tab did not move focus: %d", d.Focused())
+	}
+}
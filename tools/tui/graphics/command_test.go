@@ -13,6 +13,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/exp/rand"
+
+	"kitty/tools/wcswidth"
 )
 
 var _ = fmt.Print
@@ -100,3 +102,25 @@ func TestGraphicsCommandSerialization(t *testing.T) {
 	test_chunked_payload([]byte(strings.Repeat("a", 8007)))
 
 }
+
+func TestGraphicsResponseParsing(t *testing.T) {
+	var responses []string
+	p := wcswidth.EscapeCodeParser{HandleAPC: func(raw []byte) error {
+		if gc := GraphicsCommandFromAPC([]byte(wcswidth.ParseAPC(raw).Data)); gc != nil {
+			responses = append(responses, fmt.Sprintf("%d %d %s", gc.ImageId(), gc.PlacementId(), gc.ResponseMessage()))
+		}
+		return nil
+	}}
+	if err := p.ParseString("\x1b_Gi=31;OK\x1b\\x\x1b_Gi=7,p=2;ENOENT:no such image\x1b\\\x1b_Xignored\x1b\\"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"31 0 OK", "7 2 ENOENT:no such image"}, responses); diff != "" {
+		t.Fatalf("Incorrect graphics responses:\n%s", diff)
+	}
+	c := NewImageCollection()
+	c.detection_file_id = 31
+	c.temp_file_map[31] = &temp_resource{}
+	if !c.HandleGraphicsCommand(GraphicsCommandFromAPC([]byte("Gi=31;OK"))) || !c.Files_supported.Load() {
+		t.Fatalf("File transmission support not detected from graphics response")
+	}
+}
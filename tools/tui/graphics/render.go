@@ -0,0 +1,99 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package graphics
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/utils/images"
+)
+
+var _ = fmt.Print
+
+// An opaque handle to an image displayed with RenderImage()
+type ImageID uint32
+
+var ErrGraphicsNotSupported = errors.New("The terminal does not support the kitty graphics protocol")
+
+// Start at a random id to make clashes with images from other programs
+// running in the same terminal unlikely
+var image_id_counter = atomic.Uint32{}
+var image_id_counter_init sync.Once
+
+func next_image_id() uint32 {
+	image_id_counter_init.Do(func() { image_id_counter.Store(rand.Uint32N(1 << 30)) })
+	for {
+		if ans := image_id_counter.Add(1); ans != 0 {
+			return ans
+		}
+	}
+}
+
+// The number of cells needed to display an image of the specified size in
+// pixels, scaled down to fit in max_cols x max_rows preserving its aspect ratio
+func image_size_in_cells(width, height, cell_width, cell_height, max_cols, max_rows int) (cols, rows int) {
+	width, height = images.FitImage(width, height, max_cols*cell_width, max_rows*cell_height)
+	cols, rows = (width+cell_width-1)/cell_width, (height+cell_height-1)/cell_height
+	return max(1, cols), max(1, rows)
+}
+
+// Display img using the kitty graphics protocol with its top left corner at
+// the cell x, y (0, 0 is the top left cell of the screen), scaled down to fit
+// in max_cols x max_rows cells, preserving its aspect ratio. The cursor
+// position is not changed. Returns ErrGraphicsNotSupported if the terminal
+// does not support the graphics protocol or was not identified, which
+// requires LoopConfig.IdentifyTerminal, see Loop.TerminalID(). Must be called
+// from the loop's goroutine while the loop is running.
+func RenderImage(lp *loop.Loop, img image.Image, x, y, max_cols, max_rows int) (ImageID, error) {
+	if max_cols < 1 || max_rows < 1 {
+		return 0, fmt.Errorf("Cannot render an image in a region of %dx%d cells", max_cols, max_rows)
+	}
+	if !lp.TerminalID().SupportsFeature(loop.FEATURE_KITTY_GRAPHICS) {
+		return 0, ErrGraphicsNotSupported
+	}
+	sz, err := lp.ScreenSize()
+	if err != nil {
+		return 0, err
+	}
+	if sz.CellWidth == 0 || sz.CellHeight == 0 {
+		return 0, fmt.Errorf("Cannot render images as the terminal did not report the size of its cells in pixels")
+	}
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return 0, fmt.Errorf("Cannot render an empty image")
+	}
+	cols, rows := image_size_in_cells(b.Dx(), b.Dy(), int(sz.CellWidth), int(sz.CellHeight), max_cols, max_rows)
+	frame := images.ImageFrame{Width: b.Dx(), Height: b.Dy(), Is_opaque: images.IsOpaque(img), Img: img}
+	id := next_image_id()
+	gc := GraphicsCommand{}
+	gc.SetAction(GRT_action_transmit_and_display).SetQuiet(GRT_quiet_silent).SetImageId(id)
+	gc.SetDataWidth(uint64(b.Dx())).SetDataHeight(uint64(b.Dy())).SetColumns(uint64(cols)).SetRows(uint64(rows))
+	gc.SetCursorMovement(GRT_cursor_static)
+	if frame.Is_opaque {
+		gc.SetFormat(GRT_format_rgb)
+	}
+	lp.SaveCursorPosition()
+	lp.MoveCursorTo(x+1, y+1)
+	if err = gc.WriteWithPayloadToLoop(lp, frame.Data()); err != nil {
+		return 0, err
+	}
+	lp.RestoreCursorPosition()
+	return ImageID(id), nil
+}
+
+// Remove an image displayed with RenderImage() from the screen, freeing the
+// memory it uses in the terminal
+func RemoveImage(lp *loop.Loop, id ImageID) error {
+	if id == 0 {
+		return fmt.Errorf("Invalid image id: %d", id)
+	}
+	gc := GraphicsCommand{}
+	gc.SetAction(GRT_action_delete).SetQuiet(GRT_quiet_silent).SetDelete(GRT_free_by_id).SetImageId(uint32(id))
+	return gc.WriteWithPayloadToLoop(lp, nil)
+}
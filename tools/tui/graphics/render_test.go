@@ -0,0 +1,29 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package graphics
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestImageSizeInCells(t *testing.T) {
+	test := func(width, height, max_cols, max_rows, cols, rows int) {
+		t.Helper()
+		ac, ar := image_size_in_cells(width, height, 10, 20, max_cols, max_rows)
+		if diff := cmp.Diff([]int{cols, rows}, []int{ac, ar}); diff != "" {
+			t.Fatalf("Incorrect size in cells for %dx%d in %dx%d cells:\n%s", width, height, max_cols, max_rows, diff)
+		}
+	}
+	test(15, 30, 80, 24, 2, 2)
+	test(1000, 100, 80, 24, 80, 4)
+	test(1000, 1000, 80, 10, 20, 10)
+	test(1, 1, 80, 24, 1, 1)
+	if a, b := next_image_id(), next_image_id(); a == 0 || b == 0 || a == b {
+		t.Fatalf("Invalid image ids: %d %d", a, b)
+	}
+}
@@ -0,0 +1,240 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package layout
+
+import (
+	"fmt"
+	"math"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+// Wrap a component to control how much of the space of a Row or Column it
+// gets. Components that are not wrapped behave as if FlexGrow were one.
+type FlexWidget struct {
+	loop.Component
+	// The share of the space the component gets, relative to the other
+	// children. Zero means the component is always MinSize.
+	FlexGrow float64
+	// The limits on the size of the component, a MaxSize of zero means no
+	// limit
+	MinSize, MaxSize int
+}
+
+func flex_of(c loop.Component) (grow float64, min_size, max_size int) {
+	switch f := c.(type) {
+	case FlexWidget:
+		return max(0, f.FlexGrow), max(0, f.MinSize), f.MaxSize
+	case *FlexWidget:
+		return max(0, f.FlexGrow), max(0, f.MinSize), f.MaxSize
+	}
+	return 1, 0, 0
+}
+
+// Divide size, less the gaps, among the children in proportion to their flex
+// grow factors respecting their minimum and maximum sizes. The sizes add up
+// to the available space unless the limits make that impossible.
+func flex_layout(children []loop.Component, size, gap int) []int {
+	n := len(children)
+	if n == 0 {
+		return nil
+	}
+	available := float64(max(0, size-gap*(n-1)))
+	sizes := make([]float64, n)
+	frozen := make([]bool, n)
+	for {
+		space, total_grow := available, 0.
+		for i, c := range children {
+			if frozen[i] {
+				space -= sizes[i]
+			} else {
+				grow, _, _ := flex_of(c)
+				total_grow += grow
+			}
+		}
+		// freeze the children whose share violates their limits, at the limit
+		violated := false
+		for i, c := range children {
+			if frozen[i] {
+				continue
+			}
+			grow, min_size, max_size := flex_of(c)
+			s := 0.
+			if total_grow > 0 {
+				s = max(0, space) * grow / total_grow
+			}
+			switch {
+			case s < float64(min_size):
+				s, frozen[i], violated = float64(min_size), true, true
+			case max_size > 0 && s > float64(max_size):
+				s, frozen[i], violated = float64(max_size), true, true
+			}
+			sizes[i] = s
+		}
+		if !violated {
+			break
+		}
+	}
+	// round so that the rounded sizes add up to the rounded total
+	ans := make([]int, n)
+	cumulative, prev := 0., 0
+	for i, s := range sizes {
+		cumulative += s
+		r := int(math.Round(cumulative))
+		ans[i], prev = r-prev, r
+	}
+	return ans
+}
+
+type layout_box struct {
+	region loop.Rect
+}
+
+func (self *layout_box) Region() loop.Rect { return self.region }
+
+func (self *layout_box) set_region(r loop.Rect, children []loop.Component, rects []loop.Rect) {
+	self.region = r
+	for i, c := range children {
+		c.SetRegion(loop.Rect{X: r.X + rects[i].X, Y: r.Y + rects[i].Y, Width: rects[i].Width, Height: rects[i].Height})
+	}
+}
+
+// clip the rectangles of children that do not fit
+func clip_rects(rects []loop.Rect, width, height int) []loop.Rect {
+	for i, r := range rects {
+		r.Width = max(0, min(r.Width, width-r.X))
+		r.Height = max(0, min(r.Height, height-r.Y))
+		rects[i] = r
+	}
+	return rects
+}
+
+func render_children(lp *loop.Loop, children []loop.Component) error {
+	for _, c := range children {
+		if err := c.Render(lp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func children_handle_key_event(lp *loop.Loop, ev *loop.KeyEvent, children []loop.Component) error {
+	for _, c := range children {
+		if err := c.HandleKeyEvent(lp, ev); err != nil || ev.Handled {
+			return err
+		}
+	}
+	return nil
+}
+
+func children_handle_text(lp *loop.Loop, text string, from_key_event, in_bracketed_paste bool, children []loop.Component) (bool, error) {
+	for _, c := range children {
+		if consumed, err := c.HandleText(lp, text, from_key_event, in_bracketed_paste); consumed || err != nil {
+			return consumed, err
+		}
+	}
+	return false, nil
+}
+
+func children_handle_mouse_event(lp *loop.Loop, ev *loop.MouseEvent, children []loop.Component) (bool, error) {
+	for _, c := range children {
+		if c.Region().Contains(ev.Cell.X, ev.Cell.Y) {
+			return c.HandleMouseEvent(lp, ev)
+		}
+	}
+	return false, nil
+}
+
+func children_on_mount(lp *loop.Loop, children []loop.Component) {
+	for _, c := range children {
+		if l, ok := c.(loop.ComponentLifecycle); ok {
+			l.OnMount(lp)
+		}
+	}
+}
+
+func children_on_unmount(lp *loop.Loop, children []loop.Component) {
+	for _, c := range children {
+		if l, ok := c.(loop.ComponentLifecycle); ok {
+			l.OnUnmount(lp)
+		}
+	}
+}
+
+// Lay out its children side by side, left to right, with Gap cells between
+// them, dividing the width among them, see FlexWidget. Setting the region of
+// the row sets the regions of its children. Input events are passed to the
+// children in order, mouse events only to the child they are in.
+type Row struct {
+	Children []loop.Component
+	Gap      int
+
+	layout_box
+}
+
+// The rectangles of the children, relative to the top left of the row
+func (self *Row) Layout(width, height int) []loop.Rect {
+	ans := make([]loop.Rect, len(self.Children))
+	x := 0
+	for i, w := range flex_layout(self.Children, width, self.Gap) {
+		ans[i] = loop.Rect{X: x, Width: w, Height: height}
+		x += w + self.Gap
+	}
+	return clip_rects(ans, width, height)
+}
+
+func (self *Row) SetRegion(r loop.Rect) {
+	self.set_region(r, self.Children, self.Layout(r.Width, r.Height))
+}
+
+func (self *Row) Render(lp *loop.Loop) error { return render_children(lp, self.Children) }
+func (self *Row) OnMount(lp *loop.Loop)      { children_on_mount(lp, self.Children) }
+func (self *Row) OnUnmount(lp *loop.Loop)    { children_on_unmount(lp, self.Children) }
+func (self *Row) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	return children_handle_key_event(lp, ev, self.Children)
+}
+func (self *Row) HandleText(lp *loop.Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	return children_handle_text(lp, text, from_key_event, in_bracketed_paste, self.Children)
+}
+func (self *Row) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	return children_handle_mouse_event(lp, ev, self.Children)
+}
+
+// Like Row except that the children are laid out one below the other, top to
+// bottom, dividing the height among them
+type Column struct {
+	Children []loop.Component
+	Gap      int
+
+	layout_box
+}
+
+// The rectangles of the children, relative to the top left of the column
+func (self *Column) Layout(width, height int) []loop.Rect {
+	ans := make([]loop.Rect, len(self.Children))
+	y := 0
+	for i, h := range flex_layout(self.Children, height, self.Gap) {
+		ans[i] = loop.Rect{Y: y, Width: width, Height: h}
+		y += h + self.Gap
+	}
+	return clip_rects(ans, width, height)
+}
+
+func (self *Column) SetRegion(r loop.Rect) {
+	self.set_region(r, self.Children, self.Layout(r.Width, r.Height))
+}
+
+func (self *Column) Render(lp *loop.Loop) error { return render_children(lp, self.Children) }
+func (self *Column) OnMount(lp *loop.Loop)      { children_on_mount(lp, self.Children) }
+func (self *Column) OnUnmount(lp *loop.Loop)    { children_on_unmount(lp, self.Children) }
+func (self *Column) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	return children_handle_key_event(lp, ev, self.Children)
+}
+func (self *Column) HandleText(lp *loop.Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	return children_handle_text(lp, text, from_key_event, in_bracketed_paste, self.Children)
+}
+func (self *Column) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	return children_handle_mouse_event(lp, ev, self.Children)
+}
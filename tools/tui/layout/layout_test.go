@@ -0,0 +1,47 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package layout
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+type test_component struct {
+	loop.ComponentBase
+	clicked bool
+}
+
+func (self *test_component) Render(lp *loop.Loop) error { return nil }
+func (self *test_component) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	self.clicked = true
+	return true, nil
+}
+
+func TestLayout(t *testing.T) {
+	a, b, c := &test_component{}, &test_component{}, &test_component{}
+	row := &Row{Gap: 1, Children: []loop.Component{a, FlexWidget{Component: b, FlexGrow: 2}, &FlexWidget{Component: c, FlexGrow: 0, MinSize: 5}}}
+	if diff := cmp.Diff([]loop.Rect{{Width: 7, Height: 3}, {X: 8, Width: 14, Height: 3}, {X: 23, Width: 5, Height: 3}}, row.Layout(28, 3)); diff != "" {
+		t.Fatalf("Unexpected row layout:\n%s", diff)
+	}
+	col := &Column{Children: []loop.Component{&FlexWidget{Component: a, FlexGrow: 1, MaxSize: 2}, b, c}}
+	col.SetRegion(loop.Rect{X: 1, Y: 2, Width: 10, Height: 9})
+	if diff := cmp.Diff([]loop.Rect{{X: 1, Y: 2, Width: 10, Height: 2}, {X: 1, Y: 4, Width: 10, Height: 4}, {X: 1, Y: 8, Width: 10, Height: 3}}, []loop.Rect{a.Region(), b.Region(), c.Region()}); diff != "" {
+		t.Fatalf("Unexpected column layout:\n%s", diff)
+	}
+	// children that do not fit are clipped
+	row = &Row{Children: []loop.Component{&FlexWidget{Component: a, MinSize: 6}, &FlexWidget{Component: b, MinSize: 6}}}
+	if diff := cmp.Diff([]loop.Rect{{Width: 6, Height: 1}, {X: 6, Width: 4, Height: 1}}, row.Layout(10, 1)); diff != "" {
+		t.Fatalf("Unexpected clipped layout:\n%s", diff)
+	}
+	ev := loop.MouseEvent{Event_type: loop.MOUSE_CLICK, Buttons: loop.LEFT_MOUSE_BUTTON}.WithCell(3, 5)
+	if handled, err := col.HandleMouseEvent(nil, &ev); err != nil || !handled || a.clicked || !b.clicked || c.clicked {
+		t.Fatalf("Mouse event not delivered to the child it is in: %v %v", handled, err)
+	}
+}
@@ -0,0 +1,148 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+// The number of items the mouse wheel scrolls the list by
+const list_wheel_scroll_amount = 3
+
+type ListItem struct {
+	Label string
+	// Arbitrary data associated with the item
+	Data any
+}
+
+// A scrollable list of items, one per row. Only the visible items are
+// rendered, so the list can have very many items.
+type List struct {
+	loop.ComponentBase
+
+	items     []ListItem
+	selected  int
+	top       int
+	on_select func(int, ListItem)
+}
+
+func NewList() *List { return &List{} }
+
+func (self *List) SetItems(items []ListItem) {
+	self.items = items
+	self.selected, self.top = 0, 0
+}
+
+func (self *List) Items() []ListItem { return self.items }
+
+// Called when the user presses Enter on an item or clicks it
+func (self *List) OnSelect(f func(index int, item ListItem)) { self.on_select = f }
+
+// The index of the currently selected item, -1 if the list is empty
+func (self *List) Selected() int {
+	if len(self.items) == 0 {
+		return -1
+	}
+	return self.selected
+}
+
+// Select the item at idx, scrolling it into view
+func (self *List) Select(idx int) {
+	self.selected = max(0, min(idx, len(self.items)-1))
+	page := max(1, self.Region().Height)
+	if self.selected < self.top {
+		self.top = self.selected
+	} else if self.selected >= self.top+page {
+		self.top = self.selected - page + 1
+	}
+}
+
+// Scroll the view by delta rows leaving the selection unchanged
+func (self *List) scroll(delta int) {
+	self.top = max(0, min(self.top+delta, len(self.items)-max(1, self.Region().Height)))
+}
+
+func (self *List) activate(idx int) {
+	if self.on_select != nil {
+		self.on_select(idx, self.items[idx])
+	}
+}
+
+func (self *List) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	if len(self.items) == 0 {
+		return nil
+	}
+	page := max(1, self.Region().Height-1)
+	switch {
+	case ev.MatchesPressOrRepeat("up"):
+		self.Select(self.selected - 1)
+	case ev.MatchesPressOrRepeat("down"):
+		self.Select(self.selected + 1)
+	case ev.MatchesPressOrRepeat("page_up"):
+		self.Select(self.selected - page)
+	case ev.MatchesPressOrRepeat("page_down"):
+		self.Select(self.selected + page)
+	case ev.MatchesPressOrRepeat("home"):
+		self.Select(0)
+	case ev.MatchesPressOrRepeat("end"):
+		self.Select(len(self.items) - 1)
+	case ev.MatchesPressOrRepeat("enter"):
+		self.activate(self.selected)
+	default:
+		return nil
+	}
+	ev.Handled = true
+	return nil
+}
+
+func (self *List) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	r := self.Region()
+	switch {
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_UP != 0:
+		self.scroll(-list_wheel_scroll_amount)
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_DOWN != 0:
+		self.scroll(list_wheel_scroll_amount)
+	case ev.Event_type == loop.MOUSE_CLICK && ev.Buttons&loop.LEFT_MOUSE_BUTTON != 0:
+		idx := self.top + ev.TranslateToCellOrigin(r.X, r.Y).Cell.Y
+		if idx >= len(self.items) {
+			return false, nil
+		}
+		self.Select(idx)
+		self.activate(idx)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (self *List) Render(lp *loop.Loop) error {
+	r := self.Region()
+	if r.IsEmpty() {
+		return nil
+	}
+	// the region may have shrunk since the selection was last changed
+	self.top = max(0, min(self.top, len(self.items)-r.Height))
+	buf := strings.Builder{}
+	for y := 0; y < r.Height; y++ {
+		buf.WriteString(fmt.Sprintf(loop.MoveCursorToTemplate, r.Y+y+1, r.X+1))
+		text := ""
+		idx := self.top + y
+		if idx < len(self.items) {
+			text = self.items[idx].Label
+		}
+		text, w := wcswidth.TruncateToVisualLengthWithWidth(text, r.Width)
+		text += strings.Repeat(" ", r.Width-w)
+		if idx == self.selected && idx < len(self.items) {
+			text = lp.SprintStyled("reverse", text)
+		}
+		buf.WriteString(text)
+	}
+	lp.QueueWriteString(buf.String())
+	return nil
+}
@@ -0,0 +1,65 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestList(t *testing.T) {
+	l := NewList()
+	l.SetRegion(loop.Rect{Width: 20, Height: 10})
+	items := make([]ListItem, 100000)
+	for i := range items {
+		items[i] = ListItem{Label: fmt.Sprint("item ", i), Data: i}
+	}
+	l.SetItems(items)
+	press := func(keys ...string) {
+		for _, key := range keys {
+			if err := l.HandleKeyEvent(nil, &loop.KeyEvent{Type: loop.PRESS, Key: key}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	test := func(selected, top int) {
+		t.Helper()
+		if l.Selected() != selected || l.top != top {
+			t.Fatalf("Unexpected selection: %d top: %d expected %d %d", l.Selected(), l.top, selected, top)
+		}
+	}
+	press("DOWN", "PAGE_DOWN")
+	test(10, 1)
+	press("END")
+	test(99999, 99990)
+	press("UP", "HOME")
+	test(0, 0)
+	mouse := func(event_type loop.MouseEventType, button loop.MouseButtonFlag, y int) {
+		ev := loop.MouseEvent{Event_type: event_type, Buttons: button}.WithCell(0, y)
+		if _, err := l.HandleMouseEvent(nil, &ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mouse(loop.MOUSE_PRESS, loop.MOUSE_WHEEL_DOWN, 0)
+	mouse(loop.MOUSE_PRESS, loop.MOUSE_WHEEL_UP, 0)
+	mouse(loop.MOUSE_PRESS, loop.MOUSE_WHEEL_DOWN, 0)
+	test(0, 3)
+	var selected ListItem
+	l.OnSelect(func(idx int, item ListItem) { selected = item })
+	mouse(loop.MOUSE_CLICK, loop.LEFT_MOUSE_BUTTON, 2)
+	test(5, 3)
+	if selected.Data != 5 {
+		t.Fatalf("Clicking did not select: %#v", selected)
+	}
+	press("ENTER")
+	if selected.Label != "item 5" {
+		t.Fatalf("Enter did not select: %#v", selected)
+	}
+	l.SetItems(nil)
+	press("DOWN")
+	test(-1, 0)
+}
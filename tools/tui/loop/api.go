@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
 	"strings"
@@ -24,6 +25,19 @@ type ScreenSize struct {
 	updated                                                           bool
 }
 
+// The size without the internal updated flag, so that the sizes given to
+// callers compare equal if and only if their dimensions are equal
+func (self ScreenSize) without_flags() ScreenSize {
+	self.updated = false
+	return self
+}
+
+// Whether all the dimensions are known, they are zero before the screen size
+// has been read from the terminal or when the terminal does not report them
+func (self ScreenSize) IsValid() bool {
+	return self.WidthCells > 0 && self.HeightCells > 0 && self.WidthPx > 0 && self.HeightPx > 0 && self.CellWidth > 0 && self.CellHeight > 0
+}
+
 type IdType uint64
 type TimerCallback func(timer_id IdType) error
 type EscapeCodeType int
@@ -37,25 +51,107 @@ const (
 	PM
 )
 
+func (self EscapeCodeType) String() string {
+	switch self {
+	case CSI:
+		return "CSI"
+	case DCS:
+		return "DCS"
+	case OSC:
+		return "OSC"
+	case APC:
+		return "APC"
+	case SOS:
+		return "SOS"
+	case PM:
+		return "PM"
+	}
+	return fmt.Sprintf("EscapeCodeType(%d)", int(self))
+}
+
 type Loop struct {
 	controlling_term                       *tty.Term
 	terminal_options                       TerminalStateOptions
-	screen_size                            ScreenSize
+	screen_size, previous_screen_size      ScreenSize
 	escape_code_parser                     wcswidth.EscapeCodeParser
 	keep_going                             bool
 	death_signal                           unix.Signal
+	signal_to_reraise                      unix.Signal
 	exit_code                              int
 	timers, timers_temp                    []*timer
 	timer_id_counter, write_msg_id_counter IdType
 	wakeup_channel                         chan byte
 	pending_writes                         []write_msg
 	tty_write_channel                      chan write_msg
-	pending_mouse_events                   *utils.RingBuffer[MouseEvent]
+	mouse_state_machine                    MouseStateMachine
+	write_rate                             WriteRateMonitor
+	event_stats                            event_stats
+	tracer                                 event_tracer
+	profiler                               profiler_state
+	pending_escape_timer                   IdType
+	render_profiler                        RenderProfiler
+	terminal_state                         TerminalState
+	logger                                 *slog.Logger
 	on_SIGTSTP                             func() error
 	style_cache                            map[string]func(...any) string
 	style_ctx                              style.Context
 	atomic_update_active                   bool
 	pointer_shapes                         []PointerShape
+	stats                                  loop_stats
+	render_requested                       bool
+	render_in_progress                     bool
+	cursor_visible                         bool
+	cursor_blink                           CursorBlinkMode
+	components                             []Component
+	clipboard_timeout                      time.Duration
+	clipboard_request                      *clipboard_request
+	clipboard_history                      []string
+	clipboard_history_size                 int
+	wait_for_response                      func(query string, timeout time.Duration, is_done func() bool) error
+	queried_cell_width                     uint
+	queried_cell_height                    uint
+	startup_queries                        []terminal_query
+	startup_input                          []byte
+	notification_support                   notification_support
+	notification_id_counter                uint
+	pending_notifications                  []pending_notification
+	color_scheme                           ColorScheme
+	system_color_schemes                   *[2]ColorScheme
+	color_scheme_preference                ColorSchemePreference
+	portal_color_scheme                    chan ColorSchemePreference
+	synchronized_update_support            mode_support
+	kitty_keyboard_support                 mode_support
+	paste_sanitizer                        wcswidth.EscapeCodeParser
+	xtwinops_support                       mode_support
+	xtwinops_reported                      bool
+	paste                                  paste_state
+	input_rate                             input_rate
+	render_hooks                           []render_hook
+	render_hook_id_counter                 HookID
+	synchronized_render_in_progress        bool
+	subscriptions                          []subscription
+	subscription_id_counter                IdType
+	focusables                             []focusable
+	focused                                Focusable
+	macros                                 map[IdType][]recorded_key_event
+	macro_recording                        *macro_recording
+	macro_id_counter                       IdType
+	macro_playing                          bool
+	scrollback                             scrollback
+	osc_terminated_by_bel                  bool
+	hot_zones                              []hot_zone
+	hot_zone_id_counter, active_hot_zone   IdType
+	mouse_emulation                        *mouse_emulation
+	compose_state                          *ComposeState
+	cursor_style                           *CursorStyle
+	saved_terminal_state                   saved_terminal_state
+	posted_events                          posted_events
+	typed_handlers                         []typed_event_handler
+	paste_normalizer                       paste_normalizer
+	pending_ime_commit                     []byte
+
+	// Settings controlling the behavior of the loop
+	Config LoopConfig
 
 	// Suspend the loop restoring terminal state, and run the provided function. When it returns terminal state is
 	// put back to what it was before suspending unless the function returns an error or an error occurs saving/restoring state.
@@ -71,6 +167,10 @@ type Loop struct {
 	// shutdown
 	OnFinalize func() string
 
+	// Called after input events, timers and wakeups have been dispatched, to
+	// redraw the screen. Time taken by this callback is reported in Stats()
+	OnRender func() error
+
 	// Called when a key event happens
 	OnKeyEvent func(event *KeyEvent) error
 
@@ -78,24 +178,41 @@ type Loop struct {
 	OnMouseEvent func(event *MouseEvent) error
 
 	// Called when text is received either from a key event or directly from the terminal
-	// Called with an empty string when bracketed paste ends
+	// Called with an empty string when bracketed paste ends. Text committed
+	// by an input method is typed text, so from_key_event is true for it,
+	// see OnIMEEvent.
 	OnText func(text string, from_key_event bool, in_bracketed_paste bool) error
 
-	// Called when the terminal is resized
+	// Called when the terminal is resized, with the size before and after the
+	// resize, see also PreviousScreenSize()
 	OnResize func(old_size ScreenSize, new_size ScreenSize) error
 
 	// Called when writing is done
 	OnWriteComplete func(msg_id IdType, has_pending_writes bool) error
 
+	// Called when the output waiting to be written to the terminal exceeds
+	// LoopConfig.WriteBackpressureThreshold, for example, over a slow network
+	// connection. Not called again until the pending output has fallen below
+	// the threshold. Applications can reduce the amount of output they
+	// generate, by disabling animations, for instance.
+	OnWriteBackpressure func(bytes_pending int, lag time.Duration) error
+
 	// Called when a response to an rc command is received
 	OnRCResponse func(data []byte) error
 
 	// Called when a response to a query command is received
 	OnQueryResponse func(key, val string, valid bool) error
 
+	// Called when the user clicks on or closes a notification shown with ShowNotification()
+	OnNotification func(event NotificationEvent) error
+
 	// Called when any input from tty is received
 	OnReceivedData func(data []byte) error
 
+	// Called when an input method commits text, before the text is delivered
+	// as typed text, to OnText with from_key_event true, see IMEEvent
+	OnIMEEvent func(ev IMEEvent) error
+
 	// Called when an escape code is received that is not handled by any other handler
 	OnEscapeCode func(EscapeCodeType, []byte) error
 
@@ -105,6 +222,18 @@ type Loop struct {
 	// Called when main loop is woken up
 	OnWakeup func() error
 
+	// Called with the events posted with PostEvent(), in the order they were
+	// posted, before OnWakeup. Not called for events handled by a handler
+	// registered with RegisterTypedHandler().
+	OnPostedEvent func(ev PostedEvent) error
+
+	// Called when there is no input waiting to be processed, for doing work
+	// incrementally without threads. budget is how long the callback can
+	// run before the next timer is due. Return true if more work remains,
+	// to have it called again once any input that arrived meanwhile has been
+	// processed.
+	OnIdle func(budget time.Duration) (more_work bool, err error)
+
 	// Called on SIGINT return true if you wish to handle it yourself
 	OnSIGINT func() (bool, error)
 
@@ -204,10 +333,23 @@ func (self *Loop) DeathSignalName() string {
 
 func (self *Loop) ScreenSize() (ScreenSize, error) {
 	if self.screen_size.updated {
-		return self.screen_size, nil
+		return self.screen_size.without_flags(), nil
 	}
 	err := self.update_screen_size()
-	return self.screen_size, err
+	return self.screen_size.without_flags(), err
+}
+
+// The size of the screen, zero if it cannot be read from the terminal. Can be
+// called from any callback, in OnResize it is the new size.
+func (self *Loop) CurrentScreenSize() ScreenSize {
+	sz, _ := self.ScreenSize()
+	return sz
+}
+
+// The size of the screen before the last resize, zero before the first
+// resize
+func (self *Loop) PreviousScreenSize() ScreenSize {
+	return self.previous_screen_size
 }
 
 func (self *Loop) KillIfSignalled() {
@@ -282,6 +424,9 @@ func (self *Loop) DebugPrintln(args ...any) {
 }
 
 func (self *Loop) Run() (err error) {
+	if err = self.Config.Validate(); err != nil {
+		return err
+	}
 	defer func() {
 		if r := recover(); r != nil {
 			pcs := make([]uintptr, 256)
@@ -299,6 +444,7 @@ func (self *Loop) Run() (err error) {
 				}
 				fmt.Fprintf(os.Stderr, "%s\r\n\t%s:%d\r\n", frame.Function, frame.File, frame.Line)
 			}
+			self.write_trace(os.Stderr)
 			if self.terminal_options.Alternate_screen {
 				term, err := tty.OpenControllingTerm(tty.SetRaw)
 				if err == nil {
@@ -310,7 +456,10 @@ func (self *Loop) Run() (err error) {
 			}
 		}
 	}()
-	return self.run()
+	err = self.run()
+	self.log_stop(err)
+	self.reraise_signal()
+	return err
 }
 
 func (self *Loop) WakeupMainThread() bool {
@@ -370,10 +519,17 @@ func (self *Loop) EndAtomicUpdate() {
 }
 
 func (self *Loop) SetCursorShape(shape CursorShapes, blink bool) {
+	self.cursor_style = &CursorStyle{Shape: shape, Blink: blink}
 	self.QueueWriteString(CursorShape(shape, blink))
 }
 
+// Show or hide the text cursor. Does nothing if the cursor is already in the
+// requested state. The cursor is always made visible when the loop exits.
 func (self *Loop) SetCursorVisible(visible bool) {
+	if visible == self.cursor_visible {
+		return
+	}
+	self.cursor_visible = visible
 	if visible {
 		self.QueueWriteString(DECTCEM.EscapeCodeToSet())
 	} else {
@@ -381,6 +537,40 @@ func (self *Loop) SetCursorVisible(visible bool) {
 	}
 }
 
+func (self *Loop) IsCursorVisible() bool { return self.cursor_visible }
+
+// Make the text cursor blink or stay steady. The terminal's own preference is
+// restored when the loop exits.
+func (self *Loop) SetCursorBlink(blink bool) {
+	if blink {
+		self.SetCursorBlinkMode(CURSOR_BLINKING)
+	} else {
+		self.SetCursorBlinkMode(CURSOR_STEADY)
+	}
+}
+
+// Set whether the text cursor blinks, does nothing if it is already in the
+// requested mode. Uses XTSAVE/XTRESTORE to return to CURSOR_BLINK_DEFAULT.
+func (self *Loop) SetCursorBlinkMode(mode CursorBlinkMode) {
+	if mode == self.cursor_blink {
+		return
+	}
+	if self.cursor_blink == CURSOR_BLINK_DEFAULT {
+		self.QueueWriteString(ATT610_BLINK.escape_code("s"))
+	}
+	self.cursor_blink = mode
+	switch mode {
+	case CURSOR_BLINKING:
+		self.QueueWriteString(ATT610_BLINK.EscapeCodeToSet())
+	case CURSOR_STEADY:
+		self.QueueWriteString(ATT610_BLINK.EscapeCodeToReset())
+	default:
+		self.QueueWriteString(ATT610_BLINK.escape_code("r"))
+	}
+}
+
+func (self *Loop) CursorBlinkMode() CursorBlinkMode { return self.cursor_blink }
+
 const MoveCursorToTemplate = "\x1b[%d;%dH"
 
 func (self *Loop) MoveCursorTo(x, y int) { // 1, 1 is top left
@@ -419,6 +609,39 @@ func (self *Loop) ClearToEndOfLine() {
 	self.QueueWriteString("\x1b[K")
 }
 
+// Restrict scrolling to the rows from top_row to bottom_row inclusive, 1 is
+// the top row. Moves the cursor to the top left of the screen. The scrolling
+// region is always reset when the loop exits.
+func (self *Loop) SetScrollingRegion(top_row, bottom_row int) error {
+	if top_row < 1 || bottom_row <= top_row {
+		return fmt.Errorf("Invalid scrolling region: %d to %d", top_row, bottom_row)
+	}
+	if sz, err := self.ScreenSize(); err == nil && sz.HeightCells > 0 && bottom_row > int(sz.HeightCells) {
+		return fmt.Errorf("Scrolling region bottom row: %d is larger than the screen height: %d", bottom_row, sz.HeightCells)
+	}
+	self.QueueWriteString(fmt.Sprintf("\x1b[%d;%dr", top_row, bottom_row))
+	return nil
+}
+
+// Make the entire screen scroll. Moves the cursor to the top left of the screen.
+func (self *Loop) ResetScrollingRegion() {
+	self.QueueWriteString(RESET_SCROLLING_REGION)
+}
+
+// Scroll the contents of the current scrolling region up by n lines (SU)
+func (self *Loop) ScrollUp(n int) {
+	if n > 0 {
+		self.QueueWriteString(fmt.Sprintf("\x1b[%dS", n))
+	}
+}
+
+// Scroll the contents of the current scrolling region down by n lines (SD)
+func (self *Loop) ScrollDown(n int) {
+	if n > 0 {
+		self.QueueWriteString(fmt.Sprintf("\x1b[%dT", n))
+	}
+}
+
 func (self *Loop) StartBracketedPaste() {
 	self.QueueWriteString(BRACKETED_PASTE.EscapeCodeToSet())
 }
@@ -437,11 +660,11 @@ func (self *Loop) AllowLineWrapping(allow bool) {
 
 func EscapeCodeToSetWindowTitle(title string) string {
 	title = wcswidth.StripEscapeCodes(title)
-	return "\033]2;" + title + "\033\\"
+	return NewOSCBuilder(2).Param(title).Terminate(ST_TERMINATOR)
 }
 
 func (self *Loop) SetWindowTitle(title string) {
-	self.QueueWriteString(EscapeCodeToSetWindowTitle(title))
+	self.QueueWriteString(NewOSCBuilder(2).Param(wcswidth.StripEscapeCodes(title)).Terminate(self.OSCTerminatorStyle()))
 }
 
 func (self *Loop) ClearScreen() {
@@ -461,6 +684,32 @@ func (self *Loop) Quit(exit_code int) {
 	self.keep_going = false
 }
 
+// Re-initialize the terminal state, for use after running some other program
+// that left the terminal in a bad state, for example, by exiting without
+// turning off raw mode or mouse tracking. Puts the tty back into raw mode,
+// re-sends the escape codes used to setup the terminal when the loop was
+// started, restores the visibility of the cursor and the stack of pointer
+// shapes and requests a full redraw.
+// As the other program might have been running while the terminal was
+// resized, OnResize is called with the current screen size. Unlike
+// SuspendAndRun() this does not rely on the other program to restore any
+// state. Must be called in the loop goroutine.
+func (self *Loop) SoftRestart() error {
+	if self.controlling_term == nil {
+		return fmt.Errorf("Cannot soft restart a loop that is not running")
+	}
+	if err := self.controlling_term.ApplyOperations(tty.TCSANOW, tty.SetRaw); err != nil {
+		return err
+	}
+	self.escape_code_parser.Reset()
+	self.atomic_update_active = false
+	self.QueueWriteString(self.terminal_options.ReapplyStateEscapeCodes())
+	self.restore_cursor_visibility(self.cursor_visible)
+	self.set_pointer_shapes(self.ClearPointerShapes())
+	self.render_requested = true
+	return self.on_SIGWINCH()
+}
+
 type DefaultColor int
 
 const (
@@ -486,6 +735,7 @@ func (self *Loop) CopyTextToPrimarySelection(text string) {
 }
 
 func (self *Loop) CopyTextToClipboard(text string) {
+	self.add_to_clipboard_history(text)
 	self.copy_text_to(text, "c")
 }
 
@@ -500,11 +750,40 @@ func (self *Loop) QueryTerminal(fields ...string) IdType {
 	return self.QueueWriteString(fmt.Sprintf("\x1bP+q%s\a", strings.Join(q, ";")))
 }
 
+// Send query to the terminal and wait for the response, processing input from
+// the terminal and dispatching events as usual, until is_done returns true.
+// Returns os.ErrDeadlineExceeded if is_done does not return true before the
+// timeout. Must be called from the loop's goroutine while the loop is running.
+func (self *Loop) SendQueryAndWait(query string, timeout time.Duration, is_done func() bool) error {
+	if self.wait_for_response == nil {
+		return fmt.Errorf("Cannot wait for a response from the terminal when the loop is not running")
+	}
+	return self.wait_for_response(query, timeout, is_done)
+}
+
 func (self *Loop) PushPointerShape(s PointerShape) {
 	self.pointer_shapes = append(self.pointer_shapes, s)
 	self.QueueWriteString("\x1b]22;" + s.String() + "\x1b\\")
 }
 
+// Whether the terminal can display the pointer shape, false if the terminal
+// was not identified, see TerminalID()
+func (self *Loop) IsPointerShapeSupported(s PointerShape) bool {
+	return self.TerminalID().SupportsPointerShape(s)
+}
+
+// Push the first of shapes that the terminal supports onto the shape stack,
+// or the default shape if it supports none of them
+func (self *Loop) SetPointerShapeWithFallback(shapes ...PointerShape) {
+	for _, s := range shapes {
+		if self.IsPointerShapeSupported(s) {
+			self.PushPointerShape(s)
+			return
+		}
+	}
+	self.PushPointerShape(DEFAULT_POINTER)
+}
+
 func (self *Loop) PopPointerShape() {
 	if len(self.pointer_shapes) > 0 {
 		self.pointer_shapes = self.pointer_shapes[:len(self.pointer_shapes)-1]
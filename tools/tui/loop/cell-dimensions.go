@@ -0,0 +1,86 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kitty/tools/tty"
+)
+
+var _ = fmt.Print
+
+// The cell size in pixels used when the terminal does not report it
+const default_cell_width, default_cell_height = 10, 20
+
+var ErrCellDimensionsNotReported = errors.New("The terminal did not report its cell dimensions")
+
+func cell_dimensions_query(width_px, height_px *int) terminal_query {
+	return terminal_query{query: "\x1b[16t", csi: func(raw []byte) bool {
+		csi := string(raw)
+		if !strings.HasPrefix(csi, "6;") || !strings.HasSuffix(csi, "t") {
+			return false
+		}
+		parts := strings.Split(csi[2:len(csi)-1], ";")
+		if len(parts) == 2 {
+			ch, herr := strconv.Atoi(parts[0])
+			cw, werr := strconv.Atoi(parts[1])
+			if herr == nil && werr == nil && cw > 0 && ch > 0 {
+				*width_px, *height_px = cw, ch
+			}
+		}
+		return true
+	}}
+}
+
+// Query the terminal for the size of a cell in pixels using XTWINOPS (CSI 16 t).
+// A primary device attributes query is sent after it, which all terminals
+// respond to, so that this does not wait forever with terminals that do not
+// support XTWINOPS. Any other input read from r is discarded.
+func QueryCellDimensions(w io.Writer, r io.Reader) (width_px, height_px int, err error) {
+	if _, err = run_terminal_queries(w, r, cell_dimensions_query(&width_px, &height_px)); err != nil {
+		return 0, 0, err
+	}
+	if width_px == 0 {
+		return 0, 0, ErrCellDimensionsNotReported
+	}
+	return
+}
+
+type tty_reader_with_deadline struct {
+	term     *tty.Term
+	deadline time.Time
+}
+
+func (self *tty_reader_with_deadline) Read(b []byte) (int, error) {
+	timeout := time.Until(self.deadline)
+	if timeout <= 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return self.term.ReadWithTimeout(b, timeout)
+}
+
+// Whether to query the cell dimensions from the terminal, which is needed when
+// the kernel does not know the size of the screen in pixels, as happens over
+// some serial and remote connections
+func (self *Loop) needs_cell_dimensions() bool {
+	ws, err := self.controlling_term.GetSize()
+	return err == nil && (ws.Xpixel == 0 || ws.Ypixel == 0)
+}
+
+// Use the cell dimensions reported by the terminal. If the terminal did not
+// report them, a typical cell size is assumed, so that pixel positions can
+// still be converted to cells.
+func (self *Loop) set_queried_cell_dimensions(width_px, height_px int) {
+	if width_px > 0 && height_px > 0 {
+		self.queried_cell_width, self.queried_cell_height = uint(width_px), uint(height_px)
+	} else {
+		self.queried_cell_width, self.queried_cell_height = default_cell_width, default_cell_height
+	}
+}
@@ -0,0 +1,55 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+func TestAssumedCellDimensions(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		// the kernel does not know the pixel size of the screen
+		if err := unix.IoctlSetWinsize(int(os.Stdin.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Col: 80, Row: 24}); err != nil {
+			write_pty_test_result(output, err.Error())
+			return
+		}
+		lp, _ := New(NoAlternateScreen)
+		results := []string{}
+		lp.OnInitialize = func() (string, error) {
+			sz, err := lp.ScreenSize()
+			results = append(results, fmt.Sprintf("%dx%d px: %dx%d cell: %dx%d", sz.WidthCells, sz.HeightCells, sz.WidthPx, sz.HeightPx, sz.CellWidth, sz.CellHeight))
+			lp.Quit(0)
+			return "", err
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v %v", results, err))
+	}
+	result := run_test_in_pty(t, "TestAssumedCellDimensions", func(master *os.File) {
+		buf, received := make([]byte, 4096), []byte{}
+		for !bytes.HasSuffix(received, []byte("\x1b[c")) {
+			n, err := master.Read(buf)
+			if err != nil {
+				return
+			}
+			received = append(received, buf[:n]...)
+		}
+		// respond to the primary device attributes query without reporting
+		// the cell size
+		master.WriteString("\x1b[?62;4c")
+		for {
+			if _, err := master.Read(buf); err != nil {
+				return
+			}
+		}
+	})
+	if result != "[80x24 px: 800x480 cell: 10x20] <nil>" {
+		t.Fatalf("The default cell size was not used: %s", result)
+	}
+}
@@ -0,0 +1,38 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestQueryCellDimensions(t *testing.T) {
+	w := strings.Builder{}
+	cw, ch, err := QueryCellDimensions(&w, strings.NewReader("a\x1b[6;20;10t\x1b[?62;22c"))
+	if err != nil || cw != 10 || ch != 20 {
+		t.Fatalf("Failed to parse cell dimensions: %d %d %v", cw, ch, err)
+	}
+	if w.String() != "\x1b[16t\x1b[c" {
+		t.Fatalf("Unexpected query: %#v", w.String())
+	}
+	if _, _, err = QueryCellDimensions(&w, strings.NewReader("\x1b[?62;22c")); err != ErrCellDimensionsNotReported {
+		t.Fatalf("Unexpected error when cell dimensions not reported: %v", err)
+	}
+	if _, _, err = QueryCellDimensions(&w, strings.NewReader("\x1b[6;20;10t")); err == nil {
+		t.Fatalf("No error when terminal did not respond fully")
+	}
+}
+
+func TestQueriedCellDimensions(t *testing.T) {
+	lp, _ := New()
+	for _, c := range [][4]int{{9, 18, 9, 18}, {0, 0, 10, 20}, {9, 0, 10, 20}, {-1, 18, 10, 20}} {
+		lp.set_queried_cell_dimensions(c[0], c[1])
+		if lp.queried_cell_width != uint(c[2]) || lp.queried_cell_height != uint(c[3]) {
+			t.Fatalf("Unexpected cell dimensions for %dx%d: %dx%d", c[0], c[1], lp.queried_cell_width, lp.queried_cell_height)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+var _ = fmt.Print
+
+const default_clipboard_timeout = 2 * time.Second
+
+// Returned by GetClipboard() when the terminal does not respond to the OSC 52
+// read request. Many terminals do not support reading the clipboard or disable
+// it in their security settings, for example, kitty's clipboard_control option.
+var ErrClipboardUnavailable = errors.New("The terminal did not respond to the request to read the clipboard. It may not support OSC 52 or clipboard access may be disabled in its security settings")
+
+type clipboard_request struct {
+	done bool
+	data []byte
+	err  error
+}
+
+// Set the maximum time GetClipboard() waits for a response from the
+// terminal, defaults to two seconds
+func (self *Loop) ClipboardTimeout(timeout time.Duration) *Loop {
+	self.clipboard_timeout = timeout
+	return self
+}
+
+// Set the contents of the clipboard using OSC 52. This works only with
+// terminals that support OSC 52 and have not disabled clipboard writing in
+// their security settings. There is no way to detect if the write succeeded.
+func (self *Loop) SetClipboard(text string) error {
+	self.CopyTextToClipboard(text)
+	return nil
+}
+
+// Read the contents of the clipboard using OSC 52, waiting for the terminal to
+// respond. Input events that arrive while waiting are dispatched as usual.
+// Must be called from the loop's goroutine while the loop is running.
+// Returns ErrClipboardUnavailable if the terminal does not respond in time,
+// which is what happens when OSC 52 clipboard reading is not supported or is
+// disabled by the terminal's security settings.
+func (self *Loop) GetClipboard() (string, error) {
+	if self.clipboard_request != nil {
+		return "", fmt.Errorf("Cannot read the clipboard while already waiting for the clipboard contents")
+	}
+	req := &clipboard_request{}
+	self.clipboard_request = req
+	defer func() { self.clipboard_request = nil }()
+	if err := self.SendQueryAndWait("\x1b]52;c;?\x1b\\", self.clipboard_timeout, func() bool { return req.done }); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = ErrClipboardUnavailable
+		}
+		return "", err
+	}
+	return string(req.data), req.err
+}
+
+// Parse the payload of an OSC 52 response of the form 52;c;<base64 data>
+func parse_clipboard_response(raw []byte) ([]byte, error) {
+	_, payload, found := bytes.Cut(raw[len("52;"):], []byte{';'})
+	if !found {
+		return nil, fmt.Errorf("Invalid OSC 52 response from the terminal: %#v", string(raw))
+	}
+	ans, err := base64.StdEncoding.DecodeString(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base64 encoded clipboard data from the terminal: %w", err)
+	}
+	return ans, nil
+}
+
+func (self *Loop) handle_clipboard_response(raw []byte) bool {
+	if self.clipboard_request == nil || !bytes.HasPrefix(raw, []byte("52;")) {
+		return false
+	}
+	self.clipboard_request.data, self.clipboard_request.err = parse_clipboard_response(raw)
+	self.clipboard_request.done = true
+	return true
+}
+
+// Remember the last max_entries texts copied to the clipboard with
+// SetClipboard() or CopyTextToClipboard(), for ClipboardHistory() and
+// PasteFromHistory(). Copying the same text as the last entry does not add a
+// new entry. Zero or less disables the history, discarding it.
+func (self *Loop) EnableClipboardHistory(max_entries int) {
+	self.clipboard_history_size = max(0, max_entries)
+	if len(self.clipboard_history) > self.clipboard_history_size {
+		self.clipboard_history = self.clipboard_history[:self.clipboard_history_size]
+	}
+}
+
+// The texts copied to the clipboard, newest first, see EnableClipboardHistory()
+func (self *Loop) ClipboardHistory() []string {
+	return slices.Clone(self.clipboard_history)
+}
+
+func (self *Loop) add_to_clipboard_history(text string) {
+	if self.clipboard_history_size == 0 || (len(self.clipboard_history) > 0 && self.clipboard_history[0] == text) {
+		return
+	}
+	if len(self.clipboard_history) == self.clipboard_history_size {
+		self.clipboard_history = self.clipboard_history[:len(self.clipboard_history)-1]
+	}
+	self.clipboard_history = slices.Insert(self.clipboard_history, 0, text)
+}
+
+// Deliver the entry at index in ClipboardHistory() as if it had been pasted,
+// that is as bracketed paste text followed by the end of the paste
+func (self *Loop) PasteFromHistory(index int) error {
+	if index < 0 || index >= len(self.clipboard_history) {
+		return fmt.Errorf("No clipboard history entry at index %d, the history has %d entries", index, len(self.clipboard_history))
+	}
+	self.record_event(paste_event, "history_index", index)
+	self.stats.event_received(self.OnText != nil || len(self.components) > 0)
+	if err := self.dispatch_text(self.clipboard_history[index], false, true); err != nil {
+		return err
+	}
+	return self.dispatch_text("", false, false)
+}
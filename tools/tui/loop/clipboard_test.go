@@ -0,0 +1,62 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestClipboardResponse(t *testing.T) {
+	lp, _ := New()
+	if lp.handle_clipboard_response([]byte("52;c;aGVsbG8=")) {
+		t.Fatalf("Clipboard response handled when not waiting for one")
+	}
+	lp.clipboard_request = &clipboard_request{}
+	if !lp.handle_clipboard_response([]byte("52;c;aGVsbG8=")) || !lp.clipboard_request.done {
+		t.Fatalf("Clipboard response not handled")
+	}
+	if diff := cmp.Diff("hello", string(lp.clipboard_request.data)); diff != "" || lp.clipboard_request.err != nil {
+		t.Fatalf("Failed to parse clipboard response: %v\n%s", lp.clipboard_request.err, diff)
+	}
+	if _, err := parse_clipboard_response([]byte("52;c;!!")); err == nil {
+		t.Fatalf("Invalid clipboard data did not cause an error")
+	}
+	if _, err := lp.GetClipboard(); err == nil {
+		t.Fatalf("Reading the clipboard without a running loop did not fail")
+	}
+}
+
+func TestClipboardHistory(t *testing.T) {
+	lp, _ := New()
+	lp.SetClipboard("ignored")
+	lp.EnableClipboardHistory(3)
+	for _, text := range []string{"one", "two", "two", "three", "four"} {
+		lp.SetClipboard(text)
+	}
+	if diff := cmp.Diff([]string{"four", "three", "two"}, lp.ClipboardHistory()); diff != "" {
+		t.Fatalf("Unexpected clipboard history:\n%s", diff)
+	}
+	var pasted []string
+	lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+		pasted = append(pasted, fmt.Sprintf("%s:%v", text, in_bracketed_paste))
+		return nil
+	}
+	if err := lp.PasteFromHistory(1); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"three:true", ":false"}, pasted); diff != "" {
+		t.Fatalf("Unexpected pasted text:\n%s", diff)
+	}
+	if err := lp.PasteFromHistory(3); err == nil {
+		t.Fatalf("Pasting a non-existent history entry did not fail")
+	}
+	lp.EnableClipboardHistory(1)
+	if diff := cmp.Diff([]string{"four"}, lp.ClipboardHistory()); diff != "" {
+		t.Fatalf("Clipboard history not shrunk:\n%s", diff)
+	}
+}
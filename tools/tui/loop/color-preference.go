@@ -0,0 +1,153 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"kitty/tools/tty"
+)
+
+var _ = fmt.Print
+
+// Whether the user prefers a dark or a light color scheme
+type ColorSchemePreference uint8
+
+const (
+	UNKNOWN_COLOR_SCHEME ColorSchemePreference = iota
+	DARK_COLOR_SCHEME
+	LIGHT_COLOR_SCHEME
+)
+
+func (self ColorSchemePreference) String() string {
+	switch self {
+	case DARK_COLOR_SCHEME:
+		return "dark"
+	case LIGHT_COLOR_SCHEME:
+		return "light"
+	}
+	return "unknown"
+}
+
+const color_preference_query_timeout = 2 * time.Second
+const portal_query_timeout = 500 * time.Millisecond
+
+// Parse the color preference report: CSI ? 997 ; 1 n for dark and CSI ? 997 ; 2 n for light
+func parse_color_preference_report(csi string) (ColorSchemePreference, bool) {
+	switch csi {
+	case "?997;1n":
+		return DARK_COLOR_SCHEME, true
+	case "?997;2n":
+		return LIGHT_COLOR_SCHEME, true
+	}
+	return UNKNOWN_COLOR_SCHEME, false
+}
+
+func color_scheme_preference_query(ans *ColorSchemePreference) terminal_query {
+	return terminal_query{query: "\x1b[?996n", csi: func(raw []byte) bool {
+		pref, ok := parse_color_preference_report(string(raw))
+		if ok {
+			*ans = pref
+		}
+		return ok
+	}}
+}
+
+// Query the terminal for the color scheme preference with the color
+// preference notification protocol (CSI ? 996 n) supported by kitty. A
+// primary device attributes query is sent after it so that this does not wait
+// forever with terminals that do not support it. Any other input read from r
+// is discarded.
+func QueryColorSchemePreference(w io.Writer, r io.Reader) (ans ColorSchemePreference, err error) {
+	_, err = run_terminal_queries(w, r, color_scheme_preference_query(&ans))
+	return
+}
+
+// Parse the output of dbus-send --print-reply=literal for the color-scheme
+// setting of the XDG desktop portal, which is: variant variant uint32 N
+// where 1 means dark, 2 light and 0 no preference
+func parse_portal_color_scheme(output string) ColorSchemePreference {
+	fields := strings.Fields(output)
+	if len(fields) > 1 && fields[len(fields)-2] == "uint32" {
+		switch fields[len(fields)-1] {
+		case "1":
+			return DARK_COLOR_SCHEME
+		case "2":
+			return LIGHT_COLOR_SCHEME
+		}
+	}
+	return UNKNOWN_COLOR_SCHEME
+}
+
+// Read the color-scheme setting of the XDG desktop portal over D-Bus, using
+// dbus-send if it is available
+func color_scheme_preference_from_portal() ColorSchemePreference {
+	exe, err := exec.LookPath("dbus-send")
+	if err != nil {
+		return UNKNOWN_COLOR_SCHEME
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), portal_query_timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, exe, "--session", "--print-reply=literal", "--reply-timeout="+strconv.Itoa(int(portal_query_timeout.Milliseconds())),
+		"--dest=org.freedesktop.portal.Desktop", "/org/freedesktop/portal/desktop", "org.freedesktop.portal.Settings.Read",
+		"string:org.freedesktop.appearance", "string:color-scheme").Output()
+	if err != nil {
+		return UNKNOWN_COLOR_SCHEME
+	}
+	return parse_portal_color_scheme(string(output))
+}
+
+// Guess the color scheme preference from the background color in COLORFGBG,
+// of the form fg;bg or fg;default;bg, or from TERM for the Linux console,
+// which has a black background
+func color_scheme_preference_from_environment(getenv func(string) string) ColorSchemePreference {
+	if fgbg := getenv("COLORFGBG"); fgbg != "" {
+		parts := strings.Split(fgbg, ";")
+		if bg, err := strconv.Atoi(parts[len(parts)-1]); err == nil && bg >= 0 && bg < 16 {
+			if bg == 7 || bg == 15 {
+				return LIGHT_COLOR_SCHEME
+			}
+			return DARK_COLOR_SCHEME
+		}
+	}
+	if getenv("TERM") == "linux" {
+		return DARK_COLOR_SCHEME
+	}
+	return UNKNOWN_COLOR_SCHEME
+}
+
+// The color scheme preference from the system, without querying the terminal
+func system_color_scheme_preference() ColorSchemePreference {
+	if ans := color_scheme_preference_from_portal(); ans != UNKNOWN_COLOR_SCHEME {
+		return ans
+	}
+	return color_scheme_preference_from_environment(os.Getenv)
+}
+
+// Detect whether the user prefers a dark or light color scheme, by querying
+// the terminal, see QueryColorSchemePreference(), then the XDG desktop portal
+// over D-Bus and finally from the COLORFGBG and TERM environment variables.
+// Must not be called while a loop is running. The error is from querying the
+// terminal and is only returned if no preference is found.
+func DetectColorSchemePreference() (ans ColorSchemePreference, err error) {
+	term, err := tty.OpenControllingTerm(tty.SetRaw)
+	if err == nil {
+		r := tty_reader_with_deadline{term, time.Now().Add(color_preference_query_timeout)}
+		ans, err = QueryColorSchemePreference(term, &r)
+		term.RestoreAndClose()
+		if ans != UNKNOWN_COLOR_SCHEME {
+			return ans, nil
+		}
+	}
+	if ans = system_color_scheme_preference(); ans != UNKNOWN_COLOR_SCHEME {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,137 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"kitty/tools/utils/style"
+)
+
+var _ = fmt.Print
+
+// Colors for the semantic parts of the UI, so that all components of a
+// program present a consistent look
+type ColorScheme struct {
+	Background, Foreground, Accent, Warning, Error, Selection, Border, Muted style.RGBA
+}
+
+func rgb(val uint32) (ans style.RGBA) {
+	ans.FromRGB(val)
+	return
+}
+
+func DefaultDarkTheme() ColorScheme {
+	return ColorScheme{
+		Background: rgb(0x1e1e2e), Foreground: rgb(0xdddddd), Accent: rgb(0x5fafff), Warning: rgb(0xffaf00),
+		Error: rgb(0xff5f5f), Selection: rgb(0x3a3a5a), Border: rgb(0x6c6c8c), Muted: rgb(0x8a8a8a),
+	}
+}
+
+func DefaultLightTheme() ColorScheme {
+	return ColorScheme{
+		Background: rgb(0xfafafa), Foreground: rgb(0x202020), Accent: rgb(0x005fd7), Warning: rgb(0xaf5f00),
+		Error: rgb(0xd70000), Selection: rgb(0xc6d8f0), Border: rgb(0x9e9e9e), Muted: rgb(0x6c6c6c),
+	}
+}
+
+// Components can optionally implement this interface to be notified when the
+// color scheme changes, for example, to invalidate any cached renderings
+type ColorSchemeListener interface {
+	OnColorSchemeChange(lp *Loop, cs ColorScheme)
+}
+
+// The current color scheme, defaults to DefaultDarkTheme()
+func (self *Loop) ColorScheme() ColorScheme { return self.color_scheme }
+
+// Change the color scheme, notifying mounted components that implement
+// ColorSchemeListener and redrawing the screen
+func (self *Loop) SetColorScheme(cs ColorScheme) {
+	if cs == self.color_scheme {
+		return
+	}
+	self.color_scheme = cs
+	self.render_requested = true
+	for _, c := range slices.Clone(self.components) {
+		if l, ok := c.(ColorSchemeListener); ok {
+			l.OnColorSchemeChange(self, cs)
+		}
+	}
+}
+
+// Switch between the specified color schemes when the terminal reports that
+// the system color preference has changed between dark and light. Uses the
+// color preference notification protocol (DEC private mode 2031) supported by
+// kitty and some other terminals. On other terminals the color scheme is set
+// once, when the loop starts, from the preference of the system, see
+// DetectColorSchemePreference().
+func (self *Loop) FollowSystemColorScheme(dark, light ColorScheme) *Loop {
+	self.terminal_options.color_preference_notification = true
+	self.system_color_schemes = &[2]ColorScheme{dark, light}
+	return self
+}
+
+// The color scheme preference last reported by the terminal or detected from
+// the system when following the system color scheme
+func (self *Loop) ColorSchemePreference() ColorSchemePreference {
+	return self.color_scheme_preference
+}
+
+func (self *Loop) set_color_scheme_preference(p ColorSchemePreference) {
+	self.color_scheme_preference = p
+	if self.system_color_schemes != nil && p != UNKNOWN_COLOR_SCHEME {
+		self.SetColorScheme(self.system_color_schemes[int(p-DARK_COLOR_SCHEME)])
+	}
+}
+
+// Use the preference reported by the terminal in response to the startup
+// query, see run_startup_queries(). Terminals that do not report it do not
+// send color preference notifications either, so use the preference of the
+// system instead: from the environment immediately and from the XDG desktop
+// portal once the, potentially slow, D-Bus lookup completes, so that it does
+// not delay startup.
+func (self *Loop) set_startup_color_scheme_preference(p ColorSchemePreference) {
+	self.color_scheme_preference = UNKNOWN_COLOR_SCHEME
+	self.portal_color_scheme = nil
+	if self.system_color_schemes == nil {
+		return
+	}
+	if p == UNKNOWN_COLOR_SCHEME {
+		p = color_scheme_preference_from_environment(os.Getenv)
+		self.portal_color_scheme = make(chan ColorSchemePreference, 1)
+	}
+	self.set_color_scheme_preference(p)
+}
+
+// Must be called after the wakeup channel is created
+func (self *Loop) start_portal_color_scheme_lookup_if_needed() {
+	if ch, wakeup := self.portal_color_scheme, self.wakeup_channel; ch != nil {
+		go func() {
+			ch <- color_scheme_preference_from_portal()
+			select {
+			case wakeup <- 1:
+			default:
+			}
+		}()
+	}
+}
+
+func (self *Loop) handle_portal_color_scheme() {
+	select {
+	case p := <-self.portal_color_scheme:
+		if p != UNKNOWN_COLOR_SCHEME {
+			self.set_color_scheme_preference(p)
+		}
+	default:
+	}
+}
+
+func (self *Loop) handle_color_preference_report(csi string) bool {
+	p, ok := parse_color_preference_report(csi)
+	if ok {
+		self.set_color_scheme_preference(p)
+	}
+	return ok
+}
@@ -0,0 +1,97 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+type scheme_listener struct {
+	ComponentBase
+	received []ColorScheme
+}
+
+func (self *scheme_listener) Render(lp *Loop) error { return nil }
+func (self *scheme_listener) OnColorSchemeChange(lp *Loop, cs ColorScheme) {
+	self.received = append(self.received, cs)
+}
+
+func TestColorScheme(t *testing.T) {
+	lp, _ := New()
+	if lp.ColorScheme() != DefaultDarkTheme() {
+		t.Fatalf("The default color scheme is not the dark theme")
+	}
+	c := &scheme_listener{}
+	lp.MountComponent(c)
+	lp.render_requested = false
+	lp.SetColorScheme(DefaultLightTheme())
+	lp.SetColorScheme(DefaultLightTheme())
+	if diff := cmp.Diff([]ColorScheme{DefaultLightTheme()}, c.received); diff != "" || !lp.render_requested {
+		t.Fatalf("Color scheme listener not notified correctly:\n%s", diff)
+	}
+	// reports are ignored unless following the system color scheme
+	lp.handle_csi([]byte("?997;1n"))
+	if lp.ColorScheme() != DefaultLightTheme() {
+		t.Fatalf("Color scheme changed by color preference report")
+	}
+	custom := DefaultDarkTheme()
+	custom.Accent = custom.Error
+	lp.FollowSystemColorScheme(custom, DefaultLightTheme())
+	if s := lp.terminal_options.SetStateEscapeCodes(); !strings.Contains(s, "\x1b[?2031h\x1b[?996n") {
+		t.Fatalf("Color preference notifications not enabled in: %#v", s)
+	}
+	if s := lp.terminal_options.ResetStateEscapeCodes(); !strings.Contains(s, "\x1b[?2031l") {
+		t.Fatalf("Color preference notifications not disabled in: %#v", s)
+	}
+	lp.handle_csi([]byte("?997;1n"))
+	if lp.ColorScheme() != custom {
+		t.Fatalf("Color scheme not changed to dark by color preference report")
+	}
+	lp.handle_csi([]byte("?997;2n"))
+	if lp.ColorScheme() != DefaultLightTheme() {
+		t.Fatalf("Color scheme not changed to light by color preference report")
+	}
+}
+
+func TestColorSchemePreference(t *testing.T) {
+	for response, expected := range map[string]ColorSchemePreference{"\x1b[?997;1n\x1b[?62c": DARK_COLOR_SCHEME, "x\x1b[?997;2n\x1b[?62;4c": LIGHT_COLOR_SCHEME, "\x1b[?62c": UNKNOWN_COLOR_SCHEME} {
+		w := strings.Builder{}
+		actual, err := QueryColorSchemePreference(&w, strings.NewReader(response))
+		if err != nil || actual != expected || w.String() != "\x1b[?996n\x1b[c" {
+			t.Fatalf("Incorrect preference for %#v: %s %v", response, actual, err)
+		}
+	}
+	if _, err := QueryColorSchemePreference(io.Discard, strings.NewReader("\x1b[?997;1n")); err == nil {
+		t.Fatalf("No error when the terminal did not respond to the device attributes query")
+	}
+	for output, expected := range map[string]ColorSchemePreference{"   variant       variant          uint32 1\n": DARK_COLOR_SCHEME, "variant variant uint32 2": LIGHT_COLOR_SCHEME, "variant variant uint32 0": UNKNOWN_COLOR_SCHEME, "": UNKNOWN_COLOR_SCHEME} {
+		if actual := parse_portal_color_scheme(output); actual != expected {
+			t.Fatalf("Incorrect preference for portal output %#v: %s", output, actual)
+		}
+	}
+	for _, tc := range []struct {
+		colorfgbg, term string
+		expected        ColorSchemePreference
+	}{
+		{"15;0", "xterm", DARK_COLOR_SCHEME}, {"0;default;15", "", LIGHT_COLOR_SCHEME}, {"0;7", "", LIGHT_COLOR_SCHEME},
+		{"", "linux", DARK_COLOR_SCHEME}, {"nonsense", "xterm-kitty", UNKNOWN_COLOR_SCHEME},
+	} {
+		env := map[string]string{"COLORFGBG": tc.colorfgbg, "TERM": tc.term}
+		if actual := color_scheme_preference_from_environment(func(k string) string { return env[k] }); actual != tc.expected {
+			t.Fatalf("Incorrect preference for COLORFGBG=%#v TERM=%#v: %s", tc.colorfgbg, tc.term, actual)
+		}
+	}
+	lp, _ := New()
+	lp.FollowSystemColorScheme(DefaultDarkTheme(), DefaultLightTheme())
+	lp.handle_csi([]byte("?997;2n"))
+	if lp.ColorSchemePreference() != LIGHT_COLOR_SCHEME || lp.ColorScheme() != DefaultLightTheme() {
+		t.Fatalf("Color preference report not applied: %s", lp.ColorSchemePreference())
+	}
+}
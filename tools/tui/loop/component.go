@@ -0,0 +1,172 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"slices"
+)
+
+var _ = fmt.Print
+
+// A rectangular region of the screen in cells, 0, 0 is the top left cell
+type Rect struct {
+	X, Y, Width, Height int
+}
+
+func (self Rect) Contains(x, y int) bool {
+	return x >= self.X && x < self.X+self.Width && y >= self.Y && y < self.Y+self.Height
+}
+
+func (self Rect) IsEmpty() bool { return self.Width <= 0 || self.Height <= 0 }
+
+func (self Rect) String() string {
+	return fmt.Sprintf("Rect{x: %d y: %d width: %d height: %d}", self.X, self.Y, self.Width, self.Height)
+}
+
+// A re-usable UI element. Mounted components are rendered after OnRender and
+// get the first chance at handling input events, before the loop callbacks.
+// Components mounted later are on top of components mounted earlier, they are
+// rendered after and receive events before them.
+type Component interface {
+	// The region of the screen occupied by this component
+	Region() Rect
+	SetRegion(Rect)
+
+	// Draw the component
+	Render(lp *Loop) error
+
+	// Set ev.Handled to prevent the event being delivered to components below
+	// this one and to OnKeyEvent
+	HandleKeyEvent(lp *Loop, ev *KeyEvent) error
+
+	// Return true if the text was consumed and should not be delivered to
+	// components below this one and to OnText
+	HandleText(lp *Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error)
+
+	// Called only for events whose cell is inside Region(). Return true if the
+	// event was consumed and should not be delivered to components below
+	// this one and to OnMouseEvent
+	HandleMouseEvent(lp *Loop, ev *MouseEvent) (bool, error)
+}
+
+// Components can optionally implement this interface to be notified when
+// they are mounted and unmounted
+type ComponentLifecycle interface {
+	OnMount(lp *Loop)
+	OnUnmount(lp *Loop)
+}
+
+// Embed this in a struct to get do nothing implementations of all Component
+// methods except Render
+type ComponentBase struct {
+	region Rect
+}
+
+func (self *ComponentBase) Region() Rect     { return self.region }
+func (self *ComponentBase) SetRegion(r Rect) { self.region = r }
+func (self *ComponentBase) HandleKeyEvent(lp *Loop, ev *KeyEvent) error {
+	return nil
+}
+func (self *ComponentBase) HandleText(lp *Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	return false, nil
+}
+func (self *ComponentBase) HandleMouseEvent(lp *Loop, ev *MouseEvent) (bool, error) {
+	return false, nil
+}
+
+// Mount the component making it part of the UI. Mounting an already mounted
+// component moves it to the top.
+func (self *Loop) MountComponent(c Component) {
+	already_mounted := slices.Index(self.components, c) > -1
+	self.components = slices.DeleteFunc(self.components, func(x Component) bool { return x == c })
+	self.components = append(self.components, c)
+	self.render_requested = true
+	if l, ok := c.(ComponentLifecycle); ok && !already_mounted {
+		l.OnMount(self)
+	}
+}
+
+// Unmount a previously mounted component, cancelling its subscriptions, see
+// SubscribeFor(), and removing it from the focus cycle. Returns false if the component was not mounted.
+func (self *Loop) UnmountComponent(c Component) bool {
+	idx := slices.Index(self.components, c)
+	if idx < 0 {
+		return false
+	}
+	self.components = slices.Delete(self.components, idx, idx+1)
+	self.render_requested = true
+	if l, ok := c.(ComponentLifecycle); ok {
+		l.OnUnmount(self)
+	}
+	self.cancel_subscriptions_for(c)
+	if f, ok := c.(Focusable); ok {
+		self.UnregisterFocusable(f)
+	}
+	return true
+}
+
+// The currently mounted components, from bottom to top
+func (self *Loop) Components() []Component {
+	return slices.Clone(self.components)
+}
+
+func (self *Loop) render_components() error {
+	for _, c := range slices.Clone(self.components) {
+		if p := self.render_profiler; p != nil {
+			name := component_name(c)
+			p.BeginWidget(name)
+			err := c.Render(self)
+			p.EndWidget(name)
+			if err != nil {
+				return err
+			}
+		} else if err := c.Render(self); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Iterate over a copy of the mounted components from top to bottom so that
+// handlers can mount and unmount components
+func (self *Loop) components_top_down() []Component {
+	ans := slices.Clone(self.components)
+	slices.Reverse(ans)
+	return ans
+}
+
+func (self *Loop) dispatch_key_event_to_components(ev *KeyEvent) error {
+	for _, c := range self.components_top_down() {
+		if !self.accepts_keyboard_input(c) {
+			continue
+		}
+		if err := c.HandleKeyEvent(self, ev); err != nil || ev.Handled {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Loop) dispatch_text_to_components(text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	for _, c := range self.components_top_down() {
+		if !self.accepts_keyboard_input(c) {
+			continue
+		}
+		if consumed, err := c.HandleText(self, text, from_key_event, in_bracketed_paste); err != nil || consumed {
+			return consumed, err
+		}
+	}
+	return false, nil
+}
+
+func (self *Loop) dispatch_mouse_event_to_components(ev *MouseEvent) (bool, error) {
+	for _, c := range self.components_top_down() {
+		if c.Region().Contains(ev.Cell.X, ev.Cell.Y) {
+			if consumed, err := c.HandleMouseEvent(self, ev); err != nil || consumed {
+				return consumed, err
+			}
+		}
+	}
+	return false, nil
+}
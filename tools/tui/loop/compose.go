@@ -0,0 +1,241 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var _ = fmt.Print
+
+// The characters of the X11 keysyms for symbols used in compose sequences,
+// letters and digits are their own keysyms
+var keysym_characters = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "apostrophe": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "minus": '-', "period": '.', "slash": '/', "colon": ':',
+	"semicolon": ';', "less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@',
+	"bracketleft": '[', "backslash": '\\', "bracketright": ']', "asciicircum": '^',
+	"underscore": '_', "grave": '`', "braceleft": '{', "bar": '|', "braceright": '}',
+	"asciitilde": '~', "nobreakspace": ' ', "exclamdown": '¡', "cent": '¢', "sterling": '£',
+	"currency": '¤', "yen": '¥', "brokenbar": '¦', "section": '§', "diaeresis": '¨',
+	"copyright": '©', "ordfeminine": 'ª', "guillemotleft": '«', "notsign": '¬', "hyphen": '­',
+	"registered": '®', "macron": '¯', "degree": '°', "plusminus": '±', "twosuperior": '²',
+	"threesuperior": '³', "acute": '´', "mu": 'µ', "paragraph": '¶', "periodcentered": '·',
+	"cedilla": '¸', "onesuperior": '¹', "masculine": 'º', "guillemotright": '»',
+	"onequarter": '¼', "onehalf": '½', "threequarters": '¾', "questiondown": '¿',
+	"multiply": '×', "division": '÷',
+}
+
+// The token for the compose key in compose sequences
+const compose_key_token = "Multi_key"
+
+func keysym_to_token(name string) (string, bool) {
+	if name == compose_key_token || strings.HasPrefix(name, "dead_") {
+		return name, true
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return name, true
+	}
+	if r, found := keysym_characters[name]; found {
+		return string(r), true
+	}
+	if hex, found := strings.CutPrefix(name, "U"); found {
+		if cp, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(cp)) {
+			return string(rune(cp)), true
+		}
+	}
+	return "", false
+}
+
+type compose_node struct {
+	children map[string]*compose_node
+	result   string
+}
+
+// A table of compose sequences, in the format of the X11 Compose files
+type ComposeTable struct {
+	root compose_node
+}
+
+func (self *ComposeTable) add(tokens []string, result string) {
+	n := &self.root
+	for _, t := range tokens {
+		if n.children == nil {
+			n.children = make(map[string]*compose_node)
+		}
+		c := n.children[t]
+		if c == nil {
+			c = &compose_node{}
+			n.children[t] = c
+		}
+		n = c
+	}
+	n.result = result
+}
+
+// Parse a table with lines of the form:
+//
+//	<Multi_key> <asciitilde> <n> : "ñ" ntilde # comment
+//
+// Sequences with keysyms that do not correspond to characters, other than
+// the compose key and dead keys, are ignored, as are include statements.
+func ParseComposeTable(r io.Reader) (*ComposeTable, error) {
+	ans := &ComposeTable{}
+	scanner := bufio.NewScanner(r)
+	for lnum := 1; scanner.Scan(); lnum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "<") {
+			continue
+		}
+		lhs, rhs, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("Invalid compose sequence at line %d: %s", lnum, line)
+		}
+		var tokens []string
+		valid := true
+		for _, f := range strings.Fields(lhs) {
+			name, ok := strings.CutPrefix(f, "<")
+			if name, ok = strings.CutSuffix(name, ">"); !ok {
+				return nil, fmt.Errorf("Invalid keysym at line %d: %s", lnum, f)
+			}
+			t, ok := keysym_to_token(name)
+			valid = valid && ok
+			tokens = append(tokens, t)
+		}
+		rhs = strings.TrimSpace(rhs)
+		if !strings.HasPrefix(rhs, "\"") {
+			continue // only a keysym result
+		}
+		result, err := strconv.QuotedPrefix(rhs)
+		if err == nil {
+			result, err = strconv.Unquote(result)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid result of compose sequence at line %d: %s", lnum, line)
+		}
+		if valid && len(tokens) > 0 {
+			ans.add(tokens, result)
+		}
+	}
+	return ans, scanner.Err()
+}
+
+// The state of a compose sequence being typed
+type ComposeState struct {
+	table   *ComposeTable
+	current *compose_node
+}
+
+func NewComposeState(table *ComposeTable) *ComposeState {
+	return &ComposeState{table: table}
+}
+
+// Whether a compose sequence is being typed
+func (self *ComposeState) InProgress() bool { return self.current != nil }
+
+func (self *ComposeState) Reset() { self.current = nil }
+
+// Process the next token of a sequence, the text of a key or Multi_key for
+// the compose key. Returns the composed text when a sequence completes and
+// whether the token was consumed as part of a sequence. An invalid token in
+// a sequence aborts it, consuming the token, like X11 does.
+func (self *ComposeState) Feed(token string) (result string, consumed bool) {
+	n := self.current
+	if n == nil {
+		if token != compose_key_token {
+			return "", false
+		}
+		n = &self.table.root
+	}
+	next := n.children[token]
+	switch {
+	case next == nil:
+		self.current = nil
+	case len(next.children) == 0:
+		self.current = nil
+		result = next.result
+	default:
+		self.current = next
+	}
+	return result, true
+}
+
+func default_compose_file() string {
+	locale := "en_US.UTF-8"
+	for _, v := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if val := os.Getenv(v); val != "" && val != "C" && val != "POSIX" {
+			locale = val
+			break
+		}
+	}
+	for _, l := range []string{locale, "en_US.UTF-8"} {
+		path := filepath.Join("/usr/share/X11/locale", l, "Compose")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join("/usr/share/X11/locale", locale, "Compose")
+}
+
+// Combine the key presses of compose sequences, starting with
+// LoopConfig.ComposeKey, into a single key event with the composed text,
+// using the sequences defined in composeFile. If composeFile is empty, the
+// X11 Compose file for the current locale is used.
+func (self *Loop) EnableComposeProcessing(composeFile string) error {
+	if composeFile == "" {
+		composeFile = default_compose_file()
+	}
+	f, err := os.Open(composeFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	table, err := ParseComposeTable(f)
+	if err != nil {
+		return fmt.Errorf("Failed to parse compose file: %s with error: %w", composeFile, err)
+	}
+	self.compose_state = NewComposeState(table)
+	return nil
+}
+
+func is_modifier_key(key string) bool {
+	for _, suffix := range []string{"SHIFT", "CONTROL", "ALT", "SUPER", "HYPER", "META", "CAPS_LOCK", "NUM_LOCK"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Loop) handle_compose_key(ev *KeyEvent) (consumed bool, err error) {
+	cs := self.compose_state
+	if cs == nil || is_modifier_key(ev.Key) {
+		return false, nil
+	}
+	if ev.Type == RELEASE {
+		// releases of the keys of a sequence
+		return cs.InProgress() || ev.MatchesRelease(self.Config.ComposeKey), nil
+	}
+	token := ev.Text
+	if ev.MatchesPressOrRepeat(self.Config.ComposeKey) {
+		token = compose_key_token
+	} else if token == "" && cs.InProgress() {
+		// other keys abort the sequence
+		cs.Reset()
+		return true, nil
+	}
+	result, consumed := cs.Feed(token)
+	if result != "" {
+		composed := KeyEvent{Type: PRESS, Key: result, Text: result}
+		err = self.process_key_event(&composed)
+	}
+	return consumed, err
+}
@@ -0,0 +1,71 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+const test_compose_table = `# comment
+include "%L"
+<dead_tilde> <n>			: "ñ"	ntilde # LATIN SMALL LETTER N WITH TILDE
+<Multi_key> <asciitilde> <n>		: "ñ"	ntilde # LATIN SMALL LETTER N WITH TILDE
+<Multi_key> <o> <c>  : "©"
+<Multi_key> <U2192> <quotedbl> : "\"q\""
+<Multi_key> <unknown_keysym> <x> : "x"
+`
+
+func TestComposeProcessing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Compose")
+	if err := os.WriteFile(path, []byte(test_compose_table), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lp, _ := New()
+	if err := lp.EnableComposeProcessing(path); err != nil {
+		t.Fatal(err)
+	}
+	var text []string
+	lp.OnText = func(t string, from_key_event, in_bracketed_paste bool) error {
+		text = append(text, t)
+		return nil
+	}
+	test := func(expected []string, keys ...string) {
+		t.Helper()
+		text = nil
+		for _, k := range keys {
+			ev := KeyEvent{Type: PRESS, Key: k}
+			if k != "MENU" && k != "LEFT_SHIFT" && k != "UP" {
+				ev.Text = k
+			}
+			if err := lp.handle_key_event(&ev); err != nil {
+				t.Fatal(err)
+			}
+			ev = KeyEvent{Type: RELEASE, Key: k}
+			if err := lp.handle_key_event(&ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if diff := cmp.Diff(expected, text); diff != "" {
+			t.Fatalf("Unexpected text for: %v\n%s", keys, diff)
+		}
+	}
+	test([]string{"a", "ñ", "b"}, "a", "MENU", "LEFT_SHIFT", "~", "n", "b")
+	test([]string{"©"}, "MENU", "o", "c")
+	test([]string{`"q"`}, "MENU", "→", `"`)
+	// invalid sequences are discarded
+	test([]string{"z"}, "MENU", "o", "x", "z")
+	test([]string{"z"}, "MENU", "o", "UP", "z")
+	// sequences with unknown keysyms are ignored
+	test(nil, "MENU", "x")
+	test([]string{"n"}, "n")
+	if err := lp.EnableComposeProcessing(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("Enabling compose processing with a missing file did not fail")
+	}
+}
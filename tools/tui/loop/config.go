@@ -0,0 +1,197 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = fmt.Print
+
+// Settings that control the behavior of the loop, change them before calling Run()
+type LoopConfig struct {
+	// Wrap every render, that is the call to OnRender and the rendering of
+	// mounted components, in a synchronized update (DEC private mode 2026)
+	// so that the terminal only ever displays complete frames. Support is
+	// detected with DECRQM when the loop starts and synchronized rendering is
+	// silently disabled if the terminal reports that it does not support it.
+	SynchronizedRendering bool
+	// Remove escape codes from pasted text before it is delivered to
+	// components and OnText, so that pasted content cannot inject key
+	// presses or other terminal input. Enabled by default.
+	StripPasteEscapes bool
+	// The maximum size in bytes of the text of a bracketed paste, text beyond
+	// it is discarded, see Loop.PasteTruncated(). Zero means no limit.
+	// Defaults to 1MB.
+	MaxPasteSize int
+	// The maximum number of mouse move events and bracketed pastes delivered
+	// per second, events in excess of it are dropped. A bracketed paste
+	// counts as a single event. Key presses, typed text and mouse button
+	// events are never dropped, so that, for example, ctrl+c always works.
+	// Zero means no limit, the default.
+	MaxEventsPerSecond int
+	// Deliver all the key events of a macro immediately in Loop.PlayMacro()
+	// instead of with the delays with which they were recorded
+	InstantMacroPlayback bool
+	// The number of lines of output to keep for reviewing with
+	// Loop.ScrollBackward(), zero means no scrollback, the default
+	ScrollbackLines int
+	// The key that starts compose sequences, see Loop.EnableComposeProcessing().
+	// Defaults to menu, an empty string disables compose sequences.
+	ComposeKey string
+	// The number of bytes of output waiting to be written to the terminal
+	// above which OnWriteBackpressure is called, zero means never, the default
+	WriteBackpressureThreshold int
+	// How long to wait for more input after receiving an ESC before
+	// delivering it as an Escape key press, rather than as the start of a
+	// longer sequence, such as those sent for Alt modified keys. Increase it
+	// for high latency connections. Zero means wait until more input arrives.
+	// Defaults to 50ms.
+	AltKeyTimeout time.Duration
+	// Catch SIGINT and SIGTERM, stop the loop, restore the terminal and then
+	// raise the signal again with its default disposition, so that the
+	// process is killed by it, unless handled by OnSIGINT or OnSIGTERM.
+	// Disable it for processes that manage these signals themselves, the
+	// loop then does not catch them at all, so such processes must stop the
+	// loop themselves when they receive them for the terminal to be
+	// restored. Enabled by default.
+	HandleSignals bool
+	// Identify the terminal when the loop starts, see Loop.TerminalID(),
+	// which is needed for Loop.IsPointerShapeSupported(), the OSC 9
+	// notification fallback and graphics.RenderImage(). It delays startup
+	// by a round trip to the terminal, so it is disabled by default, the
+	// identity is queried only once per process.
+	IdentifyTerminal bool
+	// How notifications are shown by Loop.ShowNotification() when the
+	// terminal does not support the kitty notification protocol. OSC 9 is
+	// used only for terminals known to support it, which requires
+	// IdentifyTerminal. Defaults to KITTY_THEN_OSC9.
+	NotificationFallback NotificationFallback
+	// The normalization form pasted text is converted to before it is
+	// delivered, see NormalizeText(). Defaults to NFC.
+	PasteNormalization NormalizationForm
+	// Render only when Loop.MarkDirty() was called since the last render,
+	// instead of after every input event, wakeup and timer, for example, to
+	// avoid redrawing on every mouse move. Changes made through the loop,
+	// such as to mounted components, the color scheme, focus, the screen
+	// size or Loop.TerminalState(), still cause a render.
+	RenderOnlyWhenDirty bool
+}
+
+const default_max_paste_size = 1024 * 1024
+const default_alt_key_timeout = 50 * time.Millisecond
+
+// Check the settings for invalid values, returning an error that lists all of
+// them. Called by Loop.Run() before the loop starts.
+func (self LoopConfig) Validate() error {
+	var problems []string
+	non_negative := func(name string, val int) {
+		if val < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got: %d", name, val))
+		}
+	}
+	non_negative("MaxPasteSize", self.MaxPasteSize)
+	non_negative("MaxEventsPerSecond", self.MaxEventsPerSecond)
+	non_negative("ScrollbackLines", self.ScrollbackLines)
+	non_negative("WriteBackpressureThreshold", self.WriteBackpressureThreshold)
+	if self.AltKeyTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("AltKeyTimeout must not be negative, got: %s", self.AltKeyTimeout))
+	}
+	if self.NotificationFallback > KITTY_ONLY {
+		problems = append(problems, fmt.Sprintf("NotificationFallback is not a valid value: %s", self.NotificationFallback))
+	}
+	if self.PasteNormalization > NFKD {
+		problems = append(problems, fmt.Sprintf("PasteNormalization is not a valid normalization form: %s", self.PasteNormalization))
+	}
+	if self.ComposeKey != "" {
+		ps := ParseShortcut(self.ComposeKey)
+		if ps.KeyName == "" || ps.Mods&(META<<8) != 0 {
+			problems = append(problems, fmt.Sprintf("ComposeKey is not a valid key: %#v", self.ComposeKey))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid loop configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+type mode_support uint8
+
+const (
+	mode_support_unknown mode_support = iota
+	mode_support_querying
+	mode_supported
+	mode_unsupported
+)
+
+// The query for the state of a mode, DECRQM
+func (self Mode) query_escape_code() string {
+	return self.escape_code("$p")
+}
+
+// Parse a DECRPM response of the form ? mode ; setting $ y, setting is 0
+// when the mode is not recognized and 4 when it is permanently reset
+func parse_decrpm(csi string) (mode Mode, setting int, ok bool) {
+	body, found := strings.CutSuffix(csi, "$y")
+	if !found {
+		return
+	}
+	priv := strings.HasPrefix(body, "?")
+	m, s, found := strings.Cut(strings.TrimPrefix(body, "?"), ";")
+	if !found {
+		return
+	}
+	num, err := strconv.ParseUint(m, 10, 31)
+	if err != nil {
+		return
+	}
+	if setting, err = strconv.Atoi(s); err != nil {
+		return
+	}
+	mode = Mode(num)
+	if priv {
+		mode |= private
+	}
+	return mode, setting, true
+}
+
+func (self *Loop) query_synchronized_update_support() {
+	self.synchronized_update_support = mode_support_unknown
+	if self.Config.SynchronizedRendering {
+		self.synchronized_update_support = mode_support_querying
+		self.QueueWriteString(PENDING_UPDATE.query_escape_code())
+	}
+}
+
+func (self *Loop) handle_synchronized_update_support_response(csi string) bool {
+	if self.synchronized_update_support != mode_support_querying {
+		return false
+	}
+	mode, setting, ok := parse_decrpm(csi)
+	if !ok || mode != PENDING_UPDATE {
+		return false
+	}
+	self.synchronized_update_support = mode_supported
+	if setting == 0 || setting == 4 {
+		self.synchronized_update_support = mode_unsupported
+	}
+	return true
+}
+
+func (self *Loop) use_synchronized_rendering() bool {
+	return self.Config.SynchronizedRendering && self.synchronized_update_support != mode_unsupported && !self.atomic_update_active
+}
+
+// Pass pasted text through a parser so that only its characters are
+// dispatched. The sanitizer must never enter its own bracketed paste state,
+// otherwise escape codes following a pasted CSI 200~ would pass through.
+func (self *Loop) dispatch_sanitized_paste(ch rune) error {
+	err := self.paste_sanitizer.ParseString(string(ch))
+	if self.paste_sanitizer.InBracketedPaste() {
+		self.paste_sanitizer.Reset()
+	}
+	return err
+}
@@ -0,0 +1,343 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+func take_pending_writes(lp *Loop) string {
+	ans := strings.Builder{}
+	for _, w := range lp.pending_writes {
+		ans.WriteString(w.str)
+		ans.Write(w.bytes)
+	}
+	lp.pending_writes = nil
+	return ans.String()
+}
+
+func TestSynchronizedRendering(t *testing.T) {
+	lp, _ := New()
+	lp.OnRender = func() error {
+		lp.QueueWriteString("frame")
+		return nil
+	}
+	test := func(expected string) {
+		t.Helper()
+		if err := lp.render(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected render output:\n%s", diff)
+		}
+	}
+	test("frame")
+	lp.Config.SynchronizedRendering = true
+	lp.query_synchronized_update_support()
+	if diff := cmp.Diff("\x1b[?2026$p", take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Support for synchronized updates not queried:\n%s", diff)
+	}
+	// render synchronized while waiting for the response
+	test("\x1b[?2026hframe\x1b[?2026l")
+	if !lp.handle_synchronized_update_support_response("?2026;2$y") || lp.synchronized_update_support != mode_supported {
+		t.Fatalf("Support for synchronized updates not detected")
+	}
+	test("\x1b[?2026hframe\x1b[?2026l")
+	// a render inside an explicit atomic update is not wrapped again
+	lp.StartAtomicUpdate()
+	take_pending_writes(lp)
+	test("frame")
+	lp.EndAtomicUpdate()
+	take_pending_writes(lp)
+
+	lp.query_synchronized_update_support()
+	take_pending_writes(lp)
+	if lp.handle_synchronized_update_support_response("?2004;1$y") {
+		t.Fatalf("Report for a different mode was handled")
+	}
+	if !lp.handle_synchronized_update_support_response("?2026;0$y") || lp.synchronized_update_support != mode_unsupported {
+		t.Fatalf("Lack of support for synchronized updates not detected")
+	}
+	test("frame")
+	if lp.handle_synchronized_update_support_response("?2026;0$y") {
+		t.Fatalf("Report handled when not querying support")
+	}
+
+	for csi, expected := range map[string]string{"?2026;1$y": "2026|private 1 true", "20;2$y": "20 2 true", "?2026$y": "0 0 false", "?x;1$y": "0 0 false"} {
+		mode, setting, ok := parse_decrpm(csi)
+		actual := fmt.Sprintf("%d %d %v", mode, setting, ok)
+		if mode&private != 0 {
+			actual = fmt.Sprintf("%d|private %d %v", mode&^private, setting, ok)
+		}
+		if actual != expected {
+			t.Fatalf("Incorrect parsing of DECRPM response: %#v: %s != %s", csi, actual, expected)
+		}
+	}
+}
+
+// A terminal that refreshes the screen after receiving each chunk of data,
+// counting refreshes that show an incomplete frame. Frames start with CSI H and
+// end with CSI J.
+type tearing_terminal struct {
+	parser                  wcswidth.EscapeCodeParser
+	in_frame, in_sync       bool
+	refreshes, torn_refresh int
+}
+
+func new_tearing_terminal() *tearing_terminal {
+	ans := &tearing_terminal{}
+	ans.parser.HandleCSI = func(raw []byte) error {
+		switch string(raw) {
+		case "H":
+			ans.in_frame = true
+		case "J":
+			ans.in_frame = false
+		case "?2026h":
+			ans.in_sync = true
+		case "?2026l":
+			ans.in_sync = false
+		}
+		return nil
+	}
+	return ans
+}
+
+func (self *tearing_terminal) receive(data []byte) {
+	_ = self.parser.Parse(data)
+	if !self.in_sync {
+		self.refreshes++
+		if self.in_frame {
+			self.torn_refresh++
+		}
+	}
+}
+
+// Compare the fraction of screen refreshes that show partial frames with and
+// without synchronized rendering, when a terminal receives output in chunks of
+// random size
+func BenchmarkSynchronizedRendering(b *testing.B) {
+	for _, synchronized := range []bool{false, true} {
+		b.Run(fmt.Sprintf("synchronized=%v", synchronized), func(b *testing.B) {
+			lp, _ := New()
+			lp.Config.SynchronizedRendering = synchronized
+			lp.synchronized_update_support = mode_supported
+			line := strings.Repeat("x", 78) + "\r\n"
+			lp.OnRender = func() error {
+				lp.QueueWriteString("\x1b[H")
+				for i := 0; i < 24; i++ {
+					lp.QueueWriteString(line)
+				}
+				lp.QueueWriteString("\x1b[J")
+				return nil
+			}
+			term := new_tearing_terminal()
+			r := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := lp.render(); err != nil {
+					b.Fatal(err)
+				}
+				data := []byte(take_pending_writes(lp))
+				for len(data) > 0 {
+					n := min(len(data), 1+r.Intn(1024))
+					term.receive(data[:n])
+					data = data[n:]
+				}
+			}
+			b.ReportMetric(float64(term.torn_refresh)/float64(max(1, term.refreshes)), "torn-refreshes/refresh")
+		})
+	}
+}
+
+func TestPasteEscapeStripping(t *testing.T) {
+	lp, _ := New()
+	type text_event struct {
+		Text     string
+		In_paste bool
+	}
+	var events []text_event
+	lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+		events = append(events, text_event{text, in_bracketed_paste})
+		return nil
+	}
+	test := func(strip bool, input string, expected ...text_event) {
+		t.Helper()
+		lp.Config.StripPasteEscapes = strip
+		lp.escape_code_parser.Reset()
+		events = nil
+		if err := lp.escape_code_parser.ParseString(input); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, events); diff != "" {
+			t.Fatalf("Unexpected text events for: %#v\n%s", input, diff)
+		}
+	}
+	if !lp.Config.StripPasteEscapes {
+		t.Fatalf("Stripping of escape codes in pasted text is not enabled by default")
+	}
+	test(true, "\x1b[200~a\x1b[Ab\x1b[201~", text_event{"a", true}, text_event{"b", true}, text_event{"", false})
+	test(false, "\x1b[200~a\x1b[A\x1b[201~", text_event{"a", true}, text_event{"\x1b", true}, text_event{"[", true}, text_event{"A", true}, text_event{"", false})
+	test(true, "\x1b[200~\x1b]52;c;eA==\x07\x1b[200~\x1b[Bx\x1b[201~", text_event{"x", true}, text_event{"", false})
+	// an incomplete escape code at the end of a paste does not swallow the next paste
+	test(true, "\x1b[200~\x1b[1\x1b[201~\x1b[200~y\x1b[201~", text_event{"", false}, text_event{"y", true}, text_event{"", false})
+	// text outside a paste is unaffected
+	test(true, "z", text_event{"z", false})
+	// pasted text is normalized to NFC by default
+	test(true, "\x1b[200~e\u0301a\x1b[201~", text_event{"é", true}, text_event{"a", true}, text_event{"", false})
+	lp.Config.PasteNormalization = NO_NORMALIZATION
+	test(true, "\x1b[200~e\u0301\x1b[201~", text_event{"e", true}, text_event{"\u0301", true}, text_event{"", false})
+	if NormalizeText("é", NFD) != "e\u0301" {
+		t.Fatalf("Text not normalized")
+	}
+}
+
+func TestInputLimits(t *testing.T) {
+	lp, _ := New()
+	var text []string
+	lp.OnText = func(t string, from_key_event, in_bracketed_paste bool) error {
+		if t == "" {
+			t = fmt.Sprintf("<end truncated=%v>", lp.PasteTruncated())
+		}
+		text = append(text, t)
+		return nil
+	}
+	test := func(input string, expected ...string) {
+		t.Helper()
+		text = nil
+		if err := lp.escape_code_parser.ParseString(input); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, text); diff != "" {
+			t.Fatalf("Unexpected text for: %#v\n%s", input, diff)
+		}
+	}
+	if lp.Config.MaxPasteSize != 1024*1024 {
+		t.Fatalf("Incorrect default maximum paste size: %d", lp.Config.MaxPasteSize)
+	}
+	lp.Config.MaxPasteSize = 4
+	test("\x1b[200~ab\x1b[201~", "a", "b", "<end truncated=false>")
+	test("\x1b[200~abécd\x1b[201~", "a", "b", "é", "<end truncated=true>")
+	test("\x1b[200~abc\x1b[201~", "a", "b", "c", "<end truncated=false>")
+
+	lp.Config.MaxPasteSize = 0
+	lp.Config.MaxEventsPerSecond = 3
+	lp.screen_size = ScreenSize{WidthCells: 10, HeightCells: 5, CellWidth: 10, CellHeight: 20, WidthPx: 100, HeightPx: 100, updated: true}
+	lp.OnKeyEvent = func(ev *KeyEvent) error {
+		text = append(text, "key: "+ev.String())
+		ev.Handled = true
+		return nil
+	}
+	lp.OnMouseEvent = func(ev *MouseEvent) error {
+		text = append(text, "mouse: "+ev.Event_type.String())
+		return nil
+	}
+	move := "\x1b[<35;21;41M"
+	// the paste counts as a single event
+	test(move+move+"ab\x1b[200~cdef\x1b[201~gh", "mouse: move", "mouse: move", "a", "b", "c", "d", "e", "f", "<end truncated=false>", "g", "h")
+	// only mouse moves and pastes are dropped, never key presses, typed text
+	// and mouse buttons
+	test(move+"\x1b[200~ij\x1b[201~\x1b[<0;21;41Mk\x1b[99;5u", "mouse: press", "k", "key: PRESS{ ctrl+c }")
+	stats := lp.Stats()
+	if stats.DroppedEvents < 3 {
+		t.Fatalf("Events dropped because of the input rate not counted: %s", stats)
+	}
+	lp.input_rate.window_start = lp.input_rate.window_start.Add(-time.Second)
+	test(move+"l", "mouse: move", "l")
+}
+
+func TestLoopConfigValidation(t *testing.T) {
+	defaults, _ := New()
+	for _, tc := range []struct {
+		name     string
+		modify   func(*LoopConfig)
+		expected string
+	}{
+		{"defaults", func(c *LoopConfig) {}, ""},
+		{"zero value", func(c *LoopConfig) { *c = LoopConfig{} }, ""},
+		{"limits disabled", func(c *LoopConfig) { c.MaxPasteSize, c.MaxEventsPerSecond, c.ScrollbackLines = 0, 0, 0 }, ""},
+		{"compose key with modifiers", func(c *LoopConfig) { c.ComposeKey = "ctrl+shift+m" }, ""},
+		{"unknown notification fallback", func(c *LoopConfig) { c.NotificationFallback = KITTY_ONLY + 1 }, "Invalid loop configuration: NotificationFallback is not a valid value: NotificationFallback(4)"},
+		{"unknown paste normalization", func(c *LoopConfig) { c.PasteNormalization = NFKD + 1 }, "Invalid loop configuration: PasteNormalization is not a valid normalization form: NormalizationForm(5)"},
+		{"negative paste size", func(c *LoopConfig) { c.MaxPasteSize = -1 }, "Invalid loop configuration: MaxPasteSize must not be negative, got: -1"},
+		{"several invalid values", func(c *LoopConfig) { c.MaxEventsPerSecond, c.ScrollbackLines, c.ComposeKey = -3, -1, "nonsense+q" },
+			"Invalid loop configuration: MaxEventsPerSecond must not be negative, got: -3; ScrollbackLines must not be negative, got: -1; ComposeKey is not a valid key: \"nonsense+q\""},
+	} {
+		c := defaults.Config
+		tc.modify(&c)
+		actual := ""
+		if err := c.Validate(); err != nil {
+			actual = err.Error()
+		}
+		if diff := cmp.Diff(tc.expected, actual); diff != "" {
+			t.Fatalf("Unexpected validation result for %s:\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	lp, _ := New()
+	if !slices.Contains(lp.handled_signals(), os.Signal(unix.SIGTERM)) {
+		t.Fatalf("SIGTERM not caught by default")
+	}
+	lp.handle_key_event(&KeyEvent{Type: PRESS, Key: "c", Mods: CTRL})
+	if lp.DeathSignalName() != "interrupt" || lp.signal_to_reraise != SIGNULL {
+		t.Fatalf("Incorrect handling of ctrl+c: %#v %v", lp.DeathSignalName(), lp.signal_to_reraise)
+	}
+	lp.death_signal = SIGNULL
+	lp.OnSIGTERM = func() (bool, error) { return true, nil }
+	if lp.on_signal(unix.SIGTERM); lp.death_signal != SIGNULL || lp.signal_to_reraise != SIGNULL {
+		t.Fatalf("SIGTERM handled by OnSIGTERM stops the loop")
+	}
+	lp.OnSIGTERM = nil
+	if lp.on_signal(unix.SIGTERM); lp.death_signal != unix.SIGTERM || lp.signal_to_reraise != unix.SIGTERM {
+		t.Fatalf("SIGTERM does not stop the loop to be raised again")
+	}
+	lp.Config.HandleSignals = false
+	if slices.Contains(lp.handled_signals(), os.Signal(unix.SIGINT)) {
+		t.Fatalf("SIGINT caught with HandleSignals disabled")
+	}
+}
+
+func TestRenderOnlyWhenDirty(t *testing.T) {
+	lp, _ := New()
+	renders := 0
+	lp.OnRender = func() error {
+		renders++
+		return lp.ForceRender()
+	}
+	lp.event_received_needs_render()
+	if !lp.render_requested {
+		t.Fatalf("Render not requested for an event by default")
+	}
+	lp.render_requested = false
+	lp.Config.RenderOnlyWhenDirty = true
+	lp.event_received_needs_render()
+	if lp.render_requested {
+		t.Fatalf("Render requested for an event with RenderOnlyWhenDirty")
+	}
+	lp.MarkDirty()
+	if !lp.render_requested {
+		t.Fatalf("MarkDirty() did not request a render")
+	}
+	lp.render_requested = false
+	if err := lp.ForceRender(); err != nil {
+		t.Fatal(err)
+	}
+	// ForceRender() during a render only requests another render
+	if renders != 1 || !lp.render_requested {
+		t.Fatalf("Unexpected renders: %d requested: %v", renders, lp.render_requested)
+	}
+}
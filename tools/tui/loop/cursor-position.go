@@ -0,0 +1,80 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+var ErrCursorPositionNotReported = errors.New("The terminal did not report the cursor position")
+
+// Parse a DECXCPR response of the form ?row;col;page R or a CPR response of
+// the form row;col R, for which the page is one
+func parse_cursor_position_report(csi string) (row, col, page int, ok bool) {
+	if !strings.HasSuffix(csi, "R") {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(csi[:len(csi)-1], "?"), ";")
+	if len(parts) < 2 || len(parts) > 3 {
+		return
+	}
+	nums := []int{0, 0, 1}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			return
+		}
+		nums[i] = n
+	}
+	return nums[0], nums[1], nums[2], true
+}
+
+// Query the terminal for the position of the cursor, one based, and the page
+// it is on with DECXCPR (CSI ? 6 n). Terminals that respond with a standard
+// cursor position report, which has no page, are on page one. A primary
+// device attributes query is sent after it, which all terminals respond to, so
+// that this does not wait forever with terminals that do not respond. Any
+// other input read from r is discarded.
+func QueryExtendedCursorPosition(w io.Writer, r io.Reader) (row, col, page int, err error) {
+	if _, err = io.WriteString(w, "\x1b[?6n\x1b[c"); err != nil {
+		return
+	}
+	found, done := false, false
+	p := wcswidth.EscapeCodeParser{}
+	p.HandleCSI = func(raw []byte) error {
+		csi := string(raw)
+		if strings.HasPrefix(csi, "?") && strings.HasSuffix(csi, "c") {
+			done = true
+		} else if y, x, pg, ok := parse_cursor_position_report(csi); ok {
+			row, col, page, found = y, x, pg, true
+		}
+		return nil
+	}
+	buf := make([]byte, 256)
+	for !done {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if err = p.Parse(buf[:n]); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		if rerr != nil {
+			if !done {
+				return 0, 0, 0, rerr
+			}
+			break
+		}
+	}
+	if !found {
+		return 0, 0, 0, ErrCursorPositionNotReported
+	}
+	return
+}
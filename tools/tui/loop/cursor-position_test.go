@@ -0,0 +1,39 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestQueryExtendedCursorPosition(t *testing.T) {
+	for response, expected := range map[string][3]int{
+		"\x1b[?12;40;2R\x1b[?62c": {12, 40, 2},
+		"x\x1b[3;7R\x1b[?62;4c":   {3, 7, 1},
+		"\x1b[?5;9R\x1b[?62c":     {5, 9, 1},
+	} {
+		w := strings.Builder{}
+		row, col, page, err := QueryExtendedCursorPosition(&w, strings.NewReader(response))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, [3]int{row, col, page}); diff != "" || w.String() != "\x1b[?6n\x1b[c" {
+			t.Fatalf("Incorrect cursor position for %#v:\n%s", response, diff)
+		}
+	}
+	for _, response := range []string{"\x1b[?62c", "\x1b[?1;2;3;4R\x1b[?62c", "\x1b[?0;2R\x1b[?62c"} {
+		if _, _, _, err := QueryExtendedCursorPosition(io.Discard, strings.NewReader(response)); err != ErrCursorPositionNotReported {
+			t.Fatalf("Invalid response %#v not detected, error: %v", response, err)
+		}
+	}
+	if _, _, _, err := QueryExtendedCursorPosition(io.Discard, strings.NewReader("\x1b[?1;2R")); err == nil {
+		t.Fatalf("No error when the terminal did not respond to the device attributes query")
+	}
+}
@@ -0,0 +1,48 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestCursorBlinkRestoredOnExit(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		lp.OnInitialize = func() (string, error) {
+			lp.SetCursorBlink(false)
+			lp.Quit(0)
+			return "", nil
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v", err))
+	}
+	received := make(chan []byte, 1)
+	result := run_test_in_pty(t, "TestCursorBlinkRestoredOnExit", func(master *os.File) {
+		buf, data := make([]byte, 4096), []byte{}
+		for {
+			n, err := master.Read(buf)
+			data = append(data, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		received <- data
+	})
+	if result != "<nil>" {
+		t.Fatalf("Running the loop failed: %s", result)
+	}
+	data := <-received
+	steady := bytes.Index(data, []byte("\x1b[?12s\x1b[?12l"))
+	if steady < 0 {
+		t.Fatalf("The cursor was not made steady: %#v", string(data))
+	}
+	if !bytes.Contains(data[steady:], []byte("\x1b[?12r")) {
+		t.Fatalf("The terminal's cursor blink preference was not restored: %#v", string(data))
+	}
+}
@@ -0,0 +1,71 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestCursorVisibility(t *testing.T) {
+	lp, _ := New()
+	lp.cursor_visible = true
+	check := func(visible bool, expected string) {
+		t.Helper()
+		lp.SetCursorVisible(visible)
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected escape codes for SetCursorVisible(%v):\n%s", visible, diff)
+		}
+		if lp.IsCursorVisible() != visible {
+			t.Fatalf("IsCursorVisible() is not %v", visible)
+		}
+	}
+	check(true, "")
+	check(false, "\x1b[?25l")
+	check(false, "")
+	check(true, "\x1b[?25h")
+	// after the state escape codes, which show the cursor, a hidden cursor is
+	// hidden again
+	lp.cursor_visible = false
+	lp.restore_cursor_visibility(lp.cursor_visible)
+	if diff := cmp.Diff("\x1b[?25l", take_pending_writes(lp)); diff != "" || lp.IsCursorVisible() {
+		t.Fatalf("Hidden cursor not restored:\n%s", diff)
+	}
+	lp.restore_cursor_visibility(true)
+	if diff := cmp.Diff("", take_pending_writes(lp)); diff != "" || !lp.IsCursorVisible() {
+		t.Fatalf("Visible cursor not restored:\n%s", diff)
+	}
+}
+
+func TestCursorBlink(t *testing.T) {
+	lp, _ := New()
+	check := func(mode CursorBlinkMode, expected string) {
+		t.Helper()
+		lp.SetCursorBlinkMode(mode)
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected escape codes for SetCursorBlinkMode(%v):\n%s", mode, diff)
+		}
+		if lp.CursorBlinkMode() != mode {
+			t.Fatalf("CursorBlinkMode() is %v not %v", lp.CursorBlinkMode(), mode)
+		}
+	}
+	check(CURSOR_BLINK_DEFAULT, "")
+	// the terminal's preference is saved before it is first changed
+	check(CURSOR_BLINKING, "\x1b[?12s\x1b[?12h")
+	check(CURSOR_BLINKING, "")
+	check(CURSOR_STEADY, "\x1b[?12l")
+	check(CURSOR_BLINK_DEFAULT, "\x1b[?12r")
+	check(CURSOR_STEADY, "\x1b[?12s\x1b[?12l")
+	lp.SetCursorBlink(true)
+	if diff := cmp.Diff("\x1b[?12h", take_pending_writes(lp)); diff != "" || lp.CursorBlinkMode() != CURSOR_BLINKING {
+		t.Fatalf("SetCursorBlink(true) did not make the cursor blink:\n%s", diff)
+	}
+	lp.SetCursorBlink(false)
+	if diff := cmp.Diff("\x1b[?12l", take_pending_writes(lp)); diff != "" || lp.CursorBlinkMode() != CURSOR_STEADY {
+		t.Fatalf("SetCursorBlink(false) did not make the cursor steady:\n%s", diff)
+	}
+}
@@ -0,0 +1,35 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Print
+
+// Request a render the next time the loop is about to wait for events. Only
+// needed with LoopConfig.RenderOnlyWhenDirty, otherwise the loop renders
+// after every event anyway.
+func (self *Loop) MarkDirty() {
+	self.render_requested = true
+}
+
+// Render immediately and queue the output for writing, rather than waiting
+// until the current event has been handled. When called during a render, a
+// render is requested instead. Must be called in the loop goroutine.
+func (self *Loop) ForceRender() error {
+	if self.render_in_progress {
+		self.render_requested = true
+		return nil
+	}
+	return self.profiled("render", self.render)
+}
+
+// Called when an event is received, requests a render unless rendering is
+// left to the handlers of the event, see LoopConfig.RenderOnlyWhenDirty
+func (self *Loop) event_received_needs_render() {
+	if !self.Config.RenderOnlyWhenDirty {
+		self.render_requested = true
+	}
+}
@@ -0,0 +1,121 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"slices"
+
+	"kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// A widget that can have the keyboard focus, see Loop.RegisterFocusable()
+type Focusable interface {
+	OnFocus()
+	OnBlur()
+}
+
+type focusable struct {
+	widget    Focusable
+	tab_order int
+}
+
+func (self *Loop) focusable_index(f Focusable) int {
+	return slices.IndexFunc(self.focusables, func(x focusable) bool { return x.widget == f })
+}
+
+// Add a widget to the focus cycle, Tab and Shift+Tab move the focus between
+// registered widgets in increasing tab order, widgets with the same tab order
+// are in the order of registration. Registered widgets that are components
+// receive key and text events only while they have the focus, registered
+// components are unregistered automatically when unmounted. Registering an
+// already registered widget changes its tab order.
+func (self *Loop) RegisterFocusable(f Focusable, tabOrder int) {
+	if idx := self.focusable_index(f); idx > -1 {
+		self.focusables = slices.Delete(self.focusables, idx, idx+1)
+	}
+	self.focusables = append(self.focusables, focusable{f, tabOrder})
+	slices.SortStableFunc(self.focusables, func(a, b focusable) int { return a.tab_order - b.tab_order })
+}
+
+// Remove a widget from the focus cycle, removing the focus from it if it has
+// it. Returns false if the widget was not registered.
+func (self *Loop) UnregisterFocusable(f Focusable) bool {
+	idx := self.focusable_index(f)
+	if idx < 0 {
+		return false
+	}
+	if self.focused == f {
+		self.SetFocus(nil)
+	}
+	self.focusables = slices.Delete(self.focusables, idx, idx+1)
+	return true
+}
+
+// Give the keyboard focus to f, calling OnBlur() for the widget that has the
+// focus and OnFocus() for f. Use nil to remove the focus.
+func (self *Loop) SetFocus(f Focusable) {
+	if f == self.focused {
+		return
+	}
+	prev := self.focused
+	self.focused = f
+	self.render_requested = true
+	if prev != nil {
+		prev.OnBlur()
+	}
+	if f != nil {
+		f.OnFocus()
+	}
+}
+
+// The widget that has the keyboard focus or nil
+func (self *Loop) Focused() Focusable {
+	return self.focused
+}
+
+func (self *Loop) move_focus(delta int) {
+	if len(self.focusables) == 0 {
+		return
+	}
+	idx := self.focusable_index(self.focused)
+	if idx < 0 {
+		idx = utils.IfElse(delta > 0, 0, len(self.focusables)-1)
+	} else {
+		idx = (idx + delta + len(self.focusables)) % len(self.focusables)
+	}
+	self.SetFocus(self.focusables[idx].widget)
+}
+
+// Move the focus to the next widget in tab order, wrapping around
+func (self *Loop) FocusNext() { self.move_focus(1) }
+
+// Move the focus to the previous widget in tab order, wrapping around
+func (self *Loop) FocusPrev() { self.move_focus(-1) }
+
+// Cycle the focus on Tab and Shift+Tab when there are focusable widgets
+func (self *Loop) handle_focus_key(ev *KeyEvent) bool {
+	if len(self.focusables) == 0 {
+		return false
+	}
+	switch {
+	case ev.MatchesPressOrRepeat("tab"):
+		self.FocusNext()
+	case ev.MatchesPressOrRepeat("shift+tab"):
+		self.FocusPrev()
+	case ev.MatchesRelease("tab") || ev.MatchesRelease("shift+tab"):
+	default:
+		return false
+	}
+	ev.Handled = true
+	return true
+}
+
+// Registered focusable components receive key and text events only when
+// they have the focus
+func (self *Loop) accepts_keyboard_input(c Component) bool {
+	f, ok := c.(Focusable)
+	return !ok || f == self.focused || self.focusable_index(f) < 0
+}
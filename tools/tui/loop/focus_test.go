@@ -0,0 +1,63 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+type focus_test_widget struct {
+	ComponentBase
+	name string
+	log  *[]string
+}
+
+func (self *focus_test_widget) Render(lp *Loop) error { return nil }
+func (self *focus_test_widget) OnFocus()              { *self.log = append(*self.log, "focus:"+self.name) }
+func (self *focus_test_widget) OnBlur()               { *self.log = append(*self.log, "blur:"+self.name) }
+func (self *focus_test_widget) HandleKeyEvent(lp *Loop, ev *KeyEvent) error {
+	*self.log = append(*self.log, "key:"+self.name)
+	return nil
+}
+
+func TestFocusCycling(t *testing.T) {
+	lp, _ := New()
+	var log []string
+	w := func(name string) *focus_test_widget { return &focus_test_widget{name: name, log: &log} }
+	a, b, c, other := w("a"), w("b"), w("c"), w("other")
+	for _, x := range []*focus_test_widget{a, b, c, other} {
+		lp.MountComponent(x)
+	}
+	lp.RegisterFocusable(c, 2)
+	lp.RegisterFocusable(a, 1)
+	lp.RegisterFocusable(b, 1)
+	press := func(mods KeyModifiers, key string, expected ...string) {
+		t.Helper()
+		log = nil
+		if err := lp.handle_key_event(&KeyEvent{Type: PRESS, Mods: mods, Key: key}); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, log); diff != "" {
+			t.Fatalf("Unexpected events for: %s\n%s", key, diff)
+		}
+	}
+	// unfocused registered widgets do not get key events
+	press(0, "x", "key:other")
+	press(0, "TAB", "focus:a")
+	press(0, "TAB", "blur:a", "focus:b")
+	press(0, "x", "key:other", "key:b")
+	press(0, "TAB", "blur:b", "focus:c")
+	press(0, "TAB", "blur:c", "focus:a")
+	press(SHIFT, "TAB", "blur:a", "focus:c")
+	log = nil
+	lp.UnmountComponent(c)
+	if lp.Focused() != nil || len(log) != 1 || log[0] != "blur:c" {
+		t.Fatalf("Unmounted component still has the focus: %v", log)
+	}
+	press(SHIFT, "TAB", "focus:b")
+}
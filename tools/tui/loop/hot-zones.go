@@ -0,0 +1,91 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"slices"
+)
+
+var _ = fmt.Print
+
+// A rectangular area of the screen in pixels, positioned relative to the top
+// left corner of a cell, over which the pointer has the specified shape. Can
+// extend into neighboring cells and be smaller than a cell.
+type HotZone struct {
+	CellX, CellY               int
+	PixelOffsetX, PixelOffsetY int
+	PixelWidth, PixelHeight    int
+	Shape                      PointerShape
+}
+
+// Whether the pixel at (x, y) is inside the zone, for the specified cell size
+func (self HotZone) Contains(x, y, cell_width, cell_height int) bool {
+	left := self.CellX*cell_width + self.PixelOffsetX
+	top := self.CellY*cell_height + self.PixelOffsetY
+	return x >= left && x < left+self.PixelWidth && y >= top && y < top+self.PixelHeight
+}
+
+type hot_zone struct {
+	id   IdType
+	zone HotZone
+}
+
+// Change the pointer shape while the mouse is in the zone, as reported by
+// MOUSE_MOVE events with pixel coordinates. Zones registered later take
+// precedence when zones overlap. Returns an id that can be used to
+// unregister the zone.
+func (self *Loop) RegisterHotZone(hz HotZone) IdType {
+	self.hot_zone_id_counter++
+	self.hot_zones = append(self.hot_zones, hot_zone{self.hot_zone_id_counter, hz})
+	return self.hot_zone_id_counter
+}
+
+// Remove a zone, restoring the pointer shape if the mouse is in it
+func (self *Loop) UnregisterHotZone(id IdType) bool {
+	idx := slices.IndexFunc(self.hot_zones, func(z hot_zone) bool { return z.id == id })
+	if idx < 0 {
+		return false
+	}
+	if self.active_hot_zone == id {
+		self.set_active_hot_zone(nil)
+	}
+	self.hot_zones = slices.Delete(self.hot_zones, idx, idx+1)
+	return true
+}
+
+func (self *Loop) set_active_hot_zone(z *hot_zone) {
+	var id IdType
+	if z != nil {
+		id = z.id
+	}
+	if id == self.active_hot_zone {
+		return
+	}
+	if self.active_hot_zone != 0 {
+		self.PopPointerShape()
+	}
+	self.active_hot_zone = id
+	if z != nil {
+		self.PushPointerShape(z.zone.Shape)
+	}
+}
+
+func (self *Loop) update_hot_zones(ev *MouseEvent) {
+	if len(self.hot_zones) == 0 && self.active_hot_zone == 0 {
+		return
+	}
+	switch ev.Event_type {
+	case MOUSE_LEAVE:
+		self.set_active_hot_zone(nil)
+	case MOUSE_MOVE:
+		cw, ch := int(self.screen_size.CellWidth), int(self.screen_size.CellHeight)
+		for i := len(self.hot_zones) - 1; i >= 0; i-- {
+			if self.hot_zones[i].zone.Contains(ev.Pixel.X, ev.Pixel.Y, cw, ch) {
+				self.set_active_hot_zone(&self.hot_zones[i])
+				return
+			}
+		}
+		self.set_active_hot_zone(nil)
+	}
+}
@@ -0,0 +1,32 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"time"
+)
+
+var _ = fmt.Print
+
+// The most time given to OnIdle at a time, so that input is still processed
+// promptly when no timers are due
+const max_idle_budget = 50 * time.Millisecond
+
+func (self *Loop) idle_budget(now time.Time) time.Duration {
+	if len(self.timers) > 0 {
+		return max(0, min(max_idle_budget, self.timers[0].deadline.Sub(now)))
+	}
+	return max_idle_budget
+}
+
+// Called just before the loop waits for events. Returns true if the wait
+// must not block, because there is more idle work or a render was requested
+// by OnIdle.
+func (self *Loop) dispatch_idle() (bool, error) {
+	if self.OnIdle == nil {
+		return false, nil
+	}
+	more_work, err := self.OnIdle(self.idle_budget(time.Now()))
+	return more_work || self.render_requested, err
+}
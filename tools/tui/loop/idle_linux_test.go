@@ -0,0 +1,58 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var _ = fmt.Print
+
+func TestIdleWithPendingInput(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		idle_calls, got_text := 0, false
+		lp.OnText = func(string, bool, bool) error {
+			got_text = true
+			lp.Quit(0)
+			return nil
+		}
+		lp.OnIdle = func(time.Duration) (bool, error) {
+			if got_text {
+				return false, nil
+			}
+			// bypass the loop so that the input is sent while OnIdle runs
+			if idle_calls == 0 {
+				os.Stdout.WriteString("READY")
+			}
+			idle_calls++
+			time.Sleep(200 * time.Millisecond)
+			return true, nil
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%d %v", idle_calls, err))
+	}
+	result := run_test_in_pty(t, "TestIdleWithPendingInput", func(master *os.File) {
+		buf, received := make([]byte, 4096), []byte{}
+		for !bytes.Contains(received, []byte("READY")) {
+			n, err := master.Read(buf)
+			if err != nil {
+				return
+			}
+			received = append(received, buf[:n]...)
+		}
+		master.WriteString("x")
+		for {
+			if _, err := master.Read(buf); err != nil {
+				return
+			}
+		}
+	})
+	if result != "1 <nil>" {
+		t.Fatalf("OnIdle called again before processing pending input, calls and error: %s", result)
+	}
+}
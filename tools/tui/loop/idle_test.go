@@ -0,0 +1,52 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var _ = fmt.Print
+
+func TestIdleCallback(t *testing.T) {
+	lp, _ := New()
+	lp.timers, lp.timers_temp = make([]*timer, 0, 8), make([]*timer, 0, 8)
+	if dont_wait, err := lp.dispatch_idle(); dont_wait || err != nil {
+		t.Fatalf("Waiting prevented without an idle callback")
+	}
+	remaining := 3
+	var budgets []time.Duration
+	lp.OnIdle = func(budget time.Duration) (bool, error) {
+		budgets = append(budgets, budget)
+		remaining--
+		return remaining > 0, nil
+	}
+	for i := 0; i < 3; i++ {
+		dont_wait, err := lp.dispatch_idle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dont_wait != (i < 2) {
+			t.Fatalf("Incorrect waiting after idle call: %d", i)
+		}
+	}
+	if budgets[0] != max_idle_budget {
+		t.Fatalf("Incorrect budget with no timers: %s", budgets[0])
+	}
+	now := time.Now()
+	if _, err := lp.AddTimer(10*time.Millisecond, false, func(IdType) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b := lp.idle_budget(now.Add(5 * time.Millisecond)); b <= 0 || b > 10*time.Millisecond {
+		t.Fatalf("Budget not limited by the next timer: %s", b)
+	}
+	lp.OnIdle = func(time.Duration) (bool, error) {
+		lp.render_requested = true
+		return false, nil
+	}
+	if dont_wait, _ := lp.dispatch_idle(); !dont_wait {
+		t.Fatalf("Waiting not prevented when a render was requested")
+	}
+}
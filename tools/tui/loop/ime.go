@@ -0,0 +1,92 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var _ = fmt.Print
+
+// Text from an input method, such as fcitx or ibus, used for CJK input
+type IMEEvent struct {
+	// The text being composed. Terminals display it themselves and do not
+	// report it, so it is currently always empty.
+	Preedit string
+	// The text the input method committed
+	Committed string
+}
+
+func (self IMEEvent) String() string {
+	return fmt.Sprintf("IMEEvent{Preedit: %#v, Committed: %#v}", self.Preedit, self.Committed)
+}
+
+// When the kitty keyboard protocol reports all keys as escape codes, typed
+// text arrives only in key events, so text received outside a bracketed
+// paste is text committed by an input method, which kitty sends as is
+func (self *Loop) receives_ime_commits_as_text() bool {
+	return self.reports_all_keys_as_escape_codes() && self.kitty_keyboard_support == mode_supported
+}
+
+func (self *Loop) reports_all_keys_as_escape_codes() bool {
+	mode := self.terminal_options.kitty_keyboard_mode
+	return mode != NO_KEYBOARD_STATE_CHANGE && mode&REPORT_ALL_KEYS_AS_ESCAPE_CODES != 0
+}
+
+// The runes of a commit arrive one at a time, they are collected till the end
+// of the input they arrived in or the next escape code, so that the whole
+// commit is delivered as a single event
+func (self *Loop) queue_ime_commit(ch rune) {
+	self.pending_ime_commit = utf8.AppendRune(self.pending_ime_commit, ch)
+}
+
+func (self *Loop) flush_ime_commit() error {
+	if len(self.pending_ime_commit) == 0 {
+		return nil
+	}
+	text := string(self.pending_ime_commit)
+	self.pending_ime_commit = self.pending_ime_commit[:0]
+	return self.handle_ime_commit(text)
+}
+
+// Deliver any pending commit before handling an escape code, so that events
+// are delivered in the order they were received
+func (self *Loop) after_ime_commit(handler func([]byte) error) func([]byte) error {
+	return func(raw []byte) error {
+		if err := self.flush_ime_commit(); err != nil {
+			return err
+		}
+		return handler(raw)
+	}
+}
+
+// Deliver the committed text to OnIMEEvent and then as typed text
+func (self *Loop) handle_ime_commit(text string) error {
+	if self.OnIMEEvent != nil {
+		if err := self.OnIMEEvent(IMEEvent{Committed: text}); err != nil {
+			return err
+		}
+	}
+	return self.dispatch_text(text, true, false)
+}
+
+// Support for the kitty keyboard protocol is queried without waiting for the
+// response, terminals that do not support it do not respond, so until a
+// response arrives text is delivered as typed text
+func (self *Loop) query_kitty_keyboard_support() {
+	self.kitty_keyboard_support = mode_support_unknown
+	if self.reports_all_keys_as_escape_codes() {
+		self.kitty_keyboard_support = mode_support_querying
+		self.QueueWriteString("\x1b[?u")
+	}
+}
+
+func (self *Loop) handle_kitty_keyboard_support_response(csi string) bool {
+	if self.kitty_keyboard_support != mode_support_querying || !strings.HasPrefix(csi, "?") || !strings.HasSuffix(csi, "u") {
+		return false
+	}
+	self.kitty_keyboard_support = mode_supported
+	return true
+}
@@ -0,0 +1,50 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestIMEEvents(t *testing.T) {
+	lp, _ := New()
+	var events []string
+	lp.OnIMEEvent = func(ev IMEEvent) error {
+		events = append(events, ev.String())
+		return nil
+	}
+	lp.OnKeyEvent = func(ev *KeyEvent) error {
+		events = append(events, "key: "+ev.String())
+		ev.Handled = true
+		return nil
+	}
+	lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+		events = append(events, fmt.Sprintf("text: %s %v", text, from_key_event))
+		return nil
+	}
+	parse := func(input string, expected ...string) {
+		t.Helper()
+		events = nil
+		if err := lp.dispatch_input_data([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, events); diff != "" {
+			t.Fatalf("Unexpected events for %#v:\n%s", input, diff)
+		}
+	}
+	// until the terminal reports support for the kitty keyboard protocol
+	// text is typed text
+	lp.query_kitty_keyboard_support()
+	parse("日", "text: 日 false")
+	parse("\x1b[?31u")
+	parse("日本語\x1b[200~x\x1b[201~", `IMEEvent{Preedit: "", Committed: "日本語"}`, "text: 日本語 true", "text: x false", "text:  false")
+	parse("日本\x1b[97u語", `IMEEvent{Preedit: "", Committed: "日本"}`, "text: 日本 true", "key: PRESS{ a }",
+		`IMEEvent{Preedit: "", Committed: "語"}`, "text: 語 true")
+	lp.NoKeyboardStateChange()
+	parse("日", "text: 日 false")
+}
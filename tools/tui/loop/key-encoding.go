@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"kitty"
 )
@@ -374,6 +375,109 @@ func (self *KeyEvent) AsCSI() string {
 	return ans.String()
 }
 
+var legacy_letter_trailers = map[string]string{"UP": "A", "DOWN": "B", "RIGHT": "C", "LEFT": "D", "HOME": "H", "END": "F", "F1": "P", "F2": "Q", "F3": "R", "F4": "S"}
+var legacy_tilde_numbers = map[string]int{"INSERT": 2, "DELETE": 3, "PAGE_UP": 5, "PAGE_DOWN": 6, "F5": 15, "F6": 17, "F7": 18, "F8": 19, "F9": 20, "F10": 21, "F11": 23, "F12": 24}
+
+// Encode the key event as the bytes a terminal would send for it, for
+// injecting key input into other programs. Keys are encoded as legacy VT
+// sequences, understood by all programs, when that is possible and with the
+// kitty keyboard protocol, see AsCSI(), otherwise, for example, for release
+// events or keys with the super modifier.
+func (self *KeyEvent) ToCSI() string {
+	mods := self.Mods.WithoutLocks()
+	if self.Type != RELEASE && mods&^(SHIFT|ALT|CTRL) == 0 {
+		if ans := self.legacy_encoding(mods); ans != "" {
+			return ans
+		}
+	}
+	return self.AsCSI()
+}
+
+func legacy_ctrl_char(ch rune) (byte, bool) {
+	switch {
+	case ch >= 'a' && ch <= 'z':
+		return byte(ch-'a') + 1, true
+	case ch >= '2' && ch <= '8':
+		return "\x00\x1b\x1c\x1d\x1e\x1f\x7f"[ch-'2'], true
+	}
+	switch ch {
+	case ' ', '@':
+		return 0, true
+	case '[':
+		return 0x1b, true
+	case '\\':
+		return 0x1c, true
+	case ']':
+		return 0x1d, true
+	case '^', '~':
+		return 0x1e, true
+	case '/', '_':
+		return 0x1f, true
+	case '?':
+		return 0x7f, true
+	}
+	return 0, false
+}
+
+// Returns an empty string for key events that have no legacy encoding
+func (self *KeyEvent) legacy_encoding(mods KeyModifiers) string {
+	if t, found := legacy_letter_trailers[self.Key]; found {
+		if mods != 0 {
+			return fmt.Sprintf("\x1b[1;%d%s", mods+1, t)
+		}
+		if strings.HasPrefix(self.Key, "F") {
+			return "\x1bO" + t
+		}
+		return "\x1b[" + t
+	}
+	if n, found := legacy_tilde_numbers[self.Key]; found {
+		if mods != 0 {
+			return fmt.Sprintf("\x1b[%d;%d~", n, mods+1)
+		}
+		return fmt.Sprintf("\x1b[%d~", n)
+	}
+	prefix := ""
+	if mods&ALT != 0 {
+		prefix = "\x1b"
+	}
+	switch self.Key {
+	case "ENTER", "ESCAPE", "BACKSPACE", "TAB":
+		switch mods &^ ALT {
+		case 0:
+			return prefix + map[string]string{"ENTER": "\r", "ESCAPE": "\x1b", "BACKSPACE": "\x7f", "TAB": "\t"}[self.Key]
+		case CTRL:
+			if self.Key == "BACKSPACE" {
+				return prefix + "\b"
+			}
+		case SHIFT:
+			if self.Key == "TAB" {
+				return prefix + "\x1b[Z"
+			}
+		}
+		return ""
+	}
+	if _, is_functional := name_to_functional_number_map[self.Key]; is_functional || utf8.RuneCountInString(self.Key) != 1 {
+		return ""
+	}
+	switch mods &^ ALT {
+	case CTRL:
+		if ch, ok := legacy_ctrl_char([]rune(self.Key)[0]); ok {
+			return prefix + string([]byte{ch})
+		}
+		return ""
+	case 0, SHIFT:
+		text := self.Text
+		if text == "" {
+			text = self.Key
+			if mods&SHIFT != 0 && self.ShiftedKey != "" {
+				text = self.ShiftedKey
+			}
+		}
+		return prefix + text
+	}
+	return ""
+}
+
 func csi_number_for_name(key_name string) int {
 	if key_name == "" {
 		return 0
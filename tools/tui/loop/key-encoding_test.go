@@ -5,6 +5,7 @@ package loop
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -28,3 +29,55 @@ func TestKeyEventFromCSI(t *testing.T) {
 	test_text("121;;121u", "y", "")
 	test_text("121::122;;121u", "y", "z")
 }
+
+func TestKeyEventToCSI(t *testing.T) {
+	for csi, expected := range map[string]string{
+		"97u": "a", "97;2u": "a", "97:65;2;65u": "A", "97;3u": "\x1ba", "97;5u": "\x01", "97;7u": "\x1b\x01", "32;5u": "\x00",
+		"13u": "\r", "13;3u": "\x1b\r", "27u": "\x1b", "9;2u": "\x1b[Z", "127;5u": "\b", "A": "\x1b[A", "1;5D": "\x1b[1;5D",
+		"P": "\x1bOP", "13~": "\x1bOR", "3~": "\x1b[3~", "5;2~": "\x1b[5;2~", "1;65A": "\x1b[A",
+		// only representable with the kitty keyboard protocol
+		"97;9u": "\x1b[97;9u", "97;1:3u": "\x1b[97;1:3u", "97;6u": "\x1b[97;6u", "57399u": "\x1b[57399u",
+	} {
+		ev := KeyEventFromCSI(csi)
+		if diff := cmp.Diff(expected, ev.ToCSI()); diff != "" {
+			t.Fatalf("Unexpected encoding of %s (%#v):\n%s", ev, csi, diff)
+		}
+	}
+}
+
+func TestAltKeyTimeout(t *testing.T) {
+	lp, _ := New()
+	lp.timers, lp.timers_temp = make([]*timer, 0, 8), make([]*timer, 0, 8)
+	var keys []string
+	lp.OnKeyEvent = func(ev *KeyEvent) error {
+		keys = append(keys, ev.String())
+		return nil
+	}
+	test := func(expected ...string) {
+		t.Helper()
+		if err := lp.dispatch_timers(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, keys); diff != "" {
+			t.Fatalf("Unexpected key events:\n%s", diff)
+		}
+		keys = nil
+	}
+	input := func(data string) {
+		if err := lp.dispatch_input_data([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input("\x1b")
+	test("PRESS{ ESCAPE }")
+	// the rest of the sequence arrives before the timeout
+	input("\x1b")
+	input("[A")
+	test("PRESS{ UP }")
+	lp.Config.AltKeyTimeout = 0
+	input("\x1b")
+	test()
+	if !lp.escape_code_parser.InEscape() {
+		t.Fatalf("Pending ESC discarded with no timeout")
+	}
+}
@@ -0,0 +1,57 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+var _ = fmt.Print
+
+// Log the lifecycle of the loop, its start and stop at Info level, every
+// event received at Debug level, input that is dropped, such as truncated
+// pastes, at Warn level and the error the loop fails with, if any, at Error
+// level. Event details are in an event group. Set to nil, the
+// default, to disable logging. The logger must not write to the terminal.
+func (self *Loop) SetLogger(l *slog.Logger) {
+	self.logger = l
+}
+
+func (self *Loop) log_enabled(level slog.Level) bool {
+	return self.logger != nil && self.logger.Enabled(context.Background(), level)
+}
+
+// Count, trace and label the event and log it with the attributes, which
+// are key, value pairs as for slog.Group()
+func (self *Loop) record_event(t event_type, attrs ...any) {
+	self.event_stats.count(t)
+	self.tracer.begin(t)
+	self.label_event(t)
+	if self.log_enabled(slog.LevelDebug) {
+		self.logger.Debug("Event received", slog.Group("event", append([]any{"type", event_type_names[t]}, attrs...)...))
+	}
+}
+
+func (self *Loop) record_mouse_event(ev *MouseEvent) {
+	if ev.Event_type <= MOUSE_LEAVE {
+		self.record_event(mouse_press_event+event_type(ev.Event_type), "mouse", ev)
+	}
+}
+
+func (self *Loop) log_start() {
+	if self.log_enabled(slog.LevelInfo) {
+		self.logger.Info("Loop started", slog.Group("terminal", "id", self.TerminalID()))
+	}
+}
+
+func (self *Loop) log_stop(err error) {
+	if err != nil {
+		if self.log_enabled(slog.LevelError) {
+			self.logger.Error("Loop failed", "error", err)
+		}
+	} else if self.log_enabled(slog.LevelInfo) {
+		self.logger.Info("Loop stopped", "exit_code", self.exit_code, "stats", self.Stats())
+	}
+}
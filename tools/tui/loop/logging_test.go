@@ -0,0 +1,42 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestLoopLogging(t *testing.T) {
+	lp, _ := New()
+	lp.escape_code_parser.ParseString("a")
+	w := strings.Builder{}
+	lp.SetLogger(slog.New(slog.NewTextHandler(&w, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return a
+	}})))
+	lp.escape_code_parser.ParseString("b\x1b[97u\x1b]999;x\x1b\\")
+	lp.Config.MaxPasteSize = 1
+	lp.escape_code_parser.ParseString("\x1b[200~cd\x1b[201~")
+	lp.log_stop(errors.New("Some error"))
+	expected := []string{
+		`level=DEBUG msg="Event received" event.type=text event.text=b`,
+		`level=DEBUG msg="Event received" event.type=key event.key="PRESS{ a }"`,
+		`level=DEBUG msg="Event received" event.type=escape_code event.code=OSC event.size=5`,
+		`level=DEBUG msg="Event received" event.type=paste event.truncated=true`,
+		`level=WARN msg="Bracketed paste truncated to the maximum paste size" max_paste_size=1`,
+		`level=ERROR msg="Loop failed" error="Some error"`,
+	}
+	if diff := cmp.Diff(expected, strings.Split(strings.TrimSpace(w.String()), "\n")); diff != "" {
+		t.Fatalf("Unexpected log output:\n%s", diff)
+	}
+}
@@ -0,0 +1,129 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+var _ = fmt.Print
+
+type recorded_key_event struct {
+	Event KeyEvent `json:"event"`
+	// The time since the previous event in the macro
+	Delay time.Duration `json:"delay"`
+}
+
+type macro_recording struct {
+	id         IdType
+	events     []recorded_key_event
+	last_event time.Time
+}
+
+// Start recording key events as a macro, discarding any macro currently
+// being recorded. Events played back from macros are not recorded.
+func (self *Loop) StartMacroRecording() IdType {
+	self.macro_id_counter++
+	self.macro_recording = &macro_recording{id: self.macro_id_counter}
+	return self.macro_id_counter
+}
+
+// Stop recording, returning the id of the recorded macro and its key events.
+// Returns zero and nil if no macro is being recorded.
+func (self *Loop) StopMacroRecording() (IdType, []KeyEvent) {
+	r := self.macro_recording
+	if r == nil {
+		return 0, nil
+	}
+	self.macro_recording = nil
+	if self.macros == nil {
+		self.macros = make(map[IdType][]recorded_key_event)
+	}
+	self.macros[r.id] = r.events
+	ans := make([]KeyEvent, len(r.events))
+	for i, e := range r.events {
+		ans[i] = e.Event
+	}
+	return r.id, ans
+}
+
+func (self *Loop) record_key_event(ev *KeyEvent) {
+	if r := self.macro_recording; r != nil && !self.macro_playing {
+		now := time.Now()
+		e := recorded_key_event{Event: *ev}
+		if len(r.events) > 0 {
+			e.Delay = now.Sub(r.last_event)
+		}
+		e.Event.Handled = false
+		r.last_event = now
+		r.events = append(r.events, e)
+	}
+}
+
+// Serialize a recorded macro as JSON, for persistence, see LoadMacro()
+func (self *Loop) MacroJSON(id IdType) ([]byte, error) {
+	events, found := self.macros[id]
+	if !found {
+		return nil, fmt.Errorf("No macro with id: %d", id)
+	}
+	return json.Marshal(events)
+}
+
+// Load a macro serialized with MacroJSON(), returning its id
+func (self *Loop) LoadMacro(data []byte) (IdType, error) {
+	var events []recorded_key_event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return 0, fmt.Errorf("Failed to parse macro with error: %w", err)
+	}
+	if self.macros == nil {
+		self.macros = make(map[IdType][]recorded_key_event)
+	}
+	self.macro_id_counter++
+	self.macros[self.macro_id_counter] = events
+	return self.macro_id_counter, nil
+}
+
+func (self *Loop) play_key_event(ev KeyEvent) error {
+	self.macro_playing = true
+	defer func() { self.macro_playing = false }()
+	return self.process_key_event(&ev)
+}
+
+// Deliver the key events of a macro, repeatCount times, as if they had been
+// typed. Events are delivered with the delays between them with which they
+// were recorded, using timers, unless LoopConfig.InstantMacroPlayback is set,
+// in which case they are all delivered before this function returns.
+func (self *Loop) PlayMacro(id IdType, repeatCount int) error {
+	events, found := self.macros[id]
+	if !found {
+		return fmt.Errorf("No macro with id: %d", id)
+	}
+	if repeatCount < 1 || len(events) == 0 {
+		return nil
+	}
+	if self.Config.InstantMacroPlayback {
+		for i := 0; i < repeatCount; i++ {
+			for _, e := range events {
+				if err := self.play_key_event(e.Event); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	idx, total := 0, len(events)*repeatCount
+	var play_next TimerCallback
+	play_next = func(IdType) error {
+		e := events[idx%len(events)]
+		if idx++; idx < total {
+			if _, err := self.AddTimer(events[idx%len(events)].Delay, false, play_next); err != nil {
+				return err
+			}
+		}
+		return self.play_key_event(e.Event)
+	}
+	_, err := self.AddTimer(events[0].Delay, false, play_next)
+	return err
+}
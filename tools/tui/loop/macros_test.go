@@ -0,0 +1,79 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestMacros(t *testing.T) {
+	lp, _ := New()
+	var keys []string
+	lp.OnKeyEvent = func(ev *KeyEvent) error {
+		keys = append(keys, ev.Key)
+		ev.Handled = true
+		return nil
+	}
+	press := func(key string) {
+		if err := lp.handle_key_event(&KeyEvent{Type: PRESS, Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(expected ...string) {
+		t.Helper()
+		if diff := cmp.Diff(expected, keys); diff != "" {
+			t.Fatalf("Unexpected key events:\n%s", diff)
+		}
+		keys = nil
+	}
+	press("x")
+	id := lp.StartMacroRecording()
+	press("a")
+	press("b")
+	if rid, events := lp.StopMacroRecording(); rid != id || len(events) != 2 || events[1].Key != "b" || events[1].Handled {
+		t.Fatalf("Incorrect recorded macro: %d %v", rid, events)
+	}
+	press("y")
+	check("x", "a", "b", "y")
+
+	lp.Config.InstantMacroPlayback = true
+	lp.StartMacroRecording()
+	if err := lp.PlayMacro(id, 2); err != nil {
+		t.Fatal(err)
+	}
+	check("a", "b", "a", "b")
+	if _, events := lp.StopMacroRecording(); len(events) != 0 {
+		t.Fatalf("Events played back from a macro were recorded: %v", events)
+	}
+	if err := lp.PlayMacro(12345, 1); err == nil {
+		t.Fatalf("Playing an unknown macro did not fail")
+	}
+
+	data, err := lp.MacroJSON(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := lp.LoadMacro(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// timed playback delivers events from timers
+	lp.Config.InstantMacroPlayback = false
+	lp.timers, lp.timers_temp = make([]*timer, 0, 8), make([]*timer, 0, 8)
+	if err := lp.PlayMacro(loaded, 1); err != nil {
+		t.Fatal(err)
+	}
+	check()
+	for i := 0; i < 4 && len(lp.timers) > 0; i++ {
+		if err := lp.dispatch_timers(time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("a", "b")
+}
@@ -0,0 +1,161 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Print
+
+// Settings for controlling the mouse with the keyboard, see
+// Loop.EnableMouseEmulation()
+type MouseEmulationConfig struct {
+	// The number of cells the virtual pointer moves per arrow key press,
+	// defaults to one
+	Step int
+	// The button pressed by Space and Enter, defaults to LEFT_MOUSE_BUTTON
+	Button MouseButtonFlag
+}
+
+type mouse_emulation struct {
+	config MouseEmulationConfig
+	x, y   int
+}
+
+// Control the mouse with the keyboard. The arrow keys move a virtual pointer,
+// delivering MOUSE_MOVE events, Space and Enter click at its position and
+// Escape stops the emulation. While there are hot zones, see
+// RegisterHotZone(), the pointer only moves to cells in them, otherwise
+// anywhere on the screen. The terminal cannot move its pointer, so the
+// pointer shape is changed to a crosshair and to the shape of the hot zone the
+// virtual pointer is in, instead.
+func (self *Loop) EnableMouseEmulation(config MouseEmulationConfig) error {
+	if config.Step < 1 {
+		config.Step = 1
+	}
+	if config.Button == NO_MOUSE_BUTTON {
+		config.Button = LEFT_MOUSE_BUTTON
+	}
+	if self.mouse_emulation == nil {
+		self.PushPointerShape(CROSSHAIR_POINTER)
+		self.mouse_emulation = &mouse_emulation{}
+		for y := 0; y < self.mouse_emulation_height(); y++ {
+			if x := self.first_emulated_pointer_cell(y); x > -1 {
+				self.mouse_emulation.x, self.mouse_emulation.y = x, y
+				break
+			}
+		}
+	}
+	self.mouse_emulation.config = config
+	return self.send_emulated_mouse_event(MOUSE_MOVE, NO_MOUSE_BUTTON)
+}
+
+// Stop controlling the mouse with the keyboard, see EnableMouseEmulation()
+func (self *Loop) DisableMouseEmulation() (err error) {
+	if self.mouse_emulation != nil {
+		err = self.send_emulated_mouse_event(MOUSE_LEAVE, NO_MOUSE_BUTTON)
+		self.mouse_emulation = nil
+		self.PopPointerShape()
+	}
+	return
+}
+
+// The cell the virtual pointer is in and whether mouse emulation is enabled
+func (self *Loop) EmulatedPointerPosition() (x, y int, enabled bool) {
+	if self.mouse_emulation == nil {
+		return
+	}
+	return self.mouse_emulation.x, self.mouse_emulation.y, true
+}
+
+func (self *Loop) mouse_emulation_cell_size() (int, int) {
+	return max(1, int(self.screen_size.CellWidth)), max(1, int(self.screen_size.CellHeight))
+}
+
+func (self *Loop) mouse_emulation_height() int {
+	return max(1, int(self.screen_size.HeightCells))
+}
+
+func (self *Loop) emulated_pointer_allowed_in(x, y int) bool {
+	if x < 0 || y < 0 || (self.screen_size.WidthCells > 0 && x >= int(self.screen_size.WidthCells)) || (self.screen_size.HeightCells > 0 && y >= int(self.screen_size.HeightCells)) {
+		return false
+	}
+	if len(self.hot_zones) == 0 {
+		return true
+	}
+	cw, ch := self.mouse_emulation_cell_size()
+	px, py := CellToPixelCenter(x, cw), CellToPixelCenter(y, ch)
+	for _, z := range self.hot_zones {
+		if z.zone.Contains(px, py, cw, ch) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Loop) first_emulated_pointer_cell(y int) int {
+	for x := 0; x < max(1, int(self.screen_size.WidthCells)); x++ {
+		if self.emulated_pointer_allowed_in(x, y) {
+			return x
+		}
+	}
+	return -1
+}
+
+// Move the virtual pointer to the nearest allowed cell in the direction,
+// leaving it in place if there is none
+func (self *Loop) move_emulated_pointer(dx, dy int) error {
+	m := self.mouse_emulation
+	limit := max(int(self.screen_size.WidthCells), int(self.screen_size.HeightCells), 1)
+	for i := 1; i <= limit; i++ {
+		x, y := m.x+i*dx, m.y+i*dy
+		if x < 0 || y < 0 {
+			break
+		}
+		if self.emulated_pointer_allowed_in(x, y) {
+			m.x, m.y = x, y
+			return self.send_emulated_mouse_event(MOUSE_MOVE, NO_MOUSE_BUTTON)
+		}
+	}
+	return nil
+}
+
+func (self *Loop) send_emulated_mouse_event(event_type MouseEventType, button MouseButtonFlag) error {
+	m := self.mouse_emulation
+	cw, ch := self.mouse_emulation_cell_size()
+	ev := MouseEvent{Event_type: event_type, Buttons: button}.WithCell(m.x, m.y)
+	ev.Pixel.X, ev.Pixel.Y = CellToPixelCenter(m.x, cw), CellToPixelCenter(m.y, ch)
+	return self.handle_mouse_event(&ev)
+}
+
+func (self *Loop) handle_mouse_emulation_key(ev *KeyEvent) (bool, error) {
+	m := self.mouse_emulation
+	if m == nil {
+		return false, nil
+	}
+	var err error
+	step := m.config.Step
+	switch {
+	case ev.MatchesPressOrRepeat("left"):
+		err = self.move_emulated_pointer(-step, 0)
+	case ev.MatchesPressOrRepeat("right"):
+		err = self.move_emulated_pointer(step, 0)
+	case ev.MatchesPressOrRepeat("up"):
+		err = self.move_emulated_pointer(0, -step)
+	case ev.MatchesPressOrRepeat("down"):
+		err = self.move_emulated_pointer(0, step)
+	case ev.MatchesPressOrRepeat("space") || ev.MatchesPressOrRepeat("enter"):
+		if err = self.send_emulated_mouse_event(MOUSE_PRESS, m.config.Button); err == nil {
+			err = self.send_emulated_mouse_event(MOUSE_RELEASE, m.config.Button)
+		}
+	case ev.MatchesPressOrRepeat("escape"):
+		err = self.DisableMouseEmulation()
+	case ev.MatchesRelease("left") || ev.MatchesRelease("right") || ev.MatchesRelease("up") || ev.MatchesRelease("down") ||
+		ev.MatchesRelease("space") || ev.MatchesRelease("enter") || ev.MatchesRelease("escape"):
+	default:
+		return false, nil
+	}
+	ev.Handled = true
+	return true, err
+}
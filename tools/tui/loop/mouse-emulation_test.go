@@ -0,0 +1,55 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestMouseEmulation(t *testing.T) {
+	lp, _ := New()
+	lp.screen_size = ScreenSize{WidthCells: 10, HeightCells: 5, CellWidth: 10, CellHeight: 20, WidthPx: 100, HeightPx: 100, updated: true}
+	lp.RegisterHotZone(HotZone{CellX: 5, CellY: 2, PixelWidth: 30, PixelHeight: 20, Shape: POINTER_POINTER})
+	var events []string
+	lp.OnMouseEvent = func(ev *MouseEvent) error {
+		events = append(events, fmt.Sprintf("%s:%d,%d", ev.Event_type, ev.Cell.X, ev.Cell.Y))
+		return nil
+	}
+	press := func(key string) {
+		t.Helper()
+		ev := KeyEvent{Type: PRESS, Key: key}
+		if err := lp.process_key_event(&ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lp.EnableMouseEmulation(MouseEmulationConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("\x1b]22;crosshair\x1b\\\x1b]22;pointer\x1b\\", take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Unexpected pointer shapes:\n%s", diff)
+	}
+	for _, key := range []string{"LEFT", "RIGHT", "RIGHT", "RIGHT", "UP", " "} {
+		press(key)
+	}
+	if x, y, enabled := lp.EmulatedPointerPosition(); x != 7 || y != 2 || !enabled {
+		t.Fatalf("Incorrect position of the virtual pointer: %d, %d", x, y)
+	}
+	press("ESCAPE")
+	expected := []string{"move:5,2", "move:6,2", "move:7,2", "press:7,2", "release:7,2", "click:7,2", "leave:7,2"}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Fatalf("Unexpected mouse events:\n%s", diff)
+	}
+	if _, _, enabled := lp.EmulatedPointerPosition(); enabled || len(lp.pointer_shapes) != 0 {
+		t.Fatalf("Mouse emulation not disabled by escape, pointer shapes: %v", lp.pointer_shapes)
+	}
+	events = nil
+	press("LEFT")
+	if len(events) != 0 {
+		t.Fatalf("Arrow key moved the pointer with emulation disabled: %v", events)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var _ = fmt.Print
@@ -18,6 +19,8 @@ const (
 	MOUSE_RELEASE
 	MOUSE_MOVE
 	MOUSE_CLICK
+	// The pointer left the window
+	MOUSE_LEAVE
 )
 
 func (e MouseEventType) String() string {
@@ -30,10 +33,22 @@ func (e MouseEventType) String() string {
 		return "move"
 	case MOUSE_CLICK:
 		return "click"
+	case MOUSE_LEAVE:
+		return "leave"
 	}
 	return strconv.Itoa(int(e))
 }
 
+// Parse the names returned by MouseEventType.String()
+func ParseMouseEventType(s string) (MouseEventType, error) {
+	for e := MOUSE_PRESS; e <= MOUSE_LEAVE; e++ {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown mouse event type: %#v", s)
+}
+
 type PointerShape uint8
 
 const (
@@ -140,6 +155,16 @@ func (e PointerShape) String() string {
 	return strconv.Itoa(int(e))
 }
 
+// Parse the names returned by PointerShape.String()
+func ParsePointerShape(s string) (PointerShape, error) {
+	for e := DEFAULT_POINTER; e <= GRABBING_POINTER; e++ {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown pointer shape: %#v", s)
+}
+
 const (
 	SHIFT_INDICATOR  int = 1 << 2
 	ALT_INDICATOR        = 1 << 3
@@ -199,37 +224,197 @@ func (b MouseButtonFlag) String() string {
 	return ans
 }
 
+// The kind of input device that generated a mouse event
+type MouseDeviceFlag uint8
+
+const (
+	DEVICE_UNKNOWN MouseDeviceFlag = iota
+	DEVICE_MOUSE
+	DEVICE_TOUCH
+	DEVICE_PEN
+)
+
+func (e MouseDeviceFlag) String() string {
+	switch e {
+	case DEVICE_UNKNOWN:
+		return "unknown"
+	case DEVICE_MOUSE:
+		return "mouse"
+	case DEVICE_TOUCH:
+		return "touch"
+	case DEVICE_PEN:
+		return "pen"
+	}
+	return strconv.Itoa(int(e))
+}
+
 type MouseEvent struct {
 	Event_type  MouseEventType
 	Buttons     MouseButtonFlag
 	Mods        KeyModifiers
 	Cell, Pixel struct{ X, Y int }
+	// Identifies the pointer that generated the event when a terminal has
+	// several independent pointers, 0 is the primary pointer and is used for
+	// all events decoded from the SGR mouse protocol
+	PointerID uint8
+	// The kind of device that generated the event, DEVICE_MOUSE for events
+	// decoded from the SGR mouse protocol unless the terminal reports
+	// otherwise
+	DeviceFlags MouseDeviceFlag
 }
 
 func (e MouseEvent) String() string {
-	return fmt.Sprintf("MouseEvent{%s %s %s Cell:%v Pixel:%v}", e.Event_type, e.Buttons, e.Mods, e.Cell, e.Pixel)
+	pointer := ""
+	if e.PointerID != 0 {
+		pointer = fmt.Sprintf(" Pointer:%d", e.PointerID)
+	}
+	if e.DeviceFlags == DEVICE_TOUCH || e.DeviceFlags == DEVICE_PEN {
+		pointer += " Device:" + e.DeviceFlags.String()
+	}
+	return fmt.Sprintf("MouseEvent{%s %s %s Cell:%v Pixel:%v%s}", e.Event_type, e.Buttons, e.Mods, e.Cell, e.Pixel, pointer)
+}
+
+// Return a copy of the event with the Cell and Pixel coordinates shifted by
+// (dx, dy)
+func (e MouseEvent) Translate(dx, dy int) MouseEvent {
+	e.Cell.X += dx
+	e.Cell.Y += dy
+	e.Pixel.X += dx
+	e.Pixel.Y += dy
+	return e
+}
+
+// Return a copy of the event with coordinates relative to the specified
+// origin, for example, the top left cell of a widget
+func (e MouseEvent) TranslateToCellOrigin(originX, originY int) MouseEvent {
+	return e.Translate(-originX, -originY)
 }
 
-func pixel_to_cell(px, length, cell_length int) int {
-	px = max(0, min(px, length-1))
-	if cell_length > 0 {
-		return px / cell_length
+// Return a copy of the event with the specified Cell coordinates, useful for
+// building synthetic events
+func (e MouseEvent) WithCell(x, y int) MouseEvent {
+	e.Cell.X, e.Cell.Y = x, y
+	return e
+}
+
+// Combine a burst of events into a single event with the type and position of
+// the last event and the buttons and modifiers of all the events. Returns the
+// zero event for an empty slice.
+func AggregateMouseEvents(events []MouseEvent) (ans MouseEvent) {
+	if len(events) == 0 {
+		return
+	}
+	ans = events[len(events)-1]
+	for _, ev := range events {
+		ans.Buttons |= ev.Buttons
+		ans.Mods |= ev.Mods
+	}
+	return
+}
+
+// Convert a pixel coordinate along one axis of the screen into the cell
+// containing it. The coordinate is first clamped to [0, totalPixels-1], so
+// that positions reported outside the window, for example when dragging, map
+// to the first or last cell. Returns zero if cellSizePixels is not positive.
+func PixelToCell(px, totalPixels, cellSizePixels int) int {
+	px = max(0, min(px, totalPixels-1))
+	if cellSizePixels > 0 {
+		return px / cellSizePixels
 	}
 	return 0
 }
 
+// The pixel coordinate of the center of a cell along one axis, the inverse of
+// PixelToCell()
+func CellToPixelCenter(cell, cellSizePixels int) int {
+	return cell*cellSizePixels + cellSizePixels/2
+}
+
+type pending_press struct {
+	ev MouseEvent
+	at time.Time
+}
+
+// Synthesizes MOUSE_CLICK events from presses followed by releases in the same
+// or a nearby cell, for use with events from MouseEventFromCSI(). The loop
+// does this automatically. Presses and releases are tracked separately for
+// each pointer so that events from one pointer cannot complete a click
+// started by another. The zero value is ready to use.
+type MouseStateMachine struct {
+	// The maximum time between a press and a release for them to form a
+	// click, zero means no limit
+	ClickTimeout time.Duration
+
+	pending map[uint8]pending_press
+	now     func() time.Time
+}
+
+func is_click(press, release *MouseEvent) bool {
+	x := press.Cell.X - release.Cell.X
+	y := press.Cell.Y - release.Cell.Y
+	return x*x+y*y <= 4
+}
+
+// Returns the event followed by the MOUSE_CLICK event it completes, if any
+func (self *MouseStateMachine) Feed(e *MouseEvent) []*MouseEvent {
+	ans := []*MouseEvent{e}
+	now := time.Now
+	if self.now != nil {
+		now = self.now
+	}
+	switch e.Event_type {
+	case MOUSE_PRESS:
+		if self.pending == nil {
+			self.pending = make(map[uint8]pending_press)
+		}
+		self.pending[e.PointerID] = pending_press{*e, now()}
+	case MOUSE_RELEASE:
+		if p, found := self.pending[e.PointerID]; found {
+			delete(self.pending, e.PointerID)
+			if is_click(&p.ev, e) && (self.ClickTimeout <= 0 || now().Sub(p.at) <= self.ClickTimeout) {
+				click := *e
+				click.Event_type = MOUSE_CLICK
+				ans = append(ans, &click)
+			}
+		}
+	}
+	return ans
+}
+
+// When the screen size in pixels is not known, the cell of mouse events is
+// estimated with default_cell_size, one of default_cell_width and
+// default_cell_height
+func pixel_to_cell_or_estimate(px int, total_pixels, cell_size_pixels uint, default_cell_size int) int {
+	if total_pixels == 0 || cell_size_pixels == 0 {
+		return max(0, px) / default_cell_size
+	}
+	return PixelToCell(px, int(total_pixels), int(cell_size_pixels))
+}
+
 func decode_sgr_mouse(text string, screen_size ScreenSize) *MouseEvent {
 	last_letter := text[len(text)-1]
 	text = text[:len(text)-1]
 	parts := strings.Split(text, ";")
-	if len(parts) != 3 {
+	if len(parts) != 3 && len(parts) != 4 {
 		return nil
 	}
 	cb, err := strconv.Atoi(parts[0])
 	if err != nil {
 		return nil
 	}
-	ans := MouseEvent{}
+	ans := MouseEvent{DeviceFlags: DEVICE_MOUSE}
+	// the optional fourth parameter is the kind of device: 1 for a mouse, 2
+	// for a touch screen and 3 for a pen
+	if len(parts) == 4 {
+		d, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil
+		}
+		ans.DeviceFlags = DEVICE_UNKNOWN
+		if d >= int(DEVICE_MOUSE) && d <= int(DEVICE_PEN) {
+			ans.DeviceFlags = MouseDeviceFlag(d)
+		}
+	}
 	ans.Pixel.X, err = strconv.Atoi(parts[1])
 	if err != nil {
 		return nil
@@ -262,8 +447,8 @@ func decode_sgr_mouse(text string, screen_size ScreenSize) *MouseEvent {
 	if cb&CTRL_INDICATOR != 0 {
 		ans.Mods |= CTRL
 	}
-	ans.Cell.X = pixel_to_cell(ans.Pixel.X, int(screen_size.WidthPx), int(screen_size.CellWidth))
-	ans.Cell.Y = pixel_to_cell(ans.Pixel.Y, int(screen_size.HeightPx), int(screen_size.CellHeight))
+	ans.Cell.X = pixel_to_cell_or_estimate(ans.Pixel.X, screen_size.WidthPx, screen_size.CellWidth, default_cell_width)
+	ans.Cell.Y = pixel_to_cell_or_estimate(ans.Pixel.Y, screen_size.HeightPx, screen_size.CellHeight, default_cell_height)
 
 	return &ans
 }
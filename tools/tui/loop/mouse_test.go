@@ -0,0 +1,228 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestMouseEventTranslation(t *testing.T) {
+	ev := MouseEvent{Event_type: MOUSE_CLICK, Buttons: LEFT_MOUSE_BUTTON}.WithCell(10, 5)
+	ev.Pixel.X, ev.Pixel.Y = 100, 50
+	expected := ev
+	expected.Cell.X, expected.Cell.Y = 7, 1
+	expected.Pixel.X, expected.Pixel.Y = 97, 46
+	if diff := cmp.Diff(expected, ev.TranslateToCellOrigin(3, 4)); diff != "" {
+		t.Fatalf("Incorrect translation of %s:\n%s", ev, diff)
+	}
+	if diff := cmp.Diff(ev, ev.Translate(-3, -4).Translate(3, 4)); diff != "" {
+		t.Fatalf("Translation not reversible for %s:\n%s", ev, diff)
+	}
+	if ev.Cell.X != 10 || ev.Cell.Y != 5 {
+		t.Fatalf("Translation modified the original event: %s", ev)
+	}
+}
+
+func TestMouseEventAggregation(t *testing.T) {
+	evs := []MouseEvent{
+		{Event_type: MOUSE_PRESS, Buttons: LEFT_MOUSE_BUTTON, Mods: SHIFT},
+		{Event_type: MOUSE_MOVE, Buttons: LEFT_MOUSE_BUTTON | RIGHT_MOUSE_BUTTON},
+		{Event_type: MOUSE_MOVE, Buttons: RIGHT_MOUSE_BUTTON, Mods: CTRL},
+	}
+	for i := range evs {
+		evs[i] = evs[i].WithCell(i, 2*i)
+	}
+	expected := MouseEvent{Event_type: MOUSE_MOVE, Buttons: LEFT_MOUSE_BUTTON | RIGHT_MOUSE_BUTTON, Mods: SHIFT | CTRL}.WithCell(2, 4)
+	if diff := cmp.Diff(expected, AggregateMouseEvents(evs)); diff != "" {
+		t.Fatalf("Incorrect aggregation of mouse events:\n%s", diff)
+	}
+	if diff := cmp.Diff(MouseEvent{}, AggregateMouseEvents(nil)); diff != "" {
+		t.Fatalf("Incorrect aggregation of no mouse events:\n%s", diff)
+	}
+}
+
+func TestMouseEventTypeNames(t *testing.T) {
+	for _, name := range []string{"press", "release", "move", "click", "leave"} {
+		e, err := ParseMouseEventType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.String() != name {
+			t.Fatalf("Mouse event type name does not round trip: %#v != %#v", name, e.String())
+		}
+	}
+	if _, err := ParseMouseEventType("4"); err == nil {
+		t.Fatalf("Parsing an unknown mouse event type did not fail")
+	}
+}
+
+func TestMouseClicksPerPointer(t *testing.T) {
+	lp, _ := New()
+	var clicks []uint8
+	lp.OnMouseEvent = func(ev *MouseEvent) error {
+		if ev.Event_type == MOUSE_CLICK {
+			clicks = append(clicks, ev.PointerID)
+		}
+		return nil
+	}
+	send := func(event_type MouseEventType, pointer_id uint8) {
+		ev := MouseEvent{Event_type: event_type, Buttons: LEFT_MOUSE_BUTTON, PointerID: pointer_id}
+		if err := lp.handle_mouse_event(&ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ev := decode_sgr_mouse("0;10;20M", ScreenSize{}); ev == nil || ev.PointerID != 0 {
+		t.Fatalf("SGR mouse event not from the primary pointer: %v", ev)
+	}
+	// interleaved presses and releases from two pointers
+	send(MOUSE_PRESS, 0)
+	send(MOUSE_PRESS, 1)
+	send(MOUSE_RELEASE, 1)
+	send(MOUSE_RELEASE, 0)
+	// a release from another pointer does not complete a click
+	send(MOUSE_PRESS, 2)
+	send(MOUSE_RELEASE, 3)
+	if diff := cmp.Diff([]uint8{1, 0}, clicks); diff != "" {
+		t.Fatalf("Unexpected clicks:\n%s", diff)
+	}
+}
+
+func TestHotZones(t *testing.T) {
+	lp, _ := New()
+	lp.screen_size = ScreenSize{CellWidth: 10, CellHeight: 20}
+	// a resize handle straddling the border between cells 2 and 3 of row 1
+	id := lp.RegisterHotZone(HotZone{CellX: 2, CellY: 1, PixelOffsetX: 8, PixelWidth: 4, PixelHeight: 20, Shape: E_RESIZE_POINTER})
+	move := func(x, y int, expected string) {
+		t.Helper()
+		ev := MouseEvent{Event_type: MOUSE_MOVE}
+		ev.Pixel.X, ev.Pixel.Y = x, y
+		if err := lp.handle_mouse_event(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected output for move to (%d, %d):\n%s", x, y, diff)
+		}
+	}
+	move(27, 25, "")
+	move(28, 25, "\x1b]22;e-resize\x1b\\")
+	move(31, 39, "")
+	move(32, 25, "\x1b]22;<\x1b\\")
+	move(30, 30, "\x1b]22;e-resize\x1b\\")
+	if !lp.UnregisterHotZone(id) || lp.UnregisterHotZone(id) {
+		t.Fatalf("Unregistering did not report success exactly once")
+	}
+	if diff := cmp.Diff("\x1b]22;<\x1b\\", take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Pointer shape not restored after unregistering:\n%s", diff)
+	}
+}
+
+func TestPixelToCell(t *testing.T) {
+	for _, tc := range [][4]int{{0, 100, 10, 0}, {19, 100, 10, 1}, {-5, 100, 10, 0}, {150, 100, 10, 9}, {50, 100, 0, 0}} {
+		if actual := PixelToCell(tc[0], tc[1], tc[2]); actual != tc[3] {
+			t.Fatalf("PixelToCell(%d, %d, %d) = %d != %d", tc[0], tc[1], tc[2], actual, tc[3])
+		}
+	}
+	for cell := 0; cell < 10; cell++ {
+		if px := CellToPixelCenter(cell, 7); PixelToCell(px, 70, 7) != cell {
+			t.Fatalf("The center of cell %d at %d is not in the cell", cell, px)
+		}
+	}
+}
+
+func TestMouseStateMachine(t *testing.T) {
+	now := time.Now()
+	m := MouseStateMachine{ClickTimeout: time.Second, now: func() time.Time { return now }}
+	feed := func(event_type MouseEventType, x, y int, after time.Duration) (ans []MouseEventType) {
+		now = now.Add(after)
+		ev := MouseEvent{Event_type: event_type}.WithCell(x, y)
+		for _, e := range m.Feed(&ev) {
+			ans = append(ans, e.Event_type)
+		}
+		return
+	}
+	test := func(actual []MouseEventType, expected ...MouseEventType) {
+		t.Helper()
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("Unexpected events:\n%s", diff)
+		}
+	}
+	test(feed(MOUSE_PRESS, 1, 1, 0), MOUSE_PRESS)
+	test(feed(MOUSE_RELEASE, 1, 1, time.Millisecond), MOUSE_RELEASE, MOUSE_CLICK)
+	test(feed(MOUSE_RELEASE, 1, 1, time.Millisecond), MOUSE_RELEASE)
+	test(feed(MOUSE_PRESS, 1, 1, 0), MOUSE_PRESS)
+	test(feed(MOUSE_RELEASE, 9, 1, time.Millisecond), MOUSE_RELEASE)
+	test(feed(MOUSE_PRESS, 1, 1, 0), MOUSE_PRESS)
+	test(feed(MOUSE_RELEASE, 1, 1, 2*time.Second), MOUSE_RELEASE)
+	m.ClickTimeout = 0
+	test(feed(MOUSE_PRESS, 1, 1, 0), MOUSE_PRESS)
+	test(feed(MOUSE_RELEASE, 1, 1, time.Hour), MOUSE_RELEASE, MOUSE_CLICK)
+}
+
+func TestMouseEventWithoutScreenSize(t *testing.T) {
+	sz := ScreenSize{WidthCells: 10, HeightCells: 5, WidthPx: 100, HeightPx: 100, CellWidth: 10, CellHeight: 20}
+	if !sz.IsValid() || (ScreenSize{}).IsValid() {
+		t.Fatalf("Incorrect screen size validity")
+	}
+	for _, tc := range []struct {
+		sz         ScreenSize
+		x, y       int
+		csi_prefix string
+	}{
+		{sz, 3, 2, "0;35;45"},
+		{ScreenSize{}, 3, 2, "0;35;45"},
+		{ScreenSize{}, 50, 0, "0;500;-5"},
+	} {
+		ev := MouseEventFromCSI("<"+tc.csi_prefix+"M", tc.sz)
+		if ev == nil || ev.Cell.X != tc.x || ev.Cell.Y != tc.y {
+			t.Fatalf("Incorrect cell for %s with %v: %v", tc.csi_prefix, tc.sz, ev)
+		}
+	}
+}
+
+var all_pointer_shapes = []PointerShape{
+	DEFAULT_POINTER, TEXT_POINTER, POINTER_POINTER, HELP_POINTER, WAIT_POINTER, PROGRESS_POINTER,
+	CROSSHAIR_POINTER, CELL_POINTER, VERTICAL_TEXT_POINTER, MOVE_POINTER, E_RESIZE_POINTER,
+	NE_RESIZE_POINTER, NW_RESIZE_POINTER, N_RESIZE_POINTER, SE_RESIZE_POINTER, SW_RESIZE_POINTER,
+	S_RESIZE_POINTER, W_RESIZE_POINTER, EW_RESIZE_POINTER, NS_RESIZE_POINTER, NESW_RESIZE_POINTER,
+	NWSE_RESIZE_POINTER, ZOOM_IN_POINTER, ZOOM_OUT_POINTER, ALIAS_POINTER, COPY_POINTER,
+	NOT_ALLOWED_POINTER, NO_DROP_POINTER, GRAB_POINTER, GRABBING_POINTER,
+}
+
+func TestPointerShapeConstantsUnique(t *testing.T) {
+	seen := make(map[uint8]PointerShape, len(all_pointer_shapes))
+	for _, s := range all_pointer_shapes {
+		if prev, found := seen[uint8(s)]; found {
+			t.Fatalf("The pointer shapes %s and %s have the same value: %d", prev, s, uint8(s))
+		}
+		seen[uint8(s)] = s
+	}
+}
+
+func TestPointerShapeStringRoundTrip(t *testing.T) {
+	for _, s := range all_pointer_shapes {
+		if q, err := ParsePointerShape(s.String()); err != nil || q != s {
+			t.Fatalf("The pointer shape %d with name %#v did not round trip: %d %v", uint8(s), s.String(), uint8(q), err)
+		}
+	}
+	if _, err := ParsePointerShape("no-such-shape"); err == nil {
+		t.Fatalf("Parsing an unknown pointer shape did not fail")
+	}
+}
+
+func TestMouseDeviceFlags(t *testing.T) {
+	for csi, expected := range map[string]MouseDeviceFlag{"0;1;1M": DEVICE_MOUSE, "0;1;1;1M": DEVICE_MOUSE, "0;1;1;2m": DEVICE_TOUCH, "32;1;1;3M": DEVICE_PEN, "0;1;1;9M": DEVICE_UNKNOWN} {
+		ev := decode_sgr_mouse(csi, ScreenSize{})
+		if ev == nil || ev.DeviceFlags != expected {
+			t.Fatalf("Incorrect device for %#v: %v", csi, ev)
+		}
+	}
+	if decode_sgr_mouse("0;1;1;xM", ScreenSize{}) != nil || decode_sgr_mouse("0;1;1;1;1M", ScreenSize{}) != nil {
+		t.Fatalf("Invalid SGR mouse events decoded")
+	}
+}
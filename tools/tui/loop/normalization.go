@@ -0,0 +1,97 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ = fmt.Print
+
+// A Unicode normalization form, see NormalizeText()
+type NormalizationForm uint8
+
+const (
+	NO_NORMALIZATION NormalizationForm = iota
+	NFC
+	NFD
+	NFKC
+	NFKD
+)
+
+func (self NormalizationForm) String() string {
+	switch self {
+	case NO_NORMALIZATION:
+		return "NO_NORMALIZATION"
+	case NFC:
+		return "NFC"
+	case NFD:
+		return "NFD"
+	case NFKC:
+		return "NFKC"
+	case NFKD:
+		return "NFKD"
+	}
+	return fmt.Sprintf("NormalizationForm(%d)", uint8(self))
+}
+
+func (self NormalizationForm) norm_form() (norm.Form, bool) {
+	switch self {
+	case NFC:
+		return norm.NFC, true
+	case NFD:
+		return norm.NFD, true
+	case NFKC:
+		return norm.NFKC, true
+	case NFKD:
+		return norm.NFKD, true
+	}
+	return 0, false
+}
+
+// Convert text to the specified normalization form, so that, for example,
+// composed and decomposed forms of the same character compare equal
+func NormalizeText(s string, form NormalizationForm) string {
+	if f, ok := form.norm_form(); ok {
+		return f.String(s)
+	}
+	return s
+}
+
+// Pasted text arrives a character at a time, characters are held back until
+// the next character that starts a new normalization segment, so that
+// combining characters are normalized together with their base character
+type paste_normalizer struct {
+	pending []byte
+}
+
+func (self *Loop) dispatch_pasted_rune(ch rune) error {
+	f, ok := self.Config.PasteNormalization.norm_form()
+	if !ok {
+		return self.dispatch_text(string(ch), false, true)
+	}
+	p := &self.paste_normalizer
+	if len(p.pending) > 0 && (len(p.pending) >= norm.MaxSegmentSize || f.PropertiesString(string(ch)).BoundaryBefore()) {
+		if err := self.flush_pasted_text(); err != nil {
+			return err
+		}
+	}
+	p.pending = utf8.AppendRune(p.pending, ch)
+	return nil
+}
+
+func (self *Loop) flush_pasted_text() error {
+	p := &self.paste_normalizer
+	if len(p.pending) == 0 {
+		return nil
+	}
+	text := string(p.pending)
+	p.pending = p.pending[:0]
+	if f, ok := self.Config.PasteNormalization.norm_form(); ok {
+		text = f.String(text)
+	}
+	return self.dispatch_text(text, false, true)
+}
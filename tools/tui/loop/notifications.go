@@ -0,0 +1,296 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+type NotificationUrgency int
+
+const (
+	URGENCY_NORMAL NotificationUrgency = iota
+	URGENCY_LOW
+	URGENCY_CRITICAL
+)
+
+type NotificationOptions struct {
+	// Used to identify the notification in a NotificationEvent, must consist
+	// of only the characters a-zA-Z0-9-_+. If empty, an id is generated.
+	Id      string
+	Urgency NotificationUrgency
+	// The name of an icon, such as: error, warning, info, question or the
+	// name of an application whose icon should be used
+	Icon string
+	// Labels of buttons to show in the notification
+	Buttons []string
+}
+
+type NotificationEvent struct {
+	Id string
+	// The number of the button that was clicked, starting from 1, or zero if
+	// the notification itself was clicked
+	Button int
+	// True if the notification was closed rather than activated
+	Closed bool
+}
+
+// How to show notifications, see LoopConfig.NotificationFallback
+type NotificationFallback uint8
+
+const (
+	// Use the kitty notification protocol if the terminal supports it,
+	// otherwise OSC 9 if the terminal supports that, otherwise ring the bell
+	KITTY_THEN_OSC9 NotificationFallback = iota
+	// Always use OSC 9, without detecting support for the kitty protocol
+	OSC9_ONLY
+	// Always ring the bell instead of showing a notification
+	BELL_ONLY
+	// Use only the kitty notification protocol, showing nothing if the
+	// terminal does not support it
+	KITTY_ONLY
+)
+
+func (self NotificationFallback) String() string {
+	switch self {
+	case KITTY_THEN_OSC9:
+		return "KITTY_THEN_OSC9"
+	case OSC9_ONLY:
+		return "OSC9_ONLY"
+	case BELL_ONLY:
+		return "BELL_ONLY"
+	case KITTY_ONLY:
+		return "KITTY_ONLY"
+	}
+	return fmt.Sprintf("NotificationFallback(%d)", uint8(self))
+}
+
+// Terminals known to show OSC 9 notifications, by the lowercase name they
+// report, see TerminalID
+var osc9_terminals = []string{"iterm2", "conemu", "wezterm", "ghostty", "foot"}
+
+// Whether OSC 9 notifications are supported. When the terminal did not report
+// its name it is assumed that they are, as there is no way to tell.
+func supports_osc9_notifications(id TerminalID) bool {
+	return id.Name == "" || slices.Contains(osc9_terminals, strings.ToLower(id.Name))
+}
+
+type notification_support int
+
+const (
+	notification_support_unknown notification_support = iota
+	notification_support_querying
+	notification_support_available
+	notification_support_unavailable
+)
+
+type pending_notification struct {
+	title, body string
+	opts        NotificationOptions
+}
+
+// Max size of an OSC 99 payload before encoding
+const notification_chunk_size = 2048
+const notification_query_id = "kitty-notification-query"
+
+func is_valid_notification_id(id string) bool {
+	for _, ch := range id {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || strings.ContainsRune("-_+.", ch)) {
+			return false
+		}
+	}
+	return id != ""
+}
+
+// Split text into chunks of at most notification_chunk_size bytes on character boundaries
+func notification_chunks(text string) (ans []string) {
+	for len(text) > notification_chunk_size {
+		n := notification_chunk_size
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		ans = append(ans, text[:n])
+		text = text[n:]
+	}
+	return append(ans, text)
+}
+
+// The OSC 99 escape codes to show a notification
+func notification_escape_codes(title, body string, opts NotificationOptions, want_reports bool) string {
+	b64 := func(x string) string { return base64.StdEncoding.EncodeToString(utils.UnsafeStringToBytes(x)) }
+	ans := strings.Builder{}
+	metadata := "i=" + opts.Id + ":d=0"
+	if want_reports {
+		metadata += ":a=focus,report:c=1"
+	}
+	switch opts.Urgency {
+	case URGENCY_LOW:
+		metadata += ":u=0"
+	case URGENCY_CRITICAL:
+		metadata += ":u=2"
+	}
+	if opts.Icon != "" {
+		metadata += ":n=" + b64(opts.Icon)
+	}
+	write := func(payload_type, text string) {
+		for _, chunk := range notification_chunks(text) {
+			fmt.Fprintf(&ans, "\x1b]99;%s:e=1:p=%s;%s\x1b\\", metadata, payload_type, b64(chunk))
+			metadata = "i=" + opts.Id + ":d=0"
+		}
+	}
+	write("title", title)
+	if body != "" {
+		write("body", body)
+	}
+	if len(opts.Buttons) > 0 {
+		write("buttons", strings.Join(opts.Buttons, "\u2028"))
+	}
+	fmt.Fprintf(&ans, "\x1b]99;i=%s:d=1;\x1b\\", opts.Id)
+	return ans.String()
+}
+
+// The OSC 9 escape code used for terminals that do not support OSC 99
+func fallback_notification_escape_code(title, body string) string {
+	text := title
+	if body != "" {
+		text += ": " + body
+	}
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, text)
+	return "\x1b]9;" + text + "\x1b\\"
+}
+
+// Show a desktop notification using the kitty notification protocol (OSC 99).
+// Support for the protocol is detected the first time a notification is
+// shown, if the terminal does not support it, the notification is sent using
+// the simpler OSC 9 protocol instead, in which case urgency, icons and
+// buttons are ignored and no NotificationEvent is generated. Terminals that
+// support neither get a bell. This can be changed with
+// LoopConfig.NotificationFallback. Clicks on the notification and its
+// buttons are reported via OnNotification, when set.
+func (self *Loop) ShowNotification(title, body string, opts NotificationOptions) error {
+	if opts.Id == "" {
+		self.notification_id_counter++
+		opts.Id = "n" + strconv.FormatUint(uint64(self.notification_id_counter), 10)
+	} else if !is_valid_notification_id(opts.Id) {
+		return fmt.Errorf("Invalid notification id: %#v", opts.Id)
+	}
+	if title == "" {
+		title, body = body, ""
+	}
+	if title == "" {
+		return fmt.Errorf("Cannot show a notification with no title or body")
+	}
+	switch self.Config.NotificationFallback {
+	case OSC9_ONLY:
+		self.QueueWriteString(fallback_notification_escape_code(title, body))
+		return nil
+	case BELL_ONLY:
+		self.Beep()
+		return nil
+	}
+	switch self.notification_support {
+	case notification_support_unknown:
+		self.notification_support = notification_support_querying
+		// The primary device attributes query is answered by all terminals,
+		// if its response arrives before the OSC 99 response it means OSC 99
+		// is not supported
+		self.QueueWriteString("\x1b]99;i=" + notification_query_id + ":p=?;\x1b\\\x1b[c")
+		fallthrough
+	case notification_support_querying:
+		self.pending_notifications = append(self.pending_notifications, pending_notification{title, body, opts})
+	default:
+		self.send_notification(title, body, opts)
+	}
+	return nil
+}
+
+func (self *Loop) send_notification(title, body string, opts NotificationOptions) {
+	switch {
+	case self.notification_support == notification_support_available:
+		self.QueueWriteString(notification_escape_codes(title, body, opts, self.OnNotification != nil))
+	case self.Config.NotificationFallback == KITTY_ONLY:
+	case supports_osc9_notifications(self.TerminalID()):
+		self.QueueWriteString(fallback_notification_escape_code(title, body))
+	default:
+		self.Beep()
+	}
+}
+
+func (self *Loop) set_notification_support(available bool) {
+	self.notification_support = utils.IfElse(available, notification_support_available, notification_support_unavailable)
+	pending := self.pending_notifications
+	self.pending_notifications = nil
+	for _, n := range pending {
+		self.send_notification(n.title, n.body, n.opts)
+	}
+}
+
+// Handle the response to the primary device attributes query sent when
+// detecting notification support
+func (self *Loop) handle_notification_support_query_end(csi string) bool {
+	if self.notification_support != notification_support_querying || !strings.HasPrefix(csi, "?") || !strings.HasSuffix(csi, "c") {
+		return false
+	}
+	self.set_notification_support(false)
+	return true
+}
+
+// Parse an OSC 99 response of the form: 99;i=id:p=type;payload
+func parse_notification_response(raw string) (metadata map[string]string, payload string, ok bool) {
+	raw, ok = strings.CutPrefix(raw, "99;")
+	if !ok {
+		return
+	}
+	md, payload, _ := strings.Cut(raw, ";")
+	metadata = make(map[string]string)
+	for _, x := range strings.Split(md, ":") {
+		if k, v, found := strings.Cut(x, "="); found {
+			metadata[k] = v
+		}
+	}
+	return
+}
+
+func (self *Loop) handle_notification_response(raw []byte) (bool, error) {
+	metadata, payload, ok := parse_notification_response(string(raw))
+	if !ok {
+		return false, nil
+	}
+	if metadata["p"] == "?" {
+		if metadata["i"] == notification_query_id && self.notification_support == notification_support_querying {
+			self.set_notification_support(true)
+		}
+		return true, nil
+	}
+	if self.OnNotification == nil {
+		return true, nil
+	}
+	ev := NotificationEvent{Id: utils.IfElse(metadata["i"] == "", "0", metadata["i"])}
+	switch metadata["p"] {
+	case "close":
+		ev.Closed = true
+	case "":
+		if payload != "" {
+			if n, err := strconv.Atoi(payload); err == nil && n > 0 {
+				ev.Button = n
+			}
+		}
+	default:
+		return true, nil
+	}
+	return true, self.OnNotification(ev)
+}
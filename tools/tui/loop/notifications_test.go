@@ -0,0 +1,101 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestNotifications(t *testing.T) {
+	lp, _ := New()
+	written := func() string {
+		ans := strings.Builder{}
+		for _, w := range lp.pending_writes {
+			ans.WriteString(w.str)
+		}
+		lp.pending_writes = nil
+		return ans.String()
+	}
+	events := []NotificationEvent{}
+	lp.OnNotification = func(ev NotificationEvent) error {
+		events = append(events, ev)
+		return nil
+	}
+	if err := lp.ShowNotification("", "", NotificationOptions{}); err == nil {
+		t.Fatalf("Empty notification did not fail")
+	}
+	if err := lp.ShowNotification("t", "", NotificationOptions{Id: "bad id"}); err == nil {
+		t.Fatalf("Invalid notification id did not fail")
+	}
+	if err := lp.ShowNotification("Hello", "World", NotificationOptions{Id: "x", Urgency: URGENCY_CRITICAL, Icon: "error", Buttons: []string{"A", "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("\x1b]99;i="+notification_query_id+":p=?;\x1b\\\x1b[c", written()); diff != "" {
+		t.Fatalf("Support query not sent:\n%s", diff)
+	}
+	if err := lp.handle_osc([]byte("99;i=" + notification_query_id + ":p=?;a=focus,report:o=always")); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\x1b]99;i=x:d=0:a=focus,report:c=1:u=2:n=ZXJyb3I=:e=1:p=title;SGVsbG8=\x1b\\" +
+		"\x1b]99;i=x:d=0:e=1:p=body;V29ybGQ=\x1b\\" +
+		"\x1b]99;i=x:d=0:e=1:p=buttons;QeKAqEI=\x1b\\" +
+		"\x1b]99;i=x:d=1;\x1b\\"
+	if diff := cmp.Diff(expected, written()); diff != "" {
+		t.Fatalf("Incorrect notification escape codes:\n%s", diff)
+	}
+	// the device attributes response no longer affects support once detected
+	_ = lp.handle_csi([]byte("?62;c"))
+	if lp.notification_support != notification_support_available {
+		t.Fatalf("Notification support changed by device attributes response")
+	}
+	for _, r := range []string{"99;i=x;", "99;i=x;2", "99;i=x:p=close;", "99;;"} {
+		if err := lp.handle_osc([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff([]NotificationEvent{{Id: "x"}, {Id: "x", Button: 2}, {Id: "x", Closed: true}, {Id: "0"}}, events); diff != "" {
+		t.Fatalf("Incorrect notification events:\n%s", diff)
+	}
+	chunks := notification_chunks(strings.Repeat("a", notification_chunk_size-1) + "é")
+	if len(chunks) != 2 || chunks[1] != "é" {
+		t.Fatalf("Incorrect chunking: %#v", chunks)
+	}
+
+	// fallback for terminals that do not support OSC 99
+	lp, _ = New()
+	_ = lp.ShowNotification("Hello", "a\nb", NotificationOptions{})
+	_ = written()
+	_ = lp.handle_csi([]byte("?62;c"))
+	if diff := cmp.Diff("\x1b]9;Hello: a b\x1b\\", written()); diff != "" {
+		t.Fatalf("Incorrect fallback notification:\n%s", diff)
+	}
+	_ = lp.ShowNotification("Again", "", NotificationOptions{})
+	if diff := cmp.Diff("\x1b]9;Again\x1b\\", written()); diff != "" {
+		t.Fatalf("Incorrect fallback notification:\n%s", diff)
+	}
+	terminal_id_cache.Lock()
+	saved := terminal_id_cache.id
+	terminal_id_cache.id.Name = "xterm"
+	terminal_id_cache.Unlock()
+	defer func() {
+		terminal_id_cache.Lock()
+		terminal_id_cache.id = saved
+		terminal_id_cache.Unlock()
+	}()
+	for _, x := range []struct {
+		fallback NotificationFallback
+		expected string
+	}{{KITTY_THEN_OSC9, "\a"}, {KITTY_ONLY, ""}, {BELL_ONLY, "\a"}, {OSC9_ONLY, "\x1b]9;Again\x1b\\"}} {
+		lp.Config.NotificationFallback = x.fallback
+		_ = lp.ShowNotification("Again", "", NotificationOptions{})
+		if diff := cmp.Diff(x.expected, written()); diff != "" {
+			t.Fatalf("Incorrect notification with %s:\n%s", x.fallback, diff)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// The terminator of an OSC escape code
+type TerminatorStyle uint8
+
+const (
+	// ESC \, the terminator defined by ECMA-48
+	ST_TERMINATOR TerminatorStyle = iota
+	// The BEL character, used by some older terminals
+	BEL_TERMINATOR
+)
+
+func (self TerminatorStyle) String() string {
+	switch self {
+	case ST_TERMINATOR:
+		return "ST_TERMINATOR"
+	case BEL_TERMINATOR:
+		return "BEL_TERMINATOR"
+	}
+	return fmt.Sprintf("TerminatorStyle(%d)", uint8(self))
+}
+
+func (self TerminatorStyle) terminator() string {
+	if self == BEL_TERMINATOR {
+		return "\a"
+	}
+	return "\x1b\\"
+}
+
+// Build an OSC escape code of the form: ESC ] code ; param ; param ... terminator
+type OSCBuilder struct {
+	code   int
+	params []string
+}
+
+// Start building an OSC escape code with the specified code, for example:
+// NewOSCBuilder(8).Param("").Param(url).Terminate(lp.OSCTerminatorStyle()).
+// Not named OSC() as that is the EscapeCodeType passed to OnEscapeCode.
+func NewOSCBuilder(code int) *OSCBuilder {
+	return &OSCBuilder{code: code}
+}
+
+// Append a parameter, parameters are separated by semi-colons
+func (self *OSCBuilder) Param(s string) *OSCBuilder {
+	self.params = append(self.params, s)
+	return self
+}
+
+// The escape code terminated in the specified style, see Loop.OSCTerminatorStyle()
+func (self *OSCBuilder) Terminate(style TerminatorStyle) string {
+	ans := strings.Builder{}
+	ans.WriteString("\x1b]")
+	ans.WriteString(strconv.Itoa(self.code))
+	for _, p := range self.params {
+		ans.WriteByte(';')
+		ans.WriteString(p)
+	}
+	ans.WriteString(style.terminator())
+	return ans.String()
+}
+
+// The terminator style to use for OSC escape codes sent to the terminal. This
+// is ST unless the terminal has terminated an OSC sent to the program, such
+// as a response to a query, with BEL, since terminals that do not understand
+// ST reply with BEL.
+func (self *Loop) OSCTerminatorStyle() TerminatorStyle {
+	if self.osc_terminated_by_bel {
+		return BEL_TERMINATOR
+	}
+	return ST_TERMINATOR
+}
@@ -0,0 +1,38 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestOSCBuilder(t *testing.T) {
+	if diff := cmp.Diff("\x1b]8;;https://x\x1b\\", NewOSCBuilder(8).Param("").Param("https://x").Terminate(ST_TERMINATOR)); diff != "" {
+		t.Fatalf("Incorrect OSC:\n%s", diff)
+	}
+	if diff := cmp.Diff("\x1b]112\a", NewOSCBuilder(112).Terminate(BEL_TERMINATOR)); diff != "" {
+		t.Fatalf("Incorrect OSC:\n%s", diff)
+	}
+	lp, _ := New()
+	test := func(response string, expected TerminatorStyle) {
+		t.Helper()
+		if err := lp.escape_code_parser.ParseString(response); err != nil {
+			t.Fatal(err)
+		}
+		if actual := lp.OSCTerminatorStyle(); actual != expected {
+			t.Fatalf("Incorrect terminator style after: %#v: %s != %s", response, actual, expected)
+		}
+	}
+	test("", ST_TERMINATOR)
+	test("\x1b]11;rgb:0/0/0\a", BEL_TERMINATOR)
+	lp.SetWindowTitle("title")
+	if diff := cmp.Diff("\x1b]2;title\a", take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Window title not set with the detected terminator:\n%s", diff)
+	}
+	test("\x1b]11;rgb:0/0/0\x1b\\", ST_TERMINATOR)
+}
@@ -0,0 +1,77 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"sync"
+)
+
+var _ = fmt.Print
+
+// An event posted to the loop from some goroutine, see Loop.PostEvent()
+type PostedEvent struct {
+	// Increases by one with every posted event, the order in which the
+	// events are delivered
+	Seq  uint64
+	Data any
+}
+
+type posted_events struct {
+	mutex sync.Mutex
+	queue []PostedEvent
+	seq   uint64
+}
+
+func (self *posted_events) post(data any) uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	// the sequence number is assigned under the same lock as the event is
+	// queued, so the queue is always in sequence order
+	self.seq++
+	self.queue = append(self.queue, PostedEvent{Seq: self.seq, Data: data})
+	return self.seq
+}
+
+func (self *posted_events) take() (ans []PostedEvent) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	ans, self.queue = self.queue, nil
+	return
+}
+
+func (self *posted_events) has_pending() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.queue) > 0
+}
+
+// Post an event to be delivered to OnPostedEvent in the loop goroutine. Can
+// be called from any goroutine, including before the loop is run. Events are
+// delivered in the order PostEvent() returned for them, in particular, in
+// the order they were posted by any single goroutine. The sequence numbers
+// are shared by all goroutines rather than being per goroutine and sorted
+// before delivery, as they are assigned under the same lock as the events
+// are queued, which keeps the queue in FIFO order without sorting. Returns
+// the sequence number of the event.
+func (self *Loop) PostEvent(data any) uint64 {
+	seq := self.posted_events.post(data)
+	self.WakeupMainThread()
+	return seq
+}
+
+func (self *Loop) dispatch_posted_events() error {
+	for _, ev := range self.posted_events.take() {
+		if handled, err := self.dispatch_to_typed_handlers(ev.Data); err != nil {
+			return err
+		} else if handled {
+			continue
+		}
+		if self.OnPostedEvent != nil {
+			if err := self.profiled("posted_event", func() error { return self.OnPostedEvent(ev) }); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestPostedEventOrder(t *testing.T) {
+	lp, _ := New()
+	type event struct{ producer, n int }
+	const num_producers, num_events = 8, 200
+	var wg sync.WaitGroup
+	for p := 0; p < num_producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < num_events; i++ {
+				lp.PostEvent(event{p, i})
+			}
+		}(p)
+	}
+	wg.Wait()
+	var last_seq uint64
+	next := make([]int, num_producers)
+	lp.OnPostedEvent = func(ev PostedEvent) error {
+		e := ev.Data.(event)
+		if ev.Seq != last_seq+1 || e.n != next[e.producer] {
+			t.Fatalf("Event delivered out of order: %d after %d: %#v", ev.Seq, last_seq, e)
+		}
+		last_seq = ev.Seq
+		next[e.producer]++
+		return nil
+	}
+	if err := lp.dispatch_posted_events(); err != nil {
+		t.Fatal(err)
+	}
+	if last_seq != num_producers*num_events {
+		t.Fatalf("Only %d events were delivered", last_seq)
+	}
+}
+
+func TestPostedEventOrderWhileDispatching(t *testing.T) {
+	lp, _ := New()
+	type event struct{ producer, n int }
+	const num_producers, num_events = 8, 200
+	var last_seq uint64
+	next := make([]int, num_producers)
+	var failure string
+	lp.OnPostedEvent = func(ev PostedEvent) error {
+		e := ev.Data.(event)
+		if failure == "" && (ev.Seq != last_seq+1 || e.n != next[e.producer]) {
+			failure = fmt.Sprintf("Event delivered out of order: %d after %d: %#v", ev.Seq, last_seq, e)
+		}
+		last_seq = ev.Seq
+		next[e.producer]++
+		return nil
+	}
+	var wg sync.WaitGroup
+	start := make(chan bool)
+	for p := 0; p < num_producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < num_events; i++ {
+				lp.PostEvent(event{p, i})
+			}
+		}(p)
+	}
+	producers_done := make(chan bool)
+	go func() { wg.Wait(); close(producers_done) }()
+	// dispatch in this goroutine, as the loop does, while the producers post
+	close(start)
+	for done := false; !done; {
+		select {
+		case <-producers_done:
+			done = true
+		default:
+		}
+		if err := lp.dispatch_posted_events(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if failure != "" {
+		t.Fatal(failure)
+	}
+	if last_seq != num_producers*num_events {
+		t.Fatalf("Only %d events were delivered", last_seq)
+	}
+}
+
+func TestTypedPostedEventHandlers(t *testing.T) {
+	lp, _ := New()
+	type resized struct{ width, height int }
+	var ints []int
+	var sizes []resized
+	var untyped []any
+	RegisterTypedHandler(lp, func(n int) error { ints = append(ints, n); return nil })
+	RegisterTypedHandler(lp, func(r resized) error { sizes = append(sizes, r); return nil })
+	RegisterTypedHandler(lp, func(r resized) error { sizes = append(sizes, resized{-r.width, -r.height}); return nil })
+	lp.OnPostedEvent = func(ev PostedEvent) error { untyped = append(untyped, ev.Data); return nil }
+	lp.PostEvent(1)
+	lp.PostEvent(resized{80, 24})
+	lp.PostEvent("text")
+	lp.PostEvent(2)
+	if err := lp.dispatch_posted_events(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 2}, ints); diff != "" {
+		t.Fatalf("Unexpected int events:\n%s", diff)
+	}
+	if diff := cmp.Diff([]resized{{80, 24}, {-80, -24}}, sizes, cmp.AllowUnexported(resized{})); diff != "" {
+		t.Fatalf("Unexpected resize events:\n%s", diff)
+	}
+	if diff := cmp.Diff([]any{"text"}, untyped); diff != "" {
+		t.Fatalf("Unexpected untyped events:\n%s", diff)
+	}
+}
@@ -0,0 +1,69 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/pprof"
+)
+
+var _ = fmt.Print
+
+type profiler_state struct {
+	active bool
+	// the labels of the handler currently running
+	ctx context.Context
+}
+
+// Start CPU profiling, writing the profile to w, see runtime/pprof. Samples
+// taken while the loop handles input, signals, timers and renders are
+// labelled with the name of the handler, such as csi, rune, signal, timers
+// or render, and the input ones with the type of the event, the same as the
+// keys of EventStats(), so that flamegraphs can be filtered by them, for
+// example, with go tool pprof -tagfocus event=key. Only one CPU profile can
+// be active per process.
+func (self *Loop) StartProfiling(w io.Writer) error {
+	if self.profiler.active {
+		return fmt.Errorf("Profiling is already active")
+	}
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return err
+	}
+	self.profiler.active = true
+	return nil
+}
+
+// Stop CPU profiling, finishing writing the profile started by StartProfiling()
+func (self *Loop) StopProfiling() error {
+	if !self.profiler.active {
+		return fmt.Errorf("Profiling is not active")
+	}
+	pprof.StopCPUProfile()
+	self.profiler = profiler_state{}
+	return nil
+}
+
+// Run f with the handler label when profiling
+func (self *Loop) profiled(handler string, f func() error) (err error) {
+	if !self.profiler.active {
+		return f()
+	}
+	pprof.Do(context.Background(), pprof.Labels("handler", handler), func(ctx context.Context) {
+		prev := self.profiler.ctx
+		self.profiler.ctx = ctx
+		err = f()
+		self.profiler.ctx = prev
+	})
+	return
+}
+
+// Add the event label to the labels of the running handler. They are
+// restored when the handler returns.
+func (self *Loop) label_event(t event_type) {
+	if self.profiler.active && self.profiler.ctx != nil {
+		self.profiler.ctx = pprof.WithLabels(self.profiler.ctx, pprof.Labels("event", event_type_names[t]))
+		pprof.SetGoroutineLabels(self.profiler.ctx)
+	}
+}
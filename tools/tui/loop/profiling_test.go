@@ -0,0 +1,47 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestProfiling(t *testing.T) {
+	lp, _ := New()
+	var labels []string
+	lp.OnKeyEvent = func(ev *KeyEvent) error {
+		if lp.profiler.ctx == nil {
+			labels = append(labels, "unlabelled")
+			return nil
+		}
+		h, _ := pprof.Label(lp.profiler.ctx, "handler")
+		e, _ := pprof.Label(lp.profiler.ctx, "event")
+		labels = append(labels, h+":"+e)
+		return nil
+	}
+	lp.escape_code_parser.ParseString("\x1b[97u")
+	if lp.StopProfiling() == nil {
+		t.Fatalf("Stopping profiling when not profiling did not fail")
+	}
+	w := bytes.Buffer{}
+	if err := lp.StartProfiling(&w); err != nil {
+		t.Fatal(err)
+	}
+	if lp.StartProfiling(&w) == nil {
+		t.Fatalf("Starting profiling twice did not fail")
+	}
+	lp.escape_code_parser.ParseString("\x1b[97u")
+	if err := lp.StopProfiling(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"unlabelled", "csi:key"}, labels); diff != "" || w.Len() == 0 {
+		t.Fatalf("Unexpected profiling labels, profile size: %d\n%s", w.Len(), diff)
+	}
+}
@@ -0,0 +1,92 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+// Set in the child process of run_test_in_pty() to the file it must write its
+// result to
+const pty_test_output_env = "KITTY_TEST_PTY_OUTPUT"
+
+func open_pty(t *testing.T) (master, slave *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("Cannot open a pty: %s", err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err == nil {
+		err = unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0)
+	}
+	if err == nil {
+		slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		t.Skipf("Cannot open a pty: %s", err)
+	}
+	return
+}
+
+// Run the test named name again in a child process that has a pty as its
+// controlling terminal, so that it can run a Loop. interact is called with
+// the master end of the pty and must keep reading from it, when nil the
+// output is discarded. Returns the result written by the child.
+func run_test_in_pty(t *testing.T, name string, interact func(master *os.File)) string {
+	output, err := run_in_pty(t, name, interact)
+	if err != nil {
+		t.Fatalf("The child process failed: %s", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("The child process wrote no result: %s", err)
+	}
+	return string(data)
+}
+
+// As run_test_in_pty() but returns the error the child process exited with
+// and the path to the file it writes its result to, if any
+func run_in_pty(t *testing.T, name string, interact func(master *os.File)) (output string, err error) {
+	master, slave := open_pty(t)
+	defer master.Close()
+	output = filepath.Join(t.TempDir(), "output")
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(), pty_test_output_env+"="+output)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	if interact == nil {
+		interact = func(master *os.File) { _, _ = io.Copy(io.Discard, master) }
+	}
+	go interact(master)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatalf("Timed out waiting for the child process")
+	}
+	return
+}
+
+// Write the result of the child process of run_test_in_pty() and exit
+func write_pty_test_result(output string, result string) {
+	_ = os.WriteFile(output, []byte(result), 0o600)
+	os.Exit(0)
+}
@@ -26,9 +26,34 @@ func (self *Loop) dispatch_input_data(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if err = self.flush_ime_commit(); err != nil {
+		return err
+	}
+	self.schedule_pending_escape()
 	return nil
 }
 
+// A terminal sends a bare ESC for the Escape key and also as the first byte of
+// longer sequences, so an ESC at the end of the input is delivered as an
+// Escape key press only if no more input arrives within AltKeyTimeout
+func (self *Loop) schedule_pending_escape() {
+	if self.pending_escape_timer != 0 {
+		self.remove_timer(self.pending_escape_timer)
+		self.pending_escape_timer = 0
+	}
+	if self.Config.AltKeyTimeout <= 0 || !self.escape_code_parser.InEscape() {
+		return
+	}
+	self.pending_escape_timer, _ = self.add_timer(self.Config.AltKeyTimeout, false, func(IdType) error {
+		self.pending_escape_timer = 0
+		if !self.escape_code_parser.InEscape() {
+			return nil
+		}
+		self.escape_code_parser.Reset()
+		return self.handle_key_event(&KeyEvent{Type: PRESS, Key: "ESCAPE"})
+	})
+}
+
 func read_ignoring_temporary_errors(f *tty.Term, buf []byte) (int, error) {
 	n, err := f.Read(buf)
 	if is_temporary_error(err) {
@@ -0,0 +1,115 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+)
+
+var _ = fmt.Print
+
+type RenderPhase uint8
+
+const (
+	PRE_RENDER RenderPhase = iota
+	POST_RENDER
+)
+
+func (self RenderPhase) String() string {
+	switch self {
+	case PRE_RENDER:
+		return "PRE_RENDER"
+	case POST_RENDER:
+		return "POST_RENDER"
+	}
+	return fmt.Sprintf("RenderPhase(%d)", uint8(self))
+}
+
+// A function called before and after every render, data written to w is
+// queued for writing to the terminal
+type RenderHook func(phase RenderPhase, w io.Writer) error
+
+// Identifies a hook added with Loop.AddRenderHook()
+type HookID uint64
+
+type render_hook struct {
+	// zero for the hooks the loop adds itself, so that they cannot be
+	// removed with RemoveRenderHook()
+	id   HookID
+	hook RenderHook
+}
+
+type loop_writer struct{ lp *Loop }
+
+func (self loop_writer) Write(p []byte) (int, error) {
+	self.lp.QueueWriteBytesCopy(p)
+	return len(p), nil
+}
+
+// Add a hook that is called with PRE_RENDER before OnRender and the rendering
+// of mounted components and with POST_RENDER after them. Post render hooks
+// are called in the reverse order of addition, so that hooks nest, and even
+// when rendering or a later pre render hook fails. Returns an id that can be
+// used to remove the hook.
+func (self *Loop) AddRenderHook(h RenderHook) HookID {
+	self.render_hook_id_counter++
+	self.render_hooks = append(self.render_hooks, render_hook{self.render_hook_id_counter, h})
+	return self.render_hook_id_counter
+}
+
+func (self *Loop) add_internal_render_hook(h RenderHook) {
+	self.render_hooks = append(self.render_hooks, render_hook{0, h})
+}
+
+// Remove a hook added with AddRenderHook(), returns false if there is no hook
+// with the specified id
+func (self *Loop) RemoveRenderHook(id HookID) bool {
+	for i, h := range self.render_hooks {
+		if id != 0 && h.id == id {
+			self.render_hooks = append(self.render_hooks[:i], self.render_hooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Run the pre render hooks returning the ones that were called, hooks can add
+// or remove hooks so the returned slice is a copy
+func (self *Loop) run_pre_render_hooks() (called []render_hook, err error) {
+	w := loop_writer{self}
+	for _, h := range append([]render_hook(nil), self.render_hooks...) {
+		called = append(called, h)
+		if err = h.hook(PRE_RENDER, w); err != nil {
+			break
+		}
+	}
+	return
+}
+
+func (self *Loop) run_post_render_hooks(called []render_hook) (err error) {
+	w := loop_writer{self}
+	for i := len(called) - 1; i >= 0; i-- {
+		if herr := called[i].hook(POST_RENDER, w); herr != nil && err == nil {
+			err = herr
+		}
+	}
+	return
+}
+
+// Wrap renders in a synchronized update, see LoopConfig.SynchronizedRendering
+func (self *Loop) synchronized_rendering_hook(phase RenderPhase, w io.Writer) error {
+	switch phase {
+	case PRE_RENDER:
+		if self.use_synchronized_rendering() {
+			self.StartAtomicUpdate()
+			self.synchronized_render_in_progress = true
+		}
+	case POST_RENDER:
+		if self.synchronized_render_in_progress {
+			self.synchronized_render_in_progress = false
+			self.EndAtomicUpdate()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestRenderHooks(t *testing.T) {
+	lp, _ := New()
+	var render_err, hook_err error
+	lp.OnRender = func() error {
+		lp.QueueWriteString("frame")
+		return render_err
+	}
+	hook := func(name string) RenderHook {
+		return func(phase RenderPhase, w io.Writer) error {
+			fmt.Fprintf(w, "<%s %s>", name, phase)
+			if name == "b" && phase == PRE_RENDER {
+				return hook_err
+			}
+			return nil
+		}
+	}
+	test := func(expected string, expected_err error) {
+		t.Helper()
+		if err := lp.render(); err != expected_err {
+			t.Fatalf("Unexpected render error: %v", err)
+		}
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected render output:\n%s", diff)
+		}
+	}
+	a := lp.AddRenderHook(hook("a"))
+	lp.AddRenderHook(hook("b"))
+	test("<a PRE_RENDER><b PRE_RENDER>frame<b POST_RENDER><a POST_RENDER>", nil)
+	render_err = fmt.Errorf("render failed")
+	test("<a PRE_RENDER><b PRE_RENDER>frame<b POST_RENDER><a POST_RENDER>", render_err)
+	render_err, hook_err = nil, fmt.Errorf("hook failed")
+	test("<a PRE_RENDER><b PRE_RENDER><b POST_RENDER><a POST_RENDER>", hook_err)
+	hook_err = nil
+	if !lp.RemoveRenderHook(a) || lp.RemoveRenderHook(a) {
+		t.Fatalf("Removing render hook failed")
+	}
+	// the synchronized rendering hook of the loop cannot be removed
+	if lp.RemoveRenderHook(0) || lp.RemoveRenderHook(a-1) {
+		t.Fatalf("Removed a render hook not added with AddRenderHook()")
+	}
+	lp.Config.SynchronizedRendering = true
+	test("\x1b[?2026h<b PRE_RENDER>frame<b POST_RENDER>\x1b[?2026l", nil)
+}
+
+type slow_widget struct {
+	ComponentBase
+	name  string
+	delay time.Duration
+}
+
+func (self *slow_widget) Render(lp *Loop) error {
+	time.Sleep(self.delay)
+	return nil
+}
+
+func (self *slow_widget) Name() string { return self.name }
+
+func TestRenderProfiler(t *testing.T) {
+	lp, _ := New()
+	lp.MountComponent(&slow_widget{name: "slow", delay: 20 * time.Millisecond})
+	lp.MountComponent(&slow_widget{name: "fast"})
+	lp.MountComponent(&focus_test_widget{})
+	w := strings.Builder{}
+	lp.SetRenderProfiler(LoggingRenderProfiler(10*time.Millisecond, &w))
+	if err := lp.render(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(w.String()), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], "Rendering slow took: ") {
+		t.Fatalf("Unexpected profiler output: %#v", w.String())
+	}
+	if n := component_name(&focus_test_widget{}); n != "*loop.focus_test_widget" {
+		t.Fatalf("Unexpected default component name: %s", n)
+	}
+}
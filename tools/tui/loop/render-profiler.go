@@ -0,0 +1,65 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+var _ = fmt.Print
+
+// Notified around the rendering of every mounted component, to find out which
+// components are slow to render, see Loop.SetRenderProfiler()
+type RenderProfiler interface {
+	BeginWidget(name string)
+	EndWidget(name string)
+}
+
+// Components can optionally implement this interface to set the name they
+// are reported with to a RenderProfiler, the default is their type
+type NamedComponent interface {
+	Name() string
+}
+
+func component_name(c Component) string {
+	if n, ok := c.(NamedComponent); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", c)
+}
+
+// Set the profiler that is notified around the rendering of every component,
+// nil to disable profiling
+func (self *Loop) SetRenderProfiler(p RenderProfiler) {
+	self.render_profiler = p
+}
+
+type logging_render_profiler struct {
+	threshold time.Duration
+	w         io.Writer
+	starts    []time.Time
+}
+
+func (self *logging_render_profiler) BeginWidget(name string) {
+	self.starts = append(self.starts, time.Now())
+}
+
+func (self *logging_render_profiler) EndWidget(name string) {
+	if len(self.starts) == 0 {
+		return
+	}
+	start := self.starts[len(self.starts)-1]
+	self.starts = self.starts[:len(self.starts)-1]
+	if d := time.Since(start); d > self.threshold {
+		fmt.Fprintf(self.w, "Rendering %s took: %s\n", name, d)
+	}
+}
+
+// A RenderProfiler that writes a line to w for every component that takes
+// longer than threshold to render. Use a writer that does not write to the
+// terminal, such as a file or the debug output of the kitten.
+func LoggingRenderProfiler(threshold time.Duration, w io.Writer) RenderProfiler {
+	return &logging_render_profiler{threshold: threshold, w: w}
+}
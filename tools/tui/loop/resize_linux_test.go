@@ -0,0 +1,46 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+func TestPreviousScreenSizeWithoutOnResize(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		results := []string{}
+		resize := func(cols, rows uint16) error {
+			if err := unix.IoctlSetWinsize(int(os.Stdin.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Col: cols, Row: rows}); err != nil {
+				return err
+			}
+			if err := lp.on_SIGWINCH(); err != nil {
+				return err
+			}
+			sz := lp.PreviousScreenSize()
+			results = append(results, fmt.Sprintf("%dx%d", sz.WidthCells, sz.HeightCells))
+			return nil
+		}
+		lp.OnInitialize = func() (string, error) {
+			if err := resize(100, 30); err != nil {
+				return "", err
+			}
+			if err := resize(120, 40); err != nil {
+				return "", err
+			}
+			lp.Quit(0)
+			return "", nil
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v %v", results, err))
+	}
+	if result := run_test_in_pty(t, "TestPreviousScreenSizeWithoutOnResize", nil); result != "[0x0 100x30] <nil>" {
+		t.Fatalf("Unexpected previous screen sizes: %s", result)
+	}
+}
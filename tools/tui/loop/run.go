@@ -26,14 +26,28 @@ func new_loop() *Loop {
 	l.terminal_options.Alternate_screen = true
 	l.terminal_options.restore_colors = true
 	l.terminal_options.kitty_keyboard_mode = DISAMBIGUATE_KEYS | REPORT_ALTERNATE_KEYS | REPORT_ALL_KEYS_AS_ESCAPE_CODES | REPORT_TEXT_WITH_KEYS
-	l.escape_code_parser.HandleCSI = l.handle_csi
-	l.escape_code_parser.HandleOSC = l.handle_osc
-	l.escape_code_parser.HandleDCS = l.handle_dcs
-	l.escape_code_parser.HandleAPC = l.handle_apc
-	l.escape_code_parser.HandleSOS = l.handle_sos
-	l.escape_code_parser.HandlePM = l.handle_pm
-	l.escape_code_parser.HandleRune = l.handle_rune
-	l.escape_code_parser.HandleEndOfBracketedPaste = l.handle_end_of_bracketed_paste
+	l.escape_code_parser.HandleCSI = traced_handler(&l, "csi", l.after_ime_commit(l.handle_csi))
+	l.escape_code_parser.HandleOSC = traced_handler(&l, "osc", l.after_ime_commit(l.handle_osc))
+	l.escape_code_parser.HandleDCS = traced_handler(&l, "dcs", l.after_ime_commit(l.handle_dcs))
+	l.escape_code_parser.HandleAPC = traced_handler(&l, "apc", l.after_ime_commit(l.handle_apc))
+	l.escape_code_parser.HandleSOS = traced_handler(&l, "sos", l.after_ime_commit(l.handle_sos))
+	l.escape_code_parser.HandlePM = traced_handler(&l, "pm", l.after_ime_commit(l.handle_pm))
+	l.escape_code_parser.HandleRune = traced_handler(&l, "rune", l.handle_rune)
+	l.escape_code_parser.HandleEndOfBracketedPaste = func() error {
+		defer l.tracer.end()
+		return l.profiled("end_of_bracketed_paste", l.handle_end_of_bracketed_paste)
+	}
+	l.paste_sanitizer.HandleRune = l.dispatch_pasted_rune
+	l.Config.StripPasteEscapes = true
+	l.Config.MaxPasteSize = default_max_paste_size
+	l.Config.ComposeKey = "menu"
+	l.Config.AltKeyTimeout = default_alt_key_timeout
+	l.Config.HandleSignals = true
+	l.Config.PasteNormalization = NFC
+	l.add_internal_render_hook(l.synchronized_rendering_hook)
+	l.terminal_state.wakeup = l.WakeupMainThread
+	l.clipboard_timeout = default_clipboard_timeout
+	l.color_scheme = DefaultDarkTheme()
 	l.style_cache = make(map[string]func(...any) string)
 	l.style_ctx.AllowEscapeCodes = true
 	return &l
@@ -49,6 +63,13 @@ func kill_self(sig unix.Signal) {
 	time.Sleep(20 * time.Millisecond)
 }
 
+// The state escape codes make the cursor visible, hide it again if it was
+// hidden before they were sent
+func (self *Loop) restore_cursor_visibility(visible bool) {
+	self.cursor_visible = true
+	self.SetCursorVisible(visible)
+}
+
 func (self *Loop) set_pointer_shapes(ps []PointerShape) {
 	self.pointer_shapes = ps
 	if len(ps) > 0 {
@@ -77,17 +98,34 @@ func (self *Loop) update_screen_size() error {
 	s.updated = true
 	s.HeightCells, s.WidthCells = uint(ws.Row), uint(ws.Col)
 	s.HeightPx, s.WidthPx = uint(ws.Ypixel), uint(ws.Xpixel)
-	s.CellWidth = s.WidthPx / s.WidthCells
-	s.CellHeight = s.HeightPx / s.HeightCells
+	if (s.WidthPx == 0 || s.HeightPx == 0) && self.queried_cell_width > 0 {
+		// the kernel does not know the pixel size, use the cell size reported by the terminal or the default
+		s.WidthPx, s.HeightPx = self.queried_cell_width*s.WidthCells, self.queried_cell_height*s.HeightCells
+	}
+	s.CellWidth, s.CellHeight = 0, 0
+	if s.WidthCells > 0 && s.HeightCells > 0 {
+		s.CellWidth = s.WidthPx / s.WidthCells
+		s.CellHeight = s.HeightPx / s.HeightCells
+	}
 	return nil
 }
 
 func (self *Loop) handle_csi(raw []byte) error {
+	if self.is_startup_query_response(CSI, raw) {
+		return nil
+	}
 	csi := string(raw)
+	if self.handle_notification_support_query_end(csi) || self.handle_color_preference_report(csi) || self.handle_synchronized_update_support_response(csi) || self.handle_kitty_keyboard_support_response(csi) || self.handle_xtwinops_support_response(csi) {
+		self.stats.event_received(true)
+		return nil
+	}
 	ke := KeyEventFromCSI(csi)
 	if ke != nil {
 		return self.handle_key_event(ke)
 	}
+	if handled, err := self.handle_focus_event(csi); handled {
+		return err
+	}
 	sz, err := self.ScreenSize()
 	if err == nil {
 		me := MouseEventFromCSI(csi, sz)
@@ -95,50 +133,103 @@ func (self *Loop) handle_csi(raw []byte) error {
 			return self.handle_mouse_event(me)
 		}
 	}
+	self.stats.event_received(self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", CSI, "size", len(raw))
 	if self.OnEscapeCode != nil {
 		return self.OnEscapeCode(CSI, raw)
 	}
 	return nil
 }
 
-func is_click(a, b *MouseEvent) bool {
-	if a.Event_type != MOUSE_PRESS || b.Event_type != MOUSE_RELEASE {
-		return false
+func (self *Loop) dispatch_mouse_event(ev *MouseEvent) error {
+	if consumed, err := self.dispatch_mouse_event_to_components(ev); err != nil || consumed {
+		return err
 	}
-	x := a.Cell.X - b.Cell.X
-	y := a.Cell.Y - b.Cell.Y
-	return x*x+y*y <= 4
-
+	if handled, err := self.dispatch_to_typed_handlers(ev); err != nil || handled {
+		return err
+	}
+	if self.OnMouseEvent != nil {
+		return self.OnMouseEvent(ev)
+	}
+	return nil
 }
 
 func (self *Loop) handle_mouse_event(ev *MouseEvent) error {
-	if self.OnMouseEvent != nil {
-		err := self.OnMouseEvent(ev)
+	self.record_mouse_event(ev)
+	if ev.Event_type == MOUSE_MOVE && self.input_rate_exceeded() {
+		self.stats.event_received(false)
+		return nil
+	}
+	self.update_hot_zones(ev)
+	wanted := self.OnMouseEvent != nil || len(self.components) > 0 || self.has_typed_handler(ev)
+	self.stats.event_received(wanted)
+	if wanted {
+		err := self.dispatch_mouse_event(ev)
 		if err != nil {
 			return err
 		}
-		switch ev.Event_type {
-		case MOUSE_PRESS:
-			self.pending_mouse_events.WriteAllAndDiscardOld(*ev)
-		case MOUSE_RELEASE:
-			self.pending_mouse_events.WriteAllAndDiscardOld(*ev)
-			if self.pending_mouse_events.Len() > 1 {
-				events := self.pending_mouse_events.ReadAll()
-				if is_click(&events[len(events)-2], &events[len(events)-1]) {
-					e := events[len(events)-1]
-					e.Event_type = MOUSE_CLICK
-					err = self.OnMouseEvent(&e)
-					if err != nil {
-						return err
-					}
-				}
+		for _, e := range self.mouse_state_machine.Feed(ev)[1:] {
+			self.record_mouse_event(e)
+			if err = self.dispatch_mouse_event(e); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+func (self *Loop) dispatch_text(text string, from_key_event, in_bracketed_paste bool) error {
+	if consumed, err := self.dispatch_text_to_components(text, from_key_event, in_bracketed_paste); err != nil || consumed {
+		return err
+	}
+	if in_bracketed_paste {
+		if handled, err := self.dispatch_to_typed_handlers(PasteEvent{Text: text}); err != nil || handled {
+			return err
+		}
+	}
+	if self.OnText != nil {
+		return self.OnText(text, from_key_event, in_bracketed_paste)
+	}
+	return nil
+}
+
+func (self *Loop) dispatch_end_of_paste() error {
+	if consumed, err := self.dispatch_text_to_components("", false, false); err != nil || consumed {
+		return err
+	}
+	if handled, err := self.dispatch_to_typed_handlers(PasteEvent{End: true}); err != nil || handled {
+		return err
+	}
+	if self.OnText != nil {
+		return self.OnText("", false, false)
+	}
+	return nil
+}
+
 func (self *Loop) handle_key_event(ev *KeyEvent) error {
+	self.record_event(key_event, "key", ev)
+	self.stats.event_received(self.OnKeyEvent != nil || self.OnText != nil || len(self.components) > 0 || self.has_typed_handler(ev))
+	self.record_key_event(ev)
+	return self.process_key_event(ev)
+}
+
+func (self *Loop) process_key_event(ev *KeyEvent) error {
+	if consumed, err := self.handle_compose_key(ev); err != nil || consumed {
+		ev.Handled = ev.Handled || consumed
+		return err
+	}
+	if consumed, err := self.handle_mouse_emulation_key(ev); err != nil || consumed {
+		return err
+	}
+	if self.handle_scrollback_key(ev) || self.handle_focus_key(ev) {
+		return nil
+	}
+	if err := self.dispatch_key_event_to_components(ev); err != nil || ev.Handled {
+		return err
+	}
+	if handled, err := self.dispatch_to_typed_handlers(ev); err != nil || handled {
+		return err
+	}
 	if self.OnKeyEvent != nil {
 		err := self.OnKeyEvent(ev)
 		if err != nil {
@@ -156,13 +247,27 @@ func (self *Loop) handle_key_event(ev *KeyEvent) error {
 		ev.Handled = true
 		return self.on_SIGTSTP()
 	}
-	if ev.Text != "" && self.OnText != nil {
-		return self.OnText(ev.Text, true, false)
+	if ev.Text != "" {
+		return self.dispatch_text(ev.Text, true, false)
 	}
 	return nil
 }
 
 func (self *Loop) handle_osc(raw []byte) error {
+	self.osc_terminated_by_bel = self.escape_code_parser.TerminatedByBEL()
+	if self.is_startup_query_response(OSC, raw) {
+		return nil
+	}
+	if self.handle_clipboard_response(raw) {
+		self.stats.event_received(true)
+		return nil
+	}
+	if handled, err := self.handle_notification_response(raw); handled {
+		self.stats.event_received(true)
+		return err
+	}
+	self.stats.event_received(self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", OSC, "size", len(raw))
 	if self.OnEscapeCode != nil {
 		return self.OnEscapeCode(OSC, raw)
 	}
@@ -170,6 +275,11 @@ func (self *Loop) handle_osc(raw []byte) error {
 }
 
 func (self *Loop) handle_dcs(raw []byte) error {
+	if self.is_startup_query_response(DCS, raw) {
+		return nil
+	}
+	self.stats.event_received(self.OnRCResponse != nil || self.OnQueryResponse != nil || self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", DCS, "size", len(raw))
 	if self.OnRCResponse != nil && bytes.HasPrefix(raw, utils.UnsafeStringToBytes("@kitty-cmd")) {
 		return self.OnRCResponse(raw[len("@kitty-cmd"):])
 	}
@@ -198,6 +308,11 @@ func (self *Loop) handle_dcs(raw []byte) error {
 }
 
 func (self *Loop) handle_apc(raw []byte) error {
+	if self.is_startup_query_response(APC, raw) {
+		return nil
+	}
+	self.stats.event_received(self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", APC, "size", len(raw))
 	if self.OnEscapeCode != nil {
 		return self.OnEscapeCode(APC, raw)
 	}
@@ -205,6 +320,8 @@ func (self *Loop) handle_apc(raw []byte) error {
 }
 
 func (self *Loop) handle_sos(raw []byte) error {
+	self.stats.event_received(self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", SOS, "size", len(raw))
 	if self.OnEscapeCode != nil {
 		return self.OnEscapeCode(SOS, raw)
 	}
@@ -212,6 +329,8 @@ func (self *Loop) handle_sos(raw []byte) error {
 }
 
 func (self *Loop) handle_pm(raw []byte) error {
+	self.stats.event_received(self.OnEscapeCode != nil)
+	self.record_event(escape_code_event, "code", PM, "size", len(raw))
 	if self.OnEscapeCode != nil {
 		return self.OnEscapeCode(PM, raw)
 	}
@@ -219,17 +338,46 @@ func (self *Loop) handle_pm(raw []byte) error {
 }
 
 func (self *Loop) handle_rune(raw rune) error {
-	if self.OnText != nil {
-		return self.OnText(string(raw), false, self.escape_code_parser.InBracketedPaste())
+	in_bracketed_paste := self.escape_code_parser.InBracketedPaste()
+	if !in_bracketed_paste {
+		self.record_event(text_event, "text", string(raw))
 	}
-	return nil
+	if in_bracketed_paste {
+		if err := self.flush_ime_commit(); err != nil {
+			return err
+		}
+		if !self.accept_pasted_rune(raw) {
+			self.stats.event_received(false)
+			return nil
+		}
+	}
+	self.stats.event_received(self.OnText != nil || self.OnIMEEvent != nil || len(self.components) > 0 || (in_bracketed_paste && self.has_typed_handler(PasteEvent{})))
+	if in_bracketed_paste && self.Config.StripPasteEscapes {
+		return self.dispatch_sanitized_paste(raw)
+	}
+	if in_bracketed_paste {
+		return self.dispatch_pasted_rune(raw)
+	}
+	if self.receives_ime_commits_as_text() {
+		self.queue_ime_commit(raw)
+		return nil
+	}
+	return self.dispatch_text(string(raw), false, false)
 }
 
 func (self *Loop) handle_end_of_bracketed_paste() error {
-	if self.OnText != nil {
-		return self.OnText("", false, false)
+	// discard any incomplete escape code at the end of the pasted text
+	self.paste_sanitizer.Reset()
+	if err := self.flush_pasted_text(); err != nil {
+		return err
 	}
-	return nil
+	self.record_event(paste_event, "truncated", self.paste.truncated)
+	if !self.end_paste() {
+		self.stats.event_received(false)
+		return nil
+	}
+	self.stats.event_received(self.OnText != nil || len(self.components) > 0 || self.has_typed_handler(PasteEvent{}))
+	return self.dispatch_end_of_paste()
 }
 
 func (self *Loop) on_signal(s unix.Signal) error {
@@ -240,6 +388,7 @@ func (self *Loop) on_signal(s unix.Signal) error {
 				return err
 			}
 		}
+		self.signal_to_reraise = unix.SIGINT
 		return self.on_SIGINT()
 	case unix.SIGPIPE:
 		return self.on_SIGPIPE()
@@ -251,6 +400,7 @@ func (self *Loop) on_signal(s unix.Signal) error {
 				return err
 			}
 		}
+		self.signal_to_reraise = unix.SIGTERM
 		return self.on_SIGTERM()
 	case unix.SIGTSTP:
 		return self.on_SIGTSTP()
@@ -272,14 +422,27 @@ func (self *Loop) on_SIGPIPE() error {
 }
 
 func (self *Loop) on_SIGWINCH() error {
+	self.record_event(resize_event)
+	old_size := self.screen_size.without_flags()
+	// set only once the event has been delivered, OnResize gets old_size
+	// as an argument
+	defer func() { self.previous_screen_size = old_size }()
+	// read the new size even without a handler, so that old_size is correct
+	// on the next resize
 	self.screen_size.updated = false
+	err := self.update_screen_size()
+	if self.OnResize == nil && !self.has_typed_handler(ResizeEvent{}) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	new_size := self.screen_size.without_flags()
+	if handled, err := self.dispatch_to_typed_handlers(ResizeEvent{OldSize: old_size, NewSize: new_size}); err != nil || handled {
+		return err
+	}
 	if self.OnResize != nil {
-		old_size := self.screen_size
-		err := self.update_screen_size()
-		if err != nil {
-			return err
-		}
-		return self.OnResize(old_size, self.screen_size)
+		return self.OnResize(old_size, new_size)
 	}
 	return nil
 }
@@ -296,9 +459,47 @@ func (self *Loop) on_SIGHUP() error {
 	return nil
 }
 
+func (self *Loop) handled_signals() []os.Signal {
+	ans := []os.Signal{unix.SIGTSTP, unix.SIGHUP, unix.SIGWINCH, unix.SIGPIPE}
+	if self.Config.HandleSignals {
+		ans = append(ans, unix.SIGINT, unix.SIGTERM)
+	}
+	return ans
+}
+
+func (self *Loop) handle_wakeup() error {
+	for len(self.wakeup_channel) > 0 {
+		<-self.wakeup_channel
+	}
+	self.handle_portal_color_scheme()
+	self.event_received_needs_render()
+	// changes from other goroutines are written when rendering
+	if self.terminal_state.has_changes() {
+		self.MarkDirty()
+	}
+	if err := self.dispatch_posted_events(); err != nil {
+		return err
+	}
+	if self.OnWakeup != nil {
+		return self.OnWakeup()
+	}
+	return nil
+}
+
+// Kill the process with the SIGINT or SIGTERM that stopped the loop, once
+// the terminal has been restored, with the default disposition of the
+// signal so that the process exits as if it had not been caught
+func (self *Loop) reraise_signal() {
+	if sig := self.signal_to_reraise; sig != SIGNULL {
+		self.signal_to_reraise = SIGNULL
+		signal.Reset(sig)
+		kill_self(sig)
+	}
+}
+
 func (self *Loop) run() (err error) {
 	signal_channel := make(chan os.Signal, 256)
-	handled_signals := []os.Signal{unix.SIGINT, unix.SIGTERM, unix.SIGTSTP, unix.SIGHUP, unix.SIGWINCH, unix.SIGPIPE}
+	handled_signals := self.handled_signals()
 	signal.Notify(signal_channel, handled_signals...)
 	defer signal.Reset(handled_signals...)
 
@@ -311,9 +512,12 @@ func (self *Loop) run() (err error) {
 		controlling_term.RestoreAndClose()
 		self.controlling_term = nil
 	}()
+	self.run_startup_queries()
 
 	self.keep_going = true
-	self.pending_mouse_events = utils.NewRingBuffer[MouseEvent](4)
+	self.log_start()
+	self.mouse_state_machine = MouseStateMachine{}
+	self.write_rate = WriteRateMonitor{}
 	// tty_write_channel is buffered so there is no race between initial
 	// queueing and startup of writer thread and also as a performance
 	// optimization to avoid copying unnecessarily to pending_writes
@@ -321,13 +525,24 @@ func (self *Loop) run() (err error) {
 	self.write_msg_id_counter = 0
 	write_done_channel := make(chan IdType)
 	self.wakeup_channel = make(chan byte, 256)
+	self.start_portal_color_scheme_lookup_if_needed()
+	if self.posted_events.has_pending() {
+		// events posted before the loop was run
+		self.WakeupMainThread()
+	}
 	self.pending_writes = make([]write_msg, 0, 256)
 	err_channel := make(chan error, 8)
-	self.death_signal = SIGNULL
+	self.death_signal, self.signal_to_reraise = SIGNULL, SIGNULL
+	self.previous_screen_size = ScreenSize{}
+	self.cursor_style, self.saved_terminal_state = nil, saved_terminal_state{}
+	self.paste_normalizer = paste_normalizer{}
 	self.escape_code_parser.Reset()
 	self.exit_code = 0
 	self.atomic_update_active = false
+	self.stats.reset()
+	self.event_stats.reset()
 	self.timers, self.timers_temp = make([]*timer, 0, 8), make([]*timer, 0, 8)
+	self.pending_escape_timer = 0
 	no_timeout_channel := make(<-chan time.Time)
 	finalizer := ""
 
@@ -355,7 +570,10 @@ func (self *Loop) run() (err error) {
 	}
 
 	self.QueueWriteString(self.terminal_options.SetStateEscapeCodes())
+	self.cursor_visible = true
 	needs_reset_escape_codes := true
+	self.query_synchronized_update_support()
+	self.query_kitty_keyboard_support()
 
 	shutdown_tty_reader := func() {
 		// notify tty reader that we are shutting down
@@ -373,6 +591,7 @@ func (self *Loop) run() (err error) {
 	}
 
 	defer func() {
+		self.wait_for_response = nil
 		shutdown_tty_reader()
 
 		if self.OnFinalize != nil {
@@ -382,7 +601,9 @@ func (self *Loop) run() (err error) {
 			self.QueueWriteString(finalizer)
 		}
 		if needs_reset_escape_codes {
+			self.RestoreTerminalState(self.saved_terminal_state.flags)
 			self.ClearPointerShapes()
+			self.SetCursorBlinkMode(CURSOR_BLINK_DEFAULT)
 			self.QueueWriteString(self.terminal_options.ResetStateEscapeCodes())
 		}
 		// flush queued data and wait for it to be written for a timeout, then wait for writer to shutdown
@@ -403,6 +624,8 @@ func (self *Loop) run() (err error) {
 
 	self.SuspendAndRun = func(run func() error) (err error) {
 		ps := self.ClearPointerShapes()
+		blink, cursor_visible := self.cursor_blink, self.cursor_visible
+		self.SetCursorBlinkMode(CURSOR_BLINK_DEFAULT)
 		write_id := self.QueueWriteString(self.terminal_options.ResetStateEscapeCodes())
 		needs_reset_escape_codes = false
 		if err = self.wait_for_write_to_complete(write_id, self.tty_write_channel, write_done_channel, 2*time.Second); err != nil {
@@ -424,13 +647,17 @@ func (self *Loop) run() (err error) {
 			return err
 		}
 		write_id = self.QueueWriteString(self.terminal_options.SetStateEscapeCodes())
+		self.restore_cursor_visibility(cursor_visible)
 		self.set_pointer_shapes(ps)
+		self.SetCursorBlinkMode(blink)
 		needs_reset_escape_codes = true
 		return self.wait_for_write_to_complete(write_id, self.tty_write_channel, write_done_channel, 2*time.Second)
 	}
 
 	self.on_SIGTSTP = func() error {
 		ps := self.ClearPointerShapes()
+		blink, cursor_visible := self.cursor_blink, self.cursor_visible
+		self.SetCursorBlinkMode(CURSOR_BLINK_DEFAULT)
 		write_id := self.QueueWriteString(self.terminal_options.ResetStateEscapeCodes())
 		needs_reset_escape_codes = false
 		err := self.wait_for_write_to_complete(write_id, self.tty_write_channel, write_done_channel, 2*time.Second)
@@ -446,7 +673,9 @@ func (self *Loop) run() (err error) {
 			return err
 		}
 		write_id = self.QueueWriteString(self.terminal_options.SetStateEscapeCodes())
+		self.restore_cursor_visibility(cursor_visible)
 		self.set_pointer_shapes(ps)
+		self.SetCursorBlinkMode(blink)
 		needs_reset_escape_codes = true
 		err = self.wait_for_write_to_complete(write_id, self.tty_write_channel, write_done_channel, 2*time.Second)
 		if err != nil {
@@ -458,65 +687,129 @@ func (self *Loop) run() (err error) {
 		return nil
 	}
 
-	for self.keep_going {
+	self.wait_for_response = func(query string, timeout time.Duration, is_done func() bool) error {
+		write_id := self.QueueWriteString(query)
+		if err := self.wait_for_write_to_complete(write_id, self.tty_write_channel, write_done_channel, timeout); err != nil {
+			return err
+		}
+		deadline := time.After(timeout)
+		for !is_done() {
+			select {
+			case <-deadline:
+				return os.ErrDeadlineExceeded
+			case rwerr := <-err_channel:
+				return fmt.Errorf("Failed doing I/O with terminal: %w", rwerr)
+			case input_data, more := <-tty_read_channel:
+				if !more {
+					return fmt.Errorf("Failed to read from terminal: %w", io.EOF)
+				}
+				self.event_received_needs_render()
+				if err := self.dispatch_input_data(input_data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	on_write_done := func(msg_id IdType) error {
+		self.write_rate.write_completed(msg_id, time.Now())
 		self.flush_pending_writes(self.tty_write_channel)
+		if self.OnWriteComplete != nil {
+			return self.OnWriteComplete(msg_id, msg_id < self.write_msg_id_counter)
+		}
+		return nil
+	}
+	on_signal_received := func(s os.Signal) error {
+		self.render_requested = true
+		err := self.profiled("signal", func() error { return self.on_signal(s.(unix.Signal)) })
+		self.tracer.end()
+		return err
+	}
+	on_input := func(input_data []byte, more bool) error {
+		if !more {
+			select {
+			case rwerr := <-err_channel:
+				return fmt.Errorf("Failed to read from terminal: %w", rwerr)
+			default:
+				return fmt.Errorf("Failed to read from terminal: %w", io.EOF)
+			}
+		}
+		self.event_received_needs_render()
+		return self.dispatch_input_data(input_data)
+	}
+	// Handle an event if one is pending, without blocking
+	poll_for_event := func() (handled bool, err error) {
+		select {
+		case <-self.wakeup_channel:
+			err = self.handle_wakeup()
+		case msg_id := <-write_done_channel:
+			err = on_write_done(msg_id)
+		case rwerr := <-err_channel:
+			err = fmt.Errorf("Failed doing I/O with terminal: %w", rwerr)
+		case s := <-signal_channel:
+			err = on_signal_received(s)
+		case input_data, more := <-tty_read_channel:
+			err = on_input(input_data, more)
+		default:
+			return false, nil
+		}
+		return true, err
+	}
+
+	if err = self.dispatch_startup_input(); err != nil {
+		return err
+	}
+	self.render_requested = true
+	for self.keep_going {
 		timeout_chan := no_timeout_channel
 		if len(self.timers) > 0 {
-			now := time.Now()
-			err = self.dispatch_timers(now)
+			err = self.profiled("timers", func() error { return self.dispatch_timers(time.Now()) })
 			if err != nil {
 				return err
 			}
-			var timeout time.Duration
-			if len(self.timers) > 0 {
-				timeout = self.timers[0].deadline.Sub(now)
-				if timeout < 0 {
-					timeout = 0
+		}
+		if self.render_requested {
+			if err = self.profiled("render", self.render); err != nil {
+				return err
+			}
+		}
+		self.flush_pending_writes(self.tty_write_channel)
+		if err = self.check_write_backpressure(time.Now()); err != nil {
+			return err
+		}
+		var dont_wait bool
+		if dont_wait, err = self.dispatch_idle(); err != nil {
+			return err
+		}
+		if dont_wait {
+			// process all events that arrived while OnIdle ran before
+			// calling it again, without waiting for more
+			for handled := true; handled && self.keep_going; {
+				if handled, err = poll_for_event(); err != nil {
+					return err
 				}
 			}
-			timeout_chan = time.After(timeout)
+			continue
+		}
+		if len(self.timers) > 0 {
+			timeout_chan = time.After(max(0, time.Until(self.timers[0].deadline)))
 		}
 		select {
 		case <-timeout_chan:
 		case <-self.wakeup_channel:
-			for len(self.wakeup_channel) > 0 {
-				<-self.wakeup_channel
-			}
-			if self.OnWakeup != nil {
-				err = self.OnWakeup()
-				if err != nil {
-					return err
-				}
-			}
+			err = self.handle_wakeup()
 		case msg_id := <-write_done_channel:
-			self.flush_pending_writes(self.tty_write_channel)
-			if self.OnWriteComplete != nil {
-				err = self.OnWriteComplete(msg_id, msg_id < self.write_msg_id_counter)
-				if err != nil {
-					return err
-				}
-			}
+			err = on_write_done(msg_id)
 		case rwerr := <-err_channel:
-			return fmt.Errorf("Failed doing I/O with terminal: %w", rwerr)
+			err = fmt.Errorf("Failed doing I/O with terminal: %w", rwerr)
 		case s := <-signal_channel:
-			err = self.on_signal(s.(unix.Signal))
-			if err != nil {
-				return err
-			}
+			err = on_signal_received(s)
 		case input_data, more := <-tty_read_channel:
-			if !more {
-				select {
-				case rwerr := <-err_channel:
-					return fmt.Errorf("Failed to read from terminal: %w", rwerr)
-				default:
-					return fmt.Errorf("Failed to read from terminal: %w", io.EOF)
-				}
-			}
-			err := self.dispatch_input_data(input_data)
-			if err != nil {
-				return err
-			}
-
+			err = on_input(input_data, more)
+		}
+		if err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,130 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// The parts of the terminal state to save, see Loop.SaveTerminalState()
+type TerminalStateFlags uint8
+
+const (
+	SAVE_POINTER_SHAPE TerminalStateFlags = 1 << iota
+	SAVE_CURSOR_STYLE
+	SAVE_MOUSE_TRACKING
+	SAVE_SCREEN
+
+	NO_TERMINAL_STATE  TerminalStateFlags = 0
+	ALL_TERMINAL_STATE                    = SAVE_POINTER_SHAPE | SAVE_CURSOR_STYLE | SAVE_MOUSE_TRACKING | SAVE_SCREEN
+)
+
+func (self TerminalStateFlags) String() string {
+	var parts []string
+	for _, x := range []struct {
+		flag TerminalStateFlags
+		name string
+	}{{SAVE_POINTER_SHAPE, "SAVE_POINTER_SHAPE"}, {SAVE_CURSOR_STYLE, "SAVE_CURSOR_STYLE"}, {SAVE_MOUSE_TRACKING, "SAVE_MOUSE_TRACKING"}, {SAVE_SCREEN, "SAVE_SCREEN"}} {
+		if self&x.flag != 0 {
+			parts = append(parts, x.name)
+			self &^= x.flag
+		}
+	}
+	if self != 0 {
+		parts = append(parts, fmt.Sprintf("TerminalStateFlags(%d)", uint8(self)))
+	}
+	if len(parts) == 0 {
+		return "NO_TERMINAL_STATE"
+	}
+	return strings.Join(parts, "|")
+}
+
+var saved_mouse_tracking_modes = []Mode{MOUSE_BUTTON_TRACKING, MOUSE_MOTION_TRACKING, MOUSE_MOVE_TRACKING, MOUSE_SGR_MODE, MOUSE_SGR_PIXEL_MODE}
+
+type saved_terminal_state struct {
+	flags TerminalStateFlags
+	// the length of the pointer shape stack with the saved shape on top
+	pointer_shape_depth int
+	cursor_style        *CursorStyle
+	cursor_blink        CursorBlinkMode
+}
+
+// Save or restore several private modes with a single XTSAVE/XTRESTORE
+func private_modes_escape_code(which string, modes ...Mode) string {
+	nums := make([]string, len(modes))
+	for i, m := range modes {
+		nums[i] = fmt.Sprint(uint32(m &^ private))
+	}
+	return "\x1b[?" + strings.Join(nums, ";") + which
+}
+
+// Save the specified parts of the terminal state so that they can be put back
+// with RestoreTerminalState(). Saving a part that is already saved replaces
+// the saved state. The pointer shape is saved by pushing a copy of the current
+// shape onto the terminal's pointer shape stack, the mouse tracking modes and
+// whether the alternate screen is in use with XTSAVE. The terminal has no way
+// to save the cursor style, so the loop remembers the style last set with
+// SetCursorShape() and SetCursorBlinkMode(). Any parts still saved when the
+// loop exits are restored automatically.
+func (self *Loop) SaveTerminalState(flags TerminalStateFlags) {
+	s := &self.saved_terminal_state
+	if flags&SAVE_POINTER_SHAPE != 0 {
+		if s.flags&SAVE_POINTER_SHAPE != 0 {
+			self.RestoreTerminalState(SAVE_POINTER_SHAPE)
+		}
+		shape, has_shape := self.CurrentPointerShape()
+		if !has_shape {
+			shape = DEFAULT_POINTER
+		}
+		self.PushPointerShape(shape)
+		s.pointer_shape_depth = len(self.pointer_shapes)
+	}
+	if flags&SAVE_CURSOR_STYLE != 0 {
+		s.cursor_style, s.cursor_blink = self.cursor_style, self.cursor_blink
+	}
+	if flags&SAVE_MOUSE_TRACKING != 0 {
+		self.QueueWriteString(private_modes_escape_code("s", saved_mouse_tracking_modes...))
+	}
+	if flags&SAVE_SCREEN != 0 {
+		self.QueueWriteString(ALTERNATE_SCREEN.escape_code("s"))
+	}
+	s.flags |= flags & ALL_TERMINAL_STATE
+}
+
+// Restore the specified parts of the terminal state saved by
+// SaveTerminalState(). Parts that are not saved are ignored.
+func (self *Loop) RestoreTerminalState(flags TerminalStateFlags) {
+	s := &self.saved_terminal_state
+	flags &= s.flags
+	if flags&SAVE_POINTER_SHAPE != 0 {
+		for len(self.pointer_shapes) >= s.pointer_shape_depth && len(self.pointer_shapes) > 0 {
+			self.PopPointerShape()
+		}
+		s.pointer_shape_depth = 0
+	}
+	if flags&SAVE_CURSOR_STYLE != 0 {
+		if s.cursor_style == nil {
+			self.cursor_style = nil
+			self.QueueWriteString("\x1b[0 q")
+		} else {
+			self.SetCursorShape(s.cursor_style.Shape, s.cursor_style.Blink)
+		}
+		self.SetCursorBlinkMode(s.cursor_blink)
+		s.cursor_style = nil
+	}
+	if flags&SAVE_MOUSE_TRACKING != 0 {
+		self.QueueWriteString(private_modes_escape_code("r", saved_mouse_tracking_modes...))
+	}
+	if flags&SAVE_SCREEN != 0 {
+		self.QueueWriteString(ALTERNATE_SCREEN.escape_code("r"))
+	}
+	s.flags &^= flags
+}
+
+// The parts of the terminal state currently saved, see SaveTerminalState()
+func (self *Loop) SavedTerminalState() TerminalStateFlags {
+	return self.saved_terminal_state.flags
+}
@@ -0,0 +1,46 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestSaveTerminalState(t *testing.T) {
+	lp, _ := New()
+	q := func(expected string) {
+		t.Helper()
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected escape codes:\n%s", diff)
+		}
+	}
+	lp.PushPointerShape(TEXT_POINTER)
+	take_pending_writes(lp)
+	lp.SaveTerminalState(SAVE_POINTER_SHAPE | SAVE_MOUSE_TRACKING | SAVE_SCREEN)
+	q("\x1b]22;text\x1b\\\x1b[?1000;1002;1003;1006;1016s\x1b[?1049s")
+	if s := lp.SavedTerminalState().String(); s != "SAVE_POINTER_SHAPE|SAVE_MOUSE_TRACKING|SAVE_SCREEN" {
+		t.Fatalf("Unexpected saved state: %s", s)
+	}
+	lp.PushPointerShape(POINTER_POINTER)
+	lp.PushPointerShape(WAIT_POINTER)
+	take_pending_writes(lp)
+	lp.RestoreTerminalState(SAVE_POINTER_SHAPE | SAVE_CURSOR_STYLE)
+	q("\x1b]22;<\x1b\\\x1b]22;<\x1b\\\x1b]22;<\x1b\\")
+	if s, _ := lp.CurrentPointerShape(); s != TEXT_POINTER || len(lp.pointer_shapes) != 1 {
+		t.Fatalf("Pointer shape not restored: %s %d", s, len(lp.pointer_shapes))
+	}
+
+	lp.SaveTerminalState(SAVE_CURSOR_STYLE)
+	lp.SetCursorShape(BAR_CURSOR, true)
+	take_pending_writes(lp)
+	lp.RestoreTerminalState(ALL_TERMINAL_STATE)
+	q("\x1b[0 q\x1b[?1000;1002;1003;1006;1016r\x1b[?1049r")
+	if lp.SavedTerminalState() != NO_TERMINAL_STATE {
+		t.Fatalf("Saved state not cleared: %s", lp.SavedTerminalState())
+	}
+}
@@ -0,0 +1,124 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+
+	"kitty/tools/utils"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+type scrollback struct {
+	lines        *utils.RingBuffer[string]
+	partial_line strings.Builder
+	// number of lines the viewport is scrolled up from the bottom
+	offset int
+}
+
+// Record the lines of text in output written to the terminal, as plain text.
+// Output written while rendering is not recorded as it redraws the screen
+// rather than adding to it.
+func (self *Loop) capture_scrollback(data string) {
+	sb := &self.scrollback
+	if self.Config.ScrollbackLines <= 0 || self.render_in_progress {
+		return
+	}
+	if sb.lines == nil || sb.lines.Capacity() != uint64(self.Config.ScrollbackLines) {
+		sb.lines = utils.NewRingBuffer[string](uint64(self.Config.ScrollbackLines))
+	}
+	for {
+		line, rest, found := strings.Cut(data, "\n")
+		sb.partial_line.WriteString(line)
+		if !found {
+			break
+		}
+		sb.lines.WriteAllAndDiscardOld(strings.TrimSuffix(wcswidth.StripEscapeCodes(sb.partial_line.String()), "\r"))
+		sb.partial_line.Reset()
+		data = rest
+	}
+}
+
+func (self *Loop) scrollback_lines() []string {
+	if self.scrollback.lines == nil {
+		return nil
+	}
+	ans := self.scrollback.lines.ReadAll()
+	self.scrollback.lines.WriteAllAndDiscardOld(ans...)
+	return ans
+}
+
+// Scroll the viewport n lines back into the scrollback, see
+// LoopConfig.ScrollbackLines. While the viewport is in the scrollback it
+// replaces the normal rendering and the up, down, page up and page down keys
+// scroll it, any other key returns to normal rendering.
+func (self *Loop) ScrollBackward(n int) {
+	if self.scrollback.lines == nil {
+		return
+	}
+	self.set_scrollback_offset(self.scrollback.offset + n)
+}
+
+// Scroll the viewport n lines forward, towards the current output, leaving
+// the scrollback when reaching it
+func (self *Loop) ScrollForward(n int) {
+	self.set_scrollback_offset(self.scrollback.offset - n)
+}
+
+func (self *Loop) set_scrollback_offset(offset int) {
+	num := 0
+	if self.scrollback.lines != nil {
+		num = int(self.scrollback.lines.Len())
+	}
+	// keep at least one line in the viewport
+	offset = max(0, min(offset, num-1))
+	if offset != self.scrollback.offset {
+		self.scrollback.offset = offset
+		self.render_requested = true
+	}
+}
+
+func (self *Loop) IsInScrollback() bool {
+	return self.scrollback.offset > 0
+}
+
+func (self *Loop) handle_scrollback_key(ev *KeyEvent) bool {
+	if !self.IsInScrollback() {
+		return false
+	}
+	page := max(1, int(self.screen_size.HeightCells)-1)
+	switch {
+	case ev.MatchesPressOrRepeat("up"):
+		self.ScrollBackward(1)
+	case ev.MatchesPressOrRepeat("page_up"):
+		self.ScrollBackward(page)
+	case ev.MatchesPressOrRepeat("down"):
+		self.ScrollForward(1)
+	case ev.MatchesPressOrRepeat("page_down"):
+		self.ScrollForward(page)
+	case ev.MatchesPressOrRepeat("escape"):
+		self.set_scrollback_offset(0)
+	case ev.Type == RELEASE:
+		return false
+	default:
+		self.set_scrollback_offset(0)
+		return false
+	}
+	ev.Handled = true
+	return true
+}
+
+// Draw the scrollback lines visible in the viewport over the whole screen
+func (self *Loop) render_scrollback() {
+	lines := self.scrollback_lines()
+	height := max(1, int(self.screen_size.HeightCells))
+	end := len(lines) - self.scrollback.offset
+	lines = lines[max(0, end-height):end]
+	for i, line := range lines {
+		lines[i] = wcswidth.TruncateToVisualLength(line, int(self.screen_size.WidthCells))
+	}
+	self.QueueWriteString("\x1b[H\x1b[2J" + strings.Join(lines, "\r\n"))
+}
@@ -0,0 +1,74 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestScrollback(t *testing.T) {
+	lp, _ := New()
+	lp.screen_size = ScreenSize{WidthCells: 4, HeightCells: 2}
+	lp.Config.ScrollbackLines = 3
+	frame := 0
+	lp.OnRender = func() error {
+		frame++
+		lp.QueueWriteString(fmt.Sprintf("\x1b[Hrow%d\r\nrow%d\r\nscreen", frame, frame+1))
+		return nil
+	}
+	lp.QueueWriteString("one\r\n\x1b[31mtwo\x1b[m\r\nthr")
+	lp.QueueWriteBytesCopy([]byte("ee\nfour-long\npartial"))
+	take_pending_writes(lp)
+	if diff := cmp.Diff([]string{"two", "three", "four-long"}, lp.scrollback_lines()); diff != "" {
+		t.Fatalf("Unexpected scrollback lines:\n%s", diff)
+	}
+	render := func(expected string) {
+		t.Helper()
+		if err := lp.render(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected render output:\n%s", diff)
+		}
+	}
+	key := func(key string) *KeyEvent {
+		ev := KeyEvent{Type: PRESS, Key: key}
+		if err := lp.handle_key_event(&ev); err != nil {
+			t.Fatal(err)
+		}
+		return &ev
+	}
+	lp.ScrollBackward(1)
+	if !lp.IsInScrollback() {
+		t.Fatalf("Not in scrollback after scrolling backward")
+	}
+	render("\x1b[H\x1b[2Jtwo\r\nthre")
+	lp.ScrollBackward(10)
+	render("\x1b[H\x1b[2Jtwo")
+	key("DOWN")
+	render("\x1b[H\x1b[2Jtwo\r\nthre")
+	if ev := key("ESCAPE"); !ev.Handled || lp.IsInScrollback() {
+		t.Fatalf("Escape did not leave the scrollback")
+	}
+	render("\x1b[Hrow1\r\nrow2\r\nscreen")
+	render("\x1b[Hrow2\r\nrow3\r\nscreen")
+	render("\x1b[Hrow3\r\nrow4\r\nscreen")
+	lp.ScrollBackward(2)
+	if ev := key("x"); ev.Handled || lp.IsInScrollback() {
+		t.Fatalf("A non scroll key did not leave the scrollback or was consumed")
+	}
+	// the output of rendering and of the scrollback itself is not captured
+	if diff := cmp.Diff([]string{"two", "three", "four-long"}, lp.scrollback_lines()); diff != "" {
+		t.Fatalf("Unexpected scrollback lines after rendering:\n%s", diff)
+	}
+	lp.QueueWriteString("\x1b[Hfive\r\n")
+	take_pending_writes(lp)
+	if diff := cmp.Diff([]string{"three", "four-long", "partialfive"}, lp.scrollback_lines()); diff != "" {
+		t.Fatalf("Unexpected scrollback lines after output following rendering:\n%s", diff)
+	}
+}
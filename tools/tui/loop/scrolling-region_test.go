@@ -0,0 +1,54 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestScrollingRegion(t *testing.T) {
+	lp, _ := New()
+	check := func(expected string) {
+		t.Helper()
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected escape codes:\n%s", diff)
+		}
+	}
+	if err := lp.SetScrollingRegion(2, 5); err != nil {
+		t.Fatal(err)
+	}
+	check("\x1b[2;5r")
+	for _, r := range [][2]int{{0, 5}, {3, 3}, {5, 2}} {
+		if err := lp.SetScrollingRegion(r[0], r[1]); err == nil {
+			t.Fatalf("No error for the invalid scrolling region: %v", r)
+		}
+		check("")
+	}
+	lp.screen_size = ScreenSize{WidthCells: 80, HeightCells: 24, updated: true}
+	if err := lp.SetScrollingRegion(1, 25); err == nil {
+		t.Fatalf("No error for a scrolling region larger than the screen")
+	}
+	check("")
+	if err := lp.SetScrollingRegion(1, 24); err != nil {
+		t.Fatal(err)
+	}
+	check("\x1b[1;24r")
+	lp.ResetScrollingRegion()
+	check("\x1b[r")
+	lp.ScrollUp(3)
+	lp.ScrollDown(1)
+	check("\x1b[3S\x1b[1T")
+	lp.ScrollUp(0)
+	lp.ScrollDown(-2)
+	check("")
+	// the region is reset when the loop exits
+	if s := lp.terminal_options.ResetStateEscapeCodes(); !strings.Contains(s, RESET_SCROLLING_REGION) {
+		t.Fatalf("The reset escape codes do not reset the scrolling region: %#v", s)
+	}
+}
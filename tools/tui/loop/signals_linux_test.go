@@ -0,0 +1,54 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+func TestSignalRaisedAgainAfterRestoringTerminal(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		lp.OnInitialize = func() (string, error) {
+			return "", unix.Kill(os.Getpid(), unix.SIGTERM)
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("not killed: %s %v", lp.DeathSignalName(), err))
+	}
+	received := make(chan []byte, 1)
+	_, err := run_in_pty(t, "TestSignalRaisedAgainAfterRestoringTerminal", func(master *os.File) {
+		buf, data := make([]byte, 4096), []byte{}
+		for {
+			n, err := master.Read(buf)
+			data = append(data, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		received <- data
+	})
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) || !ee.Sys().(syscall.WaitStatus).Signaled() || ee.Sys().(syscall.WaitStatus).Signal() != unix.SIGTERM {
+		t.Fatalf("The child process was not killed by SIGTERM: %v", err)
+	}
+	select {
+	case data := <-received:
+		lp, _ := New(NoAlternateScreen)
+		if reset := lp.terminal_options.ResetStateEscapeCodes(); !bytes.Contains(data, []byte(reset)) {
+			t.Fatalf("The terminal state was not reset before being killed: %#v", string(data))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the output of the child process")
+	}
+}
@@ -0,0 +1,78 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+var _ = fmt.Print
+
+func TestSoftRestart(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		results := []string{}
+		if err := lp.SoftRestart(); err == nil {
+			results = append(results, "no error when not running")
+		}
+		lp.OnResize = func(old_size, new_size ScreenSize) error {
+			results = append(results, fmt.Sprintf("resize: %dx%d", new_size.WidthCells, new_size.HeightCells))
+			return nil
+		}
+		lp.OnInitialize = func() (string, error) {
+			// simulate another program that leaves the tty in cooked mode,
+			// during which the terminal is resized
+			fd := int(os.Stdin.Fd())
+			if err := unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Col: 100, Row: 30}); err != nil {
+				return "", err
+			}
+			tios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+			if err != nil {
+				return "", err
+			}
+			tios.Lflag |= unix.ICANON | unix.ECHO
+			if err = unix.IoctlSetTermios(fd, unix.TCSETS, tios); err != nil {
+				return "", err
+			}
+			lp.PushPointerShape(CROSSHAIR_POINTER)
+			lp.PushPointerShape(POINTER_POINTER)
+			if err = lp.SoftRestart(); err != nil {
+				return "", err
+			}
+			if tios, err = unix.IoctlGetTermios(fd, unix.TCGETS); err != nil {
+				return "", err
+			}
+			results = append(results, fmt.Sprintf("raw: %v render: %v", tios.Lflag&(unix.ICANON|unix.ECHO) == 0, lp.render_requested))
+			// ignore the SIGWINCH from the resize above
+			lp.OnResize = nil
+			lp.Quit(0)
+			return "", nil
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v %v", results, err))
+	}
+	received := make(chan []byte, 1)
+	result := run_test_in_pty(t, "TestSoftRestart", func(master *os.File) {
+		buf, data := make([]byte, 4096), []byte{}
+		for {
+			n, err := master.Read(buf)
+			data = append(data, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		received <- data
+	})
+	if result != "[resize: 100x30 raw: true render: true] <nil>" {
+		t.Fatalf("Unexpected result of SoftRestart(): %s", result)
+	}
+	// the whole stack of pointer shapes is restored, not just its top
+	if data := <-received; !bytes.Contains(data, []byte("\x1b]22;<\x1b\\\x1b]22;<\x1b\\\x1b]22;>crosshair,pointer\x1b\\")) {
+		t.Fatalf("The pointer shapes were not restored: %#v", string(data))
+	}
+}
@@ -0,0 +1,96 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"sync"
+)
+
+var _ = fmt.Print
+
+type CursorStyle struct {
+	Shape CursorShapes
+	Blink bool
+}
+
+// Changes to the state of the terminal that can be made from any goroutine.
+// They are batched and written at the start of the next render, so escape
+// codes from different goroutines are never interleaved with other output.
+// Only the last change of each kind before a render is written. Get it with
+// Loop.TerminalState().
+type TerminalState struct {
+	mutex         sync.Mutex
+	pointer_shape *PointerShape
+	cursor_style  *CursorStyle
+	title         *string
+	wakeup        func() bool
+}
+
+// Wake up the loop, which marks itself dirty when there are changes, see
+// LoopConfig.RenderOnlyWhenDirty
+func (self *TerminalState) changed() {
+	if self.wakeup != nil {
+		self.wakeup()
+	}
+}
+
+// Replace the pointer shape at the top of the shape stack, see
+// Loop.PushPointerShape()
+func (self *TerminalState) SetPointerShape(s PointerShape) {
+	self.mutex.Lock()
+	self.pointer_shape = &s
+	self.mutex.Unlock()
+	self.changed()
+}
+
+func (self *TerminalState) SetCursorStyle(s CursorStyle) {
+	self.mutex.Lock()
+	self.cursor_style = &s
+	self.mutex.Unlock()
+	self.changed()
+}
+
+func (self *TerminalState) SetTitle(s string) {
+	self.mutex.Lock()
+	self.title = &s
+	self.mutex.Unlock()
+	self.changed()
+}
+
+func (self *TerminalState) has_changes() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.pointer_shape != nil || self.cursor_style != nil || self.title != nil
+}
+
+func (self *TerminalState) take_changes() (ps *PointerShape, cs *CursorStyle, title *string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	ps, cs, title = self.pointer_shape, self.cursor_style, self.title
+	self.pointer_shape, self.cursor_style, self.title = nil, nil, nil
+	return
+}
+
+// The manager for changes to the terminal state from other goroutines
+func (self *Loop) TerminalState() *TerminalState {
+	return &self.terminal_state
+}
+
+func (self *Loop) flush_terminal_state() {
+	ps, cs, title := self.terminal_state.take_changes()
+	if ps != nil {
+		if len(self.pointer_shapes) > 0 {
+			self.pointer_shapes[len(self.pointer_shapes)-1] = *ps
+			self.QueueWriteString("\x1b]22;" + ps.String() + "\x1b\\")
+		} else {
+			self.PushPointerShape(*ps)
+		}
+	}
+	if cs != nil {
+		self.SetCursorShape(cs.Shape, cs.Blink)
+	}
+	if title != nil {
+		self.SetWindowTitle(*title)
+	}
+}
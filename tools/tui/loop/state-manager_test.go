@@ -0,0 +1,70 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestTerminalStateManager(t *testing.T) {
+	lp, _ := New()
+	ts := lp.TerminalState()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ts.SetTitle("title")
+			ts.SetPointerShape(TEXT_POINTER)
+		}()
+	}
+	wg.Wait()
+	ts.SetCursorStyle(CursorStyle{Shape: BAR_CURSOR})
+	if err := lp.render(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\x1b]22;text\x1b\\" + CursorShape(BAR_CURSOR, false) + "\x1b]2;title\x1b\\"
+	if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Unexpected output:\n%s", diff)
+	}
+	ts.SetPointerShape(GRAB_POINTER)
+	if err := lp.render(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]PointerShape{GRAB_POINTER}, lp.pointer_shapes); diff != "" {
+		t.Fatalf("Pointer shape not replaced:\n%s", diff)
+	}
+	take_pending_writes(lp)
+	if err := lp.render(); err != nil || take_pending_writes(lp) != "" {
+		t.Fatalf("Changes written more than once: %v", err)
+	}
+}
+
+func TestTerminalStateWithRenderOnlyWhenDirty(t *testing.T) {
+	lp, _ := New()
+	lp.Config.RenderOnlyWhenDirty = true
+	if err := lp.handle_wakeup(); err != nil || lp.render_requested {
+		t.Fatalf("Render requested for a wakeup without changes: %v", err)
+	}
+	done := make(chan bool)
+	go func() {
+		lp.TerminalState().SetTitle("title")
+		close(done)
+	}()
+	<-done
+	if err := lp.handle_wakeup(); err != nil || !lp.render_requested {
+		t.Fatalf("Render not requested for a change to the terminal state: %v", err)
+	}
+	if err := lp.render(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("\x1b]2;title\x1b\\", take_pending_writes(lp)); diff != "" {
+		t.Fatalf("Unexpected output:\n%s", diff)
+	}
+}
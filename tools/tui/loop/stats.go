@@ -0,0 +1,179 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ = fmt.Print
+
+const num_of_render_durations_to_keep = 1024
+
+type LoopStats struct {
+	// Number of input events received from the terminal
+	TotalEvents uint64
+	// Number of input events that were discarded without being delivered to any handler
+	DroppedEvents uint64
+	// Number of times the screen was rendered, see OnRender
+	TotalRenders uint64
+
+	// Percentiles computed over the last 1024 renders
+	P50RenderDuration, P95RenderDuration, P99RenderDuration time.Duration
+	// The longest render since the loop was started
+	MaxRenderDuration time.Duration
+}
+
+func (self LoopStats) String() string {
+	return fmt.Sprintf("LoopStats{events: %d dropped: %d renders: %d p50: %s p95: %s p99: %s max: %s}",
+		self.TotalEvents, self.DroppedEvents, self.TotalRenders,
+		self.P50RenderDuration, self.P95RenderDuration, self.P99RenderDuration, self.MaxRenderDuration)
+}
+
+type loop_stats struct {
+	mutex                                       sync.Mutex
+	total_events, dropped_events, total_renders uint64
+	max_render_duration                         time.Duration
+	render_durations                            [num_of_render_durations_to_keep]time.Duration
+	num_of_render_durations, render_write_pos   int
+}
+
+func (self *loop_stats) reset() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.total_events, self.dropped_events, self.total_renders = 0, 0, 0
+	self.max_render_duration = 0
+	self.num_of_render_durations, self.render_write_pos = 0, 0
+}
+
+func (self *loop_stats) event_received(delivered bool) {
+	self.mutex.Lock()
+	self.total_events++
+	if !delivered {
+		self.dropped_events++
+	}
+	self.mutex.Unlock()
+}
+
+func (self *loop_stats) render_done(duration time.Duration) {
+	self.mutex.Lock()
+	self.total_renders++
+	self.max_render_duration = max(self.max_render_duration, duration)
+	self.render_durations[self.render_write_pos] = duration
+	self.render_write_pos = (self.render_write_pos + 1) % len(self.render_durations)
+	self.num_of_render_durations = min(self.num_of_render_durations+1, len(self.render_durations))
+	self.mutex.Unlock()
+}
+
+func (self *loop_stats) snapshot() (ans LoopStats) {
+	self.mutex.Lock()
+	ans.TotalEvents, ans.DroppedEvents, ans.TotalRenders = self.total_events, self.dropped_events, self.total_renders
+	ans.MaxRenderDuration = self.max_render_duration
+	durations := slices.Clone(self.render_durations[:self.num_of_render_durations])
+	self.mutex.Unlock()
+	if len(durations) > 0 {
+		slices.Sort(durations)
+		percentile := func(p int) time.Duration {
+			return durations[min(len(durations)-1, (len(durations)*p)/100)]
+		}
+		ans.P50RenderDuration, ans.P95RenderDuration, ans.P99RenderDuration = percentile(50), percentile(95), percentile(99)
+	}
+	return
+}
+
+// Return a consistent snapshot of the statistics for this loop. Safe to call
+// from any goroutine. The statistics are reset every time the loop is run.
+func (self *Loop) Stats() LoopStats {
+	return self.stats.snapshot()
+}
+
+type event_type uint8
+
+const (
+	key_event event_type = iota
+	text_event
+	paste_event
+	// in the order of MouseEventType
+	mouse_press_event
+	mouse_release_event
+	mouse_move_event
+	mouse_click_event
+	mouse_leave_event
+	resize_event
+	escape_code_event
+	num_of_event_types
+)
+
+var event_type_names = [num_of_event_types]string{
+	"key", "text", "paste", "mouse_press", "mouse_release", "mouse_move", "mouse_click", "mouse_leave", "resize", "escape_code"}
+
+type event_stats struct {
+	enabled atomic.Bool
+	counts  [num_of_event_types]atomic.Uint64
+}
+
+func (self *event_stats) count(t event_type) {
+	if self.enabled.Load() {
+		self.counts[t].Add(1)
+	}
+}
+
+func (self *event_stats) reset() {
+	for i := range self.counts {
+		self.counts[i].Store(0)
+	}
+}
+
+// Start counting the events received from the terminal by type, see
+// EventStats()
+func (self *Loop) EnableEventStats() {
+	self.event_stats.enabled.Store(true)
+}
+
+// The number of events of each type received since EnableEventStats() was
+// called, keyed by type, for example: key, text, paste, mouse_move, resize or
+// escape_code. Safe to call from any goroutine. The counts are reset every
+// time the loop is run.
+func (self *Loop) EventStats() map[string]uint64 {
+	ans := make(map[string]uint64, num_of_event_types)
+	for i, name := range event_type_names {
+		ans[name] = self.event_stats.counts[i].Load()
+	}
+	return ans
+}
+
+// Set the counts of events reported by EventStats() to zero
+func (self *Loop) ResetEventStats() {
+	self.event_stats.reset()
+}
+
+func (self *Loop) render() (err error) {
+	self.render_requested = false
+	self.render_in_progress = true
+	defer func() { self.render_in_progress = false }()
+	self.flush_terminal_state()
+	if self.IsInScrollback() {
+		self.render_scrollback()
+		return
+	}
+	if self.OnRender != nil || len(self.components) > 0 {
+		start := time.Now()
+		var hooks []render_hook
+		hooks, err = self.run_pre_render_hooks()
+		if err == nil && self.OnRender != nil {
+			err = self.OnRender()
+		}
+		if err == nil {
+			err = self.render_components()
+		}
+		if perr := self.run_post_render_hooks(hooks); err == nil {
+			err = perr
+		}
+		self.stats.render_done(time.Since(start))
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestEventStats(t *testing.T) {
+	lp, _ := New()
+	lp.OnText = func(string, bool, bool) error { return nil }
+	parse := func(input string) {
+		t.Helper()
+		if err := lp.escape_code_parser.ParseString(input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parse("a")
+	if lp.EventStats()["text"] != 0 {
+		t.Fatalf("Events counted before stats were enabled")
+	}
+	lp.EnableEventStats()
+	parse("ab\x1b[97u\x1b[200~xyz\x1b[201~\x1b]999;x\x1b\\")
+	lp.screen_size = ScreenSize{WidthCells: 10, HeightCells: 10, CellWidth: 1, CellHeight: 1, WidthPx: 10, HeightPx: 10, updated: true}
+	parse("\x1b[<0;1;1M\x1b[<0;1;1m\x1b[<35;2;2M")
+	expected := map[string]uint64{}
+	for _, name := range event_type_names {
+		expected[name] = 0
+	}
+	expected["text"], expected["key"], expected["paste"], expected["escape_code"] = 2, 1, 1, 1
+	expected["mouse_press"], expected["mouse_release"], expected["mouse_move"] = 1, 1, 1
+	if diff := cmp.Diff(expected, lp.EventStats()); diff != "" {
+		t.Fatalf("Unexpected event stats:\n%s", diff)
+	}
+	lp.ResetEventStats()
+	if lp.EventStats()["text"] != 0 {
+		t.Fatalf("Event stats not reset")
+	}
+}
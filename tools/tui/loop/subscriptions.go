@@ -0,0 +1,58 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"slices"
+)
+
+var _ = fmt.Print
+
+type subscription struct {
+	id    IdType
+	topic string
+	cb    func(any)
+	owner Component
+}
+
+// Call cb with the data of every message published to topic, see Publish().
+// Returns an id that can be used to unsubscribe.
+func (self *Loop) Subscribe(topic string, cb func(any)) IdType {
+	return self.add_subscription(topic, cb, nil)
+}
+
+// Like Subscribe() except that the subscription is automatically cancelled
+// when component is unmounted
+func (self *Loop) SubscribeFor(component Component, topic string, cb func(any)) IdType {
+	return self.add_subscription(topic, cb, component)
+}
+
+func (self *Loop) add_subscription(topic string, cb func(any), owner Component) IdType {
+	self.subscription_id_counter++
+	self.subscriptions = append(self.subscriptions, subscription{self.subscription_id_counter, topic, cb, owner})
+	return self.subscription_id_counter
+}
+
+// Cancel a subscription, returns false if there is no subscription with the
+// specified id
+func (self *Loop) Unsubscribe(id IdType) bool {
+	before := len(self.subscriptions)
+	self.subscriptions = slices.DeleteFunc(self.subscriptions, func(s subscription) bool { return s.id == id })
+	return len(self.subscriptions) < before
+}
+
+// Deliver data to the subscribers of topic, in the order they subscribed.
+// Subscribers can subscribe and unsubscribe while a message is being
+// delivered, which affects only later messages.
+func (self *Loop) Publish(topic string, data any) {
+	for _, s := range slices.Clone(self.subscriptions) {
+		if s.topic == topic {
+			s.cb(data)
+		}
+	}
+}
+
+func (self *Loop) cancel_subscriptions_for(c Component) {
+	self.subscriptions = slices.DeleteFunc(self.subscriptions, func(s subscription) bool { return s.owner == c })
+}
@@ -0,0 +1,49 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+type subscribing_component struct {
+	ComponentBase
+}
+
+func (self *subscribing_component) Render(lp *Loop) error { return nil }
+
+func TestSubscriptions(t *testing.T) {
+	lp, _ := New()
+	var received []string
+	subscriber := func(name string) func(any) {
+		return func(data any) { received = append(received, fmt.Sprint(name, ":", data)) }
+	}
+	test := func(topic string, data any, expected ...string) {
+		t.Helper()
+		received = nil
+		lp.Publish(topic, data)
+		if diff := cmp.Diff(expected, received); diff != "" {
+			t.Fatalf("Unexpected messages for topic: %s\n%s", topic, diff)
+		}
+	}
+	c := &subscribing_component{}
+	lp.MountComponent(c)
+	id := lp.Subscribe("a", subscriber("plain"))
+	lp.SubscribeFor(c, "a", subscriber("component"))
+	lp.SubscribeFor(c, "b", subscriber("component"))
+	test("a", 1, "plain:1", "component:1")
+	test("b", 2, "component:2")
+	test("c", 3)
+	lp.UnmountComponent(c)
+	test("a", 4, "plain:4")
+	test("b", 5)
+	if !lp.Unsubscribe(id) || lp.Unsubscribe(id) {
+		t.Fatalf("Unsubscribing did not report success exactly once")
+	}
+	test("a", 6)
+}
@@ -0,0 +1,56 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestCursorHiddenAfterSuspend(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		results := []string{}
+		lp.OnInitialize = func() (string, error) {
+			lp.SetCursorVisible(false)
+			_, err := lp.CallSoon(func(IdType) error {
+				if err := lp.SuspendAndRun(func() error { return nil }); err != nil {
+					return err
+				}
+				results = append(results, fmt.Sprintf("after suspend: %v", lp.IsCursorVisible()))
+				if err := lp.SoftRestart(); err != nil {
+					return err
+				}
+				results = append(results, fmt.Sprintf("after soft restart: %v", lp.IsCursorVisible()))
+				lp.Quit(0)
+				return nil
+			})
+			return "", err
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v %v", results, err))
+	}
+	received := make(chan []byte, 1)
+	result := run_test_in_pty(t, "TestCursorHiddenAfterSuspend", func(master *os.File) {
+		buf, data := make([]byte, 4096), []byte{}
+		for {
+			n, err := master.Read(buf)
+			data = append(data, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		received <- data
+	})
+	if result != "[after suspend: false after soft restart: false] <nil>" {
+		t.Fatalf("Unexpected cursor visibility: %s", result)
+	}
+	// hidden initially, after resuming and after the soft restart
+	if data := <-received; bytes.Count(data, []byte("\x1b[?25l")) != 3 {
+		t.Fatalf("The cursor was not hidden again: %#v", string(data))
+	}
+}
@@ -0,0 +1,218 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+// A terminal feature that can be detected by querying the terminal
+type Feature uint8
+
+const (
+	// Synchronized updates, DEC private mode 2026
+	FEATURE_SYNCHRONIZED_OUTPUT Feature = iota
+	// Reporting of mouse positions in pixels, DEC private mode 1016
+	FEATURE_PIXEL_MOUSE
+	// The kitty keyboard protocol
+	FEATURE_KITTY_KEYBOARD
+	// The kitty graphics protocol
+	FEATURE_KITTY_GRAPHICS
+	// Sixel graphics, as reported by primary device attributes
+	FEATURE_SIXEL
+	num_of_features
+)
+
+func (self Feature) String() string {
+	switch self {
+	case FEATURE_SYNCHRONIZED_OUTPUT:
+		return "FEATURE_SYNCHRONIZED_OUTPUT"
+	case FEATURE_PIXEL_MOUSE:
+		return "FEATURE_PIXEL_MOUSE"
+	case FEATURE_KITTY_KEYBOARD:
+		return "FEATURE_KITTY_KEYBOARD"
+	case FEATURE_KITTY_GRAPHICS:
+		return "FEATURE_KITTY_GRAPHICS"
+	case FEATURE_SIXEL:
+		return "FEATURE_SIXEL"
+	}
+	return fmt.Sprintf("Feature(%d)", uint8(self))
+}
+
+// The identity of the terminal, as reported by it
+type TerminalID struct {
+	// The name of the terminal, for example: kitty or xterm, from XTVERSION
+	// or the TN capability, empty if the terminal does not report it
+	Name string
+	// The version from XTVERSION or secondary device attributes
+	Version string
+
+	features       [num_of_features]bool
+	pointer_shapes [GRABBING_POINTER + 1]bool
+}
+
+func (self TerminalID) SupportsFeature(f Feature) bool {
+	return f < num_of_features && self.features[f]
+}
+
+// Whether the terminal can display the pointer shape, as reported in response
+// to the OSC 22 query
+func (self TerminalID) SupportsPointerShape(s PointerShape) bool {
+	return int(s) < len(self.pointer_shapes) && self.pointer_shapes[s]
+}
+
+func (self TerminalID) String() string {
+	features := []string{}
+	for f := Feature(0); f < num_of_features; f++ {
+		if self.features[f] {
+			features = append(features, f.String())
+		}
+	}
+	return fmt.Sprintf("TerminalID{Name: %#v, Version: %#v, Features: %s}", self.Name, self.Version, strings.Join(features, "|"))
+}
+
+const kitty_graphics_query_id = "31"
+
+// XTVERSION, secondary device attributes, DECRQM for the modes of the
+// features, the kitty keyboard and graphics protocol queries, XTGETTCAP for
+// TN and the supported pointer shapes. Sixel support is detected from the
+// response to the primary device attributes query that terminates every
+// query, see run_terminal_queries().
+var terminal_id_queries = "\x1b[>q\x1b[>c" + PENDING_UPDATE.query_escape_code() + "\x1b[?1016$p\x1b[?u" +
+	"\x1b_Gi=" + kitty_graphics_query_id + ",s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\" +
+	"\x1bP+q" + hex.EncodeToString([]byte("TN")) + "\x1b\\" + pointer_shapes_query()
+
+func pointer_shapes_query() string {
+	names := make([]string, GRABBING_POINTER+1)
+	for i := range names {
+		names[i] = PointerShape(i).String()
+	}
+	return "\x1b]22;?" + strings.Join(names, ",") + "\x1b\\"
+}
+
+// Parse the name and version in an XTVERSION response of the form
+// name(version) or name version
+func parse_xtversion(text string) (name, version string) {
+	if n, v, found := strings.Cut(text, "("); found {
+		return strings.TrimSpace(n), strings.TrimSuffix(v, ")")
+	}
+	name, version, _ = strings.Cut(text, " ")
+	return
+}
+
+type terminal_id_query struct {
+	ans             TerminalID
+	da2_version, tn string
+}
+
+func (self *terminal_id_query) terminal_query() terminal_query {
+	return terminal_query{
+		query: terminal_id_queries,
+		csi: func(raw []byte) bool {
+			csi := string(raw)
+			switch {
+			case strings.HasPrefix(csi, ">") && strings.HasSuffix(csi, "c"):
+				if parts := strings.Split(csi[1:len(csi)-1], ";"); len(parts) > 1 {
+					self.da2_version = parts[1]
+				}
+			case strings.HasPrefix(csi, "?") && strings.HasSuffix(csi, "$y"):
+				if mode, setting, ok := parse_decrpm(csi); ok && setting > 0 && setting < 4 {
+					switch mode {
+					case PENDING_UPDATE:
+						self.ans.features[FEATURE_SYNCHRONIZED_OUTPUT] = true
+					case 1016 | private:
+						self.ans.features[FEATURE_PIXEL_MOUSE] = true
+					}
+				}
+			case strings.HasPrefix(csi, "?") && strings.HasSuffix(csi, "u"):
+				self.ans.features[FEATURE_KITTY_KEYBOARD] = true
+			case is_primary_device_attributes_response(raw):
+				self.ans.features[FEATURE_SIXEL] = slices.Contains(strings.Split(csi[1:len(csi)-1], ";"), "4")
+			default:
+				return false
+			}
+			return true
+		},
+		dcs: func(raw []byte) bool {
+			ev := wcswidth.ParseDCS(raw)
+			if ev.Params == ">|" {
+				self.ans.Name, self.ans.Version = parse_xtversion(ev.Data)
+				return true
+			}
+			caps, valid, err := ev.XTGETTCAPResponse()
+			is_response := false
+			for _, c := range caps {
+				if err == nil && c.Name == "TN" {
+					is_response = true
+					if valid {
+						self.tn = c.Value
+					}
+				}
+			}
+			return is_response
+		},
+		osc: func(raw []byte) bool {
+			// the response is a comma separated list of 1 or 0 for each queried shape
+			supported, found := strings.CutPrefix(string(raw), "22;")
+			if found {
+				for i, x := range strings.Split(supported, ",") {
+					if i < len(self.ans.pointer_shapes) {
+						self.ans.pointer_shapes[i] = x == "1"
+					}
+				}
+			}
+			return found
+		},
+		apc: func(raw []byte) bool {
+			is_response := strings.HasPrefix(string(raw), "Gi="+kitty_graphics_query_id+";")
+			if is_response {
+				self.ans.features[FEATURE_KITTY_GRAPHICS] = strings.HasSuffix(string(raw), ";OK")
+			}
+			return is_response
+		},
+	}
+}
+
+func (self *terminal_id_query) result() TerminalID {
+	ans := self.ans
+	if ans.Name == "" {
+		ans.Name = self.tn
+	}
+	if ans.Version == "" {
+		ans.Version = self.da2_version
+	}
+	return ans
+}
+
+// Query the terminal for its identity and the features it supports, see
+// TerminalID. Any other input read from r is discarded.
+func QueryTerminalID(w io.Writer, r io.Reader) (TerminalID, error) {
+	q := terminal_id_query{}
+	_, err := run_terminal_queries(w, r, q.terminal_query())
+	return q.result(), err
+}
+
+var terminal_id_cache struct {
+	sync.Mutex
+	id     TerminalID
+	cached bool
+}
+
+// The identity of the terminal and the features it supports, queried when
+// the first loop in this process that needs it started, see
+// LoopConfig.IdentifyTerminal. Empty, that is, no features are supported,
+// if the terminal has not been identified.
+func (self *Loop) TerminalID() TerminalID {
+	terminal_id_cache.Lock()
+	defer terminal_id_cache.Unlock()
+	return terminal_id_cache.id
+}
@@ -0,0 +1,72 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestQueryTerminalID(t *testing.T) {
+	test := func(responses string, expected TerminalID, features ...Feature) {
+		t.Helper()
+		for _, f := range features {
+			expected.features[f] = true
+		}
+		w := strings.Builder{}
+		actual, err := QueryTerminalID(&w, strings.NewReader(responses))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.String() != terminal_id_queries+"\x1b[c" {
+			t.Fatalf("Unexpected query: %#v", w.String())
+		}
+		if diff := cmp.Diff(expected.String(), actual.String()); diff != "" {
+			t.Fatalf("Unexpected terminal identity for: %#v\n%s", responses, diff)
+		}
+	}
+	test("\x1bP>|kitty(0.36.0)\x1b\\\x1b[>1;4000;29c\x1b[?2026;2$y\x1b[?1016;2$y\x1b[?0u\x1b_Gi=31;OK\x1b\\\x1bP1+r544e=787465726d2d6b69747479\x1b\\\x1b[?62;c",
+		TerminalID{Name: "kitty", Version: "0.36.0"}, FEATURE_SYNCHRONIZED_OUTPUT, FEATURE_PIXEL_MOUSE, FEATURE_KITTY_KEYBOARD, FEATURE_KITTY_GRAPHICS)
+	test("\x1bP>|XTerm(390)\x1b\\\x1b[>41;390;0c\x1b[?2026;0$y\x1b[?1016;1$y\x1b[?63;1;4;6c",
+		TerminalID{Name: "XTerm", Version: "390"}, FEATURE_PIXEL_MOUSE, FEATURE_SIXEL)
+	// the name from TN and the version from DA2 when XTVERSION is not supported
+	test("\x1b[>1;10;0c\x1bP1+r544e=787465726d\x1b\\\x1b_Gi=31;ENOTSUPPORTED\x1b\\\x1b[?62c",
+		TerminalID{Name: "xterm", Version: "10"})
+	test("\x1bP>|tmux 3.4\x1b\\\x1b[?62c", TerminalID{Name: "tmux", Version: "3.4"})
+	if _, err := QueryTerminalID(&strings.Builder{}, strings.NewReader("\x1bP>|kitty(0.36.0)\x1b\\")); err == nil {
+		t.Fatalf("No error when terminal did not respond fully")
+	}
+	if (TerminalID{}).SupportsFeature(FEATURE_SIXEL) || (TerminalID{}).SupportsFeature(num_of_features+1) {
+		t.Fatalf("Unexpected feature support for an unknown terminal")
+	}
+}
+
+func TestPointerShapeFallback(t *testing.T) {
+	id, err := QueryTerminalID(&strings.Builder{}, strings.NewReader("\x1b]22;1,0,1\x1b\\\x1b[?62c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.SupportsPointerShape(DEFAULT_POINTER) || id.SupportsPointerShape(TEXT_POINTER) || !id.SupportsPointerShape(POINTER_POINTER) || id.SupportsPointerShape(GRAB_POINTER) {
+		t.Fatalf("Incorrect pointer shape support detected: %v", id.pointer_shapes)
+	}
+	terminal_id_cache.Lock()
+	saved := terminal_id_cache.id
+	terminal_id_cache.id = id
+	terminal_id_cache.Unlock()
+	defer func() {
+		terminal_id_cache.Lock()
+		terminal_id_cache.id = saved
+		terminal_id_cache.Unlock()
+	}()
+	lp, _ := New()
+	lp.SetPointerShapeWithFallback(GRAB_POINTER, TEXT_POINTER, POINTER_POINTER)
+	lp.SetPointerShapeWithFallback(GRAB_POINTER)
+	if diff := cmp.Diff([]PointerShape{POINTER_POINTER, DEFAULT_POINTER}, lp.pointer_shapes); diff != "" {
+		t.Fatalf("Unexpected pointer shapes:\n%s", diff)
+	}
+}
@@ -0,0 +1,172 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const startup_query_timeout = 2 * time.Second
+
+// Escape codes to send to the terminal along with handlers for the responses
+// to them, which return true if the escape code is a response to the query.
+// Handlers that are nil are ignored.
+type terminal_query struct {
+	query              string
+	csi, dcs, osc, apc func(raw []byte) bool
+}
+
+func (self terminal_query) handler(code_type EscapeCodeType) func([]byte) bool {
+	switch code_type {
+	case CSI:
+		return self.csi
+	case DCS:
+		return self.dcs
+	case OSC:
+		return self.osc
+	case APC:
+		return self.apc
+	}
+	return nil
+}
+
+func is_primary_device_attributes_response(csi []byte) bool {
+	s := string(csi)
+	return strings.HasPrefix(s, "?") && strings.HasSuffix(s, "c")
+}
+
+// Call the handlers of every query for the escape code, returning true if it
+// is a response to any of them or to the primary device attributes query
+func dispatch_terminal_query_response(queries []terminal_query, code_type EscapeCodeType, raw []byte) (is_response bool) {
+	for _, x := range queries {
+		if h := x.handler(code_type); h != nil && h(raw) {
+			is_response = true
+		}
+	}
+	return is_response || (code_type == CSI && is_primary_device_attributes_response(raw))
+}
+
+// Send the queries to the terminal in a single write, followed by a primary
+// device attributes query, which all terminals respond to, and read from r
+// until the response to it arrives, so that this does not wait forever with
+// terminals that do not respond to the queries. The handlers of every query
+// are called for every response, including the one to the primary device
+// attributes query. Returns all the input read from r, including input that
+// is not a response to the queries, such as typeahead.
+func run_terminal_queries(w io.Writer, r io.Reader, queries ...terminal_query) (input []byte, err error) {
+	q := strings.Builder{}
+	for _, x := range queries {
+		q.WriteString(x.query)
+	}
+	q.WriteString("\x1b[c")
+	if _, err = io.WriteString(w, q.String()); err != nil {
+		return
+	}
+	done := false
+	p := wcswidth.EscapeCodeParser{}
+	p.HandleCSI = func(raw []byte) error {
+		dispatch_terminal_query_response(queries, CSI, raw)
+		done = done || is_primary_device_attributes_response(raw)
+		return nil
+	}
+	p.HandleDCS = func(raw []byte) error {
+		dispatch_terminal_query_response(queries, DCS, raw)
+		return nil
+	}
+	p.HandleOSC = func(raw []byte) error {
+		dispatch_terminal_query_response(queries, OSC, raw)
+		return nil
+	}
+	p.HandleAPC = func(raw []byte) error {
+		dispatch_terminal_query_response(queries, APC, raw)
+		return nil
+	}
+	buf := make([]byte, 256)
+	for !done {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			input = append(input, buf[:n]...)
+			if err = p.Parse(buf[:n]); err != nil {
+				return
+			}
+		}
+		if rerr != nil {
+			if !done {
+				return input, rerr
+			}
+			break
+		}
+	}
+	return
+}
+
+// Query the terminal for what the loop needs to know about it at startup, in
+// a single round trip, so that startup waits for at most one response. The
+// terminal is queried only for the cell dimensions when the kernel does not
+// report the screen size in pixels, for the color scheme preference when
+// following the system color scheme and for its identity with
+// LoopConfig.IdentifyTerminal. The input read while waiting for the responses is
+// kept to be delivered by dispatch_startup_input(). Must be called before the
+// tty reader is started.
+func (self *Loop) run_startup_queries() {
+	var queries []terminal_query
+	cell_width, cell_height := 0, 0
+	needs_cell_dimensions := self.needs_cell_dimensions()
+	if needs_cell_dimensions {
+		queries = append(queries, cell_dimensions_query(&cell_width, &cell_height))
+	}
+	terminal_id_cache.Lock()
+	defer terminal_id_cache.Unlock()
+	tid := terminal_id_query{}
+	needs_terminal_id := !terminal_id_cache.cached && self.Config.IdentifyTerminal
+	if needs_terminal_id {
+		queries = append(queries, tid.terminal_query())
+	}
+	color_preference := UNKNOWN_COLOR_SCHEME
+	if self.system_color_schemes != nil {
+		queries = append(queries, color_scheme_preference_query(&color_preference))
+	}
+	self.startup_queries, self.startup_input = queries, nil
+	if len(queries) > 0 {
+		r := tty_reader_with_deadline{self.controlling_term, time.Now().Add(startup_query_timeout)}
+		self.startup_input, _ = run_terminal_queries(self.controlling_term, &r, queries...)
+	}
+	self.queried_cell_width, self.queried_cell_height = 0, 0
+	if needs_cell_dimensions {
+		self.set_queried_cell_dimensions(cell_width, cell_height)
+	}
+	if needs_terminal_id {
+		// an incomplete identification on timeout is cached so that later
+		// loops do not wait again
+		terminal_id_cache.id, terminal_id_cache.cached = tid.result(), true
+	}
+	self.set_startup_color_scheme_preference(color_preference)
+}
+
+// Deliver the input read while waiting for the responses to the startup
+// queries, so that typeahead is not lost, dropping the responses themselves,
+// see is_startup_query_response()
+func (self *Loop) dispatch_startup_input() error {
+	input := self.startup_input
+	self.startup_input = nil
+	defer func() { self.startup_queries = nil }()
+	if len(input) == 0 {
+		return nil
+	}
+	return self.dispatch_input_data(input)
+}
+
+func (self *Loop) is_startup_query_response(code_type EscapeCodeType, raw []byte) bool {
+	if self.startup_queries != nil && dispatch_terminal_query_response(self.startup_queries, code_type, raw) {
+		self.stats.event_received(true)
+		return true
+	}
+	return false
+}
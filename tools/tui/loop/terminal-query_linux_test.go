@@ -0,0 +1,57 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestStartupQueriesKeepTypeahead(t *testing.T) {
+	if output := os.Getenv(pty_test_output_env); output != "" {
+		lp, _ := New(NoAlternateScreen)
+		lp.Config.IdentifyTerminal = true
+		results := []string{}
+		lp.OnInitialize = func() (string, error) {
+			results = append(results, "terminal: "+lp.TerminalID().Name)
+			return "", nil
+		}
+		lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+			results = append(results, fmt.Sprintf("text: %#v", text))
+			if text == "\x03" {
+				lp.Quit(0)
+			}
+			return nil
+		}
+		lp.OnEscapeCode = func(code_type EscapeCodeType, raw []byte) error {
+			results = append(results, fmt.Sprintf("escape code: %#v", string(raw)))
+			return nil
+		}
+		err := lp.Run()
+		write_pty_test_result(output, fmt.Sprintf("%v %v", results, err))
+	}
+	result := run_test_in_pty(t, "TestStartupQueriesKeepTypeahead", func(master *os.File) {
+		buf, received := make([]byte, 4096), []byte{}
+		for !bytes.HasSuffix(received, []byte("\x1b[c")) {
+			n, err := master.Read(buf)
+			if err != nil {
+				return
+			}
+			received = append(received, buf[:n]...)
+		}
+		// typeahead interleaved with the responses
+		master.WriteString("a\x1bP>|kitty(0.36.0)\x1b\\b\x1b[6;20;10t\x03\x1b[?62;4c")
+		for {
+			if _, err := master.Read(buf); err != nil {
+				return
+			}
+		}
+	})
+	if result != `[terminal: kitty text: "a" text: "b" text: "\x03"] <nil>` {
+		t.Fatalf("Typeahead read with the responses to the startup queries was not delivered: %s", result)
+	}
+}
@@ -0,0 +1,68 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestRunTerminalQueries(t *testing.T) {
+	w := strings.Builder{}
+	cw, ch := 0, 0
+	pref := UNKNOWN_COLOR_SCHEME
+	tid := terminal_id_query{}
+	input := "typeahead\x1b[6;20;10t\x1bP>|kitty(0.36.0)\x1b\\\x1b[?997;2n\x1b[?62;4c"
+	read, err := run_terminal_queries(&w, strings.NewReader(input),
+		cell_dimensions_query(&cw, &ch), tid.terminal_query(), color_scheme_preference_query(&pref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != input {
+		t.Fatalf("Not all input was returned: %#v", string(read))
+	}
+	if q := "\x1b[16t" + terminal_id_queries + "\x1b[?996n\x1b[c"; w.String() != q {
+		t.Fatalf("The queries were not sent in a single write terminated by a single DA1 query: %#v", w.String())
+	}
+	if cw != 10 || ch != 20 || pref != LIGHT_COLOR_SCHEME {
+		t.Fatalf("Responses not handled: %d %d %s", cw, ch, pref)
+	}
+	if id := tid.result(); id.Name != "kitty" || id.Version != "0.36.0" || !id.SupportsFeature(FEATURE_SIXEL) {
+		t.Fatalf("Unexpected terminal identity: %s", id)
+	}
+}
+
+func TestStartupInputDispatch(t *testing.T) {
+	lp, _ := New()
+	tid := terminal_id_query{}
+	lp.startup_queries = []terminal_query{tid.terminal_query(), color_scheme_preference_query(new(ColorSchemePreference))}
+	lp.startup_input = []byte("a\x1b[>1;4000;0c\x1b[?2026;2$y\x1b_Gi=31;OK\x1b\\b\x1bP1+r544e=6b69747479\x1b\\\x1b]22;1,0\x1b\\\x1b[?997;1n\x1b[?62c\x1b[?62c")
+	var events []string
+	lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+		events = append(events, "text: "+text)
+		return nil
+	}
+	lp.OnEscapeCode = func(code_type EscapeCodeType, raw []byte) error {
+		events = append(events, fmt.Sprintf("%s: %#v", code_type, string(raw)))
+		return nil
+	}
+	if err := lp.dispatch_startup_input(); err != nil {
+		t.Fatal(err)
+	}
+	// the responses are dropped, escape codes after the input read during
+	// the startup queries are delivered as usual
+	if err := lp.dispatch_input_data([]byte("\x1b[?62c")); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"text: a", "text: b", `CSI: "?62c"`}, events); diff != "" {
+		t.Fatalf("Unexpected events:\n%s", diff)
+	}
+	if lp.startup_queries != nil || lp.startup_input != nil {
+		t.Fatalf("The startup queries were not cleared")
+	}
+}
@@ -31,6 +31,7 @@ const (
 	RESTORE_COLORS                = "\033[#Q"
 	DECSACE_DEFAULT_REGION_SELECT = "\033[*x"
 	CLEAR_SCREEN                  = "\033[H\033[2J"
+	RESET_SCROLLING_REGION        = "\033[r"
 )
 
 type CursorShapes uint
@@ -41,6 +42,16 @@ const (
 	BAR_CURSOR       CursorShapes = 5
 )
 
+// Whether the text cursor blinks, CURSOR_BLINK_DEFAULT is the terminal's own
+// preference, as it was before the first call to Loop.SetCursorBlinkMode()
+type CursorBlinkMode uint8
+
+const (
+	CURSOR_BLINK_DEFAULT CursorBlinkMode = iota
+	CURSOR_BLINKING
+	CURSOR_STEADY
+)
+
 type Mode uint32
 
 const private Mode = 1 << 31
@@ -53,6 +64,7 @@ const (
 	DECOM                  Mode = 6 | private
 	DECAWM                 Mode = 7 | private
 	DECARM                 Mode = 8 | private
+	ATT610_BLINK           Mode = 12 | private
 	DECTCEM                Mode = 25 | private
 	MOUSE_BUTTON_TRACKING  Mode = 1000 | private
 	MOUSE_MOTION_TRACKING  Mode = 1002 | private
@@ -65,6 +77,7 @@ const (
 	ALTERNATE_SCREEN       Mode = 1049 | private
 	BRACKETED_PASTE        Mode = 2004 | private
 	PENDING_UPDATE         Mode = 2026 | private
+	COLOR_PREFERENCE       Mode = 2031 | private
 	HANDLE_TERMIOS_SIGNALS Mode = kitty.HandleTermiosSignals | private
 )
 
@@ -99,6 +112,8 @@ type TerminalStateOptions struct {
 	Alternate_screen, restore_colors bool
 	mouse_tracking                   MouseTracking
 	kitty_keyboard_mode              KeyboardStateBits
+	color_preference_notification    bool
+	focus_tracking                   bool
 }
 
 func set_modes(sb *strings.Builder, modes ...Mode) {
@@ -123,21 +138,48 @@ func (self *TerminalStateOptions) SetStateEscapeCodes() string {
 	if self.restore_colors {
 		sb.WriteString(SAVE_COLORS)
 	}
+	self.write_mode_escape_codes(&sb, false)
+	return sb.String()
+}
+
+// Escape codes to put the terminal back into the state set by
+// SetStateEscapeCodes() without saving the current state again, useful when
+// some other program has messed up the terminal state.
+func (self *TerminalStateOptions) ReapplyStateEscapeCodes() string {
+	var sb strings.Builder
+	sb.Grow(256)
+	self.write_mode_escape_codes(&sb, true)
+	return sb.String()
+}
+
+func (self *TerminalStateOptions) write_mode_escape_codes(sb *strings.Builder, reapply bool) {
 	sb.WriteString(DECSACE_DEFAULT_REGION_SELECT)
-	reset_modes(&sb,
+	reset_modes(sb,
 		IRM, DECKM, DECSCNM, BRACKETED_PASTE, FOCUS_TRACKING,
 		MOUSE_BUTTON_TRACKING, MOUSE_MOTION_TRACKING, MOUSE_MOVE_TRACKING, MOUSE_UTF8_MODE, MOUSE_SGR_MODE)
-	set_modes(&sb, DECARM, DECAWM, DECTCEM)
+	set_modes(sb, DECARM, DECAWM, DECTCEM)
+	if self.focus_tracking {
+		set_modes(sb, FOCUS_TRACKING)
+	}
 	if self.Alternate_screen {
-		set_modes(&sb, ALTERNATE_SCREEN)
+		set_modes(sb, ALTERNATE_SCREEN)
 		sb.WriteString(CLEAR_SCREEN)
 	}
 	switch self.kitty_keyboard_mode {
-	case LEGACY_KEYS:
-		sb.WriteString("\033[>u")
 	case NO_KEYBOARD_STATE_CHANGE:
+	case LEGACY_KEYS:
+		if reapply {
+			// set the flags on the top of the stack rather than pushing
+			sb.WriteString("\033[=0;1u")
+		} else {
+			sb.WriteString("\033[>u")
+		}
 	default:
-		sb.WriteString(fmt.Sprintf("\033[>%du", self.kitty_keyboard_mode))
+		if reapply {
+			sb.WriteString(fmt.Sprintf("\033[=%d;1u", self.kitty_keyboard_mode))
+		} else {
+			sb.WriteString(fmt.Sprintf("\033[>%du", self.kitty_keyboard_mode))
+		}
 	}
 	if self.mouse_tracking != NO_MOUSE_TRACKING {
 		sb.WriteString(MOUSE_SGR_PIXEL_MODE.EscapeCodeToSet())
@@ -150,21 +192,31 @@ func (self *TerminalStateOptions) SetStateEscapeCodes() string {
 			sb.WriteString(MOUSE_MOVE_TRACKING.EscapeCodeToSet())
 		}
 	}
-	return sb.String()
+	if self.color_preference_notification {
+		// also query the current preference
+		sb.WriteString(COLOR_PREFERENCE.EscapeCodeToSet() + "\033[?996n")
+	}
 }
 
 func (self *TerminalStateOptions) ResetStateEscapeCodes() string {
 	var sb strings.Builder
 	sb.Grow(64)
+	// resetting the scrolling region moves the cursor, so preserve its position
+	sb.WriteString(SAVE_CURSOR + RESET_SCROLLING_REGION + RESTORE_CURSOR)
 	if self.kitty_keyboard_mode != NO_KEYBOARD_STATE_CHANGE {
 		sb.WriteString("\033[<u")
 	}
+	if self.color_preference_notification {
+		sb.WriteString(COLOR_PREFERENCE.EscapeCodeToReset())
+	}
 	if self.Alternate_screen {
 		sb.WriteString(ALTERNATE_SCREEN.EscapeCodeToReset())
 	} else {
 		sb.WriteString(SAVE_CURSOR)
 	}
 	sb.WriteString(RESTORE_PRIVATE_MODE_VALUES)
+	// always leave the cursor visible, regardless of what the saved state was
+	sb.WriteString(DECTCEM.EscapeCodeToSet())
 	if self.restore_colors {
 		sb.WriteString(RESTORE_COLORS)
 	}
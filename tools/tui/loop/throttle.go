@@ -0,0 +1,68 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+var _ = fmt.Print
+
+type paste_state struct {
+	in_progress, truncated bool
+	// the whole paste is dropped when it exceeds the input rate
+	dropped bool
+	size    int
+}
+
+type input_rate struct {
+	window_start time.Time
+	count        int
+}
+
+// Whether the current bracketed paste, or the last one once it has ended, was
+// truncated because it exceeded Config.MaxPasteSize. Can be checked in OnText
+// when it is called with an empty string to indicate the end of a paste.
+func (self *Loop) PasteTruncated() bool { return self.paste.truncated }
+
+func (self *Loop) accept_pasted_rune(ch rune) bool {
+	p := &self.paste
+	if !p.in_progress {
+		*p = paste_state{in_progress: true, dropped: self.input_rate_exceeded()}
+	}
+	if p.dropped || p.truncated {
+		return false
+	}
+	p.size += utf8.RuneLen(ch)
+	if self.Config.MaxPasteSize > 0 && p.size > self.Config.MaxPasteSize {
+		p.truncated = true
+		return false
+	}
+	return true
+}
+
+// Returns false if the end of the paste should not be delivered, as the paste
+// was dropped
+func (self *Loop) end_paste() bool {
+	if self.paste.truncated && self.log_enabled(slog.LevelWarn) {
+		self.logger.Warn("Bracketed paste truncated to the maximum paste size", "max_paste_size", self.Config.MaxPasteSize)
+	}
+	dropped := self.paste.in_progress && self.paste.dropped
+	self.paste.in_progress = false
+	return !dropped
+}
+
+func (self *Loop) input_rate_exceeded() bool {
+	if self.Config.MaxEventsPerSecond <= 0 {
+		return false
+	}
+	r := &self.input_rate
+	if now := time.Now(); now.Sub(r.window_start) >= time.Second {
+		r.window_start, r.count = now, 0
+	}
+	r.count++
+	return r.count > self.Config.MaxEventsPerSecond
+}
@@ -75,6 +75,7 @@ func (self *Loop) dispatch_timers(now time.Time) error {
 		}
 	}
 	if dispatched {
+		self.event_received_needs_render()
 		self.sort_timers() // needed because a timer callback could have added a new timer
 	}
 	return nil
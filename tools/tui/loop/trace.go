@@ -0,0 +1,120 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+var _ = fmt.Print
+
+// An event recorded by the tracer, see EnableTracing()
+type TraceEntry struct {
+	Timestamp time.Time
+	// The type of the event, the same as the keys of EventStats()
+	EventType string
+	// The time spent handling the event, zero if it was still being handled
+	HandlerDuration time.Duration
+}
+
+func (self TraceEntry) String() string {
+	return fmt.Sprintf("%s %s %s", self.Timestamp.Format("15:04:05.000000"), self.EventType, self.HandlerDuration)
+}
+
+// The fields are atomic so that the trace can be dumped from other
+// goroutines without locking, at worst an entry being overwritten is torn
+type trace_slot struct {
+	timestamp, duration atomic.Int64
+	event_type          atomic.Uint32
+}
+
+// A ring buffer of events, written only by the loop goroutine
+type event_tracer struct {
+	slots     []trace_slot
+	head      atomic.Uint64
+	open_slot *trace_slot
+	opened_at time.Time
+}
+
+func (self *event_tracer) begin(t event_type) {
+	if self.slots == nil {
+		return
+	}
+	self.end()
+	now := time.Now()
+	h := self.head.Load()
+	s := &self.slots[h%uint64(len(self.slots))]
+	s.timestamp.Store(now.UnixNano())
+	s.event_type.Store(uint32(t))
+	s.duration.Store(0)
+	self.head.Store(h + 1)
+	self.open_slot, self.opened_at = s, now
+}
+
+func (self *event_tracer) end() {
+	if self.open_slot != nil {
+		self.open_slot.duration.Store(int64(time.Since(self.opened_at)))
+		self.open_slot = nil
+	}
+}
+
+func (self *event_tracer) dump() []TraceEntry {
+	if len(self.slots) == 0 {
+		return nil
+	}
+	h := self.head.Load()
+	n := min(h, uint64(len(self.slots)))
+	ans := make([]TraceEntry, 0, n)
+	for i := h - n; i < h; i++ {
+		s := &self.slots[i%uint64(len(self.slots))]
+		e := TraceEntry{Timestamp: time.Unix(0, s.timestamp.Load()), HandlerDuration: time.Duration(s.duration.Load())}
+		if t := event_type(s.event_type.Load()); t < num_of_event_types {
+			e.EventType = event_type_names[t]
+		}
+		ans = append(ans, e)
+	}
+	return ans
+}
+
+// Wrap an input handler so that the duration of the event it handles is
+// traced and it is labelled when profiling
+func traced_handler[T any](self *Loop, name string, handler func(T) error) func(T) error {
+	return func(x T) error {
+		defer self.tracer.end()
+		if self.profiler.active {
+			return self.profiled(name, func() error { return handler(x) })
+		}
+		return handler(x)
+	}
+}
+
+// Record the last capacity events received in a ring buffer, for debugging.
+// The trace is written to stderr if the loop panics. Zero or less disables
+// tracing. Must be called before Run() or from the loop goroutine.
+func (self *Loop) EnableTracing(capacity int) {
+	self.tracer.open_slot = nil
+	self.tracer.head.Store(0)
+	if capacity > 0 {
+		self.tracer.slots = make([]trace_slot, capacity)
+	} else {
+		self.tracer.slots = nil
+	}
+}
+
+// The traced events, oldest first, see EnableTracing(). Can be called from
+// any goroutine.
+func (self *Loop) DumpTrace() []TraceEntry {
+	return self.tracer.dump()
+}
+
+func (self *Loop) write_trace(w io.Writer) {
+	if trace := self.DumpTrace(); len(trace) > 0 {
+		fmt.Fprintf(w, "Trace of the last %d events (oldest first):\r\n", len(trace))
+		for _, e := range trace {
+			fmt.Fprintf(w, "%s\r\n", e)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestEventTracing(t *testing.T) {
+	lp, _ := New()
+	lp.OnText = func(string, bool, bool) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	lp.OnKeyEvent = func(*KeyEvent) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	if err := lp.escape_code_parser.ParseString("a"); err != nil || lp.DumpTrace() != nil {
+		t.Fatalf("Events traced before tracing was enabled: %v", err)
+	}
+	lp.EnableTracing(3)
+	if err := lp.escape_code_parser.ParseString("ab\x1b[97uc"); err != nil {
+		t.Fatal(err)
+	}
+	trace := lp.DumpTrace()
+	var types []string
+	for i, e := range trace {
+		types = append(types, e.EventType)
+		if e.HandlerDuration < time.Millisecond || (i > 0 && e.Timestamp.Before(trace[i-1].Timestamp)) {
+			t.Fatalf("Incorrect trace entry: %s", e)
+		}
+	}
+	if diff := cmp.Diff([]string{"text", "key", "text"}, types); diff != "" {
+		t.Fatalf("Unexpected traced events:\n%s", diff)
+	}
+	lp.EnableTracing(0)
+	if lp.DumpTrace() != nil {
+		t.Fatalf("Trace not discarded when tracing was disabled")
+	}
+}
+
+func BenchmarkEventTracing(b *testing.B) {
+	lp, _ := New()
+	lp.EnableTracing(1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lp.tracer.begin(text_event)
+		lp.tracer.end()
+	}
+}
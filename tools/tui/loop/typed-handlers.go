@@ -0,0 +1,113 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var _ = fmt.Print
+
+// The terminal was resized, see OnResize
+type ResizeEvent struct {
+	OldSize, NewSize ScreenSize
+}
+
+// Text pasted with bracketed paste. The text is delivered in chunks as it is
+// received and once the paste ends, an event with End set and empty Text is
+// delivered.
+type PasteEvent struct {
+	Text string
+	End  bool
+}
+
+// The terminal window gained or lost the keyboard focus. Reported only when
+// a handler for it is registered with RegisterTypedHandler() before the loop
+// is run, as that turns on focus tracking (DEC private mode 1004).
+type FocusEvent struct {
+	Focused bool
+}
+
+// The events that can be handled with RegisterTypedHandler(). The loop
+// delivers the input events *KeyEvent, *MouseEvent, ResizeEvent, PasteEvent
+// and FocusEvent, and the data of events posted with PostEvent() can be of
+// any concrete type. Interface types are rejected by RegisterTypedHandler()
+// as they would match events of every type implementing them.
+type Event any
+
+// A handler for the events of type T, see RegisterTypedHandler()
+type TypedHandler[T Event] struct {
+	Handler func(T) error
+}
+
+func (self TypedHandler[T]) handles(data any) bool {
+	_, ok := data.(T)
+	return ok
+}
+
+func (self TypedHandler[T]) handle(data any) (handled bool, err error) {
+	if d, ok := data.(T); ok {
+		return true, self.Handler(d)
+	}
+	return false, nil
+}
+
+type typed_event_handler interface {
+	handles(data any) bool
+	handle(data any) (handled bool, err error)
+}
+
+// Register a handler invoked only for events of type T, so that the handler
+// does not need to do the type assertion itself. Events are delivered to
+// every matching handler, in the order the handlers were registered. Events
+// that a handler matched are not delivered to the corresponding callback:
+// OnKeyEvent, OnMouseEvent, OnResize, OnText for pasted text and
+// OnPostedEvent for events posted with PostEvent(). Key, mouse and paste
+// events are delivered to mounted components first, as for the callbacks.
+// Returns an error, without registering the handler, if T is an interface
+// type or KeyEvent or MouseEvent, which are delivered only as pointers. Must
+// be called in the loop goroutine or before the loop is run.
+func RegisterTypedHandler[T Event](lp *Loop, h func(T) error) error {
+	switch t := reflect.TypeFor[T](); {
+	case t.Kind() == reflect.Interface:
+		return fmt.Errorf("Cannot register a typed handler for the interface type %s as it matches events of every type implementing it", t)
+	case t == reflect.TypeFor[KeyEvent]() || t == reflect.TypeFor[MouseEvent]():
+		return fmt.Errorf("Cannot register a typed handler for %s as these events are delivered as *%s", t, t)
+	}
+	th := TypedHandler[T]{Handler: h}
+	if th.handles(FocusEvent{}) {
+		lp.terminal_options.focus_tracking = true
+	}
+	lp.typed_handlers = append(lp.typed_handlers, th)
+	return nil
+}
+
+func (self *Loop) has_typed_handler(sample any) bool {
+	for _, h := range self.typed_handlers {
+		if h.handles(sample) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Loop) dispatch_to_typed_handlers(data any) (handled bool, err error) {
+	for _, h := range self.typed_handlers {
+		matched, err := h.handle(data)
+		if err != nil {
+			return true, err
+		}
+		handled = handled || matched
+	}
+	return
+}
+
+func (self *Loop) handle_focus_event(csi string) (bool, error) {
+	if !self.terminal_options.focus_tracking || (csi != "I" && csi != "O") {
+		return false, nil
+	}
+	self.stats.event_received(true)
+	_, err := self.dispatch_to_typed_handlers(FocusEvent{Focused: csi == "I"})
+	return true, err
+}
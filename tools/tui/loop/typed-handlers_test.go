@@ -0,0 +1,76 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestTypedInputEventHandlers(t *testing.T) {
+	lp, _ := New()
+	lp.screen_size = ScreenSize{WidthCells: 10, HeightCells: 5, CellWidth: 10, CellHeight: 20, WidthPx: 100, HeightPx: 100, updated: true}
+	var events, callbacks []string
+	RegisterTypedHandler(lp, func(ev *KeyEvent) error {
+		events = append(events, "key: "+ev.Key)
+		return nil
+	})
+	RegisterTypedHandler(lp, func(ev *MouseEvent) error {
+		events = append(events, fmt.Sprintf("mouse: %d %d", ev.Cell.X, ev.Cell.Y))
+		return nil
+	})
+	RegisterTypedHandler(lp, func(ev PasteEvent) error {
+		events = append(events, fmt.Sprintf("paste: %#v %v", ev.Text, ev.End))
+		return nil
+	})
+	RegisterTypedHandler(lp, func(ev FocusEvent) error {
+		events = append(events, fmt.Sprintf("focus: %v", ev.Focused))
+		return nil
+	})
+	lp.OnKeyEvent = func(ev *KeyEvent) error { callbacks = append(callbacks, "key"); return nil }
+	lp.OnMouseEvent = func(ev *MouseEvent) error { callbacks = append(callbacks, "mouse"); return nil }
+	lp.OnText = func(text string, from_key_event, in_bracketed_paste bool) error {
+		callbacks = append(callbacks, fmt.Sprintf("text: %#v %v", text, in_bracketed_paste))
+		return nil
+	}
+	if !lp.terminal_options.focus_tracking {
+		t.Fatalf("Registering a FocusEvent handler did not turn on focus tracking")
+	}
+	if err := lp.dispatch_input_data([]byte("\x1b[97u\x1b[<0;21;41M\x1b[200~ab\x1b[201~\x1b[I\x1b[Oc")); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"key: a", "mouse: 2 2", `paste: "a" false`, `paste: "b" false`, `paste: "" true`, "focus: true", "focus: false"}, events); diff != "" {
+		t.Fatalf("Unexpected typed events:\n%s", diff)
+	}
+	// events handled by typed handlers are not delivered to the callbacks
+	if diff := cmp.Diff([]string{`text: "c" false`}, callbacks); diff != "" {
+		t.Fatalf("Unexpected callbacks:\n%s", diff)
+	}
+}
+
+func TestTypedHandlerRegistration(t *testing.T) {
+	lp, _ := New()
+	for name, err := range map[string]error{
+		"any":        RegisterTypedHandler(lp, func(any) error { return nil }),
+		"error":      RegisterTypedHandler(lp, func(error) error { return nil }),
+		"KeyEvent":   RegisterTypedHandler(lp, func(KeyEvent) error { return nil }),
+		"MouseEvent": RegisterTypedHandler(lp, func(MouseEvent) error { return nil }),
+	} {
+		if err == nil {
+			t.Fatalf("Registering a typed handler for %s did not fail", name)
+		}
+	}
+	if len(lp.typed_handlers) != 0 || lp.terminal_options.focus_tracking {
+		t.Fatalf("Rejected typed handlers were registered")
+	}
+	if err := RegisterTypedHandler(lp, func(*KeyEvent) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterTypedHandler(lp, func(FocusEvent) error { return nil }); err != nil || len(lp.typed_handlers) != 2 {
+		t.Fatalf("Typed handlers for concrete types not registered: %v", err)
+	}
+}
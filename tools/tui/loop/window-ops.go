@@ -0,0 +1,81 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var _ = fmt.Print
+
+const xtwinops_query_timeout = 2 * time.Second
+
+// Detect support for XTWINOPS by asking for the size of the text area in
+// cells (CSI 18 t). A primary device attributes query is sent after it, which
+// all terminals respond to, so that terminals that ignore XTWINOPS are
+// detected without waiting for the timeout.
+func (self *Loop) query_xtwinops_support() error {
+	if self.xtwinops_support == mode_supported || self.xtwinops_support == mode_unsupported {
+		return nil
+	}
+	self.xtwinops_support, self.xtwinops_reported = mode_support_querying, false
+	err := self.SendQueryAndWait("\x1b[18t\x1b[c", xtwinops_query_timeout, func() bool { return self.xtwinops_support != mode_support_querying })
+	if err != nil {
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			self.xtwinops_support = mode_support_unknown
+			return err
+		}
+		self.xtwinops_support = mode_unsupported
+	}
+	return nil
+}
+
+func (self *Loop) handle_xtwinops_support_response(csi string) bool {
+	if self.xtwinops_support != mode_support_querying {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(csi, "8;") && strings.HasSuffix(csi, "t"):
+		self.xtwinops_reported = true
+	case strings.HasPrefix(csi, "?") && strings.HasSuffix(csi, "c"):
+		self.xtwinops_support = mode_unsupported
+		if self.xtwinops_reported {
+			self.xtwinops_support = mode_supported
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (self *Loop) request_window_resize(op, height, width int) error {
+	if height < 1 || width < 1 {
+		return fmt.Errorf("Invalid window size: %dx%d", width, height)
+	}
+	if err := self.query_xtwinops_support(); err != nil {
+		return err
+	}
+	if self.xtwinops_support == mode_supported {
+		self.QueueWriteString(fmt.Sprintf("\x1b[%d;%d;%dt", op, height, width))
+	}
+	return nil
+}
+
+// Ask the terminal to resize its window to the specified number of rows and
+// columns using XTWINOPS. Does nothing if the terminal does not support
+// XTWINOPS, which is detected on first use, so must be called from the loop's
+// goroutine while the loop is running. Terminals are free to ignore the
+// request, watch OnResize for the actual change in size.
+func (self *Loop) RequestWindowResize(rows, cols int) error {
+	return self.request_window_resize(8, rows, cols)
+}
+
+// Same as RequestWindowResize() except that the size of the text area is in
+// pixels
+func (self *Loop) RequestWindowResizePixels(height, width int) error {
+	return self.request_window_resize(4, height, width)
+}
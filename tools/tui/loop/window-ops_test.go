@@ -0,0 +1,87 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+// A terminal that answers queries sent via SendQueryAndWait() with the
+// specified responses, feeding them to the loop as input
+func mock_terminal(lp *Loop, responses map[string]string) (queries *[]string) {
+	queries = &[]string{}
+	lp.wait_for_response = func(query string, timeout time.Duration, is_done func() bool) error {
+		*queries = append(*queries, query)
+		if err := lp.escape_code_parser.ParseString(responses[query]); err != nil {
+			return err
+		}
+		if !is_done() {
+			return os.ErrDeadlineExceeded
+		}
+		return nil
+	}
+	return
+}
+
+func TestWindowResizeRequests(t *testing.T) {
+	const query = "\x1b[18t\x1b[c"
+	test := func(response string, expected_queries []string, expected string) {
+		t.Helper()
+		lp, _ := New()
+		var unhandled []string
+		lp.OnEscapeCode = func(etype EscapeCodeType, raw []byte) error {
+			unhandled = append(unhandled, string(raw))
+			return nil
+		}
+		queries := mock_terminal(lp, map[string]string{query: response})
+		for _, err := range []error{lp.RequestWindowResize(24, 80), lp.RequestWindowResizePixels(600, 800)} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if diff := cmp.Diff(expected_queries, *queries); diff != "" {
+			t.Fatalf("Unexpected support queries:\n%s", diff)
+		}
+		if diff := cmp.Diff(expected, take_pending_writes(lp)); diff != "" {
+			t.Fatalf("Unexpected resize requests:\n%s", diff)
+		}
+		if len(unhandled) > 0 {
+			t.Fatalf("Responses to the support query were not consumed: %#v", unhandled)
+		}
+	}
+	// support is queried only once
+	test("\x1b[8;24;80t\x1b[?62;c", []string{query}, "\x1b[8;24;80t\x1b[4;600;800t")
+	test("\x1b[?62;c", []string{query}, "")
+	test("", []string{query}, "")
+
+	lp, _ := New()
+	if err := lp.RequestWindowResize(24, 80); err == nil {
+		t.Fatalf("No error when the loop is not running")
+	}
+	if err := lp.RequestWindowResize(0, 80); err == nil {
+		t.Fatalf("No error for invalid window size")
+	}
+}
+
+func TestPreviousScreenSize(t *testing.T) {
+	lp, _ := New()
+	sz := ScreenSize{WidthCells: 80, HeightCells: 24}
+	lp.screen_size = sz
+	lp.screen_size.updated = true
+	if lp.CurrentScreenSize() != sz || lp.PreviousScreenSize() != (ScreenSize{}) {
+		t.Fatalf("Incorrect screen sizes before resizing: %v %v", lp.CurrentScreenSize(), lp.PreviousScreenSize())
+	}
+	if err := lp.on_SIGWINCH(); err != nil {
+		t.Fatal(err)
+	}
+	if lp.PreviousScreenSize() != sz {
+		t.Fatalf("Incorrect previous screen size after resizing: %v", lp.PreviousScreenSize())
+	}
+}
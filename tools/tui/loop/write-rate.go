@@ -0,0 +1,95 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"time"
+)
+
+var _ = fmt.Print
+
+type queued_write struct {
+	id        IdType
+	size      int
+	queued_at time.Time
+}
+
+type completed_write struct {
+	size int
+	at   time.Time
+}
+
+// Tracks the output queued for the terminal and the rate at which the
+// terminal consumes it, over a rolling window of one second
+type WriteRateMonitor struct {
+	// writes are completed in the order they are queued
+	queued    []queued_write
+	completed []completed_write
+	pending   int
+	// whether OnWriteBackpressure has been called since pending output last
+	// fell below the threshold
+	signalled bool
+}
+
+func (self *WriteRateMonitor) write_queued(id IdType, size int, now time.Time) {
+	self.queued = append(self.queued, queued_write{id, size, now})
+	self.pending += size
+}
+
+func (self *WriteRateMonitor) write_completed(id IdType, now time.Time) {
+	i := 0
+	for ; i < len(self.queued) && self.queued[i].id <= id; i++ {
+		q := self.queued[i]
+		self.pending -= q.size
+		self.completed = append(self.completed, completed_write{q.size, now})
+	}
+	self.queued = self.queued[i:]
+	self.prune(now)
+}
+
+func (self *WriteRateMonitor) prune(now time.Time) {
+	i := 0
+	for i < len(self.completed) && now.Sub(self.completed[i].at) > time.Second {
+		i++
+	}
+	self.completed = self.completed[i:]
+}
+
+// The number of bytes written to the terminal in the last second
+func (self *WriteRateMonitor) BytesPerSecond() (ans int) {
+	self.prune(time.Now())
+	for _, c := range self.completed {
+		ans += c.size
+	}
+	return
+}
+
+// The number of bytes queued that the terminal has not yet consumed
+func (self *WriteRateMonitor) BytesPending() int { return self.pending }
+
+// How long the oldest pending output has been waiting to be written, zero
+// when there is no pending output
+func (self *WriteRateMonitor) Lag(now time.Time) time.Duration {
+	if len(self.queued) == 0 {
+		return 0
+	}
+	return now.Sub(self.queued[0].queued_at)
+}
+
+// Monitor of the output written to the terminal
+func (self *Loop) WriteRateMonitor() *WriteRateMonitor { return &self.write_rate }
+
+func (self *Loop) check_write_backpressure(now time.Time) error {
+	r := &self.write_rate
+	threshold := self.Config.WriteBackpressureThreshold
+	if threshold <= 0 || r.pending <= threshold {
+		r.signalled = false
+		return nil
+	}
+	if r.signalled || self.OnWriteBackpressure == nil {
+		return nil
+	}
+	r.signalled = true
+	return self.OnWriteBackpressure(r.pending, r.Lag(now))
+}
@@ -0,0 +1,58 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package loop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestWriteBackpressure(t *testing.T) {
+	lp, _ := New()
+	var calls []string
+	lp.OnWriteBackpressure = func(bytes_pending int, lag time.Duration) error {
+		calls = append(calls, fmt.Sprintf("%d %s", bytes_pending, lag))
+		return nil
+	}
+	lp.Config.WriteBackpressureThreshold = 8
+	r := lp.WriteRateMonitor()
+	now := time.Now()
+	queue := func(data string) IdType {
+		id := lp.QueueWriteString(data)
+		r.queued[len(r.queued)-1].queued_at = now
+		return id
+	}
+	first := queue("12345")
+	check := func(after time.Duration) {
+		t.Helper()
+		now = now.Add(after)
+		if err := lp.check_write_backpressure(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(0)
+	second := queue("12345")
+	check(time.Second)
+	queue("x")
+	check(time.Second)
+	r.write_completed(first, now)
+	r.write_completed(second, now)
+	check(0)
+	queue("123456789")
+	check(0)
+	if diff := cmp.Diff([]string{"10 1s", "10 1s"}, calls); diff != "" {
+		t.Fatalf("Unexpected calls to OnWriteBackpressure:\n%s", diff)
+	}
+	if r.BytesPending() != 10 || r.BytesPerSecond() != 10 {
+		t.Fatalf("Incorrect pending bytes: %d or rate: %d", r.BytesPending(), r.BytesPerSecond())
+	}
+	r.write_completed(first+10, now.Add(2*time.Second))
+	if r.BytesPending() != 0 || r.BytesPerSecond() != 10 || r.Lag(now) != 0 {
+		t.Fatalf("Incorrect pending bytes: %d or rate: %d or lag: %s", r.BytesPending(), r.BytesPerSecond(), r.Lag(now))
+	}
+}
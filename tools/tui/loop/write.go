@@ -87,6 +87,7 @@ func (self *Loop) wait_for_write_to_complete(sentinel IdType, tty_write_channel
 		case tty_write_channel <- self.pending_writes[num_sent]:
 			num_sent++
 		case write_id, more := <-write_done_channel:
+			self.write_rate.write_completed(write_id, time.Now())
 			if self.OnWriteComplete != nil {
 				err := self.OnWriteComplete(write_id, write_id < self.write_msg_id_counter)
 				if err != nil {
@@ -110,6 +111,7 @@ func (self *Loop) wait_for_write_to_complete(sentinel IdType, tty_write_channel
 		}
 		select {
 		case write_id, more := <-write_done_channel:
+			self.write_rate.write_completed(write_id, time.Now())
 			if self.OnWriteComplete != nil {
 				err := self.OnWriteComplete(write_id, write_id < self.write_msg_id_counter)
 				if err != nil {
@@ -129,6 +131,11 @@ func (self *Loop) wait_for_write_to_complete(sentinel IdType, tty_write_channel
 }
 
 func (self *Loop) add_write_to_pending_queue(data write_msg) {
+	if self.Config.ScrollbackLines > 0 {
+		self.capture_scrollback(data.str)
+		self.capture_scrollback(utils.UnsafeBytesToString(data.bytes))
+	}
+	self.write_rate.write_queued(data.id, len(data.str)+len(data.bytes), time.Now())
 	if len(self.pending_writes) > 0 || self.tty_write_channel == nil {
 		self.pending_writes = append(self.pending_writes, data)
 	} else {
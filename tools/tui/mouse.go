@@ -56,6 +56,7 @@ type MouseSelection struct {
 	is_active               bool
 	min_y, max_y            int
 	cell_width, cell_height int
+	pointer_id              uint8
 	drag_scroll             struct {
 		timer_id    loop.IdType
 		pixel_gap   int
@@ -65,11 +66,16 @@ type MouseSelection struct {
 
 func (self *MouseSelection) IsEmpty() bool  { return self.start.Equal(self.end) }
 func (self *MouseSelection) IsActive() bool { return self.is_active }
-func (self *MouseSelection) Finish()        { self.is_active = false }
-func (self *MouseSelection) Clear()         { *self = MouseSelection{} }
+
+// Whether the selection is active and was started by the specified pointer
+func (self *MouseSelection) IsActiveForPointer(pointer_id uint8) bool {
+	return self.is_active && self.pointer_id == pointer_id
+}
+func (self *MouseSelection) Finish() { self.is_active = false }
+func (self *MouseSelection) Clear()  { *self = MouseSelection{} }
 
 func (ms *MouseSelection) StartNewSelection(ev *loop.MouseEvent, line LinePos, min_y, max_y, cell_width, cell_height int) {
-	*ms = MouseSelection{cell_width: cell_width, cell_height: cell_height, min_y: min_y, max_y: max_y}
+	*ms = MouseSelection{cell_width: cell_width, cell_height: cell_height, min_y: min_y, max_y: max_y, pointer_id: ev.PointerID}
 	ms.start.line = line
 	ms.start.x = max(line.MinX(), min(ev.Cell.X, line.MaxX()))
 	cell_start := cell_width * ev.Cell.X
@@ -78,7 +84,11 @@ func (ms *MouseSelection) StartNewSelection(ev *loop.MouseEvent, line LinePos, m
 	ms.is_active = true
 }
 
+// Events from pointers other than the one that started the selection are ignored
 func (ms *MouseSelection) Update(ev *loop.MouseEvent, line LinePos) {
+	if ev.PointerID != ms.pointer_id {
+		return
+	}
 	ms.drag_scroll.timer_id = 0
 	if ms.is_active {
 		ms.end.x = max(line.MinX(), min(ev.Cell.X, line.MaxX()))
@@ -190,7 +200,7 @@ func (ms *MouseSelection) DragScrollTick(timer_id loop.IdType, lp *loop.Loop, ca
 }
 
 func (ms *MouseSelection) DragScroll(ev *loop.MouseEvent, lp *loop.Loop, callback loop.TimerCallback) {
-	if !ms.is_active {
+	if !ms.is_active || ev.PointerID != ms.pointer_id {
 		return
 	}
 	upper := ms.min_y * ms.cell_height
@@ -210,6 +220,9 @@ type CellRegion struct {
 	TopLeft, BottomRight struct{ X, Y int }
 	Id                   string
 	OnClick              []func(id string) error
+	// When regions overlap, only the regions with the highest ZOrder at the
+	// mouse position are hovered and clicked
+	ZOrder int
 }
 
 func (c CellRegion) Contains(x, y int) bool { // 0-based
@@ -226,10 +239,12 @@ type MouseState struct {
 	regions           []*CellRegion
 	region_id_map     map[string][]*CellRegion
 	hovered_ids       *utils.Set[string]
+	selected_ids      *utils.Set[string]
 	default_url_style struct {
 		value  string
 		loaded bool
 	}
+	outside_window bool
 }
 
 func (m *MouseState) AddCellRegion(id string, start_x, start_y, end_x, end_y int, on_click ...func(id string) error) *CellRegion {
@@ -248,11 +263,52 @@ func (m *MouseState) ClearCellRegions() {
 	m.hovered_ids = nil
 }
 
+// The state of the regions with a given id
+type RegionState struct {
+	// Whether the mouse is inside one of the regions, maintained by
+	// UpdateState()
+	Hovered bool
+	// Whether the regions have been selected with SetRegionSelected()
+	Selected bool
+}
+
+func (m *MouseState) RegionState(id string) RegionState {
+	return RegionState{Hovered: m.hovered_ids != nil && m.hovered_ids.Has(id), Selected: m.selected_ids != nil && m.selected_ids.Has(id)}
+}
+
+// Mark the regions with the specified id as selected. Unlike hover state,
+// selection is not reset by ClearCellRegions() so it survives re-rendering.
+func (m *MouseState) SetRegionSelected(id string, selected bool) {
+	if m.selected_ids == nil {
+		m.selected_ids = utils.NewSet[string]()
+	}
+	if selected {
+		m.selected_ids.Add(id)
+	} else {
+		m.selected_ids.Discard(id)
+	}
+}
+
+// Change the ZOrder of all regions with the specified id
+func (m *MouseState) SetRegionZOrder(id string, z int) {
+	for _, r := range m.region_id_map[id] {
+		r.ZOrder = z
+	}
+	m.UpdateHoveredIds()
+}
+
 func (m *MouseState) UpdateHoveredIds() (changed bool) {
 	h := utils.NewSet[string]()
+	top := 0
 	for _, r := range m.regions {
-		if r.Contains(m.Cell.X, m.Cell.Y) {
-			h.Add(r.Id)
+		if !m.outside_window && r.Contains(m.Cell.X, m.Cell.Y) {
+			if h.Len() == 0 || r.ZOrder > top {
+				h.Clear()
+				top = r.ZOrder
+			}
+			if r.ZOrder == top {
+				h.Add(r.Id)
+			}
 		}
 	}
 	changed = !h.Equal(m.hovered_ids)
@@ -324,6 +380,10 @@ func (m *MouseState) ClickHoveredRegions() error {
 }
 
 func (m *MouseState) UpdateState(ev *loop.MouseEvent) (hovered_ids_changed bool) {
+	m.outside_window = ev.Event_type == loop.MOUSE_LEAVE
+	if m.outside_window {
+		return m.UpdateHoveredIds()
+	}
 	m.Cell = ev.Cell
 	m.Pixel = ev.Pixel
 	if ev.Event_type == loop.MOUSE_PRESS || ev.Event_type == loop.MOUSE_RELEASE {
@@ -0,0 +1,69 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestRegionState(t *testing.T) {
+	m := MouseState{}
+	m.AddCellRegion("a", 0, 0, 4, 0)
+	m.AddCellRegion("b", 0, 1, 4, 1)
+	move := func(event_type loop.MouseEventType, x, y int, expected_a, expected_b RegionState) {
+		t.Helper()
+		m.UpdateState(&loop.MouseEvent{Event_type: event_type, Cell: struct{ X, Y int }{x, y}})
+		if diff := cmp.Diff([]RegionState{expected_a, expected_b}, []RegionState{m.RegionState("a"), m.RegionState("b")}); diff != "" {
+			t.Fatalf("Unexpected region state after moving to (%d, %d):\n%s", x, y, diff)
+		}
+	}
+	move(loop.MOUSE_MOVE, 2, 0, RegionState{Hovered: true}, RegionState{})
+	move(loop.MOUSE_MOVE, 2, 1, RegionState{}, RegionState{Hovered: true})
+	m.SetRegionSelected("a", true)
+	move(loop.MOUSE_LEAVE, 2, 1, RegionState{Selected: true}, RegionState{})
+	m.ClearCellRegions()
+	m.AddCellRegion("a", 0, 0, 4, 0)
+	move(loop.MOUSE_MOVE, 0, 0, RegionState{Hovered: true, Selected: true}, RegionState{})
+	m.SetRegionSelected("a", false)
+	move(loop.MOUSE_MOVE, 5, 0, RegionState{}, RegionState{})
+}
+
+func TestRegionZOrder(t *testing.T) {
+	m := MouseState{}
+	var clicked []string
+	on_click := func(id string) error {
+		clicked = append(clicked, id)
+		return nil
+	}
+	m.AddCellRegion("list", 0, 0, 9, 9, on_click)
+	m.AddCellRegion("item", 0, 2, 9, 2, on_click)
+	m.AddCellRegion("dropdown", 2, 2, 4, 2, on_click).ZOrder = 1
+	test := func(x, y int, expected ...string) {
+		t.Helper()
+		clicked = nil
+		m.UpdateState(&loop.MouseEvent{Event_type: loop.MOUSE_CLICK, Cell: struct{ X, Y int }{x, y}})
+		if err := m.ClickHoveredRegions(); err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(clicked)
+		if diff := cmp.Diff(expected, clicked); diff != "" {
+			t.Fatalf("Unexpected clicked regions at (%d, %d):\n%s", x, y, diff)
+		}
+	}
+	test(0, 2, "item", "list")
+	test(3, 8, "list")
+	test(3, 2, "dropdown")
+	m.SetRegionZOrder("dropdown", -1)
+	if !m.RegionState("item").Hovered {
+		t.Fatalf("Hovered regions not updated after changing the z-order")
+	}
+	test(3, 2, "item", "list")
+}
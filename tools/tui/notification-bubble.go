@@ -0,0 +1,185 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const max_notification_width = 40
+
+type NotificationStyle int
+
+const (
+	INFO NotificationStyle = iota
+	WARNING
+	ERROR
+	SUCCESS
+)
+
+func (self NotificationStyle) String() string {
+	switch self {
+	case INFO:
+		return "INFO"
+	case WARNING:
+		return "WARNING"
+	case ERROR:
+		return "ERROR"
+	case SUCCESS:
+		return "SUCCESS"
+	}
+	return fmt.Sprintf("NotificationStyle(%d)", int(self))
+}
+
+type bubble_notification struct {
+	message  string
+	style    NotificationStyle
+	timer_id loop.IdType
+	box      loop.Rect // position on screen, set when rendered
+}
+
+// Transient notifications drawn in the top right corner of its region, over
+// the rest of the UI, stacked with the oldest at the top. The region defaults
+// to the whole screen. Mount it above the other components. Dismissed
+// notifications are cleared, the UI underneath redraws the area they occupied
+// when the loop next renders.
+type NotificationBubble struct {
+	loop.ComponentBase
+
+	lp            *loop.Loop
+	notifications []*bubble_notification
+}
+
+func NewNotificationBubble() *NotificationBubble { return &NotificationBubble{} }
+
+func (self *NotificationBubble) OnMount(lp *loop.Loop) {
+	self.lp = lp
+	if self.Region().IsEmpty() {
+		if sz, err := lp.ScreenSize(); err == nil {
+			self.SetRegion(loop.Rect{Width: int(sz.WidthCells), Height: int(sz.HeightCells)})
+		}
+	}
+}
+
+func (self *NotificationBubble) OnUnmount(lp *loop.Loop) {
+	for len(self.notifications) > 0 {
+		self.dismiss(self.notifications[0])
+	}
+	self.lp = nil
+}
+
+// Show a notification, dismissing it after duration. A duration of zero or
+// less means the notification is shown until it is clicked. Must be called
+// while mounted and, for a non-zero duration, after the loop has started.
+func (self *NotificationBubble) Show(message string, duration time.Duration, style NotificationStyle) error {
+	if self.lp == nil {
+		return fmt.Errorf("Cannot show notifications before the NotificationBubble is mounted")
+	}
+	n := &bubble_notification{message: message, style: style}
+	if duration > 0 {
+		id, err := self.lp.AddTimer(duration, false, func(loop.IdType) error {
+			n.timer_id = 0
+			self.dismiss(n)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n.timer_id = id
+	}
+	self.notifications = append(self.notifications, n)
+	return nil
+}
+
+// The number of notifications currently shown
+func (self *NotificationBubble) Count() int { return len(self.notifications) }
+
+func (self *NotificationBubble) dismiss(n *bubble_notification) {
+	idx := slices.Index(self.notifications, n)
+	if idx < 0 {
+		return
+	}
+	if n.timer_id != 0 {
+		self.lp.RemoveTimer(n.timer_id)
+	}
+	// the notifications below move up so clear them all
+	for _, x := range self.notifications[idx:] {
+		self.clear(x.box)
+		x.box = loop.Rect{}
+	}
+	self.notifications = slices.Delete(self.notifications, idx, idx+1)
+}
+
+func (self *NotificationBubble) clear(box loop.Rect) {
+	if box.IsEmpty() {
+		return
+	}
+	blank := strings.Repeat(" ", box.Width)
+	for y := box.Y; y < box.Y+box.Height; y++ {
+		self.lp.MoveCursorTo(box.X+1, y+1)
+		self.lp.QueueWriteString(blank)
+	}
+}
+
+// Clicking a notification dismisses it, other events are passed on to the
+// UI underneath
+func (self *NotificationBubble) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	for _, n := range self.notifications {
+		if n.box.Contains(ev.Cell.X, ev.Cell.Y) {
+			if ev.Event_type == loop.MOUSE_CLICK {
+				self.dismiss(n)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (self *NotificationBubble) color(style NotificationStyle) string {
+	cs := self.lp.ColorScheme()
+	switch style {
+	case WARNING:
+		return "fg=" + cs.Warning.AsRGBSharp()
+	case ERROR:
+		return "fg=" + cs.Error.AsRGBSharp()
+	case SUCCESS:
+		return "fg=green"
+	}
+	return "fg=" + cs.Accent.AsRGBSharp()
+}
+
+func (self *NotificationBubble) Render(lp *loop.Loop) error {
+	r := self.Region()
+	max_width := min(max_notification_width, r.Width-4)
+	if max_width < 1 {
+		return nil
+	}
+	y := r.Y
+	for _, n := range self.notifications {
+		if y+3 > r.Y+r.Height {
+			n.box = loop.Rect{}
+			continue
+		}
+		text, width := wcswidth.TruncateToVisualLengthWithWidth(n.message, max_width)
+		n.box = loop.Rect{X: r.X + r.Width - width - 4, Y: y, Width: width + 4, Height: 3}
+		color := self.color(n.style)
+		border := func(text string) string { return lp.SprintStyled(color, text) }
+		draw := func(y int, text string) {
+			lp.MoveCursorTo(n.box.X+1, y+1)
+			lp.QueueWriteString(text)
+		}
+		draw(y, border("╭"+strings.Repeat("─", width+2)+"╮"))
+		draw(y+1, border("│")+" "+text+" "+border("│"))
+		draw(y+2, border("╰"+strings.Repeat("─", width+2)+"╯"))
+		y += 3
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestNotificationBubble(t *testing.T) {
+	lp, _ := loop.New()
+	b := NewNotificationBubble()
+	if err := b.Show("x", 0, INFO); err == nil {
+		t.Fatalf("Showing a notification before mounting did not fail")
+	}
+	b.SetRegion(loop.Rect{Width: 80, Height: 24})
+	lp.MountComponent(b)
+	if err := b.Show("File saved", time.Second, SUCCESS); err == nil {
+		t.Fatalf("Showing a notification with a duration before the loop started did not fail")
+	}
+	for _, msg := range []string{"one", "Connection lost"} {
+		if err := b.Show(msg, 0, WARNING); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Render(lp); err != nil {
+		t.Fatal(err)
+	}
+	if b.notifications[1].box != (loop.Rect{X: 61, Y: 3, Width: 19, Height: 3}) {
+		t.Fatalf("Notification not stacked in the top right corner: %s", b.notifications[1].box)
+	}
+	click := func(x, y int) bool {
+		ev := loop.MouseEvent{Event_type: loop.MOUSE_CLICK, Buttons: loop.LEFT_MOUSE_BUTTON}.WithCell(x, y)
+		consumed, err := b.HandleMouseEvent(lp, &ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return consumed
+	}
+	if click(10, 1) || b.Count() != 2 {
+		t.Fatalf("Click outside the notifications consumed")
+	}
+	if !click(79, 1) || b.Count() != 1 || b.notifications[0].message != "Connection lost" {
+		t.Fatalf("Click on a notification did not dismiss it")
+	}
+	lp.UnmountComponent(b)
+	if b.Count() != 0 {
+		t.Fatalf("Notifications not dismissed on unmount")
+	}
+}
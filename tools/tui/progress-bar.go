@@ -5,7 +5,11 @@ package tui
 import (
 	"fmt"
 	"kitty/tools/cli/markup"
+	"kitty/tools/tui/loop"
+	"kitty/tools/utils/style"
+	"kitty/tools/wcswidth"
 	"strings"
+	"time"
 )
 
 var _ = fmt.Print
@@ -61,3 +65,150 @@ func RenderProgressBar(frac float64, width int) string {
 	}
 	return ans
 }
+
+// The minimum interval between redraws of a ProgressBar, limiting it to 30 fps
+const progress_bar_redraw_interval = time.Second / 30
+
+type ProgressBarStyle struct {
+	// The character used to draw the bar. When empty, the smooth bar drawn by
+	// RenderProgressBar is used and the other fields are ignored.
+	FillChar string
+	// The character used to draw the unfilled part of the bar, defaults to FillChar
+	EmptyChar string
+	// Styles for the filled and unfilled parts of the bar, in the syntax used
+	// by loop.SprintStyled, for example: fg=green. Default to the Accent and
+	// Muted colors of the loop's color scheme.
+	FilledStyle, EmptyStyle string
+}
+
+// A single line progress bar with an optional label and percentage
+type ProgressBar struct {
+	loop.ComponentBase
+
+	Style ProgressBarStyle
+
+	current, total int64
+	label          string
+	dirty          bool
+	last_drawn_at  time.Time
+	redraw_timer   loop.IdType
+}
+
+func NewProgressBar() *ProgressBar {
+	return &ProgressBar{dirty: true}
+}
+
+func (self *ProgressBar) SetProgress(current, total int64) {
+	if current != self.current || total != self.total {
+		self.current, self.total = current, total
+		self.dirty = true
+	}
+}
+
+func (self *ProgressBar) SetLabel(s string) {
+	if s != self.label {
+		self.label = s
+		self.dirty = true
+	}
+}
+
+func (self *ProgressBar) SetRegion(r loop.Rect) {
+	self.ComponentBase.SetRegion(r)
+	self.dirty = true
+}
+
+func (self *ProgressBar) OnColorSchemeChange(lp *loop.Loop, cs loop.ColorScheme) {
+	self.dirty = true
+}
+
+// The completed fraction, between 0 and 1
+func (self *ProgressBar) Fraction() float64 {
+	if self.total <= 0 {
+		return 0
+	}
+	return max(0, min(1, float64(self.current)/float64(self.total)))
+}
+
+func (self *ProgressBar) render_bar(lp *loop.Loop, frac float64, width int) string {
+	if self.Style.FillChar == "" {
+		return RenderProgressBar(frac, width)
+	}
+	empty_char := self.Style.EmptyChar
+	if empty_char == "" {
+		empty_char = self.Style.FillChar
+	}
+	filled := int(frac*float64(width) + 0.5)
+	cs := lp.ColorScheme()
+	styled := func(spec string, defval style.RGBA, text string) string {
+		if text == "" {
+			return text
+		}
+		if spec == "" {
+			spec = "fg=" + defval.AsRGBSharp()
+		}
+		return lp.SprintStyled(spec, text)
+	}
+	return styled(self.Style.FilledStyle, cs.Accent, RepeatChar(self.Style.FillChar, filled)) + styled(self.Style.EmptyStyle, cs.Muted, RepeatChar(empty_char, width-filled))
+}
+
+// Render the line of text for the progress bar fitting in the specified width
+func (self *ProgressBar) line(lp *loop.Loop, width int) string {
+	frac := self.Fraction()
+	percent := fmt.Sprintf(" %3d%%", int(frac*100))
+	if width <= len(percent) {
+		return percent[len(percent)-width:]
+	}
+	width -= len(percent)
+	label := ""
+	if self.label != "" {
+		label = wcswidth.TruncateToVisualLength(self.label, width/3)
+		if label != "" {
+			label += " "
+		}
+	}
+	width -= wcswidth.Stringwidth(label)
+	return label + self.render_bar(lp, frac, width) + percent
+}
+
+// The bar is only redrawn when it has changed and at most 30 times a second,
+// using synchronized output to avoid flicker. When the region has zero width
+// the bar uses the rest of the screen width.
+func (self *ProgressBar) Render(lp *loop.Loop) error {
+	if !self.dirty {
+		return nil
+	}
+	if wait := progress_bar_redraw_interval - time.Since(self.last_drawn_at); wait > 0 {
+		if self.redraw_timer == 0 {
+			id, err := lp.AddTimer(wait, false, func(loop.IdType) error {
+				self.redraw_timer = 0
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			self.redraw_timer = id
+		}
+		return nil
+	}
+	r := self.Region()
+	width := r.Width
+	if width <= 0 {
+		sz, err := lp.ScreenSize()
+		if err != nil {
+			return err
+		}
+		width = int(sz.WidthCells) - r.X
+	}
+	if width <= 0 {
+		return nil
+	}
+	if !lp.IsAtomicUpdateActive() {
+		lp.StartAtomicUpdate()
+		defer lp.EndAtomicUpdate()
+	}
+	lp.MoveCursorTo(r.X+1, r.Y+1)
+	lp.QueueWriteString(self.line(lp, width))
+	self.dirty = false
+	self.last_drawn_at = time.Now()
+	return nil
+}
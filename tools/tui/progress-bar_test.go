@@ -4,6 +4,7 @@ package tui
 
 import (
 	"fmt"
+	"kitty/tools/tui/loop"
 	"kitty/tools/wcswidth"
 	"testing"
 )
@@ -23,3 +24,28 @@ func TestRenderProgressBar(t *testing.T) {
 	test(0.9459041731066461, 47)
 	test(0.9500257599175682, 47)
 }
+
+func TestProgressBarWidget(t *testing.T) {
+	lp, _ := loop.New()
+	pb := NewProgressBar()
+	pb.SetLabel("Downloading some file")
+	test := func(current, total int64, width int) {
+		pb.SetProgress(current, total)
+		b := pb.line(lp, width)
+		if a := wcswidth.Stringwidth(b); a != width {
+			t.Fatalf("Actual length %d != Expected length %d with progress: %d/%d\n%s", a, width, current, total, b)
+		}
+	}
+	for _, width := range []int{3, 10, 47, 80} {
+		test(0, 0, width)
+		test(3, 7, width)
+		test(7, 7, width)
+		test(9, 7, width)
+	}
+	pb.Style = ProgressBarStyle{FillChar: "#", EmptyChar: "-", FilledStyle: "fg=green"}
+	pb.SetLabel("")
+	test(1, 2, 13)
+	if b := wcswidth.StripEscapeCodes(pb.line(lp, 13)); b != "####----  50%" {
+		t.Fatalf("Unexpected progress bar: %#v", b)
+	}
+}
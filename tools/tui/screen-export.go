@@ -0,0 +1,158 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"kitty/tools/utils/style"
+)
+
+var _ = fmt.Print
+
+// The cells of a row, without trailing blank cells that have default formatting
+func (self *ScreenBuffer) trimmed_row(y int) []Cell {
+	row := self.row(y)
+	end := len(row)
+	for end > 0 && row[end-1].Rune == ' ' && row[end-1].same_attributes(blank_cell) {
+		end--
+	}
+	return row[:end]
+}
+
+func (self Cell) sgr_codes() string {
+	codes := []string{"0"}
+	add := func(val bool, code string) {
+		if val {
+			codes = append(codes, code)
+		}
+	}
+	add(self.Bold, "1")
+	add(self.Dim, "2")
+	add(self.Italic, "3")
+	add(self.Underline, "4")
+	add(self.Blink, "5")
+	add(self.Reverse, "7")
+	add(self.Strikethrough, "9")
+	if self.Fg.Is_set {
+		codes = append(codes, self.Fg.AsCSI(30))
+	}
+	if self.Bg.Is_set {
+		codes = append(codes, self.Bg.AsCSI(40))
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// Render the contents of the screen buffer as lines of text with SGR escape
+// codes for formatting, suitable for output to a terminal. Trailing blank
+// cells are omitted from each line.
+func ExportToANSI(buf *ScreenBuffer) string {
+	ans := strings.Builder{}
+	for y := 0; y < buf.height; y++ {
+		if y > 0 {
+			ans.WriteString("\n")
+		}
+		current := blank_cell
+		for _, c := range buf.trimmed_row(y) {
+			if !c.same_attributes(current) {
+				current = c
+				ans.WriteString(c.sgr_codes())
+			}
+			ans.WriteString(c.Text())
+		}
+		if !current.same_attributes(blank_cell) {
+			ans.WriteString("\x1b[m")
+		}
+	}
+	return ans.String()
+}
+
+func css_color(c Color, defval string) string {
+	if !c.Is_set {
+		return defval
+	}
+	if c.Is_numbered {
+		rgba := style.RGBA{}
+		rgba.FromRGB(style.ColorTable[c.Red])
+		return rgba.AsRGBSharp()
+	}
+	return style.RGBA{Red: c.Red, Green: c.Green, Blue: c.Blue}.AsRGBSharp()
+}
+
+func (self Cell) css(default_fg, default_bg string) string {
+	fg, bg := css_color(self.Fg, default_fg), css_color(self.Bg, default_bg)
+	if self.Reverse {
+		fg, bg = bg, fg
+	}
+	rules := []string{}
+	if fg != default_fg {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != default_bg {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if self.Bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if self.Dim {
+		rules = append(rules, "opacity:0.6")
+	}
+	if self.Italic {
+		rules = append(rules, "font-style:italic")
+	}
+	decorations := []string{}
+	if self.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if self.Strikethrough {
+		decorations = append(decorations, "line-through")
+	}
+	if self.Blink {
+		decorations = append(decorations, "blink")
+	}
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	return strings.Join(rules, ";")
+}
+
+// Render the contents of the screen buffer as a self-contained HTML <pre>
+// block, using inline CSS for formatting. Numbered colors are rendered using
+// kitty's default color table.
+func ExportToHTML(buf *ScreenBuffer) string {
+	default_fg, default_bg := "#dddddd", "#000000"
+	if c, err := style.ParseColor(style.DefaultColors.Foreground); err == nil {
+		default_fg = c.AsRGBSharp()
+	}
+	if c, err := style.ParseColor(style.DefaultColors.Background); err == nil {
+		default_bg = c.AsRGBSharp()
+	}
+	ans := strings.Builder{}
+	fmt.Fprintf(&ans, `<pre style="color:%s;background-color:%s">`, default_fg, default_bg)
+	for y := 0; y < buf.height; y++ {
+		if y > 0 {
+			ans.WriteString("\n")
+		}
+		row := buf.trimmed_row(y)
+		for i := 0; i < len(row); {
+			j := i + 1
+			for j < len(row) && row[j].same_attributes(row[i]) {
+				j++
+			}
+			text := strings.Builder{}
+			for _, c := range row[i:j] {
+				text.WriteString(c.Text())
+			}
+			if css := row[i].css(default_fg, default_bg); css != "" {
+				fmt.Fprintf(&ans, `<span style="%s">%s</span>`, css, html.EscapeString(text.String()))
+			} else {
+				ans.WriteString(html.EscapeString(text.String()))
+			}
+			i = j
+		}
+	}
+	ans.WriteString("</pre>")
+	return ans.String()
+}
@@ -0,0 +1,413 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kitty/tools/tui/sgr"
+	"kitty/tools/utils"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+// A cell color, when Is_set is false the terminal's default color is used
+type Color struct {
+	sgr.Color
+	Is_set bool
+}
+
+type Cell struct {
+	// The character in this cell, zero for the second cell of a wide character
+	Rune                                                        rune
+	Fg, Bg                                                      Color
+	Bold, Dim, Italic, Underline, Blink, Reverse, Strikethrough bool
+
+	combining string
+	// set on the last cell of a row when the text continues on the next row
+	next_char_was_wrapped bool
+}
+
+// The text of the cell including any combining characters
+func (self Cell) Text() string {
+	if self.Rune == 0 {
+		return ""
+	}
+	return string(self.Rune) + self.combining
+}
+
+func (self Cell) same_attributes(other Cell) bool {
+	self.Rune, self.combining, other.Rune, other.combining = 0, "", 0, ""
+	self.next_char_was_wrapped, other.next_char_was_wrapped = false, false
+	return self == other
+}
+
+var blank_cell = Cell{Rune: ' '}
+
+// An in-memory grid of cells that interprets output written to it the way a
+// terminal would. It understands text, SGR formatting, cursor movement and
+// erasing, other escape codes are ignored. LF also moves the cursor to the
+// start of the line, as with the terminal's usual output processing.
+type ScreenBuffer struct {
+	width, height      int
+	cells              []Cell
+	cursor_x, cursor_y int
+	pending_wrap       bool
+	pen                sgr.SGR
+	blink              bool
+	parser             wcswidth.EscapeCodeParser
+	// allocated when metadata is first set
+	meta []CellMeta
+}
+
+func NewScreenBuffer(width, height int) *ScreenBuffer {
+	ans := &ScreenBuffer{width: max(1, width), height: max(1, height)}
+	ans.cells = make([]Cell, ans.width*ans.height)
+	ans.Clear()
+	ans.parser.HandleRune = ans.handle_rune
+	ans.parser.HandleCSI = ans.handle_csi
+	return ans
+}
+
+func (self *ScreenBuffer) Width() int  { return self.width }
+func (self *ScreenBuffer) Height() int { return self.height }
+
+// The position of the cursor, 0, 0 is the top left cell
+func (self *ScreenBuffer) Cursor() (x, y int) { return self.cursor_x, self.cursor_y }
+
+// The cell at the specified position, 0, 0 is the top left cell
+func (self *ScreenBuffer) CellAt(x, y int) (Cell, error) {
+	if x < 0 || y < 0 || x >= self.width || y >= self.height {
+		return Cell{}, fmt.Errorf("The position %d, %d is outside the screen of size %dx%d", x, y, self.width, self.height)
+	}
+	return self.cells[y*self.width+x], nil
+}
+
+// Application defined metadata for a cell, for example, that the cell is part
+// of a URL or a button, for hit testing and accessibility. It does not affect
+// rendering.
+type CellMeta any
+
+// Associate metadata with the cell at the specified position, positions
+// outside the screen are ignored. The metadata moves with the cell contents
+// when the screen scrolls and is removed by Clear() but not by writing to the
+// cell.
+func (self *ScreenBuffer) SetCellMeta(x, y int, meta CellMeta) {
+	if x < 0 || y < 0 || x >= self.width || y >= self.height {
+		return
+	}
+	if self.meta == nil {
+		if meta == nil {
+			return
+		}
+		self.meta = make([]CellMeta, len(self.cells))
+	}
+	self.meta[y*self.width+x] = meta
+}
+
+// The metadata of the cell at the specified position, nil if none was set
+func (self *ScreenBuffer) CellMeta(x, y int) CellMeta {
+	if self.meta == nil || x < 0 || y < 0 || x >= self.width || y >= self.height {
+		return nil
+	}
+	return self.meta[y*self.width+x]
+}
+
+// The text displayed in the width cells of row y starting at column x. The
+// segment is clipped to the screen, the second cell of a wide character
+// contributes no text.
+func (self *ScreenBuffer) TextAt(x, y, width int) string {
+	if y < 0 || y >= self.height {
+		return ""
+	}
+	start, end := max(0, x), min(self.width, x+width)
+	ans := strings.Builder{}
+	for _, c := range self.row(y)[min(start, end):end] {
+		ans.WriteString(c.Text())
+	}
+	return ans.String()
+}
+
+// A line of text that wraps over the rows from StartRow to EndRow, inclusive
+type LogicalLine struct {
+	StartRow, EndRow int
+}
+
+// The text of the line, without trailing spaces
+func (self LogicalLine) Text(buf *ScreenBuffer) string {
+	ans := strings.Builder{}
+	for y := max(0, self.StartRow); y <= min(self.EndRow, buf.height-1); y++ {
+		ans.WriteString(buf.TextAt(0, y, buf.width))
+	}
+	return strings.TrimRight(ans.String(), " ")
+}
+
+// The lines of text on the screen, rows that were joined by wrapping text at
+// the right edge of the screen form a single line
+func (self *ScreenBuffer) LogicalLines() []LogicalLine {
+	ans := make([]LogicalLine, 0, self.height)
+	for y := 0; y < self.height; y++ {
+		ll := LogicalLine{StartRow: y, EndRow: y}
+		for ll.EndRow+1 < self.height && self.row(ll.EndRow)[self.width-1].next_char_was_wrapped {
+			ll.EndRow++
+		}
+		ans = append(ans, ll)
+		y = ll.EndRow
+	}
+	return ans
+}
+
+// Blank all cells and move the cursor to the top left, resetting formatting
+func (self *ScreenBuffer) Clear() {
+	for i := range self.cells {
+		self.cells[i] = blank_cell
+	}
+	self.cursor_x, self.cursor_y, self.pending_wrap = 0, 0, false
+	self.pen, self.blink = sgr.SGR{}, false
+	self.meta = nil
+}
+
+func (self *ScreenBuffer) Write(p []byte) (int, error) {
+	if err := self.parser.Parse(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (self *ScreenBuffer) WriteString(s string) (int, error) {
+	return self.Write(utils.UnsafeStringToBytes(s))
+}
+
+func (self *ScreenBuffer) row(y int) []Cell { return self.cells[y*self.width : (y+1)*self.width] }
+
+func (self *ScreenBuffer) pen_cell() (ans Cell) {
+	p := &self.pen
+	if p.Foreground.Is_set && !p.Foreground.Is_default {
+		ans.Fg = Color{p.Foreground.Val, true}
+	}
+	if p.Background.Is_set && !p.Background.Is_default {
+		ans.Bg = Color{p.Background.Val, true}
+	}
+	ans.Bold, ans.Dim, ans.Italic = p.Bold.Val, p.Dim.Val, p.Italic.Val
+	ans.Reverse, ans.Strikethrough = p.Reverse.Val, p.Strikethrough.Val
+	ans.Underline = p.Underline_style.Val != sgr.No_underline
+	ans.Blink = self.blink
+	return
+}
+
+func (self *ScreenBuffer) linefeed() {
+	if self.cursor_y+1 < self.height {
+		self.cursor_y++
+		return
+	}
+	copy(self.cells, self.cells[self.width:])
+	last := self.row(self.height - 1)
+	for i := range last {
+		last[i] = blank_cell
+	}
+	if self.meta != nil {
+		copy(self.meta, self.meta[self.width:])
+		clear(self.meta[len(self.meta)-self.width:])
+	}
+}
+
+func (self *ScreenBuffer) move_cursor_to(x, y int) {
+	self.cursor_x, self.cursor_y = max(0, min(x, self.width-1)), max(0, min(y, self.height-1))
+	self.pending_wrap = false
+}
+
+func (self *ScreenBuffer) draw(ch rune, width int) {
+	if self.pending_wrap || self.cursor_x+width > self.width {
+		self.pending_wrap = false
+		self.cursor_x = 0
+		self.row(self.cursor_y)[self.width-1].next_char_was_wrapped = true
+		self.linefeed()
+	}
+	c := self.pen_cell()
+	c.Rune = ch
+	row := self.row(self.cursor_y)
+	row[self.cursor_x] = c
+	if width > 1 && self.cursor_x+1 < self.width {
+		c.Rune = 0
+		row[self.cursor_x+1] = c
+	}
+	if self.cursor_x+width >= self.width {
+		self.cursor_x = self.width - 1
+		self.pending_wrap = true
+	} else {
+		self.cursor_x += width
+	}
+}
+
+func (self *ScreenBuffer) handle_rune(ch rune) error {
+	switch ch {
+	case '\n', '\v', '\f':
+		self.cursor_x, self.pending_wrap = 0, false
+		self.linefeed()
+	case '\r':
+		self.cursor_x, self.pending_wrap = 0, false
+	case '\b':
+		self.move_cursor_to(self.cursor_x-1, self.cursor_y)
+	case '\t':
+		self.move_cursor_to((self.cursor_x/8+1)*8, self.cursor_y)
+	default:
+		if ch < ' ' || ch == 0x7f {
+			return nil
+		}
+		switch w := wcswidth.RuneCellWidth(ch); w {
+		case 0:
+			// combining character, attach to the previous cell
+			x, y := self.cursor_x-1, self.cursor_y
+			if self.pending_wrap {
+				x = self.cursor_x
+			}
+			if x >= 0 {
+				row := self.row(y)
+				if row[x].Rune == 0 && x > 0 {
+					x--
+				}
+				row[x].combining += string(ch)
+			}
+		default:
+			self.draw(ch, w)
+		}
+	}
+	return nil
+}
+
+func (self *ScreenBuffer) erase(y, start, end int) {
+	row := self.row(y)
+	c := blank_cell
+	c.Bg = self.pen_cell().Bg
+	for x := max(0, start); x < min(end, self.width); x++ {
+		row[x] = c
+	}
+}
+
+func (self *ScreenBuffer) handle_sgr(params string) {
+	parts := strings.Split(params, ";")
+	for i := 0; i < len(parts); i++ {
+		p := parts[i]
+		switch p {
+		case "", "0":
+			self.pen, self.blink = sgr.SGR{}, false
+			continue
+		case "5", "6":
+			self.blink = true
+			continue
+		case "25":
+			self.blink = false
+			continue
+		case "38", "48", "58":
+			// the legacy form of extended colors uses semi-colons as separators
+			n := 0
+			if i+1 < len(parts) {
+				switch parts[i+1] {
+				case "5":
+					n = 2
+				case "2":
+					n = 4
+				}
+			}
+			if n == 0 || i+n >= len(parts) {
+				return
+			}
+			p = strings.Join(parts[i:i+n+1], ":")
+			i += n
+		}
+		self.pen.ApplySGR(sgr.SGRFromCSI(p + "m"))
+	}
+}
+
+func (self *ScreenBuffer) handle_csi(raw []byte) error {
+	csi := string(raw)
+	if csi == "" {
+		return nil
+	}
+	final := csi[len(csi)-1]
+	params := csi[:len(csi)-1]
+	if params != "" && (params[0] < '0' || params[0] > ';') {
+		return nil // private mode and other unsupported escape codes
+	}
+	if final == 'm' {
+		self.handle_sgr(params)
+		return nil
+	}
+	nums := []int{}
+	if params != "" {
+		for _, p := range strings.Split(params, ";") {
+			n, _ := strconv.Atoi(p)
+			nums = append(nums, n)
+		}
+	}
+	num := func(i, defval int) int {
+		if i < len(nums) && nums[i] > 0 {
+			return nums[i]
+		}
+		return defval
+	}
+	x, y := self.cursor_x, self.cursor_y
+	switch final {
+	case 'A':
+		self.move_cursor_to(x, y-num(0, 1))
+	case 'B', 'e':
+		self.move_cursor_to(x, y+num(0, 1))
+	case 'C', 'a':
+		self.move_cursor_to(x+num(0, 1), y)
+	case 'D':
+		self.move_cursor_to(x-num(0, 1), y)
+	case 'E':
+		self.move_cursor_to(0, y+num(0, 1))
+	case 'F':
+		self.move_cursor_to(0, y-num(0, 1))
+	case 'G', '`':
+		self.move_cursor_to(num(0, 1)-1, y)
+	case 'd':
+		self.move_cursor_to(x, num(0, 1)-1)
+	case 'H', 'f':
+		self.move_cursor_to(num(1, 1)-1, num(0, 1)-1)
+	case 'b':
+		// repeat the previous character
+		px := x - 1
+		if self.pending_wrap {
+			px = x
+		}
+		if px >= 0 {
+			if prev := self.row(y)[px]; prev.Rune != 0 {
+				for i := num(0, 1); i > 0; i-- {
+					self.draw(prev.Rune, wcswidth.RuneCellWidth(prev.Rune))
+				}
+			}
+		}
+	case 'K':
+		switch num(0, 0) {
+		case 0:
+			self.erase(y, x, self.width)
+		case 1:
+			self.erase(y, 0, x+1)
+		case 2:
+			self.erase(y, 0, self.width)
+		}
+	case 'J':
+		switch num(0, 0) {
+		case 0:
+			self.erase(y, x, self.width)
+			for r := y + 1; r < self.height; r++ {
+				self.erase(r, 0, self.width)
+			}
+		case 1:
+			for r := 0; r < y; r++ {
+				self.erase(r, 0, self.width)
+			}
+			self.erase(y, 0, x+1)
+		case 2, 3:
+			for r := 0; r < self.height; r++ {
+				self.erase(r, 0, self.width)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+func TestScreenBuffer(t *testing.T) {
+	text := func(buf *ScreenBuffer) []string {
+		ans := []string{}
+		for y := 0; y < buf.Height(); y++ {
+			line := strings.Builder{}
+			for _, c := range buf.trimmed_row(y) {
+				line.WriteString(c.Text())
+			}
+			ans = append(ans, line.String())
+		}
+		return ans
+	}
+	test := func(input string, expected ...string) {
+		t.Helper()
+		buf := NewScreenBuffer(5, 3)
+		buf.WriteString(input)
+		if diff := cmp.Diff(expected, text(buf)); diff != "" {
+			t.Fatalf("Unexpected screen contents for input: %s\n%s", utils.EscapeToHuman(input), diff)
+		}
+	}
+	test("abc\ndef", "abc", "def", "")
+	test("abcdefg", "abcde", "fg", "")
+	test("1\n2\n3\n4", "2", "3", "4")
+	test("abc\rX", "Xbc", "", "")
+	test("\x1b[2;3HX\x1b[HY", "Y", "  X", "")
+	test("abcde\x1b[3G\x1b[K", "ab", "", "")
+	test("abcde\x1b[3G\x1b[1K", "   de", "", "")
+	test("ab\x1b[2J", "", "", "")
+	test("a\x1b[3b", "aaaa", "", "")
+	test("a\tb", "a   b", "", "")
+	test("ab\bX", "aX", "", "")
+	test("abcd世", "abcd", "世", "")
+	test("éx", "éx", "", "")
+	test("a\x1b[?25lb", "ab", "", "")
+	// ambiguous width and private use characters are one cell wide
+	test("°°°", "°°°", "", "")
+	test("ab±§¡", "ab±§¡", "", "")
+	test("\ue0b0\ue0b0\x1b[2b", "\ue0b0\ue0b0\ue0b0\ue0b0", "", "")
+
+	buf := NewScreenBuffer(10, 2)
+	buf.WriteString("\x1b[1;31mab\x1b[0;38;5;200;4mc\x1b[42m \x1b[mx  ")
+	row := buf.row(0)
+	if !row[0].Bold || !row[0].Fg.Is_set || !row[0].Fg.Is_numbered || row[0].Fg.Red != 1 {
+		t.Fatalf("Incorrect formatting for first cell: %#v", row[0])
+	}
+	if row[2].Bold || !row[2].Underline || row[2].Fg.Red != 200 {
+		t.Fatalf("Incorrect formatting for third cell: %#v", row[2])
+	}
+	if row[3].Bg.Red != 2 || row[4].same_attributes(row[3]) {
+		t.Fatalf("Incorrect formatting for fourth cell: %#v", row[3])
+	}
+	if x, y := buf.Cursor(); x != 7 || y != 0 {
+		t.Fatalf("Incorrect cursor position: %d, %d", x, y)
+	}
+
+	if c, err := buf.CellAt(2, 0); err != nil || c != row[2] {
+		t.Fatalf("Incorrect cell returned: %#v (error: %v)", c, err)
+	}
+	for _, pos := range [][2]int{{-1, 0}, {10, 0}, {0, 2}} {
+		if _, err := buf.CellAt(pos[0], pos[1]); err == nil {
+			t.Fatalf("No error for cell outside the screen: %v", pos)
+		}
+	}
+	if diff := cmp.Diff([]string{"abc", "bc x", "ab", "", ""}, []string{
+		buf.TextAt(0, 0, 3), buf.TextAt(1, 0, 4), buf.TextAt(-3, 0, 5), buf.TextAt(0, 0, 0), buf.TextAt(0, 5, 3)}); diff != "" {
+		t.Fatalf("Incorrect text for row segments:\n%s", diff)
+	}
+
+	ansi := ExportToANSI(buf)
+	expected := "\x1b[0;1;31mab\x1b[0;4;38:5:200mc\x1b[0;4;38:5:200;42m \x1b[0mx\n"
+	if diff := cmp.Diff(utils.EscapeToHuman(expected), utils.EscapeToHuman(ansi)); diff != "" {
+		t.Fatalf("Incorrect ANSI export:\n%s", diff)
+	}
+	round_trip := NewScreenBuffer(10, 2)
+	round_trip.WriteString(ansi)
+	if diff := cmp.Diff(buf.cells, round_trip.cells, cmp.AllowUnexported(Cell{})); diff != "" {
+		t.Fatalf("ANSI export does not round trip:\n%s", diff)
+	}
+
+	buf = NewScreenBuffer(10, 2)
+	buf.WriteString("<a>\x1b[1;38:2:1:2:3mb\x1b[m\n\x1b[7mr\x1b[3;9mi")
+	expected = `<pre style="color:#dddddd;background-color:#000000">&lt;a&gt;` +
+		`<span style="color:#010203;font-weight:bold">b</span>` + "\n" +
+		`<span style="color:#000000;background-color:#dddddd">r</span>` +
+		`<span style="color:#000000;background-color:#dddddd;font-style:italic;text-decoration:line-through">i</span></pre>`
+	if diff := cmp.Diff(expected, ExportToHTML(buf)); diff != "" {
+		t.Fatalf("Incorrect HTML export:\n%s", diff)
+	}
+}
+
+func TestScreenBufferLogicalLines(t *testing.T) {
+	test := func(input string, expected ...string) {
+		t.Helper()
+		buf := NewScreenBuffer(4, 4)
+		buf.WriteString(input)
+		actual := []string{}
+		for _, ll := range buf.LogicalLines() {
+			actual = append(actual, fmt.Sprintf("%d-%d:%s", ll.StartRow, ll.EndRow, ll.Text(buf)))
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("Unexpected logical lines for input: %s\n%s", utils.EscapeToHuman(input), diff)
+		}
+	}
+	test("abcdefghij\nxy", "0-2:abcdefghij", "3-3:xy")
+	// a line that exactly fills a row is not wrapped
+	test("abcd\nef", "0-0:abcd", "1-1:ef", "2-2:", "3-3:")
+	// wide characters that do not fit wrap early, leaving a blank cell
+	test("abc世界", "0-1:abc 世界", "2-2:", "3-3:")
+	// overwriting the last cell of a row removes the wrap
+	test("abcdef\x1b[1;4HX", "0-0:abcX", "1-1:ef", "2-2:", "3-3:")
+	// the wrap flag scrolls with the text
+	test("1\n2\n3\nabcdefg", "0-0:2", "1-1:3", "2-3:abcdefg")
+}
+
+func TestScreenBufferCellMeta(t *testing.T) {
+	buf := NewScreenBuffer(4, 2)
+	if buf.CellMeta(0, 0) != nil || buf.meta != nil {
+		t.Fatalf("Metadata present before being set")
+	}
+	buf.SetCellMeta(1, 1, "url")
+	buf.SetCellMeta(4, 0, "outside")
+	buf.WriteString("\x1b[2;1Habcd")
+	if buf.CellMeta(1, 1) != "url" || buf.CellMeta(4, 0) != nil || buf.CellMeta(1, 0) != nil {
+		t.Fatalf("Incorrect metadata: %v", buf.meta)
+	}
+	if c, _ := buf.CellAt(1, 1); c.Rune != 'b' {
+		t.Fatalf("Metadata affected the displayed text: %#v", c)
+	}
+	buf.WriteString("\n")
+	if buf.CellMeta(1, 0) != "url" || buf.CellMeta(1, 1) != nil {
+		t.Fatalf("Metadata did not scroll with the text: %v", buf.meta)
+	}
+	buf.Clear()
+	if buf.CellMeta(1, 0) != nil {
+		t.Fatalf("Metadata not removed by Clear()")
+	}
+}
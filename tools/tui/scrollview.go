@@ -0,0 +1,231 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/utils/style"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const scroll_view_wheel_amount = 3
+
+type scroll_position struct {
+	line, row int // row is the index of the screen line within a wrapped line
+}
+
+func (self scroll_position) less(other scroll_position) bool {
+	return self.line < other.line || (self.line == other.line && self.row < other.row)
+}
+
+// A scrollable view of a sequence of lines. Only the lines that are visible
+// are wrapped and rendered, so it can hold very large numbers of lines.
+type ScrollView struct {
+	loop.ComponentBase
+
+	// Wrap lines wider than the view, otherwise they are truncated
+	WrapLines bool
+
+	lines      []string
+	top        scroll_position
+	wrapped    [][]string
+	wrap_width int
+	on_scroll  func(top_line int)
+}
+
+func NewScrollView() *ScrollView { return &ScrollView{} }
+
+// Append a line, text containing newlines is appended as multiple lines
+func (self *ScrollView) AppendLine(text string) {
+	self.lines = append(self.lines, strings.Split(text, "\n")...)
+}
+
+func (self *ScrollView) NumberOfLines() int { return len(self.lines) }
+
+// The index of the line at the top of the view
+func (self *ScrollView) TopLine() int { return self.top.line }
+
+// Called whenever the view is scrolled with the index of the line at the top of the view
+func (self *ScrollView) OnScroll(f func(top_line int)) { self.on_scroll = f }
+
+// The screen lines a line occupies when rendered
+func (self *ScrollView) screen_lines(idx int) []string {
+	width := self.Region().Width
+	if !self.WrapLines || width <= 0 {
+		return []string{self.lines[idx]}
+	}
+	if width != self.wrap_width {
+		self.wrap_width = width
+		self.wrapped = self.wrapped[:0]
+	}
+	if len(self.wrapped) < len(self.lines) {
+		self.wrapped = append(self.wrapped, make([][]string, len(self.lines)-len(self.wrapped))...)
+	}
+	if self.wrapped[idx] == nil {
+		self.wrapped[idx] = style.WrapTextAsLines(self.lines[idx], width, style.WrapOptions{})
+		if len(self.wrapped[idx]) == 0 {
+			self.wrapped[idx] = []string{""}
+		}
+	}
+	return self.wrapped[idx]
+}
+
+func (self *ScrollView) next_position(pos scroll_position) (scroll_position, bool) {
+	if pos.row+1 < len(self.screen_lines(pos.line)) {
+		return scroll_position{pos.line, pos.row + 1}, true
+	}
+	if pos.line+1 < len(self.lines) {
+		return scroll_position{pos.line + 1, 0}, true
+	}
+	return pos, false
+}
+
+func (self *ScrollView) prev_position(pos scroll_position) (scroll_position, bool) {
+	if pos.row > 0 {
+		return scroll_position{pos.line, pos.row - 1}, true
+	}
+	if pos.line > 0 {
+		return scroll_position{pos.line - 1, len(self.screen_lines(pos.line-1)) - 1}, true
+	}
+	return pos, false
+}
+
+// The position that shows the last screen line at the bottom of the view
+func (self *ScrollView) max_position() (ans scroll_position) {
+	if len(self.lines) == 0 {
+		return
+	}
+	ans = scroll_position{len(self.lines) - 1, len(self.screen_lines(len(self.lines)-1)) - 1}
+	for i := 1; i < self.Region().Height; i++ {
+		p, ok := self.prev_position(ans)
+		if !ok {
+			break
+		}
+		ans = p
+	}
+	return
+}
+
+func (self *ScrollView) set_top(pos scroll_position) {
+	if len(self.lines) == 0 {
+		pos = scroll_position{}
+	} else {
+		pos.line = max(0, min(pos.line, len(self.lines)-1))
+		pos.row = max(0, min(pos.row, len(self.screen_lines(pos.line))-1))
+		if m := self.max_position(); m.less(pos) {
+			pos = m
+		}
+	}
+	if pos != self.top {
+		self.top = pos
+		if self.on_scroll != nil {
+			self.on_scroll(pos.line)
+		}
+	}
+}
+
+// Scroll so that the specified line is at the top of the view, as far as possible
+func (self *ScrollView) ScrollTo(line int) {
+	self.set_top(scroll_position{line: line})
+}
+
+// Scroll by the specified number of screen lines, negative numbers scroll up
+func (self *ScrollView) ScrollBy(delta int) {
+	pos, ok := self.top, true
+	for ; delta > 0 && ok; delta-- {
+		pos, ok = self.next_position(pos)
+	}
+	for ; delta < 0 && ok; delta++ {
+		pos, ok = self.prev_position(pos)
+	}
+	self.set_top(pos)
+}
+
+func (self *ScrollView) ScrollToBottom() {
+	self.set_top(self.max_position())
+}
+
+func (self *ScrollView) IsAtBottom() bool {
+	return !self.top.less(self.max_position())
+}
+
+func (self *ScrollView) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	page := max(1, self.Region().Height-1)
+	switch {
+	case ev.MatchesPressOrRepeat("up"):
+		self.ScrollBy(-1)
+	case ev.MatchesPressOrRepeat("down"):
+		self.ScrollBy(1)
+	case ev.MatchesPressOrRepeat("page_up"):
+		self.ScrollBy(-page)
+	case ev.MatchesPressOrRepeat("page_down"):
+		self.ScrollBy(page)
+	case ev.MatchesPressOrRepeat("home"):
+		self.ScrollTo(0)
+	case ev.MatchesPressOrRepeat("end"):
+		self.ScrollToBottom()
+	default:
+		return nil
+	}
+	ev.Handled = true
+	return nil
+}
+
+func (self *ScrollView) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	if ev.Event_type != loop.MOUSE_PRESS {
+		return false, nil
+	}
+	switch {
+	case ev.Buttons&loop.MOUSE_WHEEL_UP != 0:
+		self.ScrollBy(-scroll_view_wheel_amount)
+	case ev.Buttons&loop.MOUSE_WHEEL_DOWN != 0:
+		self.ScrollBy(scroll_view_wheel_amount)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// The screen lines currently visible in the view
+func (self *ScrollView) visible_lines() (ans []string) {
+	r := self.Region()
+	if r.IsEmpty() || len(self.lines) == 0 {
+		return
+	}
+	self.set_top(self.top) // ensure top is valid after a change in the size of the view
+	pos, ok := self.top, true
+	for len(ans) < r.Height && ok {
+		ans = append(ans, self.screen_lines(pos.line)[pos.row])
+		pos, ok = self.next_position(pos)
+	}
+	return
+}
+
+func (self *ScrollView) Render(lp *loop.Loop) error {
+	r := self.Region()
+	if r.IsEmpty() {
+		return nil
+	}
+	visible := self.visible_lines()
+	buf := strings.Builder{}
+	for y := 0; y < r.Height; y++ {
+		buf.WriteString(fmt.Sprintf(loop.MoveCursorToTemplate, r.Y+y+1, r.X+1))
+		w := 0
+		if y < len(visible) {
+			line, width := wcswidth.TruncateToVisualLengthWithWidth(visible[y], r.Width)
+			buf.WriteString(line)
+			buf.WriteString("\x1b[m")
+			w = width
+		}
+		if w < r.Width {
+			buf.WriteString(strings.Repeat(" ", r.Width-w))
+		}
+	}
+	lp.QueueWriteString(buf.String())
+	return nil
+}
@@ -0,0 +1,65 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestScrollView(t *testing.T) {
+	sv := NewScrollView()
+	sv.SetRegion(loop.Rect{Width: 4, Height: 3})
+	for i := 0; i < 10; i++ {
+		sv.AppendLine(strconv.Itoa(i))
+	}
+	scrolled_to := -1
+	sv.OnScroll(func(top int) { scrolled_to = top })
+	test := func(expected ...string) {
+		t.Helper()
+		if diff := cmp.Diff(expected, sv.visible_lines()); diff != "" {
+			t.Fatalf("Unexpected visible lines:\n%s", diff)
+		}
+	}
+	test("0", "1", "2")
+	sv.ScrollBy(2)
+	test("2", "3", "4")
+	if scrolled_to != 2 {
+		t.Fatalf("OnScroll not called: %d", scrolled_to)
+	}
+	sv.ScrollBy(100)
+	test("7", "8", "9")
+	if !sv.IsAtBottom() {
+		t.Fatalf("Not at bottom after scrolling past the end")
+	}
+	sv.ScrollTo(-3)
+	test("0", "1", "2")
+	sv.HandleKeyEvent(nil, &loop.KeyEvent{Type: loop.PRESS, Key: "PAGE_DOWN"})
+	test("2", "3", "4")
+	sv.HandleMouseEvent(nil, &loop.MouseEvent{Event_type: loop.MOUSE_PRESS, Buttons: loop.MOUSE_WHEEL_UP})
+	test("0", "1", "2")
+
+	sv = NewScrollView()
+	sv.SetRegion(loop.Rect{Width: 4, Height: 3})
+	sv.WrapLines = true
+	sv.AppendLine("abcdefghij\nkl")
+	test("abcd", "efgh", "ij")
+	sv.ScrollBy(1)
+	test("efgh", "ij", "kl")
+	sv.ScrollBy(1)
+	test("efgh", "ij", "kl")
+	if sv.TopLine() != 0 {
+		t.Fatalf("Unexpected top line: %d", sv.TopLine())
+	}
+	sv.ScrollTo(1)
+	test("efgh", "ij", "kl")
+	sv.WrapLines = false
+	test("abcdefghij", "kl")
+}
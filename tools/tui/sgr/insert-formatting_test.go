@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/utils"
 )
 
 var _ = fmt.Print
@@ -14,8 +16,8 @@ var _ = fmt.Print
 func TestInsertFormatting(t *testing.T) {
 	test := func(src, expected string, spans ...*Span) {
 		actual := InsertFormatting(src, spans...)
-		if diff := cmp.Diff(expected, actual); diff != "" {
-			t.Fatalf("Failed with %#v:\n%#v != %#v\n%s", src, expected, actual, diff)
+		if diff := cmp.Diff(utils.EscapeToHuman(expected), utils.EscapeToHuman(actual)); diff != "" {
+			t.Fatalf("Failed with %s:\n%s", utils.EscapeToHuman(src), diff)
 		}
 	}
 	test(
@@ -0,0 +1,360 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const table_column_separator = "  "
+
+type Column struct {
+	Title string
+	// Width in cells, when <= 0 the column is as wide as its widest cell
+	Width int
+	// Clicking the header of a sortable column sorts the table by it
+	Sortable bool
+}
+
+// A table with a header, row selection, sorting and horizontal scrolling.
+// Only rows that have changed since the last render are redrawn, call
+// Invalidate() if the screen is cleared.
+type Table struct {
+	loop.ComponentBase
+
+	columns      []Column
+	widths       []int
+	rows         [][]string
+	order        []int // indices into rows in display order
+	selected     int   // index into order, -1 for no selection
+	top          int   // index into order of the first visible row
+	x_offset     int
+	sort_column  int
+	ascending    bool
+	on_select    func(row_index int, row []string)
+	rendered     []string
+	rendered_for loop.Rect
+}
+
+func NewTable() *Table {
+	return &Table{selected: -1, sort_column: -1}
+}
+
+func (self *Table) SetColumns(cols []Column) {
+	self.columns = slices.Clone(cols)
+	if self.sort_column >= len(self.columns) {
+		self.sort_column = -1
+	}
+	self.layout()
+}
+
+// Set the rows of the table, re-applying the current sort, if any
+func (self *Table) SetRows(rows [][]string) {
+	self.rows = rows
+	self.order = make([]int, len(rows))
+	for i := range self.order {
+		self.order[i] = i
+	}
+	self.selected = -1
+	if len(rows) > 0 {
+		self.selected = 0
+	}
+	self.top = 0
+	self.sort()
+	self.layout()
+}
+
+// Called when the user presses Enter on a row, with the index of the row as
+// passed to SetRows()
+func (self *Table) OnSelect(f func(row_index int, row []string)) { self.on_select = f }
+
+// The column the table is sorted by or -1 if it is not sorted
+func (self *Table) SortedBy() (col_index int, ascending bool) {
+	return self.sort_column, self.ascending
+}
+
+func (self *Table) SortBy(col_index int, ascending bool) {
+	if col_index >= len(self.columns) {
+		col_index = -1
+	}
+	self.sort_column, self.ascending = col_index, ascending
+	self.sort()
+}
+
+// The index of the currently selected row as passed to SetRows() or -1
+func (self *Table) Selected() int {
+	if self.selected < 0 || self.selected >= len(self.order) {
+		return -1
+	}
+	return self.order[self.selected]
+}
+
+// Force a full redraw on the next render
+func (self *Table) Invalidate() { self.rendered = nil }
+
+func (self *Table) cell(row, col int) string {
+	if r := self.rows[row]; col < len(r) {
+		return r[col]
+	}
+	return ""
+}
+
+func compare_cells(a, b string) int {
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			return cmp.Compare(fa, fb)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func (self *Table) sort() {
+	selected := self.Selected()
+	if self.sort_column < 0 {
+		slices.Sort(self.order)
+	} else {
+		col := self.sort_column
+		slices.SortStableFunc(self.order, func(a, b int) int {
+			if ans := compare_cells(self.cell(a, col), self.cell(b, col)); ans != 0 {
+				if !self.ascending {
+					ans = -ans
+				}
+				return ans
+			}
+			return cmp.Compare(a, b)
+		})
+	}
+	if selected > -1 {
+		self.selected = slices.Index(self.order, selected)
+	}
+	self.ensure_selection_visible()
+}
+
+func (self *Table) layout() {
+	self.widths = make([]int, len(self.columns))
+	for i, c := range self.columns {
+		if c.Width > 0 {
+			self.widths[i] = c.Width
+			continue
+		}
+		// leave space for the sort indicator
+		w := wcswidth.Stringwidth(c.Title)
+		if c.Sortable {
+			w += 2
+		}
+		for r := range self.rows {
+			w = max(w, wcswidth.Stringwidth(self.cell(r, i)))
+		}
+		self.widths[i] = w
+	}
+}
+
+func (self *Table) total_width() (ans int) {
+	for _, w := range self.widths {
+		ans += w
+	}
+	return ans + max(0, len(self.widths)-1)*len(table_column_separator)
+}
+
+func (self *Table) page_size() int { return max(1, self.Region().Height-1) }
+
+func (self *Table) ensure_selection_visible() {
+	if self.selected < 0 {
+		self.top = 0
+		return
+	}
+	page := self.page_size()
+	if self.selected < self.top {
+		self.top = self.selected
+	} else if self.selected >= self.top+page {
+		self.top = self.selected - page + 1
+	}
+	self.top = max(0, min(self.top, len(self.order)-page))
+}
+
+func (self *Table) select_row(idx int) {
+	if len(self.order) > 0 {
+		self.selected = max(0, min(idx, len(self.order)-1))
+		self.ensure_selection_visible()
+	}
+}
+
+func (self *Table) scroll_horizontally(delta int) {
+	self.x_offset = max(0, min(self.x_offset+delta, self.total_width()-self.Region().Width))
+}
+
+func (self *Table) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	switch {
+	case ev.MatchesPressOrRepeat("up"):
+		self.select_row(self.selected - 1)
+	case ev.MatchesPressOrRepeat("down"):
+		self.select_row(self.selected + 1)
+	case ev.MatchesPressOrRepeat("page_up"):
+		self.select_row(self.selected - self.page_size())
+	case ev.MatchesPressOrRepeat("page_down"):
+		self.select_row(self.selected + self.page_size())
+	case ev.MatchesPressOrRepeat("home"):
+		self.select_row(0)
+	case ev.MatchesPressOrRepeat("end"):
+		self.select_row(len(self.order) - 1)
+	case ev.MatchesPressOrRepeat("left"):
+		self.scroll_horizontally(-1)
+	case ev.MatchesPressOrRepeat("right"):
+		self.scroll_horizontally(1)
+	case ev.MatchesPressOrRepeat("enter"):
+		if idx := self.Selected(); idx > -1 && self.on_select != nil {
+			self.on_select(idx, self.rows[idx])
+		}
+	default:
+		return nil
+	}
+	ev.Handled = true
+	return nil
+}
+
+// The column at the specified x position relative to the left edge of the table or -1
+func (self *Table) column_at(x int) int {
+	x += self.x_offset
+	for i, w := range self.widths {
+		if x < w {
+			return i
+		}
+		x -= w + len(table_column_separator)
+		if x < 0 {
+			return -1
+		}
+	}
+	return -1
+}
+
+func (self *Table) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	r := self.Region()
+	switch {
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_UP != 0:
+		self.select_row(self.selected - 1)
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_DOWN != 0:
+		self.select_row(self.selected + 1)
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_LEFT != 0:
+		self.scroll_horizontally(-1)
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_RIGHT != 0:
+		self.scroll_horizontally(1)
+	case ev.Event_type == loop.MOUSE_CLICK && ev.Buttons&loop.LEFT_MOUSE_BUTTON != 0:
+		local := ev.TranslateToCellOrigin(r.X, r.Y)
+		if local.Cell.Y == 0 {
+			col := self.column_at(local.Cell.X)
+			if col < 0 || !self.columns[col].Sortable {
+				return false, nil
+			}
+			self.SortBy(col, col != self.sort_column || !self.ascending)
+		} else {
+			self.select_row(self.top + local.Cell.Y - 1)
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// Return the cells from start to start + width of a line of plain text
+func slice_cells(line string, start, width int) string {
+	buf := strings.Builder{}
+	x := 0
+	for _, ch := range line {
+		w := wcswidth.RuneCellWidth(ch)
+		if x >= start && x+w <= start+width {
+			buf.WriteRune(ch)
+		} else if x+w > start && x < start+width {
+			buf.WriteString(strings.Repeat(" ", min(x+w, start+width)-max(x, start)))
+		}
+		x += w
+	}
+	return buf.String()
+}
+
+func (self *Table) format_row(cells func(col int) string) string {
+	buf := strings.Builder{}
+	for i, w := range self.widths {
+		if i > 0 {
+			buf.WriteString(table_column_separator)
+		}
+		text, tw := wcswidth.TruncateToVisualLengthWithWidth(cells(i), w)
+		buf.WriteString(text)
+		buf.WriteString(strings.Repeat(" ", w-tw))
+	}
+	return buf.String()
+}
+
+// The lines of text as they appear on screen, header first
+func (self *Table) screen_lines(lp *loop.Loop) []string {
+	r := self.Region()
+	ans := make([]string, 0, r.Height)
+	line := func(text, style string) string {
+		text = slice_cells(text, self.x_offset, r.Width)
+		if w := wcswidth.Stringwidth(text); w < r.Width {
+			text += strings.Repeat(" ", r.Width-w)
+		}
+		if style != "" {
+			text = lp.SprintStyled(style, text)
+		}
+		return text
+	}
+	header := self.format_row(func(col int) string {
+		c := self.columns[col]
+		if col == self.sort_column {
+			if self.ascending {
+				return c.Title + " ▲"
+			}
+			return c.Title + " ▼"
+		}
+		return c.Title
+	})
+	ans = append(ans, line(header, "bold"))
+	for i := self.top; i < len(self.order) && len(ans) < r.Height; i++ {
+		row := self.order[i]
+		style := ""
+		if i == self.selected {
+			style = "reverse"
+		}
+		ans = append(ans, line(self.format_row(func(col int) string { return self.cell(row, col) }), style))
+	}
+	for len(ans) < r.Height {
+		ans = append(ans, line("", ""))
+	}
+	return ans
+}
+
+func (self *Table) Render(lp *loop.Loop) error {
+	r := self.Region()
+	if r.IsEmpty() {
+		return nil
+	}
+	if r != self.rendered_for {
+		self.rendered_for = r
+		self.rendered = nil
+		self.scroll_horizontally(0)
+		self.ensure_selection_visible()
+	}
+	lines := self.screen_lines(lp)
+	buf := strings.Builder{}
+	for y, line := range lines {
+		if y < len(self.rendered) && self.rendered[y] == line {
+			continue
+		}
+		buf.WriteString(fmt.Sprintf(loop.MoveCursorToTemplate, r.Y+y+1, r.X+1))
+		buf.WriteString(line)
+	}
+	self.rendered = lines
+	if buf.Len() > 0 {
+		lp.QueueWriteString(buf.String())
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+func TestTable(t *testing.T) {
+	lp, _ := loop.New()
+	tb := NewTable()
+	tb.SetRegion(loop.Rect{Width: 12, Height: 3})
+	tb.SetColumns([]Column{{Title: "Name", Sortable: true}, {Title: "Size", Width: 4, Sortable: true}})
+	tb.SetRows([][]string{{"b", "10"}, {"a", "9"}, {"c", "100"}})
+	visible := func() (ans []string) {
+		for _, line := range tb.screen_lines(lp) {
+			ans = append(ans, wcswidth.StripEscapeCodes(line))
+		}
+		return
+	}
+	test := func(expected ...string) {
+		t.Helper()
+		if diff := cmp.Diff(expected, visible()); diff != "" {
+			t.Fatalf("Unexpected table contents:\n%s", diff)
+		}
+	}
+	press := func(key string) { tb.HandleKeyEvent(lp, &loop.KeyEvent{Type: loop.PRESS, Key: key}) }
+	click := func(x, y int) {
+		tb.HandleMouseEvent(lp, &loop.MouseEvent{Event_type: loop.MOUSE_CLICK, Buttons: loop.LEFT_MOUSE_BUTTON, Cell: struct{ X, Y int }{x, y}})
+	}
+	test("Name    Size", "b       10  ", "a       9   ")
+	click(8, 0)
+	if col, asc := tb.SortedBy(); col != 1 || !asc {
+		t.Fatalf("Unexpected sort: %d %v", col, asc)
+	}
+	test("Name    Size", "a       9   ", "b       10  ")
+	if tb.Selected() != 0 {
+		t.Fatalf("Selection did not follow the row when sorting: %d", tb.Selected())
+	}
+	click(8, 0)
+	test("Name    Size", "c       100 ", "b       10  ")
+	press("DOWN")
+	test("Name    Size", "b       10  ", "a       9   ")
+	selected := -1
+	tb.OnSelect(func(idx int, row []string) { selected = idx })
+	press("HOME")
+	press("ENTER")
+	if selected != 2 {
+		t.Fatalf("Unexpected selection: %d", selected)
+	}
+	tb.SetRegion(loop.Rect{Width: 6, Height: 2})
+	press("RIGHT")
+	press("RIGHT")
+	test("me    ", "      ")
+	for i := 0; i < 10; i++ {
+		press("RIGHT")
+	}
+	test("  Size", "  100 ")
+	if s := slice_cells("°±\ue0b0ab", 1, 3); s != "±\ue0b0a" {
+		t.Fatalf("Ambiguous width and private use characters not one cell wide: %#v", s)
+	}
+}
@@ -0,0 +1,342 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+const default_max_text_input_history = 100
+
+// A single line text input widget with a cursor, selection and history
+type TextInput struct {
+	loop.ComponentBase
+
+	// Text displayed before the input
+	Prompt string
+	// The maximum number of history entries, when zero a default of 100 is used
+	MaxHistory int
+
+	text                []rune
+	cursor              int
+	selection_anchor    int
+	scroll_offset       int
+	history             []string
+	history_pos         int
+	text_before_history string
+	on_change           func(string)
+	on_submit           func(string) error
+	key_map             map[string]func(*TextInput, *loop.Loop) error
+	prompt_width        int
+}
+
+func NewTextInput() *TextInput {
+	return &TextInput{selection_anchor: -1}
+}
+
+func (self *TextInput) Value() string { return string(self.text) }
+
+// Set the current value, moving the cursor to the end and clearing any selection
+func (self *TextInput) SetValue(s string) {
+	self.cursor = len(self.text)
+	self.selection_anchor = -1
+	self.replace_text([]rune(s))
+	self.cursor = len(self.text)
+}
+
+// Called whenever the value changes
+func (self *TextInput) OnChange(f func(string)) { self.on_change = f }
+
+// Called when the user presses Enter, the value is added to the history
+// before f is called
+func (self *TextInput) OnSubmit(f func(string) error) { self.on_submit = f }
+
+// The position of the cursor, in runes from the start of the value
+func (self *TextInput) Cursor() int { return self.cursor }
+
+// The range of selected runes or ok == false if there is no selection
+func (self *TextInput) Selection() (start, end int, ok bool) {
+	if self.selection_anchor < 0 || self.selection_anchor == self.cursor {
+		return 0, 0, false
+	}
+	return min(self.selection_anchor, self.cursor), max(self.selection_anchor, self.cursor), true
+}
+
+func (self *TextInput) SelectedText() string {
+	if start, end, ok := self.Selection(); ok {
+		return string(self.text[start:end])
+	}
+	return ""
+}
+
+func (self *TextInput) History() []string { return self.history }
+
+func (self *TextInput) SetHistory(items []string) {
+	self.history = items
+	self.history_pos = len(self.history)
+}
+
+func (self *TextInput) AddToHistory(s string) {
+	if s != "" && (len(self.history) == 0 || self.history[len(self.history)-1] != s) {
+		self.history = append(self.history, s)
+		limit := self.MaxHistory
+		if limit <= 0 {
+			limit = default_max_text_input_history
+		}
+		if len(self.history) > limit {
+			self.history = self.history[len(self.history)-limit:]
+		}
+	}
+	self.history_pos = len(self.history)
+}
+
+func (self *TextInput) replace_text(text []rune) {
+	changed := string(text) != string(self.text)
+	self.text = text
+	self.cursor = max(0, min(self.cursor, len(self.text)))
+	if changed && self.on_change != nil {
+		self.on_change(string(self.text))
+	}
+}
+
+func (self *TextInput) delete_selection() bool {
+	start, end, ok := self.Selection()
+	if !ok {
+		self.selection_anchor = -1
+		return false
+	}
+	text := append(append(make([]rune, 0, len(self.text)), self.text[:start]...), self.text[end:]...)
+	self.cursor = start
+	self.selection_anchor = -1
+	self.replace_text(text)
+	return true
+}
+
+// Insert text at the cursor replacing any selected text
+func (self *TextInput) InsertText(s string) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	self.delete_selection()
+	if s == "" {
+		return
+	}
+	r := []rune(s)
+	text := make([]rune, 0, len(self.text)+len(r))
+	text = append(append(append(text, self.text[:self.cursor]...), r...), self.text[self.cursor:]...)
+	self.cursor += len(r)
+	self.replace_text(text)
+}
+
+func (self *TextInput) move_cursor_to(pos int, extend_selection bool) {
+	if extend_selection {
+		if self.selection_anchor < 0 {
+			self.selection_anchor = self.cursor
+		}
+	} else {
+		self.selection_anchor = -1
+	}
+	self.cursor = max(0, min(pos, len(self.text)))
+}
+
+func is_word_char(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' }
+
+func (self *TextInput) word_start_before(pos int) int {
+	for pos > 0 && !is_word_char(self.text[pos-1]) {
+		pos--
+	}
+	for pos > 0 && is_word_char(self.text[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func (self *TextInput) word_end_after(pos int) int {
+	for pos < len(self.text) && !is_word_char(self.text[pos]) {
+		pos++
+	}
+	for pos < len(self.text) && is_word_char(self.text[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func (self *TextInput) backspace() {
+	if !self.delete_selection() && self.cursor > 0 {
+		self.selection_anchor = self.cursor - 1
+		self.delete_selection()
+	}
+}
+
+func (self *TextInput) delete() {
+	if !self.delete_selection() && self.cursor < len(self.text) {
+		self.selection_anchor = self.cursor + 1
+		self.delete_selection()
+	}
+}
+
+func (self *TextInput) history_move(delta int) {
+	pos := self.history_pos + delta
+	if pos < 0 || pos > len(self.history) || pos == self.history_pos {
+		return
+	}
+	if self.history_pos == len(self.history) {
+		self.text_before_history = string(self.text)
+	}
+	self.history_pos = pos
+	if pos == len(self.history) {
+		self.SetValue(self.text_before_history)
+	} else {
+		self.SetValue(self.history[pos])
+	}
+	self.history_pos = pos
+}
+
+func (self *TextInput) submit() error {
+	val := self.Value()
+	self.AddToHistory(val)
+	if self.on_submit != nil {
+		return self.on_submit(val)
+	}
+	return nil
+}
+
+func movement(extend bool, pos func(*TextInput) int) func(*TextInput, *loop.Loop) error {
+	return func(self *TextInput, lp *loop.Loop) error {
+		self.move_cursor_to(pos(self), extend)
+		return nil
+	}
+}
+
+func text_input_key_map() map[string]func(*TextInput, *loop.Loop) error {
+	ans := make(map[string]func(*TextInput, *loop.Loop) error, 32)
+	motions := map[string]func(self *TextInput) int{
+		"left":       func(self *TextInput) int { return self.cursor - 1 },
+		"right":      func(self *TextInput) int { return self.cursor + 1 },
+		"home":       func(self *TextInput) int { return 0 },
+		"end":        func(self *TextInput) int { return len(self.text) },
+		"ctrl+left":  func(self *TextInput) int { return self.word_start_before(self.cursor) },
+		"alt+left":   func(self *TextInput) int { return self.word_start_before(self.cursor) },
+		"ctrl+right": func(self *TextInput) int { return self.word_end_after(self.cursor) },
+		"alt+right":  func(self *TextInput) int { return self.word_end_after(self.cursor) },
+	}
+	for spec, pos := range motions {
+		ans[spec] = movement(false, pos)
+		ans["shift+"+spec] = movement(true, pos)
+	}
+	ans["ctrl+a"] = func(self *TextInput, lp *loop.Loop) error {
+		self.cursor, self.selection_anchor = len(self.text), 0
+		return nil
+	}
+	ans["backspace"] = func(self *TextInput, lp *loop.Loop) error { self.backspace(); return nil }
+	ans["delete"] = func(self *TextInput, lp *loop.Loop) error { self.delete(); return nil }
+	ans["up"] = func(self *TextInput, lp *loop.Loop) error { self.history_move(-1); return nil }
+	ans["down"] = func(self *TextInput, lp *loop.Loop) error { self.history_move(1); return nil }
+	ans["enter"] = func(self *TextInput, lp *loop.Loop) error { return self.submit() }
+	return ans
+}
+
+func (self *TextInput) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) error {
+	if ev.Type == loop.RELEASE {
+		return nil
+	}
+	if self.key_map == nil {
+		self.key_map = text_input_key_map()
+	}
+	for spec, action := range self.key_map {
+		if ev.MatchesPressOrRepeat(spec) {
+			ev.Handled = true
+			return action(self, lp)
+		}
+	}
+	if ev.MatchesPressOrRepeat("ctrl+c") && lp != nil {
+		if text := self.SelectedText(); text != "" {
+			ev.Handled = true
+			lp.CopyTextToClipboard(text)
+		}
+	}
+	return nil
+}
+
+// Text typed by the user or pasted via bracketed paste is inserted at the cursor
+func (self *TextInput) HandleText(lp *loop.Loop, text string, from_key_event, in_bracketed_paste bool) (bool, error) {
+	self.InsertText(text)
+	return true, nil
+}
+
+func (self *TextInput) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	if ev.Event_type != loop.MOUSE_PRESS || ev.Buttons&loop.LEFT_MOUSE_BUTTON == 0 {
+		return false, nil
+	}
+	x := ev.Cell.X - self.Region().X - self.prompt_width
+	pos := self.scroll_offset
+	for x > 0 && pos < len(self.text) {
+		x -= wcswidth.RuneCellWidth(self.text[pos])
+		pos++
+	}
+	self.move_cursor_to(pos, ev.Mods&loop.SHIFT != 0)
+	return true, nil
+}
+
+func (self *TextInput) Render(lp *loop.Loop) error {
+	r := self.Region()
+	if r.IsEmpty() {
+		return nil
+	}
+	prompt := wcswidth.TruncateToVisualLength(self.Prompt, r.Width-1)
+	self.prompt_width = wcswidth.Stringwidth(prompt)
+	available := r.Width - self.prompt_width - 1 // leave space for the cursor at the end
+	// scroll horizontally so that the cursor is visible
+	self.scroll_offset = min(self.scroll_offset, self.cursor)
+	width_till_cursor := func() (ans int) {
+		for _, ch := range self.text[self.scroll_offset:self.cursor] {
+			ans += wcswidth.RuneCellWidth(ch)
+		}
+		return
+	}
+	for self.scroll_offset < self.cursor && width_till_cursor() > available {
+		self.scroll_offset++
+	}
+	sel_start, sel_end, has_selection := self.Selection()
+	buf := strings.Builder{}
+	buf.WriteString(prompt)
+	w, cursor_x := 0, self.prompt_width
+	for i := self.scroll_offset; i < len(self.text); i++ {
+		cw := wcswidth.RuneCellWidth(self.text[i])
+		if w+cw > available {
+			break
+		}
+		if i == self.cursor {
+			cursor_x = self.prompt_width + w
+		}
+		if has_selection && i >= sel_start && i < sel_end {
+			buf.WriteString(lp.SprintStyled("reverse", string(self.text[i])))
+		} else {
+			buf.WriteRune(self.text[i])
+		}
+		w += cw
+	}
+	if self.cursor == len(self.text) {
+		cursor_x = self.prompt_width + w
+	}
+	if filler := r.Width - self.prompt_width - w; filler > 0 {
+		buf.WriteString(strings.Repeat(" ", filler))
+	}
+	lp.MoveCursorTo(r.X+1, r.Y+1)
+	lp.QueueWriteString(buf.String())
+	lp.MoveCursorTo(r.X+cursor_x+1, r.Y+1)
+	return nil
+}
@@ -0,0 +1,81 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestTextInput(t *testing.T) {
+	key := func(spec string) *loop.KeyEvent {
+		ev := loop.ParseShortcut(spec)
+		return &loop.KeyEvent{Type: loop.PRESS, Key: ev.KeyName, Mods: ev.Mods}
+	}
+	// actions are either shortcuts, text to insert prefixed with : or space
+	run := func(ti *TextInput, actions string) {
+		for _, action := range strings.Fields(actions) {
+			if rest, found := strings.CutPrefix(action, ":"); found {
+				ti.HandleText(nil, rest, true, false)
+			} else if action == "space" {
+				ti.HandleText(nil, " ", true, false)
+			} else {
+				if err := ti.HandleKeyEvent(nil, key(action)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	for _, tc := range []struct {
+		actions, value, selected string
+		cursor                   int
+	}{
+		{":hello", "hello", "", 5},
+		{":hello left left :X", "helXlo", "", 4},
+		{":hello home :X end :Y", "XhelloY", "", 7},
+		{":hello backspace home delete", "ell", "", 0},
+		{":one_two space :three.four ctrl+left", "one_two three.four", "", 14},
+		{":one_two space :three.four ctrl+left ctrl+left", "one_two three.four", "", 8},
+		{":one space :two home ctrl+right", "one two", "", 3},
+		{":hello shift+left shift+left", "hello", "lo", 3},
+		{":hello shift+home", "hello", "hello", 0},
+		{":hello shift+left shift+left :X", "helX", "", 4},
+		{":hello shift+left shift+left backspace", "hel", "", 3},
+		{":hello home shift+right delete", "ello", "", 0},
+		{":hello shift+left left", "hello", "", 3},
+		{":hello ctrl+a :x", "x", "", 1},
+	} {
+		ti := NewTextInput()
+		run(ti, tc.actions)
+		if ti.Value() != tc.value || ti.Cursor() != tc.cursor || ti.SelectedText() != tc.selected {
+			t.Fatalf("Failed for actions: %#v\nvalue: %#v cursor: %d selected: %#v\nexpected value: %#v cursor: %d selected: %#v",
+				tc.actions, ti.Value(), ti.Cursor(), ti.SelectedText(), tc.value, tc.cursor, tc.selected)
+		}
+	}
+
+	ti := NewTextInput()
+	ti.InsertText("a\nb\x01c")
+	if ti.Value() != "a bc" {
+		t.Fatalf("Control characters not handled in inserted text: %#v", ti.Value())
+	}
+	ti = NewTextInput()
+	submitted, changes := []string{}, 0
+	ti.OnSubmit(func(s string) error { submitted = append(submitted, s); ti.SetValue(""); return nil })
+	ti.OnChange(func(string) { changes++ })
+	run(ti, ":one enter :two enter :two enter :three up")
+	if ti.Value() != "two" || strings.Join(submitted, ",") != "one,two,two" || strings.Join(ti.History(), ",") != "one,two" {
+		t.Fatalf("Unexpected state after submit, value: %#v submitted: %#v history: %#v", ti.Value(), submitted, ti.History())
+	}
+	run(ti, "up up down down")
+	if ti.Value() != "three" {
+		t.Fatalf("Current text not restored after browsing history: %#v", ti.Value())
+	}
+	if changes == 0 {
+		t.Fatalf("OnChange was never called")
+	}
+}
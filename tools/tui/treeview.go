@@ -0,0 +1,253 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"kitty/tools/tui/loop"
+	"kitty/tools/wcswidth"
+)
+
+var _ = fmt.Print
+
+type TreeNode struct {
+	Label    string
+	Children []*TreeNode
+	Expanded bool
+	// Arbitrary data associated with the node
+	Data any
+
+	parent          *TreeNode
+	children_loaded bool
+}
+
+func (self *TreeNode) Parent() *TreeNode { return self.parent }
+
+type tree_row struct {
+	node   *TreeNode
+	prefix string
+}
+
+// A view of a tree of nodes that can be expanded and collapsed. Only the
+// expanded parts of the tree are traversed and only the visible rows rendered.
+type TreeView struct {
+	loop.ComponentBase
+
+	// Called to load the children of a node the first time it is expanded, if
+	// the node has no children
+	ChildLoader func(*TreeNode) ([]*TreeNode, error)
+
+	root      *TreeNode
+	rows      []tree_row
+	dirty     bool
+	selected  int
+	top       int
+	on_select func(*TreeNode)
+}
+
+func NewTreeView() *TreeView { return &TreeView{} }
+
+func (self *TreeView) SetRoot(node *TreeNode) {
+	self.root = node
+	self.selected, self.top = 0, 0
+	self.dirty = true
+}
+
+func (self *TreeView) Root() *TreeNode { return self.root }
+
+// Called when the user presses Enter on a node
+func (self *TreeView) OnSelect(f func(*TreeNode)) { self.on_select = f }
+
+// The currently selected node or nil
+func (self *TreeView) Selected() *TreeNode {
+	rows := self.visible_rows()
+	if self.selected < len(rows) {
+		return rows[self.selected].node
+	}
+	return nil
+}
+
+func (self *TreeView) has_children(node *TreeNode) bool {
+	return len(node.Children) > 0 || (self.ChildLoader != nil && !node.children_loaded)
+}
+
+func (self *TreeView) flatten(node *TreeNode, prefix, child_prefix string) {
+	self.rows = append(self.rows, tree_row{node, prefix})
+	if !node.Expanded {
+		return
+	}
+	for i, child := range node.Children {
+		child.parent = node
+		if i == len(node.Children)-1 {
+			self.flatten(child, child_prefix+"└─", child_prefix+"  ")
+		} else {
+			self.flatten(child, child_prefix+"├─", child_prefix+"│ ")
+		}
+	}
+}
+
+func (self *TreeView) visible_rows() []tree_row {
+	if self.dirty {
+		self.dirty = false
+		self.rows = self.rows[:0]
+		if self.root != nil {
+			self.flatten(self.root, "", "")
+		}
+		self.selected = max(0, min(self.selected, len(self.rows)-1))
+	}
+	return self.rows
+}
+
+// Expand the node loading its children if needed
+func (self *TreeView) Expand(node *TreeNode) error {
+	if len(node.Children) == 0 && self.ChildLoader != nil && !node.children_loaded {
+		children, err := self.ChildLoader(node)
+		if err != nil {
+			return fmt.Errorf("Failed to load the children of %s with error: %w", node.Label, err)
+		}
+		node.Children = children
+	}
+	node.children_loaded = true
+	node.Expanded = true
+	self.dirty = true
+	return nil
+}
+
+func (self *TreeView) Collapse(node *TreeNode) {
+	node.Expanded = false
+	self.dirty = true
+}
+
+func (self *TreeView) select_row(idx int) {
+	rows := self.visible_rows()
+	self.selected = max(0, min(idx, len(rows)-1))
+	page := max(1, self.Region().Height)
+	if self.selected < self.top {
+		self.top = self.selected
+	} else if self.selected >= self.top+page {
+		self.top = self.selected - page + 1
+	}
+}
+
+func (self *TreeView) select_node(node *TreeNode) {
+	for i, r := range self.visible_rows() {
+		if r.node == node {
+			self.select_row(i)
+			break
+		}
+	}
+}
+
+func (self *TreeView) toggle(node *TreeNode) error {
+	if node.Expanded {
+		self.Collapse(node)
+		return nil
+	}
+	return self.Expand(node)
+}
+
+func (self *TreeView) HandleKeyEvent(lp *loop.Loop, ev *loop.KeyEvent) (err error) {
+	node := self.Selected()
+	if node == nil {
+		return nil
+	}
+	page := max(1, self.Region().Height-1)
+	switch {
+	case ev.MatchesPressOrRepeat("up"):
+		self.select_row(self.selected - 1)
+	case ev.MatchesPressOrRepeat("down"):
+		self.select_row(self.selected + 1)
+	case ev.MatchesPressOrRepeat("page_up"):
+		self.select_row(self.selected - page)
+	case ev.MatchesPressOrRepeat("page_down"):
+		self.select_row(self.selected + page)
+	case ev.MatchesPressOrRepeat("home"):
+		self.select_row(0)
+	case ev.MatchesPressOrRepeat("end"):
+		self.select_row(len(self.visible_rows()) - 1)
+	case ev.MatchesPressOrRepeat("right"):
+		if !node.Expanded && self.has_children(node) {
+			err = self.Expand(node)
+		} else if len(node.Children) > 0 {
+			self.select_row(self.selected + 1)
+		}
+	case ev.MatchesPressOrRepeat("left"):
+		if node.Expanded && len(node.Children) > 0 {
+			self.Collapse(node)
+		} else if node.parent != nil {
+			self.select_node(node.parent)
+		}
+	case ev.MatchesPressOrRepeat("enter"):
+		if self.on_select != nil {
+			self.on_select(node)
+		}
+	default:
+		return nil
+	}
+	ev.Handled = true
+	return
+}
+
+func (self *TreeView) HandleMouseEvent(lp *loop.Loop, ev *loop.MouseEvent) (bool, error) {
+	r := self.Region()
+	switch {
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_UP != 0:
+		self.select_row(self.selected - 1)
+	case ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.MOUSE_WHEEL_DOWN != 0:
+		self.select_row(self.selected + 1)
+	case ev.Event_type == loop.MOUSE_CLICK && ev.Buttons&loop.LEFT_MOUSE_BUTTON != 0:
+		local := ev.TranslateToCellOrigin(r.X, r.Y)
+		idx := self.top + local.Cell.Y
+		rows := self.visible_rows()
+		if idx >= len(rows) {
+			return false, nil
+		}
+		self.select_row(idx)
+		// clicking the expand indicator toggles the node
+		if x := wcswidth.Stringwidth(rows[idx].prefix); local.Cell.X == x && self.has_children(rows[idx].node) {
+			return true, self.toggle(rows[idx].node)
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (self *TreeView) format_row(row tree_row) string {
+	indicator := "  "
+	if self.has_children(row.node) {
+		if row.node.Expanded {
+			indicator = "▾ "
+		} else {
+			indicator = "▸ "
+		}
+	}
+	return row.prefix + indicator + row.node.Label
+}
+
+func (self *TreeView) Render(lp *loop.Loop) error {
+	r := self.Region()
+	if r.IsEmpty() {
+		return nil
+	}
+	rows := self.visible_rows()
+	self.select_row(self.selected)
+	buf := strings.Builder{}
+	for y := 0; y < r.Height; y++ {
+		buf.WriteString(fmt.Sprintf(loop.MoveCursorToTemplate, r.Y+y+1, r.X+1))
+		text := ""
+		if idx := self.top + y; idx < len(rows) {
+			text = self.format_row(rows[idx])
+		}
+		text, w := wcswidth.TruncateToVisualLengthWithWidth(text, r.Width)
+		text += strings.Repeat(" ", r.Width-w)
+		if self.top+y == self.selected && self.selected < len(rows) {
+			text = lp.SprintStyled("reverse", text)
+		}
+		buf.WriteString(text)
+	}
+	lp.QueueWriteString(buf.String())
+	return nil
+}
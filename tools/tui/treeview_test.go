@@ -0,0 +1,63 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package tui
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestTreeView(t *testing.T) {
+	tv := NewTreeView()
+	tv.SetRegion(loop.Rect{Width: 20, Height: 10})
+	loaded := 0
+	tv.ChildLoader = func(n *TreeNode) ([]*TreeNode, error) {
+		loaded++
+		if n.Label == "b" {
+			return []*TreeNode{{Label: "b1"}, {Label: "b2"}}, nil
+		}
+		return nil, nil
+	}
+	tv.SetRoot(&TreeNode{Label: "root", Expanded: true, Children: []*TreeNode{{Label: "a"}, {Label: "b"}}})
+	test := func(expected ...string) {
+		t.Helper()
+		actual := []string{}
+		for _, r := range tv.visible_rows() {
+			actual = append(actual, tv.format_row(r))
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("Unexpected tree:\n%s", diff)
+		}
+	}
+	press := func(keys ...string) {
+		for _, key := range keys {
+			if err := tv.HandleKeyEvent(nil, &loop.KeyEvent{Type: loop.PRESS, Key: key}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	test("▾ root", "├─▸ a", "└─▸ b")
+	press("DOWN", "DOWN", "RIGHT")
+	test("▾ root", "├─▸ a", "└─▾ b", "  ├─▸ b1", "  └─▸ b2")
+	press("RIGHT", "DOWN", "LEFT")
+	if tv.Selected().Label != "b" {
+		t.Fatalf("Left did not move to the parent: %s", tv.Selected().Label)
+	}
+	press("LEFT", "UP", "RIGHT")
+	test("▾ root", "├─  a", "└─▸ b")
+	if loaded != 2 {
+		t.Fatalf("Children loaded an unexpected number of times: %d", loaded)
+	}
+	var selected *TreeNode
+	tv.OnSelect(func(n *TreeNode) { selected = n })
+	press("ENTER")
+	if selected == nil || selected.Label != "a" {
+		t.Fatalf("OnSelect not called with the selected node")
+	}
+}
@@ -0,0 +1,134 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var _ = fmt.Print
+
+var control_char_names = [...]string{
+	"NUL", "SOH", "STX", "ETX", "EOT", "ENQ", "ACK", "BEL", "BS", "HT", "LF", "VT", "FF", "CR", "SO", "SI",
+	"DLE", "DC1", "DC2", "DC3", "DC4", "NAK", "SYN", "ETB", "CAN", "EM", "SUB", "ESC", "FS", "GS", "RS", "US",
+}
+
+const del_name = "DEL"
+
+func control_char_name(r rune) string {
+	switch {
+	case r >= 0 && int(r) < len(control_char_names):
+		return control_char_names[r]
+	case r == 0x7f:
+		return del_name
+	}
+	return ""
+}
+
+// The name of the control character at the start of text, preferring the longest match
+func control_char_name_prefix(text string) (name string, r rune) {
+	if text == "" || text[0] < 'A' || text[0] > 'Z' {
+		return "", 0
+	}
+	for i, n := range control_char_names {
+		if len(n) > len(name) && strings.HasPrefix(text, n) {
+			name, r = n, rune(i)
+		}
+	}
+	if len(del_name) > len(name) && strings.HasPrefix(text, del_name) {
+		name, r = del_name, 0x7f
+	}
+	return
+}
+
+// Convert a string containing escape codes into a readable form suitable for
+// printing in test failures and debug output, for example: ESC[1;32mHello ESC[m
+// Control characters are replaced by their names and other non-printable
+// characters by \u{XXXX}. Backslashes and text that could be mistaken for a
+// control character name are escaped with a backslash so that HumanToEscape()
+// can recover the original string.
+func EscapeToHuman(s string) string {
+	type token struct {
+		text          string
+		is_control    bool
+		is_plain_char bool
+	}
+	tokens := make([]token, 0, len(s))
+	for _, r := range s {
+		switch {
+		case control_char_name(r) != "":
+			tokens = append(tokens, token{text: control_char_name(r), is_control: true})
+		case r == '\\':
+			tokens = append(tokens, token{text: `\\`})
+		case !unicode.IsPrint(r) && r != ' ':
+			tokens = append(tokens, token{text: fmt.Sprintf(`\u{%X}`, r)})
+		default:
+			tokens = append(tokens, token{text: string(r), is_plain_char: true})
+		}
+	}
+	// Work backwards so that the text following each character is known when
+	// deciding if it needs to be escaped
+	parts := make([]string, len(tokens))
+	suffix := func(i int) string {
+		// enough of the following text to match the longest control character name
+		buf := strings.Builder{}
+		for j := i; j < len(parts) && buf.Len() < 3; j++ {
+			buf.WriteString(parts[j])
+		}
+		return buf.String()
+	}
+	for i := len(tokens) - 1; i >= 0; i-- {
+		t := tokens[i]
+		parts[i] = t.text
+		if t.is_plain_char {
+			follows_control := i > 0 && tokens[i-1].is_control && t.text[0] >= 'A' && t.text[0] <= 'Z'
+			if name, _ := control_char_name_prefix(t.text + suffix(i+1)); name != "" || follows_control {
+				parts[i] = `\` + t.text
+			}
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// The inverse of EscapeToHuman()
+func HumanToEscape(s string) (string, error) {
+	buf := strings.Builder{}
+	buf.Grow(len(s))
+	for i := 0; i < len(s); {
+		if s[i] == '\\' {
+			if i+1 >= len(s) {
+				return "", fmt.Errorf("Trailing backslash in: %#v", s)
+			}
+			if s[i+1] == 'u' && i+2 < len(s) && s[i+2] == '{' {
+				end := strings.IndexByte(s[i+3:], '}')
+				if end < 0 {
+					return "", fmt.Errorf("Unterminated \\u{ at position %d in: %#v", i, s)
+				}
+				val, err := strconv.ParseUint(s[i+3:i+3+end], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("Invalid code point at position %d in: %#v with error: %w", i, s, err)
+				}
+				buf.WriteRune(rune(val))
+				i += 4 + end
+				continue
+			}
+			_, sz := utf8.DecodeRuneInString(s[i+1:])
+			buf.WriteString(s[i+1 : i+1+sz])
+			i += 1 + sz
+			continue
+		}
+		if name, r := control_char_name_prefix(s[i:]); name != "" {
+			buf.WriteRune(r)
+			i += len(name)
+			continue
+		}
+		_, sz := utf8.DecodeRuneInString(s[i:])
+		buf.WriteString(s[i : i+sz])
+		i += sz
+	}
+	return buf.String(), nil
+}
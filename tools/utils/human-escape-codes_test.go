@@ -0,0 +1,41 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestHumanEscapeCodes(t *testing.T) {
+	for raw, human := range map[string]string{
+		"\x1b[1;32mHello \x1b[m": "ESC[1;32mHello ESC[m",
+		"a\\b":                   `a\\b`,
+		"ESCAPE \x1b":            `\ESCAPE ESC`,
+		"\x0eH":                  `SO\H`,
+		"\x01":                   "SOH",
+		"\x1b]8;;url\x1b\\":      `ESC]8;;urlESC\\`,
+		"\u200b\x7f\r\n":         `\u{200B}DELCRLF`,
+		"SSO":                    `S\SO`,
+	} {
+		if diff := cmp.Diff(human, EscapeToHuman(raw)); diff != "" {
+			t.Fatalf("Failed to convert %#v to human form:\n%s", raw, diff)
+		}
+		actual, err := HumanToEscape(human)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(raw, actual); diff != "" {
+			t.Fatalf("Failed to convert %#v from human form:\n%s", human, diff)
+		}
+	}
+	for _, bad := range []string{`\`, `\u{zz}`, `\u{12`} {
+		if _, err := HumanToEscape(bad); err == nil {
+			t.Fatalf("No error for invalid input: %#v", bad)
+		}
+	}
+}
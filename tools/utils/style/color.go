@@ -0,0 +1,175 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package style
+
+import (
+	"fmt"
+	"math"
+)
+
+var _ = fmt.Print
+
+type ColorSpace uint8
+
+const (
+	// One of the sixteen standard terminal colors, the index is in R
+	ANSI16 ColorSpace = iota
+	// One of the 256 indexed terminal colors, the index is in R
+	ANSI256
+	// 16 bits per channel gamma encoded sRGB
+	SRGB
+	// 16 bits per channel linear light RGB with the sRGB primaries
+	LINEARRGB
+)
+
+func (self ColorSpace) String() string {
+	switch self {
+	case ANSI16:
+		return "ANSI16"
+	case ANSI256:
+		return "ANSI256"
+	case SRGB:
+		return "SRGB"
+	case LINEARRGB:
+		return "LINEARRGB"
+	}
+	return fmt.Sprintf("ColorSpace(%d)", uint8(self))
+}
+
+// A color in any of the color spaces terminals understand. Indexed colors are
+// converted to RGB using the default kitty color table, see ColorTable.
+type Color struct {
+	Space   ColorSpace
+	R, G, B uint16
+}
+
+func IndexedColor(idx uint8) Color {
+	if idx < 16 {
+		return Color{Space: ANSI16, R: uint16(idx)}
+	}
+	return Color{Space: ANSI256, R: uint16(idx)}
+}
+
+func ColorFromRGBA(c RGBA) Color {
+	return Color{Space: SRGB, R: uint16(c.Red) * 257, G: uint16(c.Green) * 257, B: uint16(c.Blue) * 257}
+}
+
+func to_8bit(x uint16) uint8 { return uint8((uint32(x) + 128) / 257) }
+
+// The color as 8 bit sRGB
+func (self Color) AsRGBA() RGBA {
+	c := self.ToSRGB()
+	return RGBA{Red: to_8bit(c.R), Green: to_8bit(c.G), Blue: to_8bit(c.B)}
+}
+
+func srgb_to_linear(x uint16) uint16 {
+	v := float64(x) / 65535
+	if v <= 0.04045 {
+		v /= 12.92
+	} else {
+		v = math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return uint16(math.Round(v * 65535))
+}
+
+func linear_to_srgb(x uint16) uint16 {
+	v := float64(x) / 65535
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint16(math.Round(v * 65535))
+}
+
+func (self Color) ToSRGB() Color {
+	switch self.Space {
+	case ANSI16, ANSI256:
+		var c RGBA
+		c.FromRGB(ColorTable[uint8(self.R)])
+		return ColorFromRGBA(c)
+	case LINEARRGB:
+		return Color{Space: SRGB, R: linear_to_srgb(self.R), G: linear_to_srgb(self.G), B: linear_to_srgb(self.B)}
+	}
+	return self
+}
+
+func (self Color) ToLinearRGB() Color {
+	if self.Space == LINEARRGB {
+		return self
+	}
+	c := self.ToSRGB()
+	return Color{Space: LINEARRGB, R: srgb_to_linear(c.R), G: srgb_to_linear(c.G), B: srgb_to_linear(c.B)}
+}
+
+// The squared distance between two colors, weighted for how the eye perceives
+// differences in the red and blue channels, see
+// https://www.compuphase.com/cmetric.htm
+func color_distance(a, b RGBA) int {
+	rmean := (int(a.Red) + int(b.Red)) / 2
+	dr, dg, db := int(a.Red)-int(b.Red), int(a.Green)-int(b.Green), int(a.Blue)-int(b.Blue)
+	return (((512 + rmean) * dr * dr) >> 8) + 4*dg*dg + (((767 - rmean) * db * db) >> 8)
+}
+
+func nearest_indexed_color(c RGBA, first, limit int) uint8 {
+	ans, best := first, math.MaxInt
+	for i := first; i < limit; i++ {
+		var q RGBA
+		q.FromRGB(ColorTable[i])
+		if d := color_distance(c, q); d < best {
+			ans, best = i, d
+		}
+	}
+	return uint8(ans)
+}
+
+// The nearest of the sixteen standard colors. When bg is true only the first
+// eight are used, as not all terminals support bright background colors.
+func (self Color) ToANSI16(bg bool) Color {
+	limit := 16
+	if bg {
+		limit = 8
+	}
+	switch self.Space {
+	case ANSI16, ANSI256:
+		if int(self.R) < limit {
+			return Color{Space: ANSI16, R: self.R}
+		}
+		if self.R < 16 {
+			return Color{Space: ANSI16, R: self.R - 8}
+		}
+	}
+	return Color{Space: ANSI16, R: uint16(nearest_indexed_color(self.AsRGBA(), 0, limit))}
+}
+
+// The nearest of the 256 indexed colors. RGB colors are mapped to the color
+// cube and grayscale ramp only, since the first sixteen colors are usually
+// changed by color themes.
+func (self Color) ToANSI256() Color {
+	switch self.Space {
+	case ANSI16, ANSI256:
+		return Color{Space: ANSI256, R: uint16(uint8(self.R))}
+	}
+	return Color{Space: ANSI256, R: uint16(nearest_indexed_color(self.AsRGBA(), 16, 256))}
+}
+
+// The SGR escape code to use the color as the foreground color when fg is true
+// and as the background color otherwise
+func (self Color) Escape(fg bool) string {
+	base := 40
+	if fg {
+		base = 30
+	}
+	switch self.Space {
+	case ANSI16:
+		n := int(self.R & 15)
+		if n > 7 {
+			n += 60 - 8
+		}
+		return fmt.Sprintf("\x1b[%dm", base+n)
+	case ANSI256:
+		return fmt.Sprintf("\x1b[%d:5:%dm", base+8, uint8(self.R))
+	}
+	c := self.AsRGBA()
+	return fmt.Sprintf("\x1b[%d:2:%d:%d:%dm", base+8, c.Red, c.Green, c.Blue)
+}
@@ -0,0 +1,39 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package style
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestColorConversion(t *testing.T) {
+	red := ColorFromRGBA(RGBA{Red: 0xff})
+	for _, x := range []struct {
+		c        Color
+		expected string
+	}{
+		{red.ToANSI256(), "\x1b[38:5:196m"},
+		{red.ToANSI16(false), "\x1b[91m"},
+		{IndexedColor(9).ToANSI16(true), "\x1b[31m"},
+		{IndexedColor(244).ToANSI256(), "\x1b[38:5:244m"},
+		{IndexedColor(16).ToSRGB(), "\x1b[38:2:0:0:0m"},
+		{ColorFromRGBA(RGBA{Red: 8, Green: 8, Blue: 8}).ToANSI256(), "\x1b[38:5:232m"},
+		{red.ToLinearRGB(), "\x1b[38:2:255:0:0m"},
+	} {
+		if diff := cmp.Diff(x.expected, x.c.Escape(true)); diff != "" {
+			t.Fatalf("Unexpected escape code for %#v:\n%s", x.c, diff)
+		}
+	}
+	if e := IndexedColor(3).Escape(false); e != "\x1b[43m" {
+		t.Fatalf("Unexpected background escape code: %q", e)
+	}
+	gray := ColorFromRGBA(RGBA{Red: 128, Green: 128, Blue: 128})
+	if diff := cmp.Diff(gray, gray.ToLinearRGB().ToSRGB()); diff != "" {
+		t.Fatalf("Round tripping through linear RGB failed:\n%s", diff)
+	}
+}
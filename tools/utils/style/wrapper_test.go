@@ -5,6 +5,8 @@ package style
 import (
 	"fmt"
 	"testing"
+
+	"kitty/tools/utils"
 )
 
 var _ = fmt.Print
@@ -28,7 +30,7 @@ func TestANSIStyleSprint(t *testing.T) {
 		actual := ctx.SprintFunc(spec)("  ")
 		expected := prefix + "  " + suffix
 		if actual != expected {
-			t.Fatalf("Formatting with spec: %s failed expected != actual: %#v != %#v", spec, expected, actual)
+			t.Fatalf("Formatting with spec: %s failed expected != actual: %s != %s", spec, utils.EscapeToHuman(expected), utils.EscapeToHuman(actual))
 		}
 	}
 
@@ -47,6 +49,6 @@ func TestANSIStyleSprint(t *testing.T) {
 	actual := ctx.UrlFunc("u=curly uc=cyan")("http://moo.com", "___")
 	expected := "\x1b[4:3;58:5:6m\x1b]8;;http://moo.com\x1b\\___\x1b]8;;\x1b\\\x1b[4:0;59m"
 	if actual != expected {
-		t.Fatalf("Formatting URL failed expected != actual: %#v != %#v", expected, actual)
+		t.Fatalf("Formatting URL failed expected != actual: %s != %s", utils.EscapeToHuman(expected), utils.EscapeToHuman(actual))
 	}
 }
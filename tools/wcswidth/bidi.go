@@ -0,0 +1,201 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package wcswidth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var _ = fmt.Print
+
+var rtl_scripts = []*unicode.RangeTable{
+	unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko,
+	unicode.Samaritan, unicode.Mandaic, unicode.Adlam, unicode.Hanifi_Rohingya,
+	unicode.Mende_Kikakui, unicode.Yezidi, unicode.Imperial_Aramaic, unicode.Phoenician,
+	unicode.Avestan, unicode.Old_South_Arabian, unicode.Old_North_Arabian, unicode.Nabataean,
+	unicode.Palmyrene, unicode.Hatran, unicode.Manichaean, unicode.Psalter_Pahlavi,
+	unicode.Inscriptional_Pahlavi, unicode.Inscriptional_Parthian, unicode.Kharoshthi,
+	unicode.Lydian, unicode.Cypriot, unicode.Old_Hungarian, unicode.Sogdian, unicode.Old_Sogdian,
+	unicode.Elymaic, unicode.Chorasmian,
+}
+
+// Return true if the rune is a strong right-to-left character, that is, one
+// with the BiDi class R or AL, or one of the right-to-left mark and
+// embedding/override/isolate control characters. Digits and combining marks
+// from right-to-left scripts are not strong and return false.
+func IsRTL(r rune) bool {
+	switch r {
+	case 0x200f, 0x202b, 0x202e, 0x2067: // RLM, RLE, RLO, RLI
+		return true
+	}
+	if r < 0x590 || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return false
+	}
+	return unicode.In(r, rtl_scripts...)
+}
+
+type bidi_class uint8
+
+const (
+	bidi_neutral bidi_class = iota
+	bidi_ltr
+	bidi_rtl
+	bidi_number
+)
+
+type bidi_cluster struct {
+	text  string
+	class bidi_class
+	level uint8
+}
+
+var mirrored_chars = map[string]string{
+	"(": ")", ")": "(", "[": "]", "]": "[", "{": "}", "}": "{", "<": ">", ">": "<", "«": "»", "»": "«",
+}
+
+func bidi_class_of(r rune) bidi_class {
+	switch {
+	case IsRTL(r):
+		return bidi_rtl
+	case unicode.IsDigit(r):
+		return bidi_number
+	case unicode.IsLetter(r) || r == 0x200e: // LRM
+		return bidi_ltr
+	}
+	return bidi_neutral
+}
+
+// split a line into base characters with their combining marks, so that
+// reordering does not separate marks from the characters they modify
+func bidi_clusters(line string) (ans []bidi_cluster) {
+	for _, r := range line {
+		if len(ans) > 0 && unicode.In(r, unicode.Mn, unicode.Me) {
+			ans[len(ans)-1].text += string(r)
+			continue
+		}
+		ans = append(ans, bidi_cluster{text: string(r), class: bidi_class_of(r)})
+	}
+	return
+}
+
+func bidi_shape_line(line string) string {
+	clusters := bidi_clusters(line)
+	base := bidi_ltr
+	if idx := slices.IndexFunc(clusters, func(c bidi_cluster) bool { return c.class == bidi_ltr || c.class == bidi_rtl }); idx > -1 {
+		base = clusters[idx].class
+	}
+	if base == bidi_ltr && !slices.ContainsFunc(clusters, func(c bidi_cluster) bool { return c.class == bidi_rtl }) {
+		return line
+	}
+	// A single separator between two digits is part of the number: 1.5 or 10:30
+	for i := 1; i+1 < len(clusters); i++ {
+		if clusters[i].class == bidi_neutral && clusters[i-1].class == bidi_number && clusters[i+1].class == bidi_number && strings.ContainsAny(clusters[i].text, ".,:/+-") {
+			clusters[i].class = bidi_number
+		}
+	}
+	// Numbers following left-to-right text are left-to-right text
+	prev_strong := base
+	for i := range clusters {
+		switch clusters[i].class {
+		case bidi_ltr, bidi_rtl:
+			prev_strong = clusters[i].class
+		case bidi_number:
+			if prev_strong == bidi_ltr {
+				clusters[i].class = bidi_ltr
+			}
+		}
+	}
+	// Neutrals take the direction of the surrounding text if it is the same
+	// on both sides, otherwise the base direction, numbers count as
+	// right-to-left text
+	direction := func(c bidi_class) bidi_class {
+		if c == bidi_number {
+			return bidi_rtl
+		}
+		return c
+	}
+	for i := 0; i < len(clusters); {
+		if clusters[i].class != bidi_neutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(clusters) && clusters[j].class == bidi_neutral {
+			j++
+		}
+		before, after := base, base
+		if i > 0 {
+			before = direction(clusters[i-1].class)
+		}
+		if j < len(clusters) {
+			after = direction(clusters[j].class)
+		}
+		resolved := base
+		if before == after {
+			resolved = before
+		}
+		for ; i < j; i++ {
+			clusters[i].class = resolved
+		}
+	}
+	var max_level uint8
+	for i := range clusters {
+		c := &clusters[i]
+		switch {
+		case base == bidi_ltr && c.class == bidi_ltr:
+			c.level = 0
+		case base == bidi_ltr && c.class == bidi_rtl, base == bidi_rtl && c.class == bidi_rtl:
+			c.level = 1
+		default:
+			c.level = 2
+		}
+		max_level = max(max_level, c.level)
+	}
+	// Reverse every sequence at or above each level, from the highest level down to 1
+	for level := max_level; level > 0; level-- {
+		for i := 0; i < len(clusters); {
+			if clusters[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(clusters) && clusters[j].level >= level {
+				j++
+			}
+			slices.Reverse(clusters[i:j])
+			i = j
+		}
+	}
+	buf := strings.Builder{}
+	buf.Grow(len(line))
+	for _, c := range clusters {
+		if m, found := mirrored_chars[c.text]; found && c.level%2 == 1 {
+			buf.WriteString(m)
+		} else {
+			buf.WriteString(c.text)
+		}
+	}
+	return buf.String()
+}
+
+// Reorder text from logical order, the order in which it is stored, into the
+// visual order in which it should be displayed by a terminal that does not
+// implement BiDi itself. Each line is a separate paragraph whose direction is
+// that of its first strong character. This is a simplified version of the
+// Unicode Bidirectional Algorithm. It does not support explicit
+// embeddings, overrides or isolates, treats all digits as European numbers,
+// only joins single separators between digits into numbers, mirrors only
+// common brackets and does not shape Arabic, which terminals do themselves.
+// The text must not contain escape codes. Reordering does not change the
+// width of the text, so Stringwidth() gives the same result for the shaped and
+// unshaped text.
+func BiDiShape(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = bidi_shape_line(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,55 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package wcswidth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestBiDiShape(t *testing.T) {
+	for r, expected := range map[rune]bool{'a': false, 'א': true, 'ب': true, '٣': false, '1': false, 0x64b: false, 0x200f: true} {
+		if IsRTL(r) != expected {
+			t.Fatalf("IsRTL(%#x) != %v", r, expected)
+		}
+	}
+	for text, expected := range map[string]string{
+		"hello world":    "hello world",
+		"שלום":           "םולש",
+		"abc שלום def":   "abc םולש def",
+		"שלום abc עולם":  "םלוע abc םולש",
+		"מחיר 1.5 שקל":   "לקש 1.5 ריחמ",
+		"(שלום)":         "(םולש)",
+		"abc (שלום) def": "abc (םולש) def",
+		"שלום\nabc":      "םולש\nabc",
+		"abc 12 שלום":    "abc 12 םולש",
+		"بِسْمِ":         "مِسْبِ",
+		// digits in right-to-left runs keep their order
+		"שלום 123 עולם": "םלוע 123 םולש",
+		"א1ב":           "ב1א",
+		"12 שלום":       "םולש 12",
+		"שלום ٣٤":       "٣٤ םולש",
+		"שלום (12)":     "(12) םולש",
+		// brackets in left-to-right text in a right-to-left paragraph, at
+		// level 2, are not mirrored
+		"שלום a(b)c עולם": "םלוע a(b)c םולש",
+		// brackets between right-to-left and left-to-right text are at level
+		// 1 and mirrored, so that they still enclose the text
+		"שלום [x] עולם": "םלוע [x] םולש",
+		// every line is a separate paragraph with its own direction
+		"שלום\nabc עולם\n(אב)": "םולש\nabc םלוע\n(בא)",
+		"\n\nשלום\n":           "\n\nםולש\n",
+	} {
+		actual := BiDiShape(text)
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Fatalf("Failed to shape %#v:\n%s", text, diff)
+		}
+		if Stringwidth(actual) != Stringwidth(text) {
+			t.Fatalf("Shaping changed the width of %#v", text)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package wcswidth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// A Device Control String, ESC P ... ESC \
+type DCSEvent struct {
+	// The parameter, intermediate and final bytes identifying the control
+	// function, for example: 1+r for XTGETTCAP responses or 0;1q for Sixel
+	// images
+	Params string
+	// The rest of the string, after the final byte
+	Data string
+}
+
+// Split the contents of a DCS, as passed to EscapeCodeParser.HandleDCS, into
+// the control function and its data as defined by ECMA-48: parameter bytes in
+// the range 0x30-0x3f, then intermediate bytes in 0x20-0x2f and a final byte
+// in 0x40-0x7e. If there is no final byte, Params is empty and everything is
+// Data.
+func ParseDCS(raw []byte) DCSEvent {
+	i := 0
+	for i < len(raw) && raw[i] >= 0x30 && raw[i] <= 0x3f {
+		i++
+	}
+	for i < len(raw) && raw[i] >= 0x20 && raw[i] <= 0x2f {
+		i++
+	}
+	if i >= len(raw) || raw[i] < 0x40 || raw[i] > 0x7e {
+		return DCSEvent{Data: string(raw)}
+	}
+	return DCSEvent{Params: string(raw[:i+1]), Data: string(raw[i+1:])}
+}
+
+func (self DCSEvent) String() string {
+	return fmt.Sprintf("DCSEvent{Params: %#v, Data: %#v}", self.Params, self.Data)
+}
+
+// An Application Program Command, ESC _ ... ESC \, used by kitty for the
+// graphics protocol, where Data starts with G
+type APCEvent struct {
+	Data string
+}
+
+// Wrap the contents of an APC, as passed to EscapeCodeParser.HandleAPC
+func ParseAPC(raw []byte) APCEvent {
+	return APCEvent{Data: string(raw)}
+}
+
+func (self APCEvent) String() string {
+	return fmt.Sprintf("APCEvent{Data: %#v}", self.Data)
+}
+
+type TermcapEntry struct {
+	Name, Value string
+}
+
+// Decode the capabilities from an XTGETTCAP response, which is a DCS with
+// Params 1+r for a valid response or 0+r when the terminal does not know the
+// requested capabilities, and Data of the form <name>=<value>;... with names
+// and values hex encoded. The entries are in the order they were received.
+func (self DCSEvent) XTGETTCAPResponse() (caps []TermcapEntry, valid bool, err error) {
+	switch self.Params {
+	case "1+r":
+		valid = true
+	case "0+r":
+	default:
+		return nil, false, fmt.Errorf("Not an XTGETTCAP response: %s", self)
+	}
+	if self.Data == "" {
+		return
+	}
+	for _, item := range strings.Split(self.Data, ";") {
+		k, v, _ := strings.Cut(item, "=")
+		name, err := hex.DecodeString(k)
+		if err != nil {
+			return nil, valid, fmt.Errorf("Invalid capability name in XTGETTCAP response: %#v with error: %w", k, err)
+		}
+		value, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, valid, fmt.Errorf("Invalid capability value in XTGETTCAP response: %#v with error: %w", v, err)
+		}
+		caps = append(caps, TermcapEntry{string(name), string(value)})
+	}
+	return
+}
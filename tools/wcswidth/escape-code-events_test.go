@@ -0,0 +1,108 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package wcswidth
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestDCSParsing(t *testing.T) {
+	var events []DCSEvent
+	p := EscapeCodeParser{HandleDCS: func(raw []byte) error {
+		events = append(events, ParseDCS(raw))
+		return nil
+	}}
+	test := func(raw string, expected ...DCSEvent) {
+		t.Helper()
+		events = nil
+		p.Reset()
+		if err := p.ParseString(raw); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, events); diff != "" {
+			t.Fatalf("Unexpected DCS events for: %#v\n%s", raw, diff)
+		}
+	}
+	// responses from kitty to XTGETTCAP queries for TN, colors and smcup
+	test("\x1bP1+r544e=787465726d2d6b69747479\x1b\\", DCSEvent{"1+r", "544e=787465726d2d6b69747479"})
+	test("\x1bP1+r636f6c6f7273=323536\x1b\\\x1bP1+r736d637570=1b5b3f3130343968\x1b\\",
+		DCSEvent{"1+r", "636f6c6f7273=323536"}, DCSEvent{"1+r", "736d637570=1b5b3f3130343968"})
+	test("\x1bP0+r6b69747479\x1b\\", DCSEvent{"0+r", "6b69747479"})
+	test("\x1bP@kitty-cmd{}\x1b\\", DCSEvent{"@", "kitty-cmd{}"})
+	test("\x1bP0;1;0q#0;2;0;0;0~-\x1b\\", DCSEvent{"0;1;0q", "#0;2;0;0;0~-"})
+	test("\x1bP>|kitty(0.36.0)\x1b\\", DCSEvent{">|", "kitty(0.36.0)"})
+	test("\x1bP\x1b\\", DCSEvent{})
+	test("\x1bP12\x1b\\", DCSEvent{Data: "12"})
+
+	caps, valid, err := DCSEvent{"1+r", "544e=787465726d2d6b69747479;636f6c6f7273=323536"}.XTGETTCAPResponse()
+	if err != nil || !valid {
+		t.Fatalf("Failed to decode XTGETTCAP response: valid: %v err: %v", valid, err)
+	}
+	if diff := cmp.Diff([]TermcapEntry{{"TN", "xterm-kitty"}, {"colors", "256"}}, caps); diff != "" {
+		t.Fatalf("Incorrect capabilities:\n%s", diff)
+	}
+	if caps, valid, err = (DCSEvent{"0+r", "6b69747479"}).XTGETTCAPResponse(); err != nil || valid || len(caps) != 1 || caps[0].Name != "kitty" {
+		t.Fatalf("Incorrect decoding of invalid XTGETTCAP response: %#v valid: %v err: %v", caps, valid, err)
+	}
+	if _, _, err = (DCSEvent{"1+r", "zz=00"}).XTGETTCAPResponse(); err == nil {
+		t.Fatalf("Invalid hex in XTGETTCAP response did not fail")
+	}
+	if _, _, err = (DCSEvent{"@", "kitty-cmd"}).XTGETTCAPResponse(); err == nil {
+		t.Fatalf("Non XTGETTCAP response did not fail")
+	}
+}
+
+func TestAPCParsing(t *testing.T) {
+	var events []APCEvent
+	p := EscapeCodeParser{HandleAPC: func(raw []byte) error {
+		events = append(events, ParseAPC(raw))
+		return nil
+	}}
+	test := func(raw string, expected ...APCEvent) {
+		t.Helper()
+		events = nil
+		p.Reset()
+		if err := p.ParseString(raw); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, events); diff != "" {
+			t.Fatalf("Unexpected APC events for: %#v\n%s", raw, diff)
+		}
+	}
+	// responses from kitty to graphics protocol commands
+	test("\x1b_Gi=31;OK\x1b\\", APCEvent{"Gi=31;OK"})
+	test("a\x1b_Gi=1,p=7;ENOENT:Put command refers to non-existent image\x1b\\b\x1b_Gi=2;OK\x1b\\",
+		APCEvent{"Gi=1,p=7;ENOENT:Put command refers to non-existent image"}, APCEvent{"Gi=2;OK"})
+	test("\x1b_\x1b\\", APCEvent{})
+	// C1 string terminator encoded as UTF-8
+	test("\x1b_Gi=3;OK\xc2\x9c", APCEvent{"Gi=3;OK"})
+}
+
+func FuzzAPCParsing(f *testing.F) {
+	for _, seed := range []string{"Gi=31;OK", "Gi=1,p=7;ENOENT:no image", "", "G", "\x1b", "\xc2", "\x1b\\", "é\x9c"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var events []APCEvent
+		p := EscapeCodeParser{
+			HandleAPC:  func(raw []byte) error { events = append(events, ParseAPC(raw)); return nil },
+			HandleRune: func(rune) error { return nil },
+			HandleCSI:  func([]byte) error { return nil },
+		}
+		raw := append(append([]byte("\x1b_"), data...), "\x1b\\"...)
+		if err := p.Parse(raw); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.IndexByte(data, 0x1b) < 0 && bytes.IndexByte(data, 0xc2) < 0 {
+			if len(events) != 1 || events[0].Data != string(data) {
+				t.Fatalf("Incorrect APC events for: %#v: %#v", string(data), events)
+			}
+		}
+	})
+}
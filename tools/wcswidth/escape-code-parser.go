@@ -47,6 +47,7 @@ type EscapeCodeParser struct {
 	current_buffer         []byte
 	bracketed_paste_buffer []utils.UTF8State
 	current_callback       func([]byte) error
+	terminated_by_bel      bool
 
 	ReplaceInvalidUtf8Bytes bool
 
@@ -63,6 +64,15 @@ type EscapeCodeParser struct {
 
 func (self *EscapeCodeParser) InBracketedPaste() bool { return self.state == bracketed_paste }
 
+// Whether the last byte parsed was an ESC that is not yet known to start an
+// escape code
+func (self *EscapeCodeParser) InEscape() bool { return self.state == esc }
+
+// Whether the last string control sequence, such as an OSC, was terminated
+// by BEL rather than ST, can be called from the callbacks. Only OSC can be
+// terminated by BEL.
+func (self *EscapeCodeParser) TerminatedByBEL() bool { return self.terminated_by_bel }
+
 func (self *EscapeCodeParser) ParseString(s string) error {
 	return self.Parse(utils.UnsafeStringToBytes(s))
 }
@@ -302,6 +312,7 @@ func (self *EscapeCodeParser) dispatch_byte(ch byte) error {
 		}
 	case st_or_bel:
 		if ch == 0x7 {
+			self.terminated_by_bel = true
 			return self.dispatch_esc_code()
 		}
 		fallthrough
@@ -315,6 +326,7 @@ func (self *EscapeCodeParser) dispatch_byte(ch byte) error {
 		}
 	case esc_st:
 		if ch == '\\' {
+			self.terminated_by_bel = false
 			return self.dispatch_esc_code()
 		} else {
 			self.state = st
@@ -325,6 +337,7 @@ func (self *EscapeCodeParser) dispatch_byte(ch byte) error {
 		}
 	case c1_st:
 		if ch == 0x9c {
+			self.terminated_by_bel = false
 			return self.dispatch_esc_code()
 		} else {
 			self.state = st
@@ -3,7 +3,12 @@
 package wcswidth
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestEscapeCodeParsing(t *testing.T) {
@@ -55,3 +60,69 @@ func TestEscapeCodeParsing(t *testing.T) {
 	test("\x1b]X\x07\x1b]X\x1b\x07\x1b\\", "OSC: X\nOSC: X\x1b\x07")
 
 }
+
+type vt_event struct {
+	Type   string  `json:"type"`
+	Params *string `json:"params,omitempty"`
+	Data   *string `json:"data,omitempty"`
+}
+
+type vt_test_case struct {
+	Name   string     `json:"name"`
+	Input  string     `json:"input"`
+	Events []vt_event `json:"events"`
+}
+
+// Check the parser against a corpus of sequences and the events they produce.
+// Event types are the names of the EscapeCodeParser callbacks with CH for
+// HandleRune, DCS events are split with ParseDCS(). Input is parsed both in a
+// single call and one byte at a time, which must give the same events.
+func TestVTParserCorpus(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "vt_sequences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []vt_test_case
+	if err = json.Unmarshal(raw, &cases); err != nil {
+		t.Fatalf("Failed to parse the VT sequence corpus: %s", err)
+	}
+	var events []vt_event
+	add := func(typ string, data []byte) error {
+		d := string(data)
+		events = append(events, vt_event{Type: typ, Data: &d})
+		return nil
+	}
+	p := EscapeCodeParser{
+		HandleRune: func(r rune) error { return add("CH", []byte(string(r))) },
+		HandleCSI:  func(b []byte) error { return add("CSI", b) },
+		HandleOSC:  func(b []byte) error { return add("OSC", b) },
+		HandleDCS: func(b []byte) error {
+			ev := ParseDCS(b)
+			events = append(events, vt_event{Type: "DCS", Params: &ev.Params, Data: &ev.Data})
+			return nil
+		},
+		HandleAPC: func(b []byte) error { return add("APC", b) },
+		HandlePM:  func(b []byte) error { return add("PM", b) },
+		HandleSOS: func(b []byte) error { return add("SOS", b) },
+		HandleEndOfBracketedPaste: func() error {
+			events = append(events, vt_event{Type: "END_OF_BRACKETED_PASTE"})
+			return nil
+		},
+	}
+	for _, tc := range cases {
+		for _, bytewise := range []bool{false, true} {
+			events = []vt_event{}
+			p.Reset()
+			if bytewise {
+				for i := 0; i < len(tc.Input); i++ {
+					_ = p.ParseByte(tc.Input[i])
+				}
+			} else {
+				_ = p.ParseString(tc.Input)
+			}
+			if diff := cmp.Diff(tc.Events, events); diff != "" {
+				t.Fatalf("Unexpected events for %s (bytewise: %v) with input: %#v\n%s", tc.Name, bytewise, tc.Input, diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// License: GPLv3 Copyright: 2024, Kovid Goyal, <kovid at kovidgoyal.net>
+
+package wcswidth
+
+import (
+	"fmt"
+	"strings"
+)
+
+var _ = fmt.Print
+
+func fill_cells(cells int, fill rune) string {
+	if cells <= 0 {
+		return ""
+	}
+	fw := Runewidth(fill)
+	if fw < 1 {
+		fill, fw = ' ', 1
+	}
+	// a wide fill character cannot always fill cells exactly, use spaces for the remainder
+	return strings.Repeat(string(fill), cells/fw) + strings.Repeat(" ", cells%fw)
+}
+
+// Truncate s to width cells and return it with the number of cells of padding needed
+func fit_to_width(s string, width int) (string, int) {
+	s = TruncateString(s, width)
+	return s, max(0, width-Stringwidth(s))
+}
+
+// Right align s in width cells by adding fill characters on the left, s is
+// truncated if it is wider than width
+func PadLeft(s string, width int, fill rune) string {
+	s, padding := fit_to_width(s, width)
+	return fill_cells(padding, fill) + s
+}
+
+// Left align s in width cells by adding fill characters on the right, s is
+// truncated if it is wider than width
+func PadRight(s string, width int, fill rune) string {
+	s, padding := fit_to_width(s, width)
+	return s + fill_cells(padding, fill)
+}
+
+// Center s in width cells, when the padding is uneven the extra cell goes on
+// the right. s is truncated if it is wider than width.
+func PadCenter(s string, width int, fill rune) string {
+	s, padding := fit_to_width(s, width)
+	return fill_cells(padding/2, fill) + s + fill_cells(padding-padding/2, fill)
+}
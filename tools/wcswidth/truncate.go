@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"kitty/tools/utils"
 )
@@ -106,3 +108,37 @@ func TruncateToVisualLength(text string, length int) string {
 	ans, _ := TruncateToVisualLengthWithWidth(text, length)
 	return ans
 }
+
+// Return the longest prefix of s that fits in maxCols cells. If s had to be
+// truncated and an ellipsis is specified, it is appended, with the prefix
+// shortened to leave room for it.
+func TruncateString(s string, maxCols int, ellipsis ...string) string {
+	if Stringwidth(s) <= maxCols {
+		return s
+	}
+	e := ""
+	if len(ellipsis) > 0 {
+		e = ellipsis[0]
+	}
+	ew := Stringwidth(e)
+	if ew > maxCols {
+		return truncate_at_character_boundary(s, maxCols)
+	}
+	return truncate_at_character_boundary(s, maxCols-ew) + e
+}
+
+// Truncate without separating an emoji from the variation selector that gives
+// it its width and without leaving a dangling zero width joiner
+func truncate_at_character_boundary(s string, cols int) string {
+	ans := TruncateToVisualLength(s, cols)
+	if strings.HasPrefix(s[len(ans):], "\ufe0f") {
+		for ans != "" {
+			ch, sz := utf8.DecodeLastRuneInString(ans)
+			ans = ans[:len(ans)-sz]
+			if Runewidth(ch) > 0 {
+				break
+			}
+		}
+	}
+	return strings.TrimRight(ans, "\u200d")
+}
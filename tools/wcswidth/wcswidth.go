@@ -111,6 +111,19 @@ func (self *WCWidthIterator) handle_rune(ch rune) error {
 	return nil
 }
 
+// The number of cells ch occupies. Unlike Runewidth() which returns negative
+// values for unprintable (-1), private use (-2) and ambiguous width (-3)
+// characters, these are zero, one and one cells wide respectively.
+func RuneCellWidth(ch rune) int {
+	switch w := Runewidth(ch); w {
+	case -1, 0:
+		return 0
+	case 2:
+		return 2
+	}
+	return 1
+}
+
 func (self *WCWidthIterator) ParseByte(b byte) (ans int) {
 	self.parser.ParseByte(b)
 	return self.current_width
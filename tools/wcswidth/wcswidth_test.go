@@ -65,6 +65,68 @@ func TestWCSWidth(t *testing.T) {
 	truncate("a\x1b[3bbc", 5, "a\x1b[3bb", 5)
 }
 
+func TestTruncateString(t *testing.T) {
+	for _, tc := range []struct {
+		text     string
+		max_cols int
+		ellipsis []string
+		expected string
+	}{
+		{"hello", 5, nil, "hello"},
+		{"hello", 4, nil, "hell"},
+		{"hello", 4, []string{"…"}, "hel…"},
+		{"hello", 5, []string{"…"}, "hello"},
+		{"hello", 0, []string{"…"}, ""},
+		{"hello", 2, []string{"..."}, "he"},
+		{"héllo wörld", 4, nil, "héll"},
+		{"naïve", 3, []string{"…"}, "na…"},
+		{"日本語", 5, nil, "日本"},
+		{"日本語", 4, []string{"…"}, "日…"},
+		{"a日本", 2, nil, "a"},
+		{"e\u0301e\u0301e\u0301", 2, nil, "e\u0301e\u0301"},
+		{"e\u0301e\u0301e\u0301", 2, []string{"…"}, "e\u0301…"},
+		{"🌷🌷🌷", 5, nil, "🌷🌷"},
+		{"🌷🌷🌷", 5, []string{"…"}, "🌷🌷…"},
+		{"\u2716\ufe0f\u2716\ufe0f", 3, nil, "\u2716\ufe0f"},
+		{"\U0001f1ee\U0001f1f3\U0001f1ee\U0001f1f3", 3, nil, "\U0001f1ee\U0001f1f3"},
+		{"\u2716\ufe0f\u2716\ufe0f", 2, []string{"…"}, "…"},
+		{"👍🏽👍🏽", 3, nil, "👍🏽"},
+		{"👨\u200d👩\u200d👧", 3, nil, "👨"},
+		{"👨\u200d👩\u200d👧", 5, []string{"…"}, "👨\u200d👩…"},
+		{"a\x1b[31mbc", 2, []string{"…"}, "a\x1b[31m…"},
+	} {
+		if actual := TruncateString(tc.text, tc.max_cols, tc.ellipsis...); actual != tc.expected {
+			t.Fatalf("Failed to truncate %#v to %d with ellipsis: %#v\nExpected: %#v\nActual:   %#v", tc.text, tc.max_cols, tc.ellipsis, tc.expected, actual)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, tc := range []struct {
+		pad           func(string, int, rune) string
+		text          string
+		width         int
+		fill          rune
+		expected, msg string
+	}{
+		{PadLeft, "ab", 5, ' ', "   ab", "left"},
+		{PadRight, "ab", 5, '.', "ab...", "right"},
+		{PadCenter, "ab", 5, '-', "-ab--", "center"},
+		{PadCenter, "ab", 6, ' ', "  ab  ", "center even"},
+		{PadRight, "日本", 5, ' ', "日本 ", "wide text"},
+		{PadLeft, "日本語", 5, ' ', " 日本", "truncated wide text"},
+		{PadRight, "abcdef", 4, ' ', "abcd", "truncated"},
+		{PadRight, "e\u0301", 3, ' ', "e\u0301  ", "combining chars"},
+		{PadLeft, "a", 4, '日', "日 a", "wide fill"},
+		{PadLeft, "a", 3, '\u0301', "  a", "zero width fill"},
+		{PadRight, "a\x1b[31mb", 3, ' ', "a\x1b[31mb ", "escape codes"},
+	} {
+		if actual := tc.pad(tc.text, tc.width, tc.fill); actual != tc.expected {
+			t.Fatalf("Incorrect padding for %s: %#v to %d\nExpected: %#v\nActual:   %#v", tc.msg, tc.text, tc.width, tc.expected, actual)
+		}
+	}
+}
+
 func TestCellIterator(t *testing.T) {
 	f := func(text string, expected ...string) {
 		ci := NewCellIterator(text)